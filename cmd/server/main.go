@@ -77,6 +77,19 @@ func main() {
 		log.Printf("Warning: Failed to create Docker client: %v", err)
 	}
 
+	// Background jobs
+	api.RecoverVolumeBackups()
+	api.StartVolumeBackupScheduler()
+	api.RecoverClusterBackups()
+	api.StartClusterBackupScheduler()
+	api.StartImageRescanScheduler()
+	api.StartGitopsReconciler()
+	api.RecoverPipelineRuns()
+	api.RecoverNodeDrains()
+	api.RecoverHelmOperations()
+	api.RecoverK0sOperations()
+	api.StartWorkerHeartbeats()
+
 	// Setup router
 	r := api.NewRouter()
 
@@ -0,0 +1,619 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// The admission gate checks every image a deploy would run against its
+// latest scan before the deploy proceeds. Policies are scoped to a
+// namespace (optionally on one cluster), a project, or globally; the most
+// specific enabled policy wins and no policy means no gate. Admins can
+// push a refused deploy through with the X-Admission-Override header,
+// whose value is the reason; every decision is recorded.
+
+// admissionOverrideHeader carries the break-glass reason.
+const admissionOverrideHeader = "X-Admission-Override"
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type AdmissionPolicy struct {
+	ID             int     `json:"id"`
+	Name           string  `json:"name"`
+	ScopeType      string  `json:"scope_type"` // global, project, namespace
+	ProjectID      *int    `json:"project_id"`
+	ClusterID      *int    `json:"cluster_id"`
+	Namespace      *string `json:"namespace"`
+	Enabled        bool    `json:"enabled"`
+	MaxCritical    int     `json:"max_critical"`      // refuse when critical findings exceed this
+	MaxScanAgeDays int     `json:"max_scan_age_days"` // 0 = any age
+	RequireScan    bool    `json:"require_scan"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+type AdmissionEvent struct {
+	ID        int    `json:"id"`
+	PolicyID  *int   `json:"policy_id"`
+	Kind      string `json:"kind"`
+	Scope     string `json:"scope"`
+	Images    string `json:"images"`
+	Decision  string `json:"decision"` // allowed, denied, override
+	Reasons   string `json:"reasons"`
+	Username  string `json:"username"`
+	Override  string `json:"override_reason"`
+	CreatedAt string `json:"created_at"`
+}
+
+// admissionRequest describes one deploy about to happen.
+type admissionRequest struct {
+	Kind      string // container, compose, k0s_deploy, k8s_apply, gitops, helm
+	ProjectID int
+	ClusterID int
+	Namespace string
+	Images    []string
+}
+
+func (a admissionRequest) scope() string {
+	switch {
+	case a.Namespace != "":
+		return fmt.Sprintf("cluster %d/%s", a.ClusterID, a.Namespace)
+	case a.ProjectID != 0:
+		return fmt.Sprintf("project %d", a.ProjectID)
+	}
+	return "global"
+}
+
+// ImageVerdict is the gate's view of one image.
+type ImageVerdict struct {
+	Image     string   `json:"image"`
+	ReportID  int64    `json:"report_id,omitempty"`
+	ScannedAt string   `json:"scanned_at,omitempty"`
+	Critical  int      `json:"critical"`
+	AgeDays   float64  `json:"age_days,omitempty"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+type AdmissionDecision struct {
+	Allowed bool             `json:"allowed"`
+	Policy  *AdmissionPolicy `json:"policy"`
+	Images  []ImageVerdict   `json:"images"`
+}
+
+const admissionPolicyColumns = `id, name, scope_type, project_id, cluster_id, namespace, enabled,
+	max_critical, max_scan_age_days, require_scan, created_at`
+
+func scanAdmissionPolicy(row interface{ Scan(...interface{}) error }) (AdmissionPolicy, error) {
+	var p AdmissionPolicy
+	var enabled, require int
+	err := row.Scan(&p.ID, &p.Name, &p.ScopeType, &p.ProjectID, &p.ClusterID, &p.Namespace, &enabled,
+		&p.MaxCritical, &p.MaxScanAgeDays, &require, &p.CreatedAt)
+	p.Enabled = enabled == 1
+	p.RequireScan = require == 1
+	return p, err
+}
+
+// ── Evaluation ──────────────────────────────────────────────────────────────
+
+// admissionPoliciesEnabled reports whether any policy is switched on, so
+// callers can skip expensive image discovery when the gate is unused.
+func admissionPoliciesEnabled() bool {
+	var n int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM admission_policies WHERE enabled = 1`).Scan(&n)
+	return n > 0
+}
+
+// resolveAdmissionPolicy picks the most specific enabled policy for req:
+// namespace on this cluster, namespace on any cluster, project, global.
+func resolveAdmissionPolicy(req admissionRequest) (*AdmissionPolicy, error) {
+	query := `SELECT ` + admissionPolicyColumns + ` FROM admission_policies
+	          WHERE enabled = 1 AND (
+	            (scope_type = 'namespace' AND namespace = ? AND (cluster_id IS NULL OR cluster_id = ?))
+	            OR (scope_type = 'project' AND project_id = ?)
+	            OR scope_type = 'global')
+	          ORDER BY CASE scope_type WHEN 'namespace' THEN 0 WHEN 'project' THEN 1 ELSE 2 END,
+	                   cluster_id IS NULL, id
+	          LIMIT 1`
+	p, err := scanAdmissionPolicy(database.DB.QueryRow(query, req.Namespace, req.ClusterID, req.ProjectID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// imageRefCandidates lists the spellings a scan of ref may have been
+// stored under.
+func imageRefCandidates(ref string) []string {
+	ref = strings.TrimSpace(ref)
+	short := strings.TrimPrefix(strings.TrimPrefix(ref, "docker.io/"), "library/")
+	out := []string{ref, short, "docker.io/" + short}
+	if !strings.Contains(short, "/") {
+		out = append(out, "docker.io/library/"+short, "library/"+short)
+	}
+	if !refHasTag(ref) {
+		for _, c := range out {
+			out = append(out, c+":latest")
+		}
+	}
+	return out
+}
+
+// parseDBTime reads a timestamp column, which the driver hands back as
+// RFC3339 or as SQLite's own layout.
+func parseDBTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02 15:04:05", s)
+}
+
+// latestImageScan finds the newest completed scan of an image and its
+// critical findings that aren't covered by a triage decision. Only reports
+// the server produced itself count: anyone may post a report claiming an
+// image is clean.
+func latestImageScan(ref string) (v ImageVerdict, found bool, err error) {
+	v.Image = ref
+	cands := imageRefCandidates(ref)
+	args := make([]interface{}, len(cands))
+	for i, c := range cands {
+		args[i] = c
+	}
+	var reportCritical int
+	err = database.DB.QueryRow(
+		`SELECT id, created_at, critical FROM cicd_scan_reports
+		 WHERE scan_type IN ('image', 'trivy', 'dependency') AND status IN ('clean', 'findings')
+		   AND source IN ('scanner', 'pipeline')
+		   AND target IN (?`+strings.Repeat(", ?", len(cands)-1)+`)
+		 ORDER BY id DESC LIMIT 1`, args...).Scan(&v.ReportID, &v.ScannedAt, &reportCritical)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+
+	var stored int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM scan_findings WHERE report_id = ?`, v.ReportID).Scan(&stored)
+	if stored == 0 {
+		// Reports from before findings were normalized only carry counts.
+		v.Critical = reportCritical
+	} else {
+		counts, err := openFindingCounts(v.ReportID)
+		if err != nil {
+			return v, true, err
+		}
+		v.Critical = counts["critical"]
+	}
+	if t, err := parseDBTime(v.ScannedAt); err == nil {
+		v.AgeDays = time.Since(t).Hours() / 24
+	}
+	return v, true, nil
+}
+
+// evaluateAdmission checks every image of req against its policy.
+func evaluateAdmission(req admissionRequest) (AdmissionDecision, error) {
+	d := AdmissionDecision{Allowed: true, Images: []ImageVerdict{}}
+	policy, err := resolveAdmissionPolicy(req)
+	if err != nil || policy == nil {
+		return d, err
+	}
+	d.Policy = policy
+
+	seen := map[string]bool{}
+	for _, img := range req.Images {
+		img = strings.TrimSpace(img)
+		if img == "" || seen[img] {
+			continue
+		}
+		seen[img] = true
+		v, found, err := latestImageScan(img)
+		if err != nil {
+			return d, err
+		}
+		switch {
+		case !found:
+			if policy.RequireScan {
+				v.Reasons = append(v.Reasons, "no completed scan")
+			}
+		default:
+			if v.Critical > policy.MaxCritical {
+				v.Reasons = append(v.Reasons,
+					fmt.Sprintf("%d critical findings (max %d)", v.Critical, policy.MaxCritical))
+			}
+			if policy.MaxScanAgeDays > 0 && v.AgeDays > float64(policy.MaxScanAgeDays) {
+				v.Reasons = append(v.Reasons,
+					fmt.Sprintf("scan is %.0f days old (max %d)", v.AgeDays, policy.MaxScanAgeDays))
+			}
+		}
+		if len(v.Reasons) > 0 {
+			d.Allowed = false
+		}
+		d.Images = append(d.Images, v)
+	}
+	return d, nil
+}
+
+func (d AdmissionDecision) reasons() string {
+	var parts []string
+	for _, v := range d.Images {
+		if len(v.Reasons) > 0 {
+			parts = append(parts, v.Image+": "+strings.Join(v.Reasons, ", "))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func recordAdmissionEvent(req admissionRequest, d AdmissionDecision, decision, username, override string) {
+	var policyID interface{}
+	if d.Policy != nil {
+		policyID = d.Policy.ID
+	}
+	database.DB.Exec(
+		`INSERT INTO admission_events (policy_id, kind, scope, images, decision, reasons, username, override_reason)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		policyID, req.Kind, req.scope(), strings.Join(req.Images, ","), decision, d.reasons(), username, override)
+}
+
+// admitDeploy runs the gate for a handler. It returns false after writing
+// a 403 when the deploy is refused.
+func admitDeploy(w http.ResponseWriter, r *http.Request, req admissionRequest) bool {
+	user, _ := GetUserFromContext(r.Context())
+	d, err := evaluateAdmission(req)
+	if err != nil {
+		http.Error(w, "Admission check failed: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if d.Policy == nil {
+		return true
+	}
+	if d.Allowed {
+		recordAdmissionEvent(req, d, "allowed", user.Username, "")
+		return true
+	}
+
+	if reason := strings.TrimSpace(r.Header.Get(admissionOverrideHeader)); reason != "" {
+		if HasRole(user.Role, "admin") {
+			recordAdmissionEvent(req, d, "override", user.Username, reason)
+			recordActivityLog("admission_override", req.scope(),
+				fmt.Sprintf("%s by %s: %s (%s)", req.Kind, user.Username, reason, d.reasons()), "warning")
+			return true
+		}
+	}
+
+	recordAdmissionEvent(req, d, "denied", user.Username, "")
+	recordActivityLog("admission_denied", req.scope(), req.Kind+": "+d.reasons(), "error")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "Deploy refused by admission policy " + d.Policy.Name,
+		"decision": d,
+	})
+	return false
+}
+
+// ── Image discovery ────────────────────────────────────────────────────────
+
+// manifestImages returns the images of every pod template in a
+// multi-document YAML manifest, with the namespace each one targets.
+func manifestImages(manifest []byte) (map[string][]string, error) {
+	out := map[string][]string{}
+	dec := yaml.NewDecoder(bytes.NewReader(manifest))
+	for {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if doc == nil {
+			continue
+		}
+		ns := ""
+		if meta, ok := doc["metadata"].(map[string]interface{}); ok {
+			ns, _ = meta["namespace"].(string)
+		}
+		var walk func(v interface{})
+		walk = func(v interface{}) {
+			switch t := v.(type) {
+			case map[string]interface{}:
+				for k, child := range t {
+					if k == "containers" || k == "initContainers" || k == "ephemeralContainers" {
+						if list, ok := child.([]interface{}); ok {
+							for _, c := range list {
+								if cm, ok := c.(map[string]interface{}); ok {
+									if img, ok := cm["image"].(string); ok && img != "" {
+										out[ns] = append(out[ns], img)
+									}
+								}
+							}
+						}
+						continue
+					}
+					walk(child)
+				}
+			case []interface{}:
+				for _, child := range t {
+					walk(child)
+				}
+			}
+		}
+		walk(doc)
+	}
+	return out, nil
+}
+
+// admitManifest gates a manifest applied to a cluster, per namespace.
+// defaultNS applies to objects without metadata.namespace.
+func admitManifest(w http.ResponseWriter, r *http.Request, kind string, clusterID int, defaultNS string, manifest []byte) bool {
+	byNS, err := manifestImages(manifest)
+	if err != nil {
+		// Images in a document we can't read can't be checked: fail closed.
+		http.Error(w, "Admission check failed: manifest does not parse: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	for ns, images := range byNS {
+		if ns == "" {
+			ns = defaultNS
+		}
+		if !admitDeploy(w, r, admissionRequest{Kind: kind, ClusterID: clusterID, Namespace: ns, Images: images}) {
+			return false
+		}
+	}
+	return true
+}
+
+// admissionBlocksManifest evaluates a manifest outside of a request, for
+// deploys nobody is around to override. Refusals are recorded under actor.
+func admissionBlocksManifest(kind string, clusterID int, defaultNS string, manifest []byte, actor string) (string, bool) {
+	byNS, err := manifestImages(manifest)
+	if err != nil {
+		return "admission check failed: manifest does not parse: " + err.Error(), true
+	}
+	for ns, images := range byNS {
+		if ns == "" {
+			ns = defaultNS
+		}
+		req := admissionRequest{Kind: kind, ClusterID: clusterID, Namespace: ns, Images: images}
+		d, err := evaluateAdmission(req)
+		if err != nil {
+			return "admission check failed: " + err.Error(), true
+		}
+		if d.Policy == nil {
+			continue
+		}
+		if !d.Allowed {
+			recordAdmissionEvent(req, d, "denied", actor, "")
+			recordActivityLog("admission_denied", req.scope(), kind+": "+d.reasons(), "error")
+			return d.reasons(), true
+		}
+		recordAdmissionEvent(req, d, "allowed", actor, "")
+	}
+	return "", false
+}
+
+// projectForResource returns the project a container name is assigned to
+// on a host, or 0.
+func projectForResource(hostID int, name string) int {
+	var id int
+	database.DB.QueryRow(
+		`SELECT project_id FROM project_resources WHERE host_id = ? AND resource_identifier = ? LIMIT 1`,
+		hostID, strings.TrimPrefix(name, "/")).Scan(&id)
+	return id
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// GET /api/admission/policies
+func ListAdmissionPolicies(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rows, err := database.DB.Query(`SELECT ` + admissionPolicyColumns + ` FROM admission_policies ORDER BY id`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	list := []AdmissionPolicy{}
+	for rows.Next() {
+		if p, err := scanAdmissionPolicy(rows); err == nil {
+			list = append(list, p)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func decodeAdmissionPolicy(r *http.Request) (AdmissionPolicy, error) {
+	p := AdmissionPolicy{Enabled: true, RequireScan: true}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return p, errors.New("Invalid request")
+	}
+	if p.Name == "" {
+		return p, errors.New("name is required")
+	}
+	switch p.ScopeType {
+	case "global":
+		p.ProjectID, p.ClusterID, p.Namespace = nil, nil, nil
+	case "project":
+		if p.ProjectID == nil || *p.ProjectID == 0 {
+			return p, errors.New("project_id is required for project policies")
+		}
+		p.ClusterID, p.Namespace = nil, nil
+	case "namespace":
+		if p.Namespace == nil || *p.Namespace == "" {
+			return p, errors.New("namespace is required for namespace policies")
+		}
+		p.ProjectID = nil
+	default:
+		return p, errors.New("scope_type must be global, project or namespace")
+	}
+	if p.MaxCritical < 0 || p.MaxScanAgeDays < 0 {
+		return p, errors.New("max_critical and max_scan_age_days must not be negative")
+	}
+	return p, nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// POST /api/admission/policies
+func CreateAdmissionPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	p, err := decodeAdmissionPolicy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO admission_policies (name, scope_type, project_id, cluster_id, namespace, enabled,
+		                                 max_critical, max_scan_age_days, require_scan)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Name, p.ScopeType, p.ProjectID, p.ClusterID, p.Namespace, boolInt(p.Enabled),
+		p.MaxCritical, p.MaxScanAgeDays, boolInt(p.RequireScan))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+	recordActivityLog("admission_policy_create", p.Name, "created by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id})
+}
+
+// PUT /api/admission/policies/{id}
+func UpdateAdmissionPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	p, err := decodeAdmissionPolicy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := database.DB.Exec(
+		`UPDATE admission_policies SET name = ?, scope_type = ?, project_id = ?, cluster_id = ?, namespace = ?,
+		        enabled = ?, max_critical = ?, max_scan_age_days = ?, require_scan = ? WHERE id = ?`,
+		p.Name, p.ScopeType, p.ProjectID, p.ClusterID, p.Namespace, boolInt(p.Enabled),
+		p.MaxCritical, p.MaxScanAgeDays, boolInt(p.RequireScan), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	recordActivityLog("admission_policy_update", p.Name, "updated by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// DELETE /api/admission/policies/{id}
+func DeleteAdmissionPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if _, err := database.DB.Exec(`DELETE FROM admission_policies WHERE id = ?`, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordActivityLog("admission_policy_delete", id, "deleted by "+user.Username, "success")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/admission/check
+// Body: {"images": ["nginx:1.27"], "project_id": 0, "cluster_id": 1, "namespace": "prod"}
+// Evaluates without deploying or recording anything.
+func CheckAdmission(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Images    []string `json:"images"`
+		ProjectID int      `json:"project_id"`
+		ClusterID int      `json:"cluster_id"`
+		Namespace string   `json:"namespace"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	d, err := evaluateAdmission(admissionRequest{
+		ProjectID: req.ProjectID, ClusterID: req.ClusterID, Namespace: req.Namespace, Images: req.Images,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// GET /api/admission/events?decision=denied&limit=100
+func ListAdmissionEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	query := `SELECT id, policy_id, kind, scope, images, decision, reasons, username, override_reason, created_at
+	          FROM admission_events`
+	args := []interface{}{}
+	if d := r.URL.Query().Get("decision"); d != "" {
+		query += " WHERE decision = ?"
+		args = append(args, d)
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query += " ORDER BY id DESC LIMIT " + strconv.Itoa(limit)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	list := []AdmissionEvent{}
+	for rows.Next() {
+		var e AdmissionEvent
+		if err := rows.Scan(&e.ID, &e.PolicyID, &e.Kind, &e.Scope, &e.Images, &e.Decision, &e.Reasons,
+			&e.Username, &e.Override, &e.CreatedAt); err != nil {
+			continue
+		}
+		list = append(list, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -102,8 +102,8 @@ const UserContextKey contextKey = "user"
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow public endpoints
-		if strings.HasPrefix(r.URL.Path, "/api/auth/") {
+		// Allow public endpoints (webhooks verify their own signatures)
+		if strings.HasPrefix(r.URL.Path, "/api/auth/") || strings.HasPrefix(r.URL.Path, "/api/webhooks/") {
 			next.ServeHTTP(w, r)
 			return
 		}
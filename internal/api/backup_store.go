@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BackupStore is a storage target for backup archives. Keys are slash
+// separated relative paths (e.g. "volumes/host1/data/20260101_120000.tar.gz").
+//
+// Only the local-disk store is built in. Other targets (S3-compatible object
+// storage, NFS, …) plug in by implementing this interface and calling
+// RegisterBackupStore during startup; the store name is what gets recorded
+// in the backup catalog so archives can be found again later.
+type BackupStore interface {
+	Name() string
+	Put(key string, r io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var (
+	backupStoresMu sync.RWMutex
+	backupStores   = map[string]BackupStore{}
+)
+
+func init() {
+	dir := os.Getenv("BACKUP_DIR")
+	if dir == "" {
+		dir = "./backups"
+	}
+	RegisterBackupStore(&localBackupStore{dir: dir})
+}
+
+// RegisterBackupStore makes a store available under its Name().
+func RegisterBackupStore(s BackupStore) {
+	backupStoresMu.Lock()
+	defer backupStoresMu.Unlock()
+	backupStores[s.Name()] = s
+}
+
+// getBackupStore returns the named store; an empty name means "local".
+func getBackupStore(name string) (BackupStore, error) {
+	if name == "" {
+		name = "local"
+	}
+	backupStoresMu.RLock()
+	defer backupStoresMu.RUnlock()
+	s, ok := backupStores[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backup storage %q", name)
+	}
+	return s, nil
+}
+
+// localBackupStore keeps archives on the management server's disk.
+type localBackupStore struct {
+	dir string
+}
+
+func (s *localBackupStore) Name() string { return "local" }
+
+// path resolves key inside the store directory, refusing keys that would
+// escape it.
+func (s *localBackupStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(key))
+	full := filepath.Join(s.dir, clean)
+	if !strings.HasPrefix(full, filepath.Clean(s.dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid backup key %q", key)
+	}
+	return full, nil
+}
+
+func (s *localBackupStore) Put(key string, r io.Reader) (int64, error) {
+	full, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return 0, err
+	}
+	// Write to a temp file first so a failed backup never leaves a
+	// truncated archive under the final name.
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".partial-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return n, err
+	}
+	if err := os.Rename(tmp.Name(), full); err != nil {
+		os.Remove(tmp.Name())
+		return n, err
+	}
+	return n, nil
+}
+
+func (s *localBackupStore) Open(key string) (io.ReadCloser, error) {
+	full, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(full)
+}
+
+func (s *localBackupStore) Delete(key string) error {
+	full, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -1,16 +1,17 @@
 ﻿package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -19,164 +20,32 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// runKubectlWithKubeconfig executes a kubectl command using a stored kubeconfig.
-// It accepts SSH-style commands like "sudo k0s kubectl get pods -o json" and
-// transforms them to local kubectl invocations.
-func runKubectlWithKubeconfig(kubeconfigContent, sshCmd string) (string, error) {
-	// Write kubeconfig to a temp file
-	tmpKC, err := os.CreateTemp("", "kc-*.yaml")
+// writeClusterKubeconfig writes a cluster's stored admin kubeconfig to a
+// temp file for helm/kubectl. The caller must call cleanup.
+func writeClusterKubeconfig(clusterID int) (path string, cleanup func(), err error) {
+	var kc string
+	err = database.DB.QueryRow("SELECT COALESCE(kubeconfig,'') FROM k0s_clusters WHERE id = ?", clusterID).Scan(&kc)
 	if err != nil {
-		return "", fmt.Errorf("temp kubeconfig: %v", err)
-	}
-	defer os.Remove(tmpKC.Name())
-	tmpKC.WriteString(kubeconfigContent)
-	tmpKC.Close()
-
-	// Special case: bash script with base64-encoded YAML apply
-	// Pattern from ApplyClusterResource: echo 'B64...' | base64 -d > ...
-	if strings.Contains(sshCmd, "base64 -d") {
-		re := regexp.MustCompile(`echo\s+'([A-Za-z0-9+/=]+)'\s+\|\s+base64`)
-		matches := re.FindStringSubmatch(sshCmd)
-		if len(matches) > 1 {
-			yamlBytes, decErr := base64.StdEncoding.DecodeString(matches[1])
-			if decErr != nil {
-				return "", fmt.Errorf("decode base64 yaml: %v", decErr)
-			}
-			tmpYAML, yErr := os.CreateTemp("", "resource-*.yaml")
-			if yErr != nil {
-				return "", fmt.Errorf("temp yaml: %v", yErr)
-			}
-			defer os.Remove(tmpYAML.Name())
-			tmpYAML.Write(yamlBytes)
-			tmpYAML.Close()
-			return kubectlRun(tmpKC.Name(), "apply", "-f", tmpYAML.Name(), "--validate=false")
-		}
-	}
-
-	// Strip SSH/k0s prefix to get pure kubectl args
-	kubectlPart := sshCmd
-	for _, prefix := range []string{"sudo k0s kubectl ", "k0s kubectl ", "sudo kubectl ", "kubectl "} {
-		if strings.HasPrefix(kubectlPart, prefix) {
-			kubectlPart = strings.TrimPrefix(kubectlPart, prefix)
-			break
-		}
-	}
-
-	// Handle "| wc -l" â€“ count lines in Go instead
-	if strings.Contains(kubectlPart, "| wc -l") {
-		kubectlPart = strings.Split(kubectlPart, "|")[0]
-		kubectlPart = strings.ReplaceAll(kubectlPart, "2>/dev/null", "")
-		kubectlPart = strings.TrimSpace(kubectlPart)
-		args := strings.Fields(kubectlPart)
-		out, runErr := kubectlRun(tmpKC.Name(), args...)
-		if runErr != nil {
-			return "0", nil
-		}
-		trimmed := strings.TrimSpace(out)
-		if trimmed == "" {
-			return "0", nil
-		}
-		count := len(strings.Split(trimmed, "\n"))
-		return strconv.Itoa(count), nil
+		return "", nil, fmt.Errorf("cluster %d not found", clusterID)
 	}
-
-	// Handle "|| ..." fallback patterns â€“ use only the first command
-	if strings.Contains(kubectlPart, "||") {
-		kubectlPart = strings.Split(kubectlPart, "||")[0]
+	kc = database.OpenSecret(kc)
+	if strings.TrimSpace(kc) == "" {
+		return "", nil, fmt.Errorf("cluster %d has no stored kubeconfig", clusterID)
 	}
-
-	// Strip any remaining shell redirects
-	kubectlPart = strings.ReplaceAll(kubectlPart, "2>/dev/null", "")
-	kubectlPart = strings.TrimSpace(kubectlPart)
-
-	args := strings.Fields(kubectlPart)
-	log.Printf("[kubectl] running: kubectl %s", strings.Join(args, " "))
-	return kubectlRun(tmpKC.Name(), args...)
+	return writeTempKubeconfig(kc)
 }
 
-// kubectlRun runs kubectl with the given kubeconfig file and args.
-func kubectlRun(kubeconfigPath string, args ...string) (string, error) {
-	fullArgs := append([]string{"--kubeconfig=" + kubeconfigPath}, args...)
-	cmd := exec.Command("kubectl", fullArgs...)
-	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if stderr.Len() > 0 {
-		log.Printf("[kubectl] stderr: %s", strings.TrimSpace(stderr.String()))
-	}
-	if err != nil {
-		// Retry with --insecure-skip-tls-verify in case TLS cert verification is the issue
-		log.Printf("[kubectl] first attempt failed (%v), retrying with --insecure-skip-tls-verify", err)
-		fullArgs2 := append([]string{"--kubeconfig=" + kubeconfigPath, "--insecure-skip-tls-verify=true"}, args...)
-		cmd2 := exec.Command("kubectl", fullArgs2...)
-		var stdout2, stderr2 strings.Builder
-		cmd2.Stdout = &stdout2
-		cmd2.Stderr = &stderr2
-		err2 := cmd2.Run()
-		if stderr2.Len() > 0 {
-			log.Printf("[kubectl] retry stderr: %s", strings.TrimSpace(stderr2.String()))
-		}
-		if err2 != nil {
-			return stdout2.String(), fmt.Errorf("kubectl error: %v\nstderr: %s", err2, stderr2.String())
-		}
-		return stdout2.String(), nil
-	}
-	return stdout.String(), nil
-}
-
-// clusterSSHRun runs a kubectl command on a cluster.
-// If the cluster has a stored kubeconfig (imported cluster), it uses local kubectl.
-// Otherwise it falls back to SSH (k0s provisioned cluster).
-func clusterSSHRun(clusterID string, cmd string) (string, error) {
-	var ipAddress, username string
-	var password, authMethod, sshKey, storedKubeconfig sql.NullString
-
-	err := database.DB.QueryRow(
-		"SELECT ip_address, username, COALESCE(password,''), COALESCE(auth_method,'password'), COALESCE(ssh_key,''), COALESCE(kubeconfig,'') FROM k0s_clusters WHERE id = ?",
-		clusterID,
-	).Scan(&ipAddress, &username, &password, &authMethod, &sshKey, &storedKubeconfig)
-	if err != nil {
-		return "", fmt.Errorf("cluster not found: %v", err)
-	}
-
-	// Imported / external cluster â€“ use stored kubeconfig via local kubectl
-	if storedKubeconfig.Valid && strings.TrimSpace(storedKubeconfig.String) != "" {
-		return runKubectlWithKubeconfig(storedKubeconfig.String, cmd)
-	}
-
-	// k0s provisioned cluster â€“ use SSH
-	auth := authMethod.String
-	if auth == "" {
-		auth = "password"
-	}
-	credential := password.String
-	if auth == "ssh-key" {
-		credential = sshKey.String
-	}
-
-	client, err := connectSSH(ipAddress, username, credential, auth)
-	if err != nil {
-		return "", fmt.Errorf("SSH connect failed: %v", err)
-	}
-	defer client.Close()
-
-	session, err := client.NewSession()
+// writeTempKubeconfig writes kubeconfig content to a private temp file.
+// The caller must call cleanup.
+func writeTempKubeconfig(kc string) (path string, cleanup func(), err error) {
+	tmpKC, err := os.CreateTemp("", "kc-*.yaml")
 	if err != nil {
-		return "", fmt.Errorf("SSH session failed: %v", err)
+		return "", nil, fmt.Errorf("temp kubeconfig: %v", err)
 	}
-	defer session.Close()
-
-	var out strings.Builder
-	var errOut strings.Builder
-	session.Stdout = &out
-	session.Stderr = &errOut
-
-	if runErr := session.Run(cmd); runErr != nil {
-		return "", fmt.Errorf("command failed: %v\nstderr: %s", runErr, errOut.String())
-	}
-
-	return out.String(), nil
+	tmpKC.Chmod(0600)
+	tmpKC.WriteString(kc)
+	tmpKC.Close()
+	return tmpKC.Name(), func() { os.Remove(tmpKC.Name()) }, nil
 }
 
 // checkNamespaceAccess checks if user has access to a namespace
@@ -206,75 +75,85 @@ func checkNamespaceAccess(user User, clusterID int, namespace string) bool {
 	return count > 0
 }
 
+// assignedNamespaceSet returns the namespaces of a cluster assigned to user.
+func assignedNamespaceSet(user User, clusterID int) (map[string]bool, error) {
+	rows, err := database.DB.Query(
+		"SELECT namespace FROM user_namespaces WHERE user_id = ? AND cluster_id = ?",
+		user.ID, clusterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assigned := make(map[string]bool)
+	for rows.Next() {
+		var ns string
+		if err := rows.Scan(&ns); err != nil {
+			continue
+		}
+		assigned[ns] = true
+	}
+	return assigned, nil
+}
+
+// keepAssignedItems drops the namespaced items outside the assigned
+// namespaces; cluster-scoped items are kept.
+func keepAssignedItems(items []map[string]interface{}, assigned map[string]bool) []map[string]interface{} {
+	filtered := []map[string]interface{}{}
+	for _, item := range items {
+		itemNS := nestedString(item, "metadata", "namespace")
+		if itemNS == "" || assigned[itemNS] {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
 // GetClusterNamespaces returns all namespaces in a cluster
-// GET /api/k0s/clusters/{id}/k8s/namespaces
+// GET /api/k0s/clusters/{id}/k8s/namespaces?labelSelector=xxx
 // Admin users see all namespaces; non-admin users see only assigned namespaces
 func GetClusterNamespaces(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
 	clusterIDInt, _ := strconv.Atoi(clusterID)
 
-	out, err := clusterSSHRun(clusterID, "sudo k0s kubectl get namespaces -o json")
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		log.Printf("[ClusterAdmin] GetNamespaces error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
 		return
 	}
-
-	// Parse namespaces response - use generic unmarshaling to preserve full structure
-	var nsData struct {
-		Items []map[string]interface{} `json:"items"`
-	}
-	if err := json.Unmarshal([]byte(out), &nsData); err != nil {
-		log.Printf("[ClusterAdmin] Failed to parse namespaces: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	nsList, err := c.list(r.Context(), mustK8sResource("namespaces"), "", k8sListOptions{
+		LabelSelector: r.URL.Query().Get("labelSelector"),
+	})
+	if err != nil {
+		log.Printf("[ClusterAdmin] GetNamespaces error: %v", err)
+		writeK8sError(w, err)
 		return
 	}
 
 	// Check if user is admin or not - if not admin, filter namespaces
 	user, ok := GetUserFromContext(r.Context())
 	if ok && !HasRole(user.Role, "admin") {
-		// Non-admin user: get assigned namespaces for this cluster
-		rows, err := database.DB.Query(
-			"SELECT namespace FROM user_namespaces WHERE user_id = ? AND cluster_id = ?",
-			user.ID, clusterIDInt,
-		)
+		assignedNS, err := assignedNamespaceSet(user, clusterIDInt)
 		if err != nil {
 			log.Printf("[ClusterAdmin] Error getting assigned namespaces: %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		assignedNS := make(map[string]bool)
-		for rows.Next() {
-			var ns string
-			if err := rows.Scan(&ns); err != nil {
-				continue
-			}
-			assignedNS[ns] = true
-		}
 
 		// Filter namespaces by checking metadata.name
-		var filtered []map[string]interface{}
-		for _, item := range nsData.Items {
-			metadata, ok := item["metadata"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-			nsName, ok := metadata["name"].(string)
-			if !ok {
-				continue
-			}
-			if assignedNS[nsName] {
+		filtered := []map[string]interface{}{}
+		for _, item := range nsList.Items {
+			if assignedNS[nestedString(item, "metadata", "name")] {
 				filtered = append(filtered, item)
 			}
 		}
-		nsData.Items = filtered
+		nsList.Items = filtered
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(nsData)
+	json.NewEncoder(w).Encode(nsList)
 }
 
 // CreateNamespace creates a new namespace
@@ -297,13 +176,22 @@ func CreateNamespace(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "name is required", http.StatusBadRequest)
 		return
 	}
-	out, err := clusterSSHRun(clusterID, fmt.Sprintf("sudo k0s kubectl create namespace %s", body.Name))
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
+		return
+	}
+	ns := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": strings.TrimSpace(body.Name)},
+	}
+	if _, err := c.create(r.Context(), mustK8sResource("namespaces"), "", ns); err != nil {
+		writeK8sError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"output": out})
+	json.NewEncoder(w).Encode(map[string]string{"output": "namespace/" + strings.TrimSpace(body.Name) + " created"})
 }
 
 // DeleteNamespaceResource deletes a namespace
@@ -335,13 +223,22 @@ func DeleteNamespaceResource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, err := clusterSSHRun(clusterID, fmt.Sprintf("sudo k0s kubectl delete namespace %s", ns))
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
+		return
+	}
+	if err := c.delete(r.Context(), mustK8sResource("namespaces"), "", ns); err != nil {
+		writeK8sError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"output": out})
+	json.NewEncoder(w).Encode(map[string]string{"output": fmt.Sprintf("namespace %q deleted", ns)})
+}
+
+// labelPatch is the merge patch setting the given labels.
+func labelPatch(labels map[string]string) map[string]interface{} {
+	return map[string]interface{}{"metadata": map[string]interface{}{"labels": labels}}
 }
 
 // UpdateNamespaceLabels patches labels on a namespace
@@ -375,18 +272,17 @@ func UpdateNamespaceLabels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var parts []string
-	for k, v := range body.Labels {
-		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
-	}
-	cmd := fmt.Sprintf("sudo k0s kubectl label namespace %s %s --overwrite", ns, strings.Join(parts, " "))
-	out, err := clusterSSHRun(clusterID, cmd)
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
+		return
+	}
+	if _, err := c.patch(r.Context(), mustK8sResource("namespaces"), "", ns, k8sMergePatch, labelPatch(body.Labels)); err != nil {
+		writeK8sError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"output": out})
+	json.NewEncoder(w).Encode(map[string]string{"output": "namespace/" + ns + " labeled"})
 }
 
 // UpdateNodeLabels patches labels on a node
@@ -410,18 +306,17 @@ func UpdateNodeLabels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var parts []string
-	for k, v := range body.Labels {
-		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
-	}
-	cmd := fmt.Sprintf("sudo k0s kubectl label node %s %s --overwrite", nodeName, strings.Join(parts, " "))
-	out, err := clusterSSHRun(clusterID, cmd)
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
+		return
+	}
+	if _, err := c.patch(r.Context(), mustK8sResource("nodes"), "", nodeName, k8sMergePatch, labelPatch(body.Labels)); err != nil {
+		writeK8sError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"output": out})
+	json.NewEncoder(w).Encode(map[string]string{"output": "node/" + nodeName + " labeled"})
 }
 
 // GetAllResourceQuotas returns ResourceQuota objects for all namespaces
@@ -431,68 +326,30 @@ func GetAllResourceQuotas(w http.ResponseWriter, r *http.Request) {
 	clusterID := vars["id"]
 	clusterIDInt, _ := strconv.Atoi(clusterID)
 
-	out, err := clusterSSHRun(clusterID, "sudo k0s kubectl get resourcequota --all-namespaces -o json")
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		// Return empty list on error (cluster may have no quotas)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"items":[]}`))
+		writeK8sError(w, err)
 		return
 	}
-
-	// Parse quotas - use generic unmarshaling to preserve full structure
-	var quotaData struct {
-		Items []map[string]interface{} `json:"items"`
-	}
-	if err := json.Unmarshal([]byte(out), &quotaData); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"items":[]}`))
+	quotaList, err := c.list(r.Context(), mustK8sResource("resourcequotas"), "", k8sListOptions{})
+	if err != nil {
+		writeK8sError(w, err)
 		return
 	}
 
 	// Filter quotas for non-admin users
 	user, ok := GetUserFromContext(r.Context())
 	if ok && !HasRole(user.Role, "admin") {
-		// Get assigned namespaces
-		rows, err := database.DB.Query(
-			"SELECT namespace FROM user_namespaces WHERE user_id = ? AND cluster_id = ?",
-			user.ID, clusterIDInt,
-		)
+		assignedNS, err := assignedNamespaceSet(user, clusterIDInt)
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{"items":[]}`))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		assignedNS := make(map[string]bool)
-		for rows.Next() {
-			var ns string
-			if err := rows.Scan(&ns); err != nil {
-				continue
-			}
-			assignedNS[ns] = true
-		}
-
-		// Filter quotas by checking metadata.namespace
-		var filtered []map[string]interface{}
-		for _, item := range quotaData.Items {
-			metadata, ok := item["metadata"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-			itemNS, ok := metadata["namespace"].(string)
-			if !ok {
-				continue
-			}
-			if assignedNS[itemNS] {
-				filtered = append(filtered, item)
-			}
-		}
-		quotaData.Items = filtered
+		quotaList.Items = keepAssignedItems(quotaList.Items, assignedNS)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(quotaData)
+	json.NewEncoder(w).Encode(quotaList)
 }
 
 // parseQuantityMillis converts a Kubernetes CPU quantity string to millicores (int64)
@@ -577,37 +434,32 @@ func GetNamespacePodUsage(w http.ResponseWriter, r *http.Request) {
 	clusterID := vars["id"]
 	clusterIDInt, _ := strconv.Atoi(clusterID)
 
-	out, err := clusterSSHRun(clusterID, "sudo k0s kubectl get pods --all-namespaces -o json --field-selector=status.phase=Running")
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{}`))
-		return
-	}
-
-	var podList struct {
-		Items []struct {
-			Metadata struct {
-				Namespace string `json:"namespace"`
-			} `json:"metadata"`
-			Spec struct {
-				Containers []struct {
-					Resources struct {
-						Requests map[string]string `json:"requests"`
-						Limits   map[string]string `json:"limits"`
-					} `json:"resources"`
-				} `json:"containers"`
-				InitContainers []struct {
-					Resources struct {
-						Requests map[string]string `json:"requests"`
-						Limits   map[string]string `json:"limits"`
-					} `json:"resources"`
-				} `json:"initContainers"`
-			} `json:"spec"`
-		} `json:"items"`
-	}
-	if err := json.Unmarshal([]byte(out), &podList); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{}`))
+		writeK8sError(w, err)
+		return
+	}
+	running, err := c.list(r.Context(), mustK8sResource("pods"), "", k8sListOptions{FieldSelector: "status.phase=Running"})
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	var pods []struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []struct {
+				Resources struct {
+					Requests map[string]string `json:"requests"`
+					Limits   map[string]string `json:"limits"`
+				} `json:"resources"`
+			} `json:"containers"`
+		} `json:"spec"`
+	}
+	if err := decodeK8sItems(running.Items, &pods); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
 
@@ -620,7 +472,7 @@ func GetNamespacePodUsage(w http.ResponseWriter, r *http.Request) {
 	}
 	nsMap := map[string]*nsStats{}
 
-	for _, pod := range podList.Items {
+	for _, pod := range pods {
 		ns := pod.Metadata.Namespace
 		if _, ok := nsMap[ns]; !ok {
 			nsMap[ns] = &nsStats{}
@@ -638,26 +490,11 @@ func GetNamespacePodUsage(w http.ResponseWriter, r *http.Request) {
 	// Filter namespaces for non-admin users
 	user, ok := GetUserFromContext(r.Context())
 	if ok && !HasRole(user.Role, "admin") {
-		// Get assigned namespaces for non-admin user
-		rows, err := database.DB.Query(
-			"SELECT namespace FROM user_namespaces WHERE user_id = ? AND cluster_id = ?",
-			user.ID, clusterIDInt,
-		)
+		assignedNS, err := assignedNamespaceSet(user, clusterIDInt)
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(`{}`))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		assignedNS := make(map[string]bool)
-		for rows.Next() {
-			var ns string
-			if err := rows.Scan(&ns); err != nil {
-				continue
-			}
-			assignedNS[ns] = true
-		}
 
 		// Keep only assigned namespaces in the result
 		for ns := range nsMap {
@@ -717,50 +554,57 @@ func SetNamespaceQuota(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	quotas := mustK8sResource("resourcequotas")
+
 	isEmpty := func(v string) bool { return v == "" || v == "0" }
 
 	// If all fields are empty/0, delete the quota
 	if isEmpty(body.CPURequest) && isEmpty(body.CPULimit) && isEmpty(body.MemRequest) && isEmpty(body.MemLimit) {
-		cmd := fmt.Sprintf("sudo k0s kubectl delete resourcequota ns-quota -n %s --ignore-not-found", ns)
-		out, _ := clusterSSHRun(clusterID, cmd)
+		output := "Quota removed."
+		if err := c.delete(r.Context(), quotas, ns, "ns-quota"); err != nil {
+			if !isK8sNotFound(err) {
+				writeK8sError(w, err)
+				return
+			}
+			output += " No quota was set."
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"output": "Quota removed. " + strings.TrimSpace(out)})
+		json.NewEncoder(w).Encode(map[string]string{"output": output})
 		return
 	}
 
 	// Build hard limits section
-	var hard strings.Builder
+	hard := map[string]string{}
 	if !isEmpty(body.CPURequest) {
-		fmt.Fprintf(&hard, "    requests.cpu: \"%s\"\n", body.CPURequest)
+		hard["requests.cpu"] = body.CPURequest
 	}
 	if !isEmpty(body.CPULimit) {
-		fmt.Fprintf(&hard, "    limits.cpu: \"%s\"\n", body.CPULimit)
+		hard["limits.cpu"] = body.CPULimit
 	}
 	if !isEmpty(body.MemRequest) {
-		fmt.Fprintf(&hard, "    requests.memory: \"%s\"\n", body.MemRequest)
+		hard["requests.memory"] = body.MemRequest
 	}
 	if !isEmpty(body.MemLimit) {
-		fmt.Fprintf(&hard, "    limits.memory: \"%s\"\n", body.MemLimit)
+		hard["limits.memory"] = body.MemLimit
 	}
 
-	yaml := fmt.Sprintf(`apiVersion: v1
-kind: ResourceQuota
-metadata:
-  name: ns-quota
-  namespace: %s
-spec:
-  hard:
-%s`, ns, hard.String())
-
-	encoded := base64.StdEncoding.EncodeToString([]byte(yaml))
-	cmd := fmt.Sprintf("echo '%s' | base64 -d | sudo k0s kubectl apply -f -", encoded)
-	out, err := clusterSSHRun(clusterID, cmd)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	quota := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ResourceQuota",
+		"metadata":   map[string]interface{}{"name": "ns-quota", "namespace": ns},
+		"spec":       map[string]interface{}{"hard": hard},
+	}
+	if _, err := c.apply(r.Context(), quotas, ns, "ns-quota", quota, false); err != nil {
+		writeK8sError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"output": out})
+	json.NewEncoder(w).Encode(map[string]string{"output": "resourcequota/ns-quota serverside-applied"})
 }
 
 // GetClusterNodes returns all nodes in a cluster (k8s nodes, not our DB nodes)
@@ -769,202 +613,197 @@ func GetClusterNodes2(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
 
-	out, err := clusterSSHRun(clusterID, "sudo k0s kubectl get nodes -o json")
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	nodes, err := c.list(r.Context(), mustK8sResource("nodes"), "", k8sListOptions{
+		LabelSelector: r.URL.Query().Get("labelSelector"),
+	})
 	if err != nil {
 		log.Printf("[ClusterAdmin] GetNodes error for cluster %s: %v", clusterID, err)
-		// Return empty items instead of 500 so the UI shows "No nodes found" gracefully
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"items":[]}`))
+		writeK8sError(w, err)
 		return
 	}
 
-	preview := out
-	if len(preview) > 300 {
-		preview = preview[:300]
-	}
-	log.Printf("[ClusterAdmin] GetNodes cluster=%s response_len=%d content=%s", clusterID, len(out), preview)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
 
-	// Ensure the response has an `items` key; kubectl returns NodeList with items
-	var check struct {
-		Items json.RawMessage `json:"items"`
+// writeMetrics serves a metrics.k8s.io list. A cluster without a metrics
+// server gets an empty list.
+func writeMetrics(w http.ResponseWriter, r *http.Request, clusterID, apiPath string) {
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
 	}
-	if parseErr := json.Unmarshal([]byte(out), &check); parseErr != nil || check.Items == nil {
-		log.Printf("[ClusterAdmin] GetNodes unexpected format for cluster %s: %v", clusterID, parseErr)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"items":[]}`))
+	out, err := c.raw(r.Context(), apiPath, nil)
+	if err != nil {
+		if code := k8sErrorCode(err); code == http.StatusNotFound || code == http.StatusServiceUnavailable {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"items":[]}`))
+			return
+		}
+		log.Printf("[ClusterAdmin] metrics error for cluster %s (%s): %v", clusterID, apiPath, err)
+		writeK8sError(w, err)
 		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(out))
+	w.Write(out)
 }
 
 // GetNodeMetrics returns node resource usage metrics
 // GET /api/k0s/clusters/{id}/k8s/nodes/metrics
 func GetNodeMetrics(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	clusterID := vars["id"]
-
-	out, err := clusterSSHRun(clusterID, "sudo k0s kubectl get --raw /apis/metrics.k8s.io/v1beta1/nodes")
-	if err != nil {
-		log.Printf("[ClusterAdmin] GetNodeMetrics error for cluster %s: %v", clusterID, err)
-		// Metrics server might not be installed; return empty
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"items":[]}`))
-		return
-	}
-
-	log.Printf("[ClusterAdmin] GetNodeMetrics cluster=%s response_len=%d", clusterID, len(out))
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(out))
+	writeMetrics(w, r, mux.Vars(r)["id"], "/apis/metrics.k8s.io/v1beta1/nodes")
 }
 
 // GetPodMetrics returns pod resource usage metrics for a namespace
 // GET /api/k0s/clusters/{id}/k8s/pods-metrics?namespace=xxx
 func GetPodMetrics(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	clusterID := vars["id"]
 	namespace := r.URL.Query().Get("namespace")
-	
+
 	// Build the correct API path for metrics
-	var apiPath string
-	if namespace == "" || namespace == "all" {
-		// Get metrics from all namespaces
-		apiPath = "/apis/metrics.k8s.io/v1beta1/pods"
-	} else {
-		// Get metrics from specific namespace
-		apiPath = fmt.Sprintf("/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods", namespace)
+	apiPath := "/apis/metrics.k8s.io/v1beta1/pods"
+	if namespace != "" && namespace != "all" {
+		apiPath = "/apis/metrics.k8s.io/v1beta1/namespaces/" + url.PathEscape(namespace) + "/pods"
 	}
-	
-	cmd := fmt.Sprintf("sudo k0s kubectl get --raw %s", apiPath)
-	
-	out, err := clusterSSHRun(clusterID, cmd)
-	if err != nil {
-		log.Printf("[ClusterAdmin] GetPodMetrics error for cluster %s namespace %s: %v", clusterID, namespace, err)
-		// Metrics server might not be installed or no metrics available; return empty
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"items":[]}`))
-		return
-	}
-
-	log.Printf("[ClusterAdmin] GetPodMetrics cluster=%s namespace=%s response_len=%d", clusterID, namespace, len(out))
+	writeMetrics(w, r, mux.Vars(r)["id"], apiPath)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(out))
+// resourceAccessAllowed applies the cluster admin's namespace rules to a
+// request for one resource type and writes a 403 when they deny it.
+// Non-admin users may use namespaced kinds in their assigned namespaces and
+// read nodes; other cluster-scoped kinds are admin-only. An empty namespace
+// (all namespaces) passes here — such lists are filtered afterwards.
+func resourceAccessAllowed(w http.ResponseWriter, r *http.Request, clusterID int, rs k8sResource, namespace string) bool {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || HasRole(user.Role, "admin") {
+		return true
+	}
+	if !rs.Namespaced {
+		if rs.Name == "nodes" && r.Method == http.MethodGet {
+			return true
+		}
+		http.Error(w, "access denied: cluster-scoped resources require the admin role", http.StatusForbidden)
+		return false
+	}
+	if namespace != "" && !checkNamespaceAccess(user, clusterID, namespace) {
+		http.Error(w, "access denied: namespace not assigned to user", http.StatusForbidden)
+		return false
+	}
+	return true
 }
 
-// GetClusterResources returns k8s resources (pods/deployments/services/ingresses)
-// GET /api/k0s/clusters/{id}/k8s/{resource}?namespace=xxx
+// GetClusterResources lists any resource type the cluster serves, built-in
+// or custom (see GetClusterAPIResources). The resource is named by its
+// plural, "plural.group" or short name.
+// GET /api/k0s/clusters/{id}/k8s/{resource}?namespace=xxx|all&labelSelector=&fieldSelector=&limit=&continue=
 func GetClusterResources(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
 	clusterIDInt, _ := strconv.Atoi(clusterID)
 	resource := vars["resource"]
 
-	// Whitelist allowed resources
-	allowed := map[string]bool{
-		"pods": true, "deployments": true, "services": true,
-		"ingresses": true, "configmaps": true, "secrets": true,
-		"persistentvolumeclaims": true, "replicasets": true,
-		"statefulsets": true, "daemonsets": true, "jobs": true, "cronjobs": true,
-		"nodes": true, "events": true,
-	}
-	if !allowed[resource] {
-		http.Error(w, "resource not allowed", http.StatusBadRequest)
-		return
+	query := r.URL.Query()
+	namespace := query.Get("namespace")
+	listNS := namespace
+	if namespace == "all" {
+		// For "all namespaces" query, we'll fetch all but then filter for non-admin users
+		listNS = ""
 	}
 
-	namespace := r.URL.Query().Get("namespace")
-	
-	// Get current user
-	user, ok := GetUserFromContext(r.Context())
-	
-	// Non-admin users: check namespace access
-	if ok && !HasRole(user.Role, "admin") && namespace != "" && namespace != "all" && resource != "nodes" {
-		if !checkNamespaceAccess(user, clusterIDInt, namespace) {
-			http.Error(w, "access denied: namespace not assigned to user", http.StatusForbidden)
+	opts := k8sListOptions{
+		LabelSelector: query.Get("labelSelector"),
+		FieldSelector: query.Get("fieldSelector"),
+		Continue:      query.Get("continue"),
+	}
+	paged := query.Get("limit") != ""
+	if paged {
+		n, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
 			return
 		}
+		opts.Limit = n
 	}
 
-	var cmd string
-	if namespace == "" || namespace == "all" {
-		// For "all namespaces" query, we'll fetch all but then filter for non-admin users
-		cmd = fmt.Sprintf("sudo k0s kubectl get %s --all-namespaces -o json", resource)
-	} else {
-		cmd = fmt.Sprintf("sudo k0s kubectl get %s -n %s -o json", resource, namespace)
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	rs, err := c.resolveResource(r.Context(), resource)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	if !rs.Namespaced {
+		listNS = ""
+	}
+	if !resourceAccessAllowed(w, r, clusterIDInt, rs, listNS) {
+		return
 	}
 
 	log.Printf("[ClusterAdmin] cluster=%s resource=%s ns=%s", clusterID, resource, namespace)
-	out, err := clusterSSHRun(clusterID, cmd)
+	var list *k8sList
+	if paged {
+		list, err = c.listPage(r.Context(), rs, listNS, opts)
+	} else {
+		list, err = c.list(r.Context(), rs, listNS, opts)
+	}
 	if err != nil {
 		log.Printf("[ClusterAdmin] GetResources error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
 		return
 	}
 
 	// Filter results for non-admin users querying all namespaces
-	if ok && !HasRole(user.Role, "admin") && (namespace == "" || namespace == "all") && resource != "nodes" {
-		// Get assigned namespaces
-		rows, err := database.DB.Query(
-			"SELECT namespace FROM user_namespaces WHERE user_id = ? AND cluster_id = ?",
-			user.ID, clusterIDInt,
-		)
+	user, ok := GetUserFromContext(r.Context())
+	if ok && !HasRole(user.Role, "admin") && listNS == "" && rs.Namespaced {
+		assignedNS, err := assignedNamespaceSet(user, clusterIDInt)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
+		list.Items = keepAssignedItems(list.Items, assignedNS)
+	}
 
-		assignedNS := make(map[string]bool)
-		for rows.Next() {
-			var ns string
-			if err := rows.Scan(&ns); err != nil {
-				continue
-			}
-			assignedNS[ns] = true
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
 
-		// Parse and filter resources - use generic unmarshaling to preserve structure
-		var data struct {
-			Items []map[string]interface{} `json:"items"`
-		}
-		if err := json.Unmarshal([]byte(out), &data); err != nil {
-			// If we can't parse, just return the original output
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(out))
-			return
-		}
+// resolveNamedResource is the common start of the single-object handlers:
+// it resolves {resource}, defaults the namespace of namespaced kinds to
+// "default" and checks access. It writes the error response itself.
+func resolveNamedResource(w http.ResponseWriter, r *http.Request) (*k8sClient, k8sResource, string, bool) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+	clusterIDInt, _ := strconv.Atoi(clusterID)
 
-		// Filter items based on namespace
-		var filtered []map[string]interface{}
-		for _, item := range data.Items {
-			metadata, ok := item["metadata"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-			itemNS, ok := metadata["namespace"].(string)
-			if !ok {
-				// For cluster-scoped resources like nodes, include them
-				filtered = append(filtered, item)
-				continue
-			}
-			// Only include if in assigned namespaces
-			if assignedNS[itemNS] {
-				filtered = append(filtered, item)
-			}
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return nil, k8sResource{}, "", false
+	}
+	rs, err := c.resolveResource(r.Context(), vars["resource"])
+	if err != nil {
+		writeK8sError(w, err)
+		return nil, k8sResource{}, "", false
+	}
+	namespace := ""
+	if rs.Namespaced {
+		namespace = r.URL.Query().Get("namespace")
+		if namespace == "" {
+			namespace = "default"
 		}
-
-		// Re-encode filtered results
-		result := map[string]interface{}{"items": filtered}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
-		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(out))
+	if !resourceAccessAllowed(w, r, clusterIDInt, rs, namespace) {
+		return nil, k8sResource{}, "", false
+	}
+	return c, rs, namespace, true
 }
 
 // GetClusterResourceByName fetches a single resource by name
@@ -972,49 +811,90 @@ func GetClusterResources(w http.ResponseWriter, r *http.Request) {
 func GetClusterResourceByName(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
-	resource := vars["resource"]
 	name := vars["name"]
 
-	// Validate resource type
-	allowed := map[string]bool{
-		"pods": true, "deployments": true, "services": true,
-		"ingresses": true, "configmaps": true, "secrets": true,
-		"statefulsets": true, "daemonsets": true, "jobs": true,
+	c, rs, namespace, ok := resolveNamedResource(w, r)
+	if !ok {
+		return
 	}
-	if !allowed[resource] {
-		http.Error(w, "resource not allowed", http.StatusBadRequest)
+
+	log.Printf("[ClusterAdmin] GetResource: cluster=%s %s/%s ns=%s", clusterID, rs.Name, name, namespace)
+	obj, err := c.get(r.Context(), rs, namespace, name)
+	if err != nil {
+		log.Printf("[ClusterAdmin] GetResourceByName error: %v", err)
+		writeK8sError(w, err)
 		return
 	}
+	obj["apiVersion"], obj["kind"] = rs.apiVersion(), rs.Kind
 
-	namespace := r.URL.Query().Get("namespace")
-	if namespace == "" {
-		namespace = "default"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(obj)
+}
+
+// UpdateClusterResource replaces a resource with an edited copy, sent as
+// YAML or JSON. Keeping metadata.resourceVersion from the copy that was
+// read makes a concurrent change fail with 409 instead of being overwritten.
+// PUT /api/k0s/clusters/{id}/k8s/{resource}/{name}?namespace=xxx
+func UpdateClusterResource(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if ok && HasRole(user.Role, "user_k8s_view") {
+		http.Error(w, "view-only users cannot edit resources", http.StatusForbidden)
+		return
 	}
 
-	// Check user access to namespace
-	user, _ := GetUserFromContext(r.Context())
-	clusterIDint, _ := strconv.Atoi(clusterID)
-	if !HasRole(user.Role, "admin") {
-		if !checkNamespaceAccess(user, clusterIDint, namespace) {
-			http.Error(w, "Forbidden: no access to this namespace", http.StatusForbidden)
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+	name := vars["name"]
+
+	c, rs, namespace, allowed := resolveNamedResource(w, r)
+	if !allowed {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	objects, err := decodeManifestObjects(body)
+	if err != nil {
+		http.Error(w, "Invalid manifest: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(objects) != 1 {
+		http.Error(w, "exactly one object expected", http.StatusBadRequest)
+		return
+	}
+	obj := objects[0]
+	meta := nestedMap(obj, "metadata")
+	if obj["kind"] != rs.Kind || obj["apiVersion"] != rs.apiVersion() || meta == nil || meta["name"] != name {
+		http.Error(w, fmt.Sprintf("object must be %s %s/%s named %q", rs.Kind, rs.Group, rs.Version, name), http.StatusBadRequest)
+		return
+	}
+	if rs.Namespaced {
+		if ns, _ := meta["namespace"].(string); ns != "" && ns != namespace {
+			http.Error(w, "metadata.namespace does not match the namespace of the request", http.StatusBadRequest)
 			return
 		}
+		meta["namespace"] = namespace
 	}
 
-	// Get resource in JSON format
-	cmd := fmt.Sprintf("sudo k0s kubectl get %s %s -n %s -o json", resource, name, namespace)
-	log.Printf("[ClusterAdmin] GetResource: cluster=%s %s/%s ns=%s", clusterID, resource, name, namespace)
-
-	out, err := clusterSSHRun(clusterID, cmd)
+	target := rs.Name + "/" + name
+	if namespace != "" {
+		target = namespace + "/" + target
+	}
+	log.Printf("[ClusterAdmin] Update: cluster=%s %s by %s", clusterID, target, user.Username)
+	updated, err := c.update(r.Context(), rs, namespace, name, obj)
 	if err != nil {
-		log.Printf("[ClusterAdmin] GetResourceByName error: %v", err)
-		http.Error(w, "Resource not found or error fetching", http.StatusNotFound)
+		log.Printf("[ClusterAdmin] UpdateResource error: %v", err)
+		recordActivityLog("k8s_resource_update", "cluster "+clusterID+": "+target, err.Error(), "error")
+		writeK8sError(w, err)
 		return
 	}
+	recordActivityLog("k8s_resource_update", "cluster "+clusterID+": "+target, "updated by "+user.Username, "success")
 
-	// Return as raw JSON
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(out))
+	json.NewEncoder(w).Encode(updated)
 }
 
 // DeleteClusterResource deletes a k8s resource
@@ -1029,31 +909,17 @@ func DeleteClusterResource(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
-	resource := vars["resource"]
 	name := vars["name"]
 
-	allowed := map[string]bool{
-		"pods": true, "deployments": true, "services": true,
-		"ingresses": true, "configmaps": true, "secrets": true,
-		"statefulsets": true, "daemonsets": true, "jobs": true,
-	}
-	if !allowed[resource] {
-		http.Error(w, "resource not allowed", http.StatusBadRequest)
+	c, rs, namespace, allowed := resolveNamedResource(w, r)
+	if !allowed {
 		return
 	}
 
-	namespace := r.URL.Query().Get("namespace")
-	if namespace == "" {
-		namespace = "default"
-	}
-
-	cmd := fmt.Sprintf("sudo k0s kubectl delete %s %s -n %s", resource, name, namespace)
-	log.Printf("[ClusterAdmin] Delete: cluster=%s %s/%s ns=%s", clusterID, resource, name, namespace)
-
-	_, err := clusterSSHRun(clusterID, cmd)
-	if err != nil {
+	log.Printf("[ClusterAdmin] Delete: cluster=%s %s/%s ns=%s", clusterID, rs.Name, name, namespace)
+	if err := c.delete(r.Context(), rs, namespace, name); err != nil {
 		log.Printf("[ClusterAdmin] DeleteResource error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
 		return
 	}
 
@@ -1062,7 +928,7 @@ func DeleteClusterResource(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetResourceLogs returns logs for a pod
-// GET /api/k0s/clusters/{id}/k8s/pods/{name}/logs?namespace=xxx&container=xxx
+// GET /api/k0s/clusters/{id}/k8s/pods/{name}/logs?namespace=xxx&container=xxx&tailLines=N&previous=true&since=10m
 func GetResourceLogs(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
@@ -1072,30 +938,29 @@ func GetResourceLogs(w http.ResponseWriter, r *http.Request) {
 	if namespace == "" {
 		namespace = "default"
 	}
-	container := r.URL.Query().Get("container")
-	tailLines := r.URL.Query().Get("tailLines")
-
-	tail := "--tail=500"
-	if tailLines == "0" {
-		tail = "" // no limit
-	} else if tailLines != "" {
-		tail = "--tail=" + tailLines
+	if !logNamespaceAllowed(w, r, namespace) {
+		return
 	}
-
-	cmd := fmt.Sprintf("sudo k0s kubectl logs %s -n %s %s", podName, namespace, tail)
-	if container != "" {
-		cmd += " -c " + container
+	q, err := podLogQuery(r.URL.Query(), 500)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	out, err := clusterSSHRun(clusterID, cmd)
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	out, err := c.podLogs(r.Context(), namespace, podName, q)
 	if err != nil {
 		log.Printf("[ClusterAdmin] GetLogs error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
-	w.Write([]byte(out))
+	w.Write(out)
 }
 
 // GetClusterInfo returns basic cluster info
@@ -1104,46 +969,43 @@ func GetClusterInfo(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
 
-	countItems := func(cmd string) string {
-		out, err := clusterSSHRun(clusterID, cmd)
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	version, err := c.serverVersion(r.Context())
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	countItems := func(resource string) string {
+		n, err := c.count(r.Context(), mustK8sResource(resource), "", k8sListOptions{})
 		if err != nil {
+			log.Printf("[ClusterAdmin] GetClusterInfo: counting %s: %v", resource, err)
 			return "0"
 		}
-		var list struct {
-			Items []json.RawMessage `json:"items"`
-		}
-		if parseErr := json.Unmarshal([]byte(out), &list); parseErr != nil {
-			return "0"
-		}
-		return strconv.Itoa(len(list.Items))
+		return strconv.Itoa(n)
 	}
 
-	version, _ := clusterSSHRun(clusterID, "sudo k0s kubectl version --client -o json")
-	// Parse version from JSON, fallback to raw
-	var vInfo struct {
-		ClientVersion struct{ GitVersion string `json:"gitVersion"` } `json:"clientVersion"`
-	}
-	vStr := strings.TrimSpace(version)
-	if json.Unmarshal([]byte(version), &vInfo) == nil && vInfo.ClientVersion.GitVersion != "" {
-		vStr = vInfo.ClientVersion.GitVersion
-	}
-
-	nodeCount := countItems("sudo k0s kubectl get nodes -o json")
-	nsCount := countItems("sudo k0s kubectl get namespaces -o json")
-	podCount := countItems("sudo k0s kubectl get pods --all-namespaces -o json")
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"version":    vStr,
-		"node_count": nodeCount,
-		"ns_count":   nsCount,
-		"pod_count":  podCount,
+		"version":    version,
+		"node_count": countItems("nodes"),
+		"ns_count":   countItems("namespaces"),
+		"pod_count":  countItems("pods"),
 	})
 }
 
-// ApplyClusterResource applies a YAML manifest via kubectl apply -f -
-// POST /api/k0s/clusters/{id}/k8s/apply   body: {"yaml":"..."}
-// Also saves the YAML to local yaml/ folder for reference
+// ApplyClusterResource server-side applies a YAML manifest (one or more
+// documents) as the "docker-manager" field manager. Every object is
+// resolved and checked first, so nothing is applied when a document is
+// invalid or, for non-admins, outside the user's namespaces. With dry_run
+// the API server validates each object and the response carries the diff
+// against the live objects instead. Errors name the document and line they
+// refer to; applied manifests are recorded in the cluster's apply history.
+// POST /api/k0s/clusters/{id}/k8s/apply   body: {"yaml":"...","namespace":"default","dry_run":false}
 func ApplyClusterResource(w http.ResponseWriter, r *http.Request) {
 	// Check user role - view role cannot apply/create
 	user, ok := GetUserFromContext(r.Context())
@@ -1154,267 +1016,180 @@ func ApplyClusterResource(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
+	clusterIDInt, _ := strconv.Atoi(clusterID)
 
 	var body struct {
-		YAML string `json:"yaml"`
+		YAML      string `json:"yaml"`
+		Namespace string `json:"namespace"`
+		DryRun    bool   `json:"dry_run"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		log.Printf("[ApplyClusterResource] âœ— DECODE ERROR - cluster=%s user=%s error=%v", clusterID, user.Username, err)
+		log.Printf("[ApplyClusterResource] DECODE ERROR - cluster=%s user=%s error=%v", clusterID, user.Username, err)
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	if strings.TrimSpace(body.YAML) == "" {
-		log.Printf("[ApplyClusterResource] âœ— EMPTY YAML - cluster=%s user=%s", clusterID, user.Username)
+		log.Printf("[ApplyClusterResource] EMPTY YAML - cluster=%s user=%s", clusterID, user.Username)
 		http.Error(w, "YAML body is empty", http.StatusBadRequest)
 		return
 	}
+	defaultNS := body.Namespace
+	if defaultNS == "" {
+		defaultNS = "default"
+	}
+
+	docs, err := parseManifestDocuments([]byte(body.YAML))
+	if err != nil {
+		http.Error(w, "Invalid manifest: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !body.DryRun && !admitManifest(w, r, "k8s_apply", clusterIDInt, defaultNS, []byte(body.YAML)) {
+		return
+	}
 
-	// Log incoming YAML (first 300 chars for debugging)
-	yamlPreview := body.YAML
-	if len(yamlPreview) > 300 {
-		yamlPreview = yamlPreview[:300] + "..."
-	}
-	log.Printf("[ApplyClusterResource] â–¶ START - cluster=%s user=%s\n%s", clusterID, user.Username, yamlPreview)
-
-	// === SAVE YAML TO LOCAL FOLDER ===
-	// Create yaml folder if it doesn't exist
-	yamlDir := "yaml"
-	if _, err := os.Stat(yamlDir); os.IsNotExist(err) {
-		os.MkdirAll(yamlDir, 0755)
-		log.Printf("[ApplyClusterResource] Created yaml directory: %s", yamlDir)
-	}
-
-	// Generate filename with timestamp
-	timestamp := time.Now().Format("20060102_150405")
-	localYamlFile := fmt.Sprintf("%s/resource_%s_cluster%s.yaml", yamlDir, timestamp, clusterID)
-	
-	// Save YAML to local file
-	if err := os.WriteFile(localYamlFile, []byte(body.YAML), 0644); err != nil {
-		log.Printf("[ApplyClusterResource] âœ— SAVE ERROR - failed to save YAML: %v", err)
-		http.Error(w, "Failed to save YAML file: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	log.Printf("[ApplyClusterResource] âœ“ SAVED - YAML saved to: %s", localYamlFile)
-
-	// Base64-encode to avoid shell-escaping issues
-	encoded := base64.StdEncoding.EncodeToString([]byte(body.YAML))
-	
-	// Create a script that saves YAML to remote file, tests connection, applies, and debugs
-	installAndApplyScript := fmt.Sprintf(`#!/bin/bash
-set -e
-
-KUBECTL_CMD=""
-YAML_DIR="/var/lib/docker-manager/yaml"
-YAML_FILE=""
-
-# Create YAML directory if it doesn't exist
-echo "[INFO] Creating YAML directory..."
-if sudo -n true 2>/dev/null; then
-    sudo mkdir -p "${YAML_DIR}"
-    sudo chmod 755 "${YAML_DIR}"
-else
-    mkdir -p ~/.local/yaml
-    YAML_DIR="$HOME/.local/yaml"
-fi
-
-# Generate filename with timestamp
-TIMESTAMP=$(date +%%Y%%m%%d_%%H%%M%%S)
-YAML_FILENAME="${YAML_DIR}/resource_${TIMESTAMP}.yaml"
-
-# Check if k0s kubectl exists (preferred)
-if command -v k0s &> /dev/null; then
-    echo "[INFO] Using k0s kubectl"
-    KUBECTL_CMD="sudo k0s kubectl"
-# Check if kubectl exists
-elif command -v kubectl &> /dev/null; then
-    echo "[INFO] Using kubectl"
-    KUBECTL_CMD="kubectl"
-else
-    echo "[INFO] kubectl not found, installing..."
-    
-    # Try to install kubectl
-    KUBECTL_VERSION=$(curl -s -L https://dl.k8s.io/release/stable.txt)
-    KUBECTL_URL="https://dl.k8s.io/release/${KUBECTL_VERSION}/bin/linux/amd64/kubectl"
-    
-    echo "[INFO] Downloading kubectl from ${KUBECTL_URL}"
-    # Download to /tmp
-    curl -L -o /tmp/kubectl "${KUBECTL_URL}"
-    chmod +x /tmp/kubectl
-    
-    # Try to move to /usr/local/bin with sudo, fallback to ~/.local/bin
-    if sudo -n true 2>/dev/null; then
-        sudo mv /tmp/kubectl /usr/local/bin/kubectl
-        echo "[INFO] kubectl installed to /usr/local/bin"
-        KUBECTL_CMD="kubectl"
-    else
-        mkdir -p ~/.local/bin
-        mv /tmp/kubectl ~/.local/bin/kubectl
-        export PATH="$HOME/.local/bin:$PATH"
-        echo "[INFO] kubectl installed to ~/.local/bin"
-        KUBECTL_CMD="kubectl"
-    fi
-fi
-
-# Check version
-echo "[INFO] Using command: ${KUBECTL_CMD}"
-${KUBECTL_CMD} version --client=true || echo "[WARN] Could not get client version"
-
-# Test connection to Kubernetes cluster
-echo "[INFO] Testing connection to Kubernetes cluster..."
-if ${KUBECTL_CMD} cluster-info &>/dev/null; then
-    echo "[âœ“] Successfully connected to Kubernetes cluster"
-else
-    echo "[âœ—] Failed to connect to Kubernetes cluster"
-    echo "[INFO] Checking kubeconfig..."
-    ${KUBECTL_CMD} config view || echo "[WARN] Could not display kubeconfig"
-    exit 1
-fi
-
-# Get cluster info
-echo "[INFO] Cluster info:"
-${KUBECTL_CMD} cluster-info
-
-# Test API server connectivity
-echo "[INFO] Testing API server..."
-if ${KUBECTL_CMD} api-resources &>/dev/null; then
-    echo "[âœ“] API server is accessible"
-else
-    echo "[âœ—] Could not access API server"
-    exit 1
-fi
-
-# Save YAML to file
-echo "[INFO] Saving YAML to remote server: ${YAML_FILENAME}..."
-echo '%s' | base64 -d > "${YAML_FILENAME}"
-echo "[âœ“] YAML saved to: ${YAML_FILENAME}"
-echo "[INFO] YAML content:"
-echo "---"
-cat "${YAML_FILENAME}"
-echo "---"
-
-# Apply the YAML with --validate=false to skip OpenAPI schema validation
-echo ""
-echo "â•”â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•—"
-echo "â•‘ APPLYING RESOURCE                                              â•‘"
-echo "â•šâ•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•"
-APPLY_OUTPUT=$(${KUBECTL_CMD} apply -f "${YAML_FILENAME}" --validate=false 2>&1)
-APPLY_EXITCODE=$?
-echo "${APPLY_OUTPUT}"
-
-# Extract namespace and resource type/name from YAML for debugging
-NAMESPACE=$(grep -E "^  namespace:" "${YAML_FILENAME}" | head -1 | awk '{print $NF}' || echo "default")
-KIND=$(grep -E "^kind:" "${YAML_FILENAME}" | head -1 | awk '{print $NF}' || echo "unknown")
-NAME=$(grep -E "^  name:" "${YAML_FILENAME}" | head -1 | awk '{print $NF}' || echo "unknown")
-
-echo ""
-echo "Extracted Info: namespace=${NAMESPACE}, kind=${KIND}, name=${NAME}"
-
-# Debug: Only run if apply was successful or if it's a deployment
-if [ "${KIND}" = "Deployment" ] || [ "${APPLY_EXITCODE}" -eq 0 ]; then
-    echo ""
-    echo "â•”â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•—"
-    echo "â•‘ DEBUGGING: Resource Status & Logs                             â•‘"
-    echo "â•šâ•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•"
-    
-    # Wait a bit for resource to start
-    sleep 2
-    
-    # 1. Check Deployment/Pod Status
-    if [ "${KIND}" = "Deployment" ]; then
-        echo ""
-        echo "â”â”â” DEPLOYMENT STATUS â”â”â”"
-        ${KUBECTL_CMD} get deployment -n "${NAMESPACE}" "${NAME}" -o wide 2>/dev/null || echo "[WARN] Could not get deployment"
-        
-        echo ""
-        echo "â”â”â” DEPLOYMENT DESCRIBE â”â”â”"
-        ${KUBECTL_CMD} describe deployment -n "${NAMESPACE}" "${NAME}" 2>/dev/null || echo "[WARN] Could not describe deployment"
-        
-        # Get replica sets
-        echo ""
-        echo "â”â”â” REPLICA SETS â”â”â”"
-        ${KUBECTL_CMD} get replicasets -n "${NAMESPACE}" -l app="${NAME}" 2>/dev/null || echo "[WARN] Could not get replicasets"
-    fi
-    
-    # 2. Check Pods Status
-    echo ""
-    echo "â”â”â” POD STATUS â”â”â”"
-    POD_OUTPUT=$(${KUBECTL_CMD} get pods -n "${NAMESPACE}" -l app="${NAME}" -o wide 2>/dev/null)
-    if [ -n "${POD_OUTPUT}" ]; then
-        echo "${POD_OUTPUT}"
-        
-        # Get first pod name for detailed debugging
-        POD_NAME=$(echo "${POD_OUTPUT}" | tail -1 | awk '{print $1}')
-        
-        if [ -n "${POD_NAME}" ] && [ "${POD_NAME}" != "NAME" ]; then
-            echo ""
-            echo "â”â”â” POD DESCRIBE (${POD_NAME}) â”â”â”"
-            ${KUBECTL_CMD} describe pod -n "${NAMESPACE}" "${POD_NAME}" 2>/dev/null || echo "[WARN] Could not describe pod"
-            
-            echo ""
-            echo "â”â”â” POD LOGS (${POD_NAME}) â”â”â”"
-            ${KUBECTL_CMD} logs -n "${NAMESPACE}" "${POD_NAME}" --tail=50 2>/dev/null || echo "[WARN] Could not get pod logs"
-            
-            echo ""
-            echo "â”â”â” POD EVENTS (${POD_NAME}) â”â”â”"
-            ${KUBECTL_CMD} get events -n "${NAMESPACE}" --field-selector involvedObject.name="${POD_NAME}" 2>/dev/null || echo "[WARN] Could not get pod events"
-        fi
-    else
-        echo "[âš ] No pods found for app=${NAME}"
-    fi
-    
-    # 3. Check Namespace Events
-    echo ""
-    echo "â”â”â” NAMESPACE EVENTS (Recent) â”â”â”"
-    ${KUBECTL_CMD} get events -n "${NAMESPACE}" --sort-by='.lastTimestamp' 2>/dev/null | tail -10 || echo "[WARN] Could not get namespace events"
-    
-    # 4. Check Resource Quota
-    echo ""
-    echo "â”â”â” RESOURCE QUOTA â”â”â”"
-    QUOTA_OUTPUT=$(${KUBECTL_CMD} describe resourcequota -n "${NAMESPACE}" 2>/dev/null)
-    if [ -n "${QUOTA_OUTPUT}" ]; then
-        echo "${QUOTA_OUTPUT}"
-    else
-        echo "[INFO] No resource quotas found in namespace"
-    fi
-    
-    # 5. Check Namespace Resource Usage
-    echo ""
-    echo "â”â”â” NAMESPACE RESOURCE USAGE â”â”â”"
-    echo "Running Pods in namespace ${NAMESPACE}:"
-    ${KUBECTL_CMD} get pods -n "${NAMESPACE}" --all-containers=true 2>/dev/null | head -20 || echo "[WARN] Could not get pod list"
-    
-    # 6. Check RBAC if applicable
-    echo ""
-    echo "â”â”â” SERVICE ACCOUNT INFO â”â”â”"
-    SA=$(grep -E "serviceAccountName:" "${YAML_FILENAME}" | head -1 | awk '{print $NF}' || echo "default")
-    ${KUBECTL_CMD} get serviceaccount -n "${NAMESPACE}" "${SA}" -o yaml 2>/dev/null || echo "[INFO] Using default service account"
-fi
-
-echo ""
-echo "â•”â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•—"
-echo "â•‘ SUCCESS - Resource applied and saved                           â•‘"
-echo "â•‘ Saved to: ${YAML_FILENAME}                                    â•‘"
-echo "â•šâ•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•â•"
-`, encoded)
-
-	// Write script to /tmp and execute it
-	cmd := fmt.Sprintf("cat > /tmp/install_and_apply.sh << 'SCRIPT_EOF'\n%s\nSCRIPT_EOF\nchmod +x /tmp/install_and_apply.sh && /tmp/install_and_apply.sh", installAndApplyScript)
-
-	log.Printf("[ApplyClusterResource] Running kubectl apply with comprehensive debugging on cluster %s", clusterID)
-	output, err := clusterSSHRun(clusterID, cmd)
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		log.Printf("[ApplyClusterResource] âœ— SSH ERROR - cluster=%s error=%v\nOutput: %s", clusterID, err, output)
-		http.Error(w, "Failed to apply resource. Error: "+err.Error()+"\n\n--- DEBUG OUTPUT ---\n"+output, http.StatusInternalServerError)
+		writeK8sError(w, err)
+		return
+	}
+
+	var assigned map[string]bool
+	restricted := ok && !HasRole(user.Role, "admin")
+	if restricted {
+		if assigned, err = assignedNamespaceSet(user, clusterIDInt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	prepared := make([]preparedK8sObject, len(docs))
+	refs := make([]string, len(docs))
+	var issues []manifestIssue
+	status := 0
+	for i, doc := range docs {
+		p, err := prepareK8sObject(r.Context(), c, doc.Object, defaultNS)
+		prepared[i], refs[i] = p, p.ref
+		if err != nil {
+			issues = append(issues, manifestIssues(doc, p.ref, err)...)
+			if status == 0 {
+				status = k8sErrorCode(err)
+			}
+			continue
+		}
+		if !restricted {
+			continue
+		}
+		if !p.rs.Namespaced {
+			issues = append(issues, manifestIssue{Document: doc.Index, Line: doc.Line, Object: p.ref,
+				Message: "cluster-scoped resources require the admin role"})
+			status = http.StatusForbidden
+		} else if !assigned[p.namespace] {
+			line := yamlPathLine(doc.Node, "metadata.namespace")
+			if line == 0 {
+				line = doc.Line
+			}
+			issues = append(issues, manifestIssue{Document: doc.Index, Line: line, Object: p.ref, Field: "metadata.namespace",
+				Message: fmt.Sprintf("namespace %q is not assigned to you", p.namespace)})
+			status = http.StatusForbidden
+		}
+	}
+	if len(issues) > 0 {
+		log.Printf("[ApplyClusterResource] REJECTED - cluster=%s user=%s\n%s", clusterID, user.Username, joinManifestIssues(issues))
+		http.Error(w, "Manifest rejected:\n"+joinManifestIssues(issues), status)
+		return
+	}
+
+	if body.DryRun {
+		type dryRunObject struct {
+			Document  int    `json:"document"`
+			Line      int    `json:"line"`
+			Object    string `json:"object"`
+			Namespace string `json:"namespace,omitempty"`
+			Action    string `json:"action"` // created, configured, unchanged
+			Diff      string `json:"diff"`
+		}
+		results := make([]dryRunObject, 0, len(prepared))
+		pendingNS := map[string]bool{}
+		var output []string
+		var diff strings.Builder
+		for i, p := range prepared {
+			action, d, err := dryRunK8sObject(r.Context(), c, p, pendingNS)
+			if err != nil {
+				issues = append(issues, manifestIssues(docs[i], p.ref, err)...)
+				if status == 0 {
+					status = k8sErrorCode(err)
+				}
+				continue
+			}
+			if p.rs.Group == "" && p.rs.Kind == "Namespace" && action == "created" {
+				pendingNS[p.name] = true
+			}
+			results = append(results, dryRunObject{Document: docs[i].Index, Line: docs[i].Line, Object: p.ref,
+				Namespace: p.namespace, Action: action, Diff: d})
+			output = append(output, p.ref+" "+action+" (server dry run)")
+			diff.WriteString(d)
+		}
+		if len(issues) > 0 {
+			http.Error(w, "Dry run failed:\n"+joinManifestIssues(issues), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"dry_run": true,
+			"output":  strings.Join(output, "\n"),
+			"diff":    diff.String(),
+			"objects": results,
+		})
 		return
 	}
 
-	log.Printf("[ApplyClusterResource] âœ“ SUCCESS - cluster=%s\nLocal file: %s\nOutput:\n%s", clusterID, localYamlFile, output)
+	var output []string
+	var applyErr error
+	applied := 0
+	for i, p := range prepared {
+		if _, err := c.apply(r.Context(), p.rs, p.namespace, p.name, p.obj, false); err != nil {
+			applyErr = err
+			issues = manifestIssues(docs[i], p.ref, err)
+			output = append(output, "Error from server: "+joinManifestIssues(issues))
+			break
+		}
+		applied++
+		output = append(output, p.ref+" serverside-applied")
+	}
+
+	result := "success"
+	if applyErr != nil {
+		result = "failed"
+		if applied > 0 {
+			result = "partial"
+		}
+	}
+	version := recordApplyHistory(ApplyHistoryEntry{
+		ClusterID:        clusterIDInt,
+		Username:         user.Username,
+		DefaultNamespace: defaultNS,
+		Manifest:         body.YAML,
+		Objects:          strings.Join(refs, "\n"),
+		Status:           result,
+		Output:           strings.Join(output, "\n"),
+	})
+
+	if applyErr != nil {
+		log.Printf("[ApplyClusterResource] ERROR - cluster=%s user=%s version=%d\n%s", clusterID, user.Username, version, strings.Join(output, "\n"))
+		http.Error(w, "Failed to apply resource. Error: "+joinManifestIssues(issues)+"\n\n--- OUTPUT ---\n"+strings.Join(output, "\n"), k8sErrorCode(applyErr))
+		return
+	}
+
+	log.Printf("[ApplyClusterResource] SUCCESS - cluster=%s user=%s version=%d\n%s",
+		clusterID, user.Username, version, strings.Join(output, "\n"))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":        true,
-		"local_yaml_file": localYamlFile,
-		"output":         output,
+		"success": true,
+		"version": version,
+		"output":  strings.Join(output, "\n"),
+		"objects": refs,
 	})
 }
 
@@ -1438,11 +1213,15 @@ func GetPodDescribe(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	cmd := fmt.Sprintf("sudo k0s kubectl describe pod %s -n %s", podName, namespace)
-	output, err := clusterSSHRun(clusterID, cmd)
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	output, err := describePod(r.Context(), c, namespace, podName)
 	if err != nil {
 		log.Printf("[GetPodDescribe] Error: cluster=%s pod=%s ns=%s error=%v", clusterID, podName, namespace, err)
-		http.Error(w, "Failed to describe pod: "+err.Error(), http.StatusNotFound)
+		writeK8sError(w, err)
 		return
 	}
 
@@ -1474,21 +1253,16 @@ func sanitizeSAName(name string) string {
 	return result
 }
 
-// applyYAMLViaKubeconfig writes yamlContent to a temp file and runs kubectl apply.
-func applyYAMLViaKubeconfig(kubeconfigPath, yamlContent string) error {
-	tmpYAML, err := os.CreateTemp("", "k8s-manifest-*.yaml")
+// applyK8sManifest applies the objects of a YAML manifest.
+func applyK8sManifest(ctx context.Context, c *k8sClient, manifest string) error {
+	objects, err := decodeManifestObjects([]byte(manifest))
 	if err != nil {
-		return fmt.Errorf("create temp yaml: %v", err)
-	}
-	defer os.Remove(tmpYAML.Name())
-	if _, err := tmpYAML.WriteString(yamlContent); err != nil {
-		tmpYAML.Close()
 		return err
 	}
-	tmpYAML.Close()
-	out, err := kubectlRun(kubeconfigPath, "apply", "-f", tmpYAML.Name())
-	if err != nil {
-		return fmt.Errorf("kubectl apply: %v — %s", err, out)
+	for _, obj := range objects {
+		if ref, err := applyK8sObject(ctx, c, obj, "default"); err != nil {
+			return fmt.Errorf("%s: %v", ref, err)
+		}
 	}
 	return nil
 }
@@ -1551,8 +1325,8 @@ users:
 
 // ensureCustomClusterRoles applies the two managed ClusterRoles to the cluster.
 // These define the exact permissions for dm-k8s-view and dm-k8s-full users.
-// Using kubectl apply so it is safe to call multiple times (idempotent).
-func ensureCustomClusterRoles(kubeconfigPath string) {
+// Server-side apply makes it safe to call multiple times (idempotent).
+func ensureCustomClusterRoles(ctx context.Context, c *k8sClient) {
 	viewRole := `apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRole
 metadata:
@@ -1589,7 +1363,7 @@ rules:
   verbs: ["get"]
 - apiGroups: [""]
   resources: ["pods/exec", "pods/portforward"]
-  verbs: ["create"]
+  verbs: ["get", "create"]
 - apiGroups: [""]
   resources: ["services", "configmaps", "secrets", "persistentvolumeclaims"]
   verbs: ["get", "list", "watch", "create", "update", "patch", "delete"]
@@ -1610,7 +1384,7 @@ rules:
   verbs: ["get", "list", "watch", "create", "update", "patch", "delete"]
 `
 	for name, yaml := range map[string]string{"dm-k8s-view": viewRole, "dm-k8s-full": fullRole} {
-		if err := applyYAMLViaKubeconfig(kubeconfigPath, yaml); err != nil {
+		if err := applyK8sManifest(ctx, c, yaml); err != nil {
 			log.Printf("[RBAC] Warning: could not apply ClusterRole %s: %v", name, err)
 		}
 	}
@@ -1620,14 +1394,14 @@ rules:
 // all newNamespaces and deletes RoleBindings for removedNamespaces.
 // It is called automatically when namespace assignments change so the existing
 // kubeconfig stays valid without requiring a re-download.
-func SyncUserRBAC(adminKC, targetUsername, targetRole string, newNamespaces []string, removedNamespaces []string) error {
-	tmpKC, err := os.CreateTemp("", "admin-kc-sync-*.yaml")
+func SyncUserRBAC(clusterID, targetUsername, targetRole string, newNamespaces []string, removedNamespaces []string) error {
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		return fmt.Errorf("temp file: %v", err)
+		return err
 	}
-	defer os.Remove(tmpKC.Name())
-	tmpKC.WriteString(adminKC)
-	tmpKC.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	roleBindings := mustK8sResource("rolebindings")
 
 	saName := "dm-" + sanitizeSAName(targetUsername)
 
@@ -1645,7 +1419,7 @@ metadata:
   labels:
     app.kubernetes.io/managed-by: docker-manager
 `, saName, saNs)
-	if err := applyYAMLViaKubeconfig(tmpKC.Name(), saYAML); err != nil {
+	if err := applyK8sManifest(ctx, c, saYAML); err != nil {
 		return fmt.Errorf("SA apply: %v", err)
 	}
 
@@ -1662,7 +1436,7 @@ metadata:
     app.kubernetes.io/managed-by: docker-manager
 type: kubernetes.io/service-account-token
 `, secretName, saNs, saName)
-	if err := applyYAMLViaKubeconfig(tmpKC.Name(), secretYAML); err != nil {
+	if err := applyK8sManifest(ctx, c, secretYAML); err != nil {
 		log.Printf("[SyncUserRBAC] Warning: Secret apply: %v", err)
 	}
 
@@ -1685,12 +1459,12 @@ roleRef:
   name: cluster-admin
   apiGroup: rbac.authorization.k8s.io
 `, saName, saName, saNs)
-		if err := applyYAMLViaKubeconfig(tmpKC.Name(), crbYAML); err != nil {
+		if err := applyK8sManifest(ctx, c, crbYAML); err != nil {
 			log.Printf("[SyncUserRBAC] Warning: ClusterRoleBinding: %v", err)
 		}
 	} else {
 		// Ensure our custom ClusterRoles exist in the cluster
-		ensureCustomClusterRoles(tmpKC.Name())
+		ensureCustomClusterRoles(ctx, c)
 
 		clusterRoleName := "dm-k8s-view"
 		if isFullRole {
@@ -1701,7 +1475,9 @@ roleRef:
 		// so a role change (view→full) is picked up immediately.
 		for _, ns := range newNamespaces {
 			rbName := fmt.Sprintf("dm-%s-binding", saName)
-			kubectlRun(tmpKC.Name(), "delete", "rolebinding", rbName, "-n", ns, "--ignore-not-found") //nolint:errcheck
+			if err := c.delete(ctx, roleBindings, ns, rbName); err != nil && !isK8sNotFound(err) {
+				log.Printf("[SyncUserRBAC] Warning: delete RoleBinding ns=%s: %v", ns, err)
+			}
 			rbYAML := fmt.Sprintf(`apiVersion: rbac.authorization.k8s.io/v1
 kind: RoleBinding
 metadata:
@@ -1718,14 +1494,13 @@ roleRef:
   name: %s
   apiGroup: rbac.authorization.k8s.io
 `, rbName, ns, saName, saNs, clusterRoleName)
-			if err := applyYAMLViaKubeconfig(tmpKC.Name(), rbYAML); err != nil {
+			if err := applyK8sManifest(ctx, c, rbYAML); err != nil {
 				log.Printf("[SyncUserRBAC] Warning: RoleBinding ns=%s: %v", ns, err)
 			}
 		}
 		// Delete RoleBindings for namespaces that were removed
 		for _, ns := range removedNamespaces {
-			if _, delErr := kubectlRun(tmpKC.Name(), "delete", "rolebinding",
-				fmt.Sprintf("dm-%s-binding", saName), "-n", ns, "--ignore-not-found"); delErr != nil {
+			if delErr := c.delete(ctx, roleBindings, ns, fmt.Sprintf("dm-%s-binding", saName)); delErr != nil && !isK8sNotFound(delErr) {
 				log.Printf("[SyncUserRBAC] Warning: delete RoleBinding ns=%s: %v", ns, delErr)
 			}
 		}
@@ -1758,15 +1533,7 @@ func TriggerRBACSync(userID string, clusterID int, newNamespaces []string, remov
 		return
 	}
 
-	var storedKC sql.NullString
-	if err := database.DB.QueryRow(
-		"SELECT kubeconfig FROM k0s_clusters WHERE id = ?", clusterID,
-	).Scan(&storedKC); err != nil || !storedKC.Valid || storedKC.String == "" {
-		log.Printf("[RBACSync] No kubeconfig for cluster %d — skipping RBAC sync", clusterID)
-		return
-	}
-
-	if err := SyncUserRBAC(storedKC.String, username, role, newNamespaces, removedNamespaces); err != nil {
+	if err := SyncUserRBAC(strconv.Itoa(clusterID), username, role, newNamespaces, removedNamespaces); err != nil {
 		log.Printf("[RBACSync] Error syncing RBAC for user %s: %v", username, err)
 	}
 }
@@ -1775,14 +1542,13 @@ func TriggerRBACSync(userID string, clusterID int, newNamespaces []string, remov
 // Called when the user's role changes so RoleBindings immediately reflect the new permissions.
 type rbacSyncEntry struct {
 	clusterID  int
-	kubeconfig string
 	namespaces []string
 }
 
 func TriggerRBACResyncForUser(userID, newRole string) {
 	// Collect all data in one DB transaction block, then release the connection
-	// before running kubectl (which can take several seconds). This prevents the
-	// single SQLite connection from being held during kubectl, which would block
+	// before calling the Kubernetes API (which can take several seconds). This prevents the
+	// single SQLite connection from being held during those calls, which would block
 	// concurrent API calls such as ListUsers.
 	var username string
 	if err := database.DB.QueryRow(
@@ -1812,12 +1578,6 @@ func TriggerRBACResyncForUser(userID, newRole string) {
 	rows.Close()
 
 	for _, clusterID := range clusterIDs {
-		var storedKC sql.NullString
-		if err := database.DB.QueryRow(
-			"SELECT kubeconfig FROM k0s_clusters WHERE id = ?", clusterID,
-		).Scan(&storedKC); err != nil || !storedKC.Valid || storedKC.String == "" {
-			continue
-		}
 		nsRows, err := database.DB.Query(
 			"SELECT namespace FROM user_namespaces WHERE user_id = ? AND cluster_id = ?",
 			userID, clusterID,
@@ -1832,14 +1592,14 @@ func TriggerRBACResyncForUser(userID, newRole string) {
 			namespaces = append(namespaces, ns)
 		}
 		nsRows.Close()
-		entries = append(entries, rbacSyncEntry{clusterID: clusterID, kubeconfig: storedKC.String, namespaces: namespaces})
+		entries = append(entries, rbacSyncEntry{clusterID: clusterID, namespaces: namespaces})
 	}
 
-	// --- Phase 2: run kubectl operations with no DB connection held ---
+	// --- Phase 2: call the Kubernetes API with no DB connection held ---
 	for _, e := range entries {
 		log.Printf("[RBACResync] Re-syncing cluster %d for user %s (new role: %s)",
 			e.clusterID, username, newRole)
-		if err := SyncUserRBAC(e.kubeconfig, username, newRole, e.namespaces, nil); err != nil {
+		if err := SyncUserRBAC(strconv.Itoa(e.clusterID), username, newRole, e.namespaces, nil); err != nil {
 			log.Printf("[RBACResync] Error cluster %d user %s: %v", e.clusterID, username, err)
 		}
 	}
@@ -1849,15 +1609,13 @@ func TriggerRBACResyncForUser(userID, newRole string) {
 // in the cluster and returns the resulting kubeconfig YAML string.
 // adminKC is the raw admin kubeconfig content. namespaces is the list of namespaces
 // the user is allowed to access (empty = no RoleBinding, SA only).
-func generateSAKubeconfigContent(adminKC, targetUsername, targetRole string, namespaces []string) (string, error) {
-	// Write admin kubeconfig to a temp file for kubectl operations
-	tmpKC, err := os.CreateTemp("", "admin-kc-*.yaml")
+func generateSAKubeconfigContent(clusterID, targetUsername, targetRole string, namespaces []string) (string, error) {
+	c, err := newK8sClient(clusterID)
 	if err != nil {
-		return "", fmt.Errorf("unable to create temp file: %v", err)
+		return "", err
 	}
-	defer os.Remove(tmpKC.Name())
-	tmpKC.WriteString(adminKC)
-	tmpKC.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
 
 	// Sanitize ServiceAccount name: dm-<username>
 	saName := "dm-" + sanitizeSAName(targetUsername)
@@ -1868,7 +1626,7 @@ func generateSAKubeconfigContent(adminKC, targetUsername, targetRole string, nam
 	// reference it by namespace, so this SA must never move.
 	saNs := "default"
 
-	// Apply ServiceAccount (idempotent via kubectl apply)
+	// Apply ServiceAccount (idempotent via server-side apply)
 	saYAML := fmt.Sprintf(`apiVersion: v1
 kind: ServiceAccount
 metadata:
@@ -1877,7 +1635,7 @@ metadata:
   labels:
     app.kubernetes.io/managed-by: docker-manager
 `, saName, saNs)
-	if err := applyYAMLViaKubeconfig(tmpKC.Name(), saYAML); err != nil {
+	if err := applyK8sManifest(ctx, c, saYAML); err != nil {
 		return "", fmt.Errorf("creating ServiceAccount: %v", err)
 	}
 
@@ -1894,7 +1652,7 @@ metadata:
     app.kubernetes.io/managed-by: docker-manager
 type: kubernetes.io/service-account-token
 `, secretName, saNs, saName)
-	if err := applyYAMLViaKubeconfig(tmpKC.Name(), secretYAML); err != nil {
+	if err := applyK8sManifest(ctx, c, secretYAML); err != nil {
 		return "", fmt.Errorf("creating token secret: %v", err)
 	}
 
@@ -1918,17 +1676,19 @@ roleRef:
   name: cluster-admin
   apiGroup: rbac.authorization.k8s.io
 `, saName, saName, saNs)
-		if err := applyYAMLViaKubeconfig(tmpKC.Name(), crbYAML); err != nil {
+		if err := applyK8sManifest(ctx, c, crbYAML); err != nil {
 			log.Printf("[SAKubeconfig] Warning: ClusterRoleBinding error: %v", err)
 		}
 	} else if len(namespaces) > 0 {
 		// Ensure custom ClusterRoles exist, then create RoleBindings per namespace.
 		// Delete before recreate to handle roleRef immutability on role changes.
-		ensureCustomClusterRoles(tmpKC.Name())
+		ensureCustomClusterRoles(ctx, c)
 		crName := clusterRoleName(targetRole)
 		for _, ns := range namespaces {
 			rbName := fmt.Sprintf("dm-%s-binding", saName)
-			kubectlRun(tmpKC.Name(), "delete", "rolebinding", rbName, "-n", ns, "--ignore-not-found") //nolint:errcheck
+			if err := c.delete(ctx, mustK8sResource("rolebindings"), ns, rbName); err != nil && !isK8sNotFound(err) {
+				log.Printf("[SAKubeconfig] Warning: delete RoleBinding ns=%s: %v", ns, err)
+			}
 			rbYAML := fmt.Sprintf(`apiVersion: rbac.authorization.k8s.io/v1
 kind: RoleBinding
 metadata:
@@ -1945,40 +1705,51 @@ roleRef:
   name: %s
   apiGroup: rbac.authorization.k8s.io
 `, rbName, ns, saName, saNs, crName)
-			if err := applyYAMLViaKubeconfig(tmpKC.Name(), rbYAML); err != nil {
+			if err := applyK8sManifest(ctx, c, rbYAML); err != nil {
 				log.Printf("[SAKubeconfig] Warning: RoleBinding error for ns=%s: %v", ns, err)
 			}
 		}
 	}
 
 	// Wait for the token controller to populate the Secret
-	time.Sleep(3 * time.Second)
-
-	// Retrieve the base64-encoded token from the Secret
-	tokenB64, err := kubectlRun(tmpKC.Name(), "get", "secret", secretName, "-n", saNs,
-		"-o", "jsonpath={.data.token}")
-	if err != nil || strings.TrimSpace(tokenB64) == "" {
-		return "", fmt.Errorf("ServiceAccount token not ready — please try again in a moment")
-	}
-	tokenBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(tokenB64))
+	token, err := waitForSAToken(ctx, c, saNs, secretName)
 	if err != nil {
-		return "", fmt.Errorf("decoding ServiceAccount token: %v", err)
+		return "", err
 	}
-	token := string(tokenBytes)
 
-	// Extract server URL and CA from the admin kubeconfig
-	server, _ := kubectlRun(tmpKC.Name(), "config", "view", "--raw", "-o",
-		"jsonpath={.clusters[0].cluster.server}")
-	caData, _ := kubectlRun(tmpKC.Name(), "config", "view", "--raw", "-o",
-		"jsonpath={.clusters[0].cluster.certificate-authority-data}")
-	server = strings.TrimSpace(server)
-	caData = strings.TrimSpace(caData)
+	// Server URL and CA come from the admin kubeconfig
+	server, caData := c.creds.serverURL, c.creds.caData
 
 	log.Printf("[SAKubeconfig] Generated kubeconfig for user=%s (sa=%s, ns=%s, role=%s)",
 		targetUsername, saName, saNs, targetRole)
 	return buildSAKubeconfigYAML(server, caData, targetUsername, token, saNs), nil
 }
 
+// waitForSAToken polls the ServiceAccount token Secret until the token
+// controller has filled it in.
+func waitForSAToken(ctx context.Context, c *k8sClient, namespace, secretName string) (string, error) {
+	secrets := mustK8sResource("secrets")
+	for attempt := 0; attempt < 10; attempt++ {
+		secret, err := c.get(ctx, secrets, namespace, secretName)
+		if err != nil && !isK8sNotFound(err) {
+			return "", err
+		}
+		if tokenB64 := nestedString(secret, "data", "token"); tokenB64 != "" {
+			tokenBytes, err := base64.StdEncoding.DecodeString(tokenB64)
+			if err != nil {
+				return "", fmt.Errorf("decoding ServiceAccount token: %v", err)
+			}
+			return string(tokenBytes), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	return "", fmt.Errorf("ServiceAccount token not ready — please try again in a moment")
+}
+
 // getUserNamespacesForCluster fetches namespace assignments for a user+cluster from DB.
 func getUserNamespacesForCluster(userID, clusterID string) ([]string, error) {
 	rows, err := database.DB.Query(
@@ -2012,18 +1783,6 @@ func GenerateUserServiceAccountKubeconfig(w http.ResponseWriter, r *http.Request
 	clusterID := vars["id"]
 	targetUserID := vars["userId"]
 
-	var storedKC sql.NullString
-	if err := database.DB.QueryRow(
-		"SELECT COALESCE(kubeconfig,'') FROM k0s_clusters WHERE id = ?", clusterID,
-	).Scan(&storedKC); err != nil {
-		http.Error(w, "Cluster not found", http.StatusNotFound)
-		return
-	}
-	if strings.TrimSpace(storedKC.String) == "" {
-		http.Error(w, "Cluster kubeconfig not available — fetch or import it first", http.StatusBadRequest)
-		return
-	}
-
 	var targetUsername, targetRole string
 	if err := database.DB.QueryRow(
 		"SELECT username, role FROM users WHERE id = ?", targetUserID,
@@ -2038,9 +1797,9 @@ func GenerateUserServiceAccountKubeconfig(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	userKC, err := generateSAKubeconfigContent(storedKC.String, targetUsername, targetRole, namespaces)
+	userKC, err := generateSAKubeconfigContent(clusterID, targetUsername, targetRole, namespaces)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeK8sError(w, err)
 		return
 	}
 
@@ -2074,6 +1833,7 @@ func DownloadMyKubeconfig(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Cluster not found", http.StatusNotFound)
 		return
 	}
+	storedKC.String = database.OpenSecret(storedKC.String)
 
 	// ── Admin: return raw cluster-admin kubeconfig (direct K8s access, unchanged) ──
 	if HasRole(me.Role, "admin") {
@@ -2155,18 +1915,20 @@ func GetPodEvents(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Get events for this specific pod
-	cmd := fmt.Sprintf("sudo k0s kubectl get events -n %s --field-selector involvedObject.name=%s", namespace, podName)
-	output, err := clusterSSHRun(clusterID, cmd)
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	events, err := c.list(r.Context(), mustK8sResource("events"), namespace, k8sListOptions{
+		FieldSelector: "involvedObject.name=" + podName,
+	})
 	if err != nil {
 		log.Printf("[GetPodEvents] Error: cluster=%s pod=%s ns=%s error=%v", clusterID, podName, namespace, err)
-		http.Error(w, "Failed to get pod events: "+err.Error(), http.StatusNotFound)
+		writeK8sError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Write([]byte(output))
+	w.Write([]byte(formatEventTable(events.Items)))
 }
-
-
-
@@ -0,0 +1,1194 @@
+package api
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"github.com/gorilla/mux"
+)
+
+// Cluster backups come in two kinds:
+//
+//   - "k0s": `k0s backup` run over SSH on the controller of a cluster this
+//     server provisioned. The archive (etcd/kine data, PKI, manifests) is
+//     restored onto a fresh controller with `k0s restore`.
+//   - "namespaces": a portable export of the resources of selected
+//     namespaces, cleaned of status and server-owned fields, that can be
+//     restored into the same or another cluster, optionally under other
+//     namespace names.
+//
+// Archives go to a BackupStore and are catalogued in cluster_backups, like
+// volume backups. Namespace exports leave Secrets out unless include_secrets
+// is set; then each Secret value is sealed with the vault in the archive
+// and opened again on restore, so only this server can read it. A k0s
+// archive holds the datastore with every Secret of the cluster, so the
+// whole archive is stored as a vault stream and opened on download.
+
+// clusterBackupFormat is the layout version of namespace archives, recorded
+// in their backup.json.
+const clusterBackupFormat = 1
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type ClusterBackup struct {
+	ID             int     `json:"id"`
+	ClusterID      int     `json:"cluster_id"`
+	ClusterName    string  `json:"cluster_name"`
+	Kind           string  `json:"kind"`       // k0s, namespaces
+	Namespaces     string  `json:"namespaces"` // comma separated; empty for k0s backups
+	Storage        string  `json:"storage"`
+	Location       string  `json:"location"`
+	SizeBytes      int64   `json:"size_bytes"`
+	Checksum       string  `json:"checksum"`
+	ObjectCount    int     `json:"object_count"`
+	Status         string  `json:"status"` // running, success, failed
+	Error          *string `json:"error"`
+	Trigger        string  `json:"trigger"` // manual, schedule
+	ScheduleID     *int    `json:"schedule_id"`
+	IncludeSecrets bool    `json:"include_secrets"`
+	CreatedAt      string  `json:"created_at"`
+	FinishedAt     *string `json:"finished_at"`
+}
+
+type ClusterBackupSchedule struct {
+	ID              int     `json:"id"`
+	ClusterID       int     `json:"cluster_id"`
+	Kind            string  `json:"kind"`
+	Namespaces      string  `json:"namespaces"`
+	IntervalMinutes int     `json:"interval_minutes"`
+	Retention       int     `json:"retention"`    // number of successful backups to keep
+	MaxAgeDays      int     `json:"max_age_days"` // 0 keeps backups regardless of age
+	Storage         string  `json:"storage"`
+	Enabled         bool    `json:"enabled"`
+	IncludeSecrets  bool    `json:"include_secrets"`
+	LastRunAt       *string `json:"last_run_at"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+// clusterBackupManifest is the backup.json of a namespace archive.
+type clusterBackupManifest struct {
+	Format      int      `json:"format"`
+	ClusterID   int      `json:"cluster_id"`
+	ClusterName string   `json:"cluster_name"`
+	Namespaces  []string `json:"namespaces"`
+	Objects     int      `json:"objects"`
+	Secrets     bool     `json:"secrets"` // Secret values are vault-sealed
+	CreatedAt   string   `json:"created_at"`
+}
+
+const clusterBackupColumns = `id, cluster_id, cluster_name, kind, namespaces, storage, location, size_bytes, checksum,
+	object_count, status, error, trigger, schedule_id, include_secrets, created_at, finished_at`
+
+func scanClusterBackup(row interface{ Scan(...interface{}) error }) (ClusterBackup, error) {
+	var b ClusterBackup
+	var secrets int
+	err := row.Scan(&b.ID, &b.ClusterID, &b.ClusterName, &b.Kind, &b.Namespaces, &b.Storage, &b.Location, &b.SizeBytes,
+		&b.Checksum, &b.ObjectCount, &b.Status, &b.Error, &b.Trigger, &b.ScheduleID, &secrets, &b.CreatedAt, &b.FinishedAt)
+	b.IncludeSecrets = secrets == 1
+	return b, err
+}
+
+func getClusterBackupByID(id string) (ClusterBackup, error) {
+	return scanClusterBackup(database.DB.QueryRow(
+		`SELECT `+clusterBackupColumns+` FROM cluster_backups WHERE id = ?`, id))
+}
+
+// splitNamespaces parses a comma separated namespace list.
+func splitNamespaces(list string) []string {
+	var out []string
+	for _, ns := range strings.Split(list, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
+
+// requireAdmin writes a 403 unless the caller has the admin role.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, _ := GetUserFromContext(r.Context())
+	if !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden: admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ── k0s backups ─────────────────────────────────────────────────────────────
+
+// streamK0sBackup runs `k0s backup` on the cluster's controller and copies
+// the resulting archive to w.
+func streamK0sBackup(clusterID int, w io.Writer) error {
+	cl, err := loadK0sClusterAccess(clusterID)
+	if err != nil {
+		return err
+	}
+	if cl.Type == "external" || cl.Username == "" {
+		return fmt.Errorf("k0s backups need SSH access to the controller; this cluster was imported without it")
+	}
+
+	client, err := connectSSH(cl.IP, cl.Username, cl.Credential, cl.AuthMethod)
+	if err != nil {
+		return fmt.Errorf("SSH connect failed: %v", err)
+	}
+	defer client.Close()
+
+	run := func(cmd string, stdout io.Writer) error {
+		session, err := client.NewSession()
+		if err != nil {
+			return fmt.Errorf("SSH session failed: %v", err)
+		}
+		defer session.Close()
+		var errOut strings.Builder
+		session.Stdout = stdout
+		session.Stderr = &errOut
+		if err := session.Run(cmd); err != nil {
+			return fmt.Errorf("%s: %v: %s", cmd, err, strings.TrimSpace(errOut.String()))
+		}
+		return nil
+	}
+
+	dir := fmt.Sprintf("/tmp/dm-k0s-backup-%d", time.Now().UnixNano())
+	defer run("sudo rm -rf "+dir, io.Discard)
+	if err := run(fmt.Sprintf("sudo mkdir -p %s && sudo k0s backup --save-path %s", dir, dir), io.Discard); err != nil {
+		return err
+	}
+	return run(fmt.Sprintf("sudo sh -c 'cat %s/k0s_backup_*.tar.gz'", dir), w)
+}
+
+// ── Namespace export ────────────────────────────────────────────────────────
+
+// skippedBackupResources are resource types a namespace export leaves out:
+// they are derived from other objects or only record runtime state.
+var skippedBackupResources = map[string]bool{
+	"events":                          true,
+	"events.events.k8s.io":            true,
+	"endpoints":                       true,
+	"endpointslices.discovery.k8s.io": true,
+	"controllerrevisions.apps":        true,
+	"leases.coordination.k8s.io":      true,
+}
+
+// exportableResources returns the namespaced resource types that can be
+// listed and created again.
+func exportableResources(ctx context.Context, c *k8sClient) ([]k8sAPIResource, error) {
+	resources, err := c.discover(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	var out []k8sAPIResource
+	for _, res := range resources {
+		if !res.Namespaced || skippedBackupResources[res.fullName()] {
+			continue
+		}
+		verbs := map[string]bool{}
+		for _, v := range res.Verbs {
+			verbs[v] = true
+		}
+		if verbs["list"] && verbs["create"] {
+			out = append(out, res)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].fullName() < out[j].fullName() })
+	return out, nil
+}
+
+// skipExportedObject reports objects that are recreated by the cluster
+// itself: anything with an owner, per-namespace defaults and service
+// account tokens.
+func skipExportedObject(obj map[string]interface{}) bool {
+	if len(nestedSlice(obj, "metadata", "ownerReferences")) > 0 {
+		return true
+	}
+	kind, name := nestedString(obj, "kind"), nestedString(obj, "metadata", "name")
+	switch {
+	case kind == "ConfigMap" && name == "kube-root-ca.crt":
+		return true
+	case kind == "Secret" && nestedString(obj, "type") == "kubernetes.io/service-account-token":
+		return true
+	}
+	return false
+}
+
+// isSecret reports whether obj is a core v1 Secret.
+func isSecret(obj map[string]interface{}) bool {
+	return nestedString(obj, "kind") == "Secret" && nestedString(obj, "apiVersion") == "v1"
+}
+
+// mapSecretValues replaces every value of a Secret's data and stringData
+// with fn of it.
+func mapSecretValues(obj map[string]interface{}, fn func(string) (string, error)) error {
+	for _, field := range []string{"data", "stringData"} {
+		values := nestedMap(obj, field)
+		for k, v := range values {
+			s, _ := v.(string)
+			out, err := fn(s)
+			if err != nil {
+				return fmt.Errorf("secret %s key %s: %w", nestedString(obj, "metadata", "name"), k, err)
+			}
+			values[k] = out
+		}
+	}
+	return nil
+}
+
+// cleanExportedObject strips status and the fields the API server or
+// controllers fill in, so the object applies cleanly to any cluster.
+func cleanExportedObject(obj map[string]interface{}) {
+	delete(obj, "status")
+	meta := nestedMap(obj, "metadata")
+	for _, f := range []string{"managedFields", "resourceVersion", "uid", "creationTimestamp", "generation",
+		"selfLink", "deletionTimestamp", "deletionGracePeriodSeconds"} {
+		delete(meta, f)
+	}
+	if ann := nestedMap(obj, "metadata", "annotations"); ann != nil {
+		for _, a := range []string{"kubectl.kubernetes.io/last-applied-configuration", "deployment.kubernetes.io/revision",
+			"pv.kubernetes.io/bind-completed", "pv.kubernetes.io/bound-by-controller",
+			"volume.beta.kubernetes.io/storage-provisioner", "volume.kubernetes.io/storage-provisioner",
+			"volume.kubernetes.io/selected-node"} {
+			delete(ann, a)
+		}
+		if len(ann) == 0 {
+			delete(meta, "annotations")
+		}
+	}
+
+	spec := nestedMap(obj, "spec")
+	switch nestedString(obj, "kind") {
+	case "Namespace":
+		delete(obj, "spec")
+		if labels := nestedMap(obj, "metadata", "labels"); labels != nil {
+			delete(labels, "kubernetes.io/metadata.name")
+		}
+	case "Service":
+		// Cluster IPs are allocated per cluster; headless services keep "None".
+		if nestedString(obj, "spec", "clusterIP") != "None" {
+			delete(spec, "clusterIP")
+			delete(spec, "clusterIPs")
+		}
+	case "PersistentVolumeClaim":
+		delete(spec, "volumeName")
+	case "Job":
+		// The generated selector and its labels are rejected on create.
+		if manual, _ := spec["manualSelector"].(bool); !manual {
+			delete(spec, "selector")
+			if labels := nestedMap(obj, "spec", "template", "metadata", "labels"); labels != nil {
+				for _, l := range []string{"controller-uid", "job-name", "batch.kubernetes.io/controller-uid", "batch.kubernetes.io/job-name"} {
+					delete(labels, l)
+				}
+			}
+		}
+	}
+}
+
+// writeNamespaceArchive exports namespaces as a tar.gz written to w:
+// backup.json plus one YAML file per object at <namespace>/<type>/<name>.yaml.
+// Secrets are left out unless secrets is set, and then sealed. It returns
+// the number of objects written.
+func writeNamespaceArchive(ctx context.Context, c *k8sClient, clusterID int, clusterName string, namespaces []string, secrets bool, w io.Writer) (int, error) {
+	resources, err := exportableResources(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: now}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	count := 0
+	for _, ns := range namespaces {
+		nsObj, err := c.get(ctx, mustK8sResource("namespaces"), "", ns)
+		if err != nil {
+			return count, fmt.Errorf("namespace %s: %v", ns, err)
+		}
+		cleanExportedObject(nsObj)
+		if err := add(ns+"/namespace.yaml", []byte(renderYAML(nsObj))); err != nil {
+			return count, err
+		}
+		count++
+
+		for _, res := range resources {
+			if res.Group == "" && res.Name == "secrets" && !secrets {
+				continue
+			}
+			list, err := c.list(ctx, res.resource(), ns, k8sListOptions{})
+			if err != nil {
+				return count, fmt.Errorf("listing %s in %s: %v", res.fullName(), ns, err)
+			}
+			for _, obj := range list.Items {
+				if skipExportedObject(obj) {
+					continue
+				}
+				// List items carry no apiVersion/kind of their own.
+				obj["apiVersion"], obj["kind"] = res.resource().apiVersion(), res.Kind
+				cleanExportedObject(obj)
+				if isSecret(obj) {
+					if err := mapSecretValues(obj, vault.Seal); err != nil {
+						return count, err
+					}
+				}
+				name := path.Join(ns, res.fullName(), nestedString(obj, "metadata", "name")+".yaml")
+				if err := add(name, []byte(renderYAML(obj))); err != nil {
+					return count, err
+				}
+				count++
+			}
+		}
+	}
+
+	manifest, _ := json.MarshalIndent(clusterBackupManifest{
+		Format: clusterBackupFormat, ClusterID: clusterID, ClusterName: clusterName,
+		Namespaces: namespaces, Objects: count, Secrets: secrets, CreatedAt: now.UTC().Format(time.RFC3339),
+	}, "", "  ")
+	if err := add("backup.json", manifest); err != nil {
+		return count, err
+	}
+	if err := tw.Close(); err != nil {
+		return count, err
+	}
+	return count, gz.Close()
+}
+
+// readNamespaceArchive reads the objects of a namespace archive, with
+// Secret values opened again.
+func readNamespaceArchive(r io.Reader) (clusterBackupManifest, []map[string]interface{}, error) {
+	var manifest clusterBackupManifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, nil, err
+	}
+	tr := tar.NewReader(gz)
+	var objects []map[string]interface{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return manifest, nil, err
+		}
+		if hdr.Name == "backup.json" {
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return manifest, nil, fmt.Errorf("backup.json: %v", err)
+			}
+			continue
+		}
+		docs, err := decodeManifestObjects(data)
+		if err != nil {
+			return manifest, nil, fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+		objects = append(objects, docs...)
+	}
+	if manifest.Format == 0 || manifest.Format > clusterBackupFormat {
+		return manifest, nil, fmt.Errorf("unsupported backup format %d", manifest.Format)
+	}
+	for _, obj := range objects {
+		if isSecret(obj) {
+			if err := mapSecretValues(obj, vault.Open); err != nil {
+				return manifest, nil, err
+			}
+		}
+	}
+	return manifest, objects, nil
+}
+
+// ── Backup / restore ────────────────────────────────────────────────────────
+
+// createClusterBackupRecord inserts a 'running' catalog row and returns its ID.
+func createClusterBackupRecord(clusterID int, kind string, namespaces []string, secrets bool, storage, trigger string, scheduleID int) (int64, error) {
+	if storage == "" {
+		storage = "local"
+	}
+	var clusterName string
+	if err := database.DB.QueryRow("SELECT name FROM k0s_clusters WHERE id = ?", clusterID).Scan(&clusterName); err != nil {
+		return 0, fmt.Errorf("cluster %d not found", clusterID)
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO cluster_backups (cluster_id, cluster_name, kind, namespaces, include_secrets, storage, trigger, schedule_id, status)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'running')`,
+		clusterID, clusterName, kind, strings.Join(namespaces, ","), boolInt(secrets), storage, trigger, nullInt(scheduleID))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// backupNamespaces returns the namespaces a namespace backup covers: the
+// requested ones, or every namespace but the Kubernetes system ones.
+func backupNamespaces(ctx context.Context, c *k8sClient, requested []string) ([]string, error) {
+	if len(requested) > 0 {
+		return requested, nil
+	}
+	list, err := c.list(ctx, mustK8sResource("namespaces"), "", k8sListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	system := map[string]bool{"kube-system": true, "kube-public": true, "kube-node-lease": true}
+	var namespaces []string
+	for _, item := range list.Items {
+		if name := nestedString(item, "metadata", "name"); !system[name] {
+			namespaces = append(namespaces, name)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// runClusterBackup writes the backup into the backup store and finalises
+// the catalog row created by createClusterBackupRecord.
+func runClusterBackup(backupID int64, clusterID int, kind string, namespaces []string, secrets bool, storage string) error {
+	target := fmt.Sprintf("cluster %d (%s)", clusterID, kind)
+	err := func() error {
+		store, err := getBackupStore(storage)
+		if err != nil {
+			return err
+		}
+		var clusterName string
+		database.DB.QueryRow("SELECT cluster_name FROM cluster_backups WHERE id = ?", backupID).Scan(&clusterName)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer cancel()
+
+		produce := func(w io.Writer) (int, error) {
+			sealed, err := vault.SealStream(w)
+			if err != nil {
+				return 0, err
+			}
+			if err := streamK0sBackup(clusterID, sealed); err != nil {
+				return 0, err
+			}
+			return 0, sealed.Close()
+		}
+		if kind == "namespaces" {
+			c, err := newK8sClient(strconv.Itoa(clusterID))
+			if err != nil {
+				return err
+			}
+			if namespaces, err = backupNamespaces(ctx, c, namespaces); err != nil {
+				return err
+			}
+			database.DB.Exec("UPDATE cluster_backups SET namespaces = ? WHERE id = ?", strings.Join(namespaces, ","), backupID)
+			produce = func(w io.Writer) (int, error) {
+				return writeNamespaceArchive(ctx, c, clusterID, clusterName, namespaces, secrets, w)
+			}
+		}
+
+		key := fmt.Sprintf("clusters/%d/%s/%s.tar.gz", clusterID, kind, time.Now().Format("20060102_150405"))
+		pr, pw := io.Pipe()
+		var objects int
+		go func() {
+			n, err := produce(pw)
+			objects = n
+			pw.CloseWithError(err)
+		}()
+
+		hasher := sha256.New()
+		size, err := store.Put(key, io.TeeReader(pr, hasher))
+		pr.CloseWithError(err)
+		if err != nil {
+			return err
+		}
+
+		_, err = database.DB.Exec(
+			`UPDATE cluster_backups SET status = 'success', location = ?, size_bytes = ?, checksum = ?, object_count = ?,
+			 finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			key, size, hex.EncodeToString(hasher.Sum(nil)), objects, backupID)
+		return err
+	}()
+
+	if err != nil {
+		database.DB.Exec(
+			`UPDATE cluster_backups SET status = 'failed', error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			err.Error(), backupID)
+		recordActivityLog("backup_cluster", target, err.Error(), "error")
+		return err
+	}
+	recordActivityLog("backup_cluster", target, fmt.Sprintf("backup %d", backupID), "success")
+	return nil
+}
+
+// restoreKindOrder is the order object kinds are applied in during a
+// restore, so that what an object refers to exists first. Unlisted kinds
+// go between Service and the workloads.
+var restoreKindOrder = map[string]int{
+	"Namespace":             0,
+	"ResourceQuota":         1,
+	"LimitRange":            1,
+	"ServiceAccount":        2,
+	"Secret":                3,
+	"ConfigMap":             3,
+	"PersistentVolumeClaim": 4,
+	"Role":                  5,
+	"RoleBinding":           6,
+	"Service":               7,
+	"Deployment":            9,
+	"StatefulSet":           9,
+	"DaemonSet":             9,
+	"ReplicaSet":            9,
+	"Pod":                   9,
+	"Job":                   9,
+	"CronJob":               9,
+	"Ingress":               10,
+}
+
+func restoreRank(obj map[string]interface{}) int {
+	if rank, ok := restoreKindOrder[nestedString(obj, "kind")]; ok {
+		return rank
+	}
+	return 8
+}
+
+// clusterRestoreResult is the outcome of restoring one object.
+type clusterRestoreResult struct {
+	Ref       string `json:"ref"`
+	Namespace string `json:"namespace,omitempty"`
+	Action    string `json:"action,omitempty"` // applied; created, configured or unchanged on a dry run
+	Error     string `json:"error,omitempty"`
+}
+
+// restoreNamespaceObjects applies archived objects of the selected
+// namespaces (all when empty) into the cluster, renaming namespaces per
+// nsMap. With dryRun nothing is persisted.
+func restoreNamespaceObjects(ctx context.Context, c *k8sClient, objects []map[string]interface{}, selected []string, nsMap map[string]string, dryRun bool) []clusterRestoreResult {
+	want := map[string]bool{}
+	for _, ns := range selected {
+		want[ns] = true
+	}
+	mapNS := func(ns string) string {
+		if to, ok := nsMap[ns]; ok && to != "" {
+			return to
+		}
+		return ns
+	}
+
+	var restore []map[string]interface{}
+	for _, obj := range objects {
+		source := nestedString(obj, "metadata", "namespace")
+		if nestedString(obj, "kind") == "Namespace" {
+			source = nestedString(obj, "metadata", "name")
+		}
+		if len(want) > 0 && !want[source] {
+			continue
+		}
+		meta := nestedMap(obj, "metadata")
+		if nestedString(obj, "kind") == "Namespace" {
+			meta["name"] = mapNS(source)
+		} else {
+			meta["namespace"] = mapNS(source)
+		}
+		// Bindings that name service accounts of a renamed namespace follow it.
+		if nestedString(obj, "kind") == "RoleBinding" || nestedString(obj, "kind") == "ClusterRoleBinding" {
+			for _, s := range nestedSlice(obj, "subjects") {
+				if subject, ok := s.(map[string]interface{}); ok {
+					if ns, _ := subject["namespace"].(string); ns != "" {
+						subject["namespace"] = mapNS(ns)
+					}
+				}
+			}
+		}
+		restore = append(restore, obj)
+	}
+	sort.SliceStable(restore, func(i, j int) bool { return restoreRank(restore[i]) < restoreRank(restore[j]) })
+
+	results := []clusterRestoreResult{}
+	pending := map[string]bool{}
+	for _, obj := range restore {
+		p, err := prepareK8sObject(ctx, c, obj, nestedString(obj, "metadata", "namespace"))
+		res := clusterRestoreResult{Ref: p.ref, Namespace: p.namespace}
+		switch {
+		case err != nil:
+		case dryRun:
+			res.Action, _, err = dryRunK8sObject(ctx, c, p, pending)
+			if p.rs.Kind == "Namespace" && res.Action == "created" {
+				pending[p.name] = true
+			}
+		default:
+			_, err = c.apply(ctx, p.rs, p.namespace, p.name, p.obj, false)
+			res.Action = "applied"
+		}
+		if err != nil {
+			res.Action, res.Error = "", err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// pruneClusterBackups enforces a schedule's retention: successful backups
+// beyond the newest retention ones, and those older than maxAgeDays, are
+// deleted. The newest successful backup is always kept; failed runs before
+// it go.
+func pruneClusterBackups(scheduleID, retention, maxAgeDays int) {
+	rows, err := database.DB.Query(
+		`SELECT `+clusterBackupColumns+` FROM cluster_backups
+		 WHERE schedule_id = ? AND status = 'success' ORDER BY id DESC`, scheduleID)
+	if err != nil {
+		log.Printf("[ClusterBackup] retention query for schedule %d: %v", scheduleID, err)
+		return
+	}
+	var backups []ClusterBackup
+	for rows.Next() {
+		if b, err := scanClusterBackup(rows); err == nil {
+			backups = append(backups, b)
+		}
+	}
+	rows.Close()
+	if len(backups) > 0 {
+		database.DB.Exec(`DELETE FROM cluster_backups WHERE schedule_id = ? AND status = 'failed' AND id < ?`,
+			scheduleID, backups[0].ID)
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -maxAgeDays)
+	for i, b := range backups {
+		if i == 0 {
+			continue
+		}
+		expired := retention > 0 && i >= retention
+		if created, err := parseDBTime(b.CreatedAt); err == nil && maxAgeDays > 0 && created.Before(cutoff) {
+			expired = true
+		}
+		if !expired {
+			continue
+		}
+		if err := deleteClusterBackup(b); err != nil {
+			log.Printf("[ClusterBackup] retention delete of backup %d: %v", b.ID, err)
+		}
+	}
+}
+
+// deleteClusterBackup removes the archive from storage and the catalog row.
+func deleteClusterBackup(b ClusterBackup) error {
+	if b.Location != "" {
+		store, err := getBackupStore(b.Storage)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(b.Location); err != nil {
+			return err
+		}
+	}
+	_, err := database.DB.Exec("DELETE FROM cluster_backups WHERE id = ?", b.ID)
+	return err
+}
+
+// ── Scheduler ───────────────────────────────────────────────────────────────
+
+// RecoverClusterBackups fails backups left running by a previous server
+// process, so they can be deleted and pruned.
+func RecoverClusterBackups() {
+	database.DB.Exec(
+		`UPDATE cluster_backups SET status = 'failed', error = 'interrupted by server restart', finished_at = CURRENT_TIMESTAMP
+		 WHERE status = 'running'`)
+}
+
+// activeClusterBackupSchedules holds the schedules with a backup running.
+var activeClusterBackupSchedules sync.Map
+
+// StartClusterBackupScheduler runs due cluster backup schedules once a minute.
+func StartClusterBackupScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			runDueClusterBackups()
+		}
+	}()
+}
+
+func runDueClusterBackups() {
+	rows, err := database.DB.Query(
+		`SELECT id, cluster_id, kind, namespaces, include_secrets, interval_minutes, retention, max_age_days, storage, last_run_at
+		 FROM cluster_backup_schedules WHERE enabled = 1`)
+	if err != nil {
+		log.Printf("[ClusterBackup] scheduler query: %v", err)
+		return
+	}
+	var due []ClusterBackupSchedule
+	now := time.Now().UTC()
+	for rows.Next() {
+		var s ClusterBackupSchedule
+		var secrets int
+		if err := rows.Scan(&s.ID, &s.ClusterID, &s.Kind, &s.Namespaces, &secrets, &s.IntervalMinutes, &s.Retention,
+			&s.MaxAgeDays, &s.Storage, &s.LastRunAt); err != nil {
+			continue
+		}
+		s.IncludeSecrets = secrets == 1
+		if s.LastRunAt != nil {
+			last, err := parseDBTime(*s.LastRunAt)
+			if err == nil && now.Sub(last) < time.Duration(s.IntervalMinutes)*time.Minute {
+				continue
+			}
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+
+	// Each schedule runs on its own, so one slow cluster doesn't hold up
+	// the others; a schedule still busy from its last run is skipped.
+	for _, s := range due {
+		if _, busy := activeClusterBackupSchedules.LoadOrStore(s.ID, true); busy {
+			continue
+		}
+		database.DB.Exec("UPDATE cluster_backup_schedules SET last_run_at = ? WHERE id = ?",
+			now.Format("2006-01-02 15:04:05"), s.ID)
+
+		go func(s ClusterBackupSchedule) {
+			defer activeClusterBackupSchedules.Delete(s.ID)
+			namespaces := splitNamespaces(s.Namespaces)
+			id, err := createClusterBackupRecord(s.ClusterID, s.Kind, namespaces, s.IncludeSecrets, s.Storage, "schedule", s.ID)
+			if err != nil {
+				log.Printf("[ClusterBackup] schedule %d: %v", s.ID, err)
+				return
+			}
+			if err := runClusterBackup(id, s.ClusterID, s.Kind, namespaces, s.IncludeSecrets, s.Storage); err != nil {
+				log.Printf("[ClusterBackup] schedule %d backup of cluster %d failed: %v", s.ID, s.ClusterID, err)
+				return
+			}
+			pruneClusterBackups(s.ID, s.Retention, s.MaxAgeDays)
+		}(s)
+	}
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/k0s/clusters/{id}/backups
+// body: {"kind":"namespaces","namespaces":["shop"],"include_secrets":false,"storage":"local"}
+// kind "k0s" backs up the whole controller; "namespaces" with no namespaces
+// exports every non-system namespace, without Secrets unless include_secrets.
+func BackupCluster(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	clusterID, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var req struct {
+		Kind           string   `json:"kind"`
+		Namespaces     []string `json:"namespaces"`
+		IncludeSecrets bool     `json:"include_secrets"`
+		Storage        string   `json:"storage"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Kind == "" {
+		req.Kind = "namespaces"
+	}
+	if req.Kind != "namespaces" && req.Kind != "k0s" {
+		http.Error(w, `kind must be "namespaces" or "k0s"`, http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "k0s" {
+		req.Namespaces, req.IncludeSecrets = nil, false
+	}
+	if _, err := getBackupStore(req.Storage); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := createClusterBackupRecord(clusterID, req.Kind, req.Namespaces, req.IncludeSecrets, req.Storage, "manual", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	go runClusterBackup(id, clusterID, req.Kind, req.Namespaces, req.IncludeSecrets, req.Storage)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      id,
+		"status":  "running",
+	})
+}
+
+// GET /api/k0s/backups?cluster_id=1&kind=namespaces
+func ListClusterBackups(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	query := `SELECT ` + clusterBackupColumns + ` FROM cluster_backups WHERE 1=1`
+	args := []interface{}{}
+	if c := r.URL.Query().Get("cluster_id"); c != "" {
+		query += " AND cluster_id = ?"
+		args = append(args, c)
+	}
+	if k := r.URL.Query().Get("kind"); k != "" {
+		query += " AND kind = ?"
+		args = append(args, k)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []ClusterBackup{}
+	for rows.Next() {
+		b, err := scanClusterBackup(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, b)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GET /api/k0s/backups/{id}
+func GetClusterBackup(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	b, err := getClusterBackupByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// GET /api/k0s/backups/{id}/download
+func DownloadClusterBackup(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	b, err := getClusterBackupByID(mux.Vars(r)["id"])
+	if err != nil || b.Status != "success" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	store, err := getBackupStore(b.Storage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rc, err := store.Open(b.Location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+	archive, err := vault.OpenStream(rc)
+	if err != nil {
+		http.Error(w, "Opening backup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("%s_%s_%d.tar.gz", b.ClusterName, b.Kind, b.ID)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	// size_bytes of a k0s backup is the size of the sealed archive.
+	if b.SizeBytes > 0 && b.Kind != "k0s" {
+		w.Header().Set("Content-Length", strconv.FormatInt(b.SizeBytes, 10))
+	}
+	if _, err := io.Copy(w, archive); err != nil {
+		log.Printf("[ClusterBackup] download of backup %d failed: %v", b.ID, err)
+	}
+}
+
+// DELETE /api/k0s/backups/{id}
+func DeleteClusterBackup(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	b, err := getClusterBackupByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if b.Status == "running" {
+		http.Error(w, "backup is still running", http.StatusConflict)
+		return
+	}
+	target := fmt.Sprintf("cluster %d (%s)", b.ClusterID, b.Kind)
+	if err := deleteClusterBackup(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		recordActivityLog("delete_cluster_backup", target, err.Error(), "error")
+		return
+	}
+	recordActivityLog("delete_cluster_backup", target, fmt.Sprintf("backup %d", b.ID), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// POST /api/k0s/backups/{id}/restore
+// body: {"cluster_id":2,"namespaces":["shop"],"namespace_map":{"shop":"shop-restored"},"dry_run":true}
+// cluster_id defaults to the backup's own cluster and namespaces to all in
+// the archive. Only namespace backups restore through the API: a k0s backup
+// is restored onto a fresh controller with `k0s restore <archive>`.
+func RestoreClusterBackup(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	b, err := getClusterBackupByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		ClusterID    int               `json:"cluster_id"`
+		Namespaces   []string          `json:"namespaces"`
+		NamespaceMap map[string]string `json:"namespace_map"`
+		DryRun       bool              `json:"dry_run"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if b.Kind != "namespaces" {
+		http.Error(w, "k0s backups are restored onto a fresh controller with `k0s restore`; download the archive to do so", http.StatusBadRequest)
+		return
+	}
+	if b.Status != "success" {
+		http.Error(w, fmt.Sprintf("backup %d is not restorable (status %s)", b.ID, b.Status), http.StatusConflict)
+		return
+	}
+	if req.ClusterID == 0 {
+		req.ClusterID = b.ClusterID
+	}
+	for from, to := range req.NamespaceMap {
+		if to == "" || strings.Contains(to, "/") {
+			http.Error(w, fmt.Sprintf("invalid target namespace for %s", from), http.StatusBadRequest)
+			return
+		}
+	}
+
+	store, err := getBackupStore(b.Storage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rc, err := store.Open(b.Location)
+	if err != nil {
+		http.Error(w, "open backup archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, objects, err := readNamespaceArchive(rc)
+	rc.Close()
+	if err != nil {
+		http.Error(w, "read backup archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c, err := newK8sClient(strconv.Itoa(req.ClusterID))
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Minute)
+	defer cancel()
+	results := restoreNamespaceObjects(ctx, c, objects, req.Namespaces, req.NamespaceMap, req.DryRun)
+	failed := 0
+	for _, res := range results {
+		if res.Error != "" {
+			failed++
+		}
+	}
+
+	if !req.DryRun {
+		target := fmt.Sprintf("backup %d -> cluster %d", b.ID, req.ClusterID)
+		details := fmt.Sprintf("%d objects restored, %d failed", len(results)-failed, failed)
+		status := "success"
+		if failed > 0 {
+			status = "error"
+		}
+		recordActivityLog("restore_cluster_backup", target, details, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    failed == 0,
+		"cluster_id": req.ClusterID,
+		"dry_run":    req.DryRun,
+		"restored":   len(results) - failed,
+		"failed":     failed,
+		"results":    results,
+	})
+}
+
+// GET /api/k0s/backup-schedules?cluster_id=1
+func ListClusterBackupSchedules(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	query := `SELECT id, cluster_id, kind, namespaces, interval_minutes, retention, max_age_days, storage, enabled,
+		include_secrets, last_run_at, created_at
+		FROM cluster_backup_schedules`
+	args := []interface{}{}
+	if c := r.URL.Query().Get("cluster_id"); c != "" {
+		query += " WHERE cluster_id = ?"
+		args = append(args, c)
+	}
+	rows, err := database.DB.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []ClusterBackupSchedule{}
+	for rows.Next() {
+		var s ClusterBackupSchedule
+		var enabled, secrets int
+		if err := rows.Scan(&s.ID, &s.ClusterID, &s.Kind, &s.Namespaces, &s.IntervalMinutes, &s.Retention,
+			&s.MaxAgeDays, &s.Storage, &enabled, &secrets, &s.LastRunAt, &s.CreatedAt); err != nil {
+			continue
+		}
+		s.Enabled, s.IncludeSecrets = enabled == 1, secrets == 1
+		list = append(list, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// POST /api/k0s/backup-schedules
+// body: {"id":0,"cluster_id":1,"kind":"namespaces","namespaces":"shop,blog","include_secrets":false,"interval_minutes":1440,"retention":7,"max_age_days":30}
+// A schedule with the given id is updated; without one a new schedule is created.
+func SaveClusterBackupSchedule(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		ID              int    `json:"id"`
+		ClusterID       int    `json:"cluster_id"`
+		Kind            string `json:"kind"`
+		Namespaces      string `json:"namespaces"`
+		IntervalMinutes int    `json:"interval_minutes"`
+		Retention       int    `json:"retention"`
+		MaxAgeDays      int    `json:"max_age_days"`
+		Storage         string `json:"storage"`
+		Enabled         *bool  `json:"enabled"`
+		IncludeSecrets  bool   `json:"include_secrets"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = "namespaces"
+	}
+	if req.Kind != "namespaces" && req.Kind != "k0s" {
+		http.Error(w, `kind must be "namespaces" or "k0s"`, http.StatusBadRequest)
+		return
+	}
+	var exists int
+	if database.DB.QueryRow("SELECT 1 FROM k0s_clusters WHERE id = ?", req.ClusterID).Scan(&exists) != nil {
+		http.Error(w, "cluster_id must name an existing cluster", http.StatusBadRequest)
+		return
+	}
+	if req.IntervalMinutes < 15 {
+		http.Error(w, "interval_minutes must be at least 15", http.StatusBadRequest)
+		return
+	}
+	if req.Retention <= 0 {
+		req.Retention = 7
+	}
+	if req.MaxAgeDays < 0 {
+		req.MaxAgeDays = 0
+	}
+	if req.Storage == "" {
+		req.Storage = "local"
+	}
+	if _, err := getBackupStore(req.Storage); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	namespaces := ""
+	if req.Kind == "namespaces" {
+		namespaces = strings.Join(splitNamespaces(req.Namespaces), ",")
+	} else {
+		req.IncludeSecrets = false
+	}
+	enabled := 1
+	if req.Enabled != nil && !*req.Enabled {
+		enabled = 0
+	}
+
+	id := int64(req.ID)
+	if req.ID != 0 {
+		res, err := database.DB.Exec(
+			`UPDATE cluster_backup_schedules SET cluster_id = ?, kind = ?, namespaces = ?, interval_minutes = ?,
+			 retention = ?, max_age_days = ?, storage = ?, enabled = ?, include_secrets = ? WHERE id = ?`,
+			req.ClusterID, req.Kind, namespaces, req.IntervalMinutes, req.Retention, req.MaxAgeDays, req.Storage, enabled,
+			boolInt(req.IncludeSecrets), req.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		res, err := database.DB.Exec(
+			`INSERT INTO cluster_backup_schedules (cluster_id, kind, namespaces, interval_minutes, retention, max_age_days, storage, enabled, include_secrets)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			req.ClusterID, req.Kind, namespaces, req.IntervalMinutes, req.Retention, req.MaxAgeDays, req.Storage, enabled,
+			boolInt(req.IncludeSecrets))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		id, _ = res.LastInsertId()
+	}
+	recordActivityLog("schedule_cluster_backup", fmt.Sprintf("cluster %d (%s)", req.ClusterID, req.Kind),
+		fmt.Sprintf("every %d min, keep %d", req.IntervalMinutes, req.Retention), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id})
+}
+
+// DELETE /api/k0s/backup-schedules/{id}
+// Existing backups are kept; they just stop being subject to retention.
+func DeleteClusterBackupSchedule(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	res, err := database.DB.Exec("DELETE FROM cluster_backup_schedules WHERE id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	database.DB.Exec("UPDATE cluster_backups SET schedule_id = NULL WHERE schedule_id = ?", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
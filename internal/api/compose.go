@@ -52,6 +52,18 @@ func deployComposeStack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Admission gate: the project named like the compose project, never
+	// one the caller names.
+	var projectID int
+	database.DB.QueryRow(`SELECT id FROM projects WHERE name = ?`, req.Project).Scan(&projectID)
+	images := make([]string, 0, len(req.Services))
+	for _, svc := range req.Services {
+		images = append(images, svc.Image)
+	}
+	if !admitDeploy(w, r, admissionRequest{Kind: "compose", ProjectID: projectID, Images: images}) {
+		return
+	}
+
 	cli, err := GetClient(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -138,6 +138,13 @@ func createContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Admission gate: the project is the one the container name is
+	// assigned to, never one the caller names.
+	projectID := projectForResource(hostIDFromRequest(r), req.Name)
+	if !admitDeploy(w, r, admissionRequest{Kind: "container", ProjectID: projectID, Images: []string{req.Image}}) {
+		return
+	}
+
 	// Set defaults
 	if req.NetworkMode == "" {
 		req.NetworkMode = "bridge"
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+)
+
+// gitCacheDir holds persistent checkouts (repo-<id>) and the SSH material
+// used to fetch them. Override with GIT_CACHE_DIR.
+var gitCacheDir = func() string {
+	if dir := os.Getenv("GIT_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	return "./git-cache"
+}()
+
+// gitCommitPattern matches a full or abbreviated commit id.
+var gitCommitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// gitRepoLocks serializes use of each cached checkout.
+var gitRepoLocks sync.Map // repo id -> *sync.Mutex
+
+// gitRepoSource is the subset of a gitops_repos row needed to check it out.
+type gitRepoSource struct {
+	ID       int
+	Name     string
+	URL      string
+	Branch   string
+	AuthType string // none, token, ssh
+	Token    string
+	SSHKey   string
+}
+
+func loadGitRepoSource(id int) (gitRepoSource, error) {
+	var src gitRepoSource
+	var token, sshKey sql.NullString
+	err := database.DB.QueryRow(
+		`SELECT id, name, url, branch, auth_type, auth_token, ssh_key FROM gitops_repos WHERE id = ?`, id).
+		Scan(&src.ID, &src.Name, &src.URL, &src.Branch, &src.AuthType, &token, &sshKey)
+	if err != nil {
+		return src, fmt.Errorf("git repository %d not found", id)
+	}
+	src.Token = database.OpenNullSecret(token)
+	src.SSHKey = database.OpenNullSecret(sshKey)
+	if src.Branch == "" {
+		src.Branch = "main"
+	}
+	// Rows stored before validation existed must not reach git either.
+	if err := validateGitSource(src.URL, src.Branch); err != nil {
+		return src, fmt.Errorf("git repository %s: %v", src.Name, err)
+	}
+	return src, nil
+}
+
+// validateGitSource rejects a URL or branch that git could read as an
+// option, such as --upload-pack=<cmd>, and branch names that aren't valid
+// refs.
+func validateGitSource(url, branch string) error {
+	if strings.HasPrefix(strings.TrimSpace(url), "-") {
+		return fmt.Errorf("invalid repository url %q", url)
+	}
+	if strings.HasPrefix(branch, "-") {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	out, err := exec.Command("git", "check-ref-format", "--branch", branch).Output()
+	if err != nil || strings.TrimSpace(string(out)) != branch {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	return nil
+}
+
+// gitSSHCommand writes the repo's deploy key into the cache and returns a
+// GIT_SSH_COMMAND using it. Host keys are pinned on first use in the
+// cache's known_hosts.
+func gitSSHCommand(src gitRepoSource) (string, error) {
+	keyDir, err := filepath.Abs(filepath.Join(gitCacheDir, "keys"))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return "", err
+	}
+	keyFile := filepath.Join(keyDir, fmt.Sprintf("repo-%d", src.ID))
+	key := strings.TrimSpace(src.SSHKey) + "\n"
+	if err := os.WriteFile(keyFile, []byte(key), 0600); err != nil {
+		return "", err
+	}
+	knownHosts := filepath.Join(filepath.Dir(keyDir), "known_hosts")
+	return fmt.Sprintf("ssh -i %q -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=%q",
+		keyFile, knownHosts), nil
+}
+
+// gitCommand prepares a git invocation for src. Tokens are passed as an
+// extra HTTP header through GIT_CONFIG_* so they never show up in argv or
+// in the remote URL stored in .git/config; SSH keys go through
+// GIT_SSH_COMMAND.
+func gitCommand(ctx context.Context, src gitRepoSource, dir string, args ...string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	switch {
+	case src.AuthType == "token" && src.Token != "":
+		cred := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + src.Token))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+cred,
+		)
+	case src.AuthType == "ssh" && src.SSHKey != "":
+		sshCmd, err := gitSSHCommand(src)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+sshCmd)
+	}
+	return cmd, nil
+}
+
+// runGit runs a git command and returns its stdout, folding stderr into
+// the error.
+func runGit(ctx context.Context, src gitRepoSource, dir string, args ...string) (string, error) {
+	cmd, err := gitCommand(ctx, src, dir, args...)
+	if err != nil {
+		return "", err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s %s: %v: %s", args[0], src.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// checkoutGitRepo makes a shallow clone of the repo's branch into a new
+// temporary directory and returns it together with the checked-out commit.
+// The caller is responsible for removing dir.
+func checkoutGitRepo(ctx context.Context, src gitRepoSource) (dir, sha string, err error) {
+	dir, err = os.MkdirTemp("", "git-checkout-")
+	if err != nil {
+		return "", "", err
+	}
+	if _, err = runGit(ctx, src, dir, "clone", "--depth", "1", "--branch", src.Branch, "--", src.URL, "."); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	if sha, err = runGit(ctx, src, dir, "rev-parse", "HEAD"); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, sha, nil
+}
+
+// syncGitRepo brings the repo's cached checkout to the head of its branch,
+// or to commit when one is given, cloning it the first time. The checkout
+// stays locked until unlock is called so concurrent deploys of the same
+// repo don't trample each other.
+func syncGitRepo(ctx context.Context, src gitRepoSource, commit string) (dir, sha string, unlock func(), err error) {
+	mu, _ := gitRepoLocks.LoadOrStore(src.ID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	unlock = mu.(*sync.Mutex).Unlock
+
+	dir, err = filepath.Abs(filepath.Join(gitCacheDir, fmt.Sprintf("repo-%d", src.ID)))
+	if err == nil {
+		err = fetchGitRepo(ctx, src, dir)
+	}
+	if err == nil && commit != "" {
+		err = fetchGitCommit(ctx, src, dir, commit)
+	}
+	if err == nil {
+		sha, err = runGit(ctx, src, dir, "rev-parse", "HEAD")
+	}
+	if err != nil {
+		unlock()
+		return "", "", nil, err
+	}
+	return dir, sha, unlock, nil
+}
+
+func fetchGitRepo(ctx context.Context, src gitRepoSource, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		os.RemoveAll(dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		_, err := runGit(ctx, src, dir, "clone", "--depth", "1", "--branch", src.Branch, "--", src.URL, ".")
+		return err
+	}
+	// The URL or branch may have been edited since the last fetch.
+	if _, err := runGit(ctx, src, dir, "remote", "set-url", "--", "origin", src.URL); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, src, dir, "fetch", "--depth", "1", "--", "origin", "refs/heads/"+src.Branch); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, src, dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	_, err := runGit(ctx, src, dir, "clean", "-ffdx")
+	return err
+}
+
+// fetchGitCommit moves a shallow checkout to a specific commit, which
+// needs a fetch by object id (supported by git protocol v2 servers).
+func fetchGitCommit(ctx context.Context, src gitRepoSource, dir, commit string) error {
+	if !gitCommitPattern.MatchString(commit) {
+		return fmt.Errorf("invalid commit %q", commit)
+	}
+	if _, err := runGit(ctx, src, dir, "fetch", "--depth", "1", "--", "origin", commit); err != nil {
+		return err
+	}
+	_, err := runGit(ctx, src, dir, "reset", "--hard", "FETCH_HEAD")
+	return err
+}
+
+// remoteHeadSHA asks the remote for the commit its branch points at
+// without fetching anything.
+func remoteHeadSHA(ctx context.Context, src gitRepoSource) (string, error) {
+	if err := os.MkdirAll(gitCacheDir, 0755); err != nil {
+		return "", err
+	}
+	out, err := runGit(ctx, src, gitCacheDir, "ls-remote", "--", src.URL, "refs/heads/"+src.Branch)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("branch %s not found in %s", src.Branch, src.Name)
+	}
+	return fields[0], nil
+}
+
+// resolveRepoPath joins a user-supplied relative path onto a checkout,
+// refusing paths that would escape it.
+func resolveRepoPath(root, rel string) (string, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(rel))
+	full := filepath.Join(root, clean)
+	if full != filepath.Clean(root) && !strings.HasPrefix(full, filepath.Clean(root)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid path %q", rel)
+	}
+	return full, nil
+}
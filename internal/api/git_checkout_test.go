@@ -0,0 +1,40 @@
+package api
+
+import "testing"
+
+func TestValidateGitSource(t *testing.T) {
+	tests := []struct {
+		url, branch string
+		ok          bool
+	}{
+		{"https://git.example.com/team/app.git", "main", true},
+		{"git@git.example.com:team/app.git", "release/1.2", true},
+		{"https://git.example.com/team/app.git", "--upload-pack=touch /tmp/pwned", false},
+		{"https://git.example.com/team/app.git", "-b", false},
+		{"https://git.example.com/team/app.git", "a..b", false},
+		{"https://git.example.com/team/app.git", "@{-1}", false},
+		{"https://git.example.com/team/app.git", "feature x", false},
+		{"--upload-pack=touch /tmp/pwned", "main", false},
+	}
+	for _, tt := range tests {
+		if err := validateGitSource(tt.url, tt.branch); (err == nil) != tt.ok {
+			t.Errorf("validateGitSource(%q, %q) = %v, want ok=%v", tt.url, tt.branch, err, tt.ok)
+		}
+	}
+}
+
+func TestGitCommitPattern(t *testing.T) {
+	for commit, want := range map[string]bool{
+		"4b825dc": true,
+		"4b825dc642cb6eb9a060e54bf8d69288fbee4904": true,
+		"4B825DC":                        false,
+		"4b825d":                         false,
+		"main":                           false,
+		"--upload-pack=touch /tmp/pwned": false,
+		"4b825dc642cb6eb9a060e54bf8d69288fbee49041": false,
+	} {
+		if got := gitCommitPattern.MatchString(commit); got != want {
+			t.Errorf("gitCommitPattern.MatchString(%q) = %v, want %v", commit, got, want)
+		}
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -47,6 +50,39 @@ type GitopsDeployment struct {
 	WorkspaceID    *string `json:"workspace_id"`
 	DeployedAt     *string `json:"deployed_at"`
 	CreatedAt      string  `json:"created_at"`
+	DeployedSHA    *string `json:"deployed_sha"`
+	SyncInterval   int     `json:"sync_interval"` // seconds between polls, 0 = manual/webhook only
+	Paused         bool    `json:"paused"`
+	LastSyncAt     *string `json:"last_sync_at"`
+	LastSyncError  *string `json:"last_sync_error"`
+	ClusterID      *int    `json:"cluster_id"` // managed k0s cluster; replaces kube_context
+	CreatedBy      *int    `json:"created_by"`
+	SyncStatus     string  `json:"sync_status"` // Synced, OutOfSync, Unknown
+	DriftCheckedAt *string `json:"drift_checked_at"`
+	DriftDiff      *string `json:"drift_diff,omitempty"`
+}
+
+const gitopsDeploymentColumns = `id, name, repo_id, repo_name, deploy_type, namespace,
+	chart_path, values_override, manifest_path, kube_context,
+	status, last_output, workspace_id, deployed_at, created_at,
+	deployed_sha, sync_interval, paused, last_sync_at, last_sync_error, cluster_id, created_by,
+	sync_status, drift_checked_at, drift_diff`
+
+func scanGitopsDeployment(row interface{ Scan(...interface{}) error }) (GitopsDeployment, error) {
+	var d GitopsDeployment
+	var paused int
+	err := row.Scan(&d.ID, &d.Name, &d.RepoID, &d.RepoName, &d.DeployType,
+		&d.Namespace, &d.ChartPath, &d.ValuesOverride, &d.ManifestPath, &d.KubeContext,
+		&d.Status, &d.LastOutput, &d.WorkspaceID, &d.DeployedAt, &d.CreatedAt,
+		&d.DeployedSHA, &d.SyncInterval, &paused, &d.LastSyncAt, &d.LastSyncError, &d.ClusterID, &d.CreatedBy,
+		&d.SyncStatus, &d.DriftCheckedAt, &d.DriftDiff)
+	d.Paused = paused == 1
+	return d, err
+}
+
+func loadGitopsDeployment(id interface{}) (GitopsDeployment, error) {
+	return scanGitopsDeployment(database.DB.QueryRow(
+		`SELECT `+gitopsDeploymentColumns+` FROM gitops_deployments WHERE id = ?`, id))
 }
 
 // ─── Repos ───────────────────────────────────────────────────────────────────
@@ -88,12 +124,22 @@ func ListGitopsRepos(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateGitopsRepo(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_cicd_full") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 	var req struct {
 		Name        string `json:"name"`
 		URL         string `json:"url"`
 		Branch      string `json:"branch"`
 		AuthType    string `json:"auth_type"`
 		AuthToken   string `json:"auth_token"`
+		SSHKey      string `json:"ssh_key"`
 		WorkspaceID string `json:"workspace_id"`
 		Description string `json:"description"`
 	}
@@ -108,15 +154,34 @@ func CreateGitopsRepo(w http.ResponseWriter, r *http.Request) {
 	if req.Branch == "" {
 		req.Branch = "main"
 	}
+	if err := validateGitSource(req.URL, req.Branch); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	if req.AuthType == "" {
 		req.AuthType = "none"
 	}
+	if req.AuthType == "ssh" && req.SSHKey == "" {
+		http.Error(w, "ssh_key is required for ssh auth", 400)
+		return
+	}
+
+	token, err := sealSecret(req.AuthToken)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	sshKey, err := sealSecret(req.SSHKey)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 
 	res, err := database.DB.Exec(
-		`INSERT INTO gitops_repos (name, url, branch, auth_type, auth_token, workspace_id, description)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO gitops_repos (name, url, branch, auth_type, auth_token, ssh_key, workspace_id, description)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		req.Name, req.URL, req.Branch, req.AuthType,
-		nullStr(req.AuthToken), nullStr(req.WorkspaceID), nullStr(req.Description))
+		token, sshKey, nullStr(req.WorkspaceID), nullStr(req.Description))
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -136,13 +201,25 @@ func CreateGitopsRepo(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteGitopsRepo(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_cicd_full") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 	id := mux.Vars(r)["id"]
 	if _, err := database.DB.Exec(`DELETE FROM gitops_repos WHERE id = ?`, id); err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	// also remove associated deployments
+	// also remove associated deployments and the cached checkout
 	database.DB.Exec(`DELETE FROM gitops_deployments WHERE repo_id = ?`, id)
+	if repoID, err := strconv.Atoi(id); err == nil {
+		removeRepoCache(repoID)
+	}
 	w.WriteHeader(204)
 }
 
@@ -152,10 +229,7 @@ func ListDeployments(w http.ResponseWriter, r *http.Request) {
 	wsID := r.URL.Query().Get("workspace_id")
 	repoID := r.URL.Query().Get("repo_id")
 
-	query := `SELECT id, name, repo_id, repo_name, deploy_type, namespace,
-	           chart_path, values_override, manifest_path, kube_context,
-	           status, last_output, workspace_id, deployed_at, created_at
-	          FROM gitops_deployments WHERE 1=1`
+	query := `SELECT ` + gitopsDeploymentColumns + ` FROM gitops_deployments WHERE 1=1`
 	args := []interface{}{}
 
 	if wsID != "" {
@@ -177,10 +251,8 @@ func ListDeployments(w http.ResponseWriter, r *http.Request) {
 
 	deployments := []GitopsDeployment{}
 	for rows.Next() {
-		var d GitopsDeployment
-		if err := rows.Scan(&d.ID, &d.Name, &d.RepoID, &d.RepoName, &d.DeployType,
-			&d.Namespace, &d.ChartPath, &d.ValuesOverride, &d.ManifestPath, &d.KubeContext,
-			&d.Status, &d.LastOutput, &d.WorkspaceID, &d.DeployedAt, &d.CreatedAt); err != nil {
+		d, err := scanGitopsDeployment(rows)
+		if err != nil {
 			continue
 		}
 		deployments = append(deployments, d)
@@ -200,6 +272,8 @@ func CreateDeployment(w http.ResponseWriter, r *http.Request) {
 		ManifestPath   string `json:"manifest_path"`
 		KubeContext    string `json:"kube_context"`
 		WorkspaceID    string `json:"workspace_id"`
+		SyncInterval   int    `json:"sync_interval"`
+		ClusterID      int    `json:"cluster_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", 400)
@@ -209,10 +283,44 @@ func CreateDeployment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "name and deploy_type are required", 400)
 		return
 	}
+	if req.SyncInterval != 0 && req.SyncInterval < minSyncInterval {
+		http.Error(w, "sync_interval must be 0 or at least "+strconv.Itoa(minSyncInterval)+" seconds", 400)
+		return
+	}
+	if req.DeployType != "helm" && req.DeployType != "kubectl" && req.DeployType != "kustomize" {
+		http.Error(w, "deploy_type must be helm, kubectl or kustomize", 400)
+		return
+	}
 	if req.Namespace == "" {
 		req.Namespace = "default"
 	}
 
+	// Non-admins need the user_k8s_full role and may only deploy into
+	// namespaces assigned to them on a managed cluster.
+	user, _ := GetUserFromContext(r.Context())
+	if !HasRole(user.Role, "admin") {
+		if !HasRole(user.Role, "user_k8s_full") {
+			http.Error(w, "this action requires the user_k8s_full role", http.StatusForbidden)
+			return
+		}
+		if req.ClusterID <= 0 {
+			http.Error(w, "cluster_id is required", 400)
+			return
+		}
+	}
+	if req.ClusterID > 0 {
+		var exists int
+		database.DB.QueryRow(`SELECT COUNT(*) FROM k0s_clusters WHERE id = ?`, req.ClusterID).Scan(&exists)
+		if exists == 0 {
+			http.Error(w, "cluster not found", 400)
+			return
+		}
+		if !checkNamespaceAccess(user, req.ClusterID, req.Namespace) {
+			http.Error(w, "no access to namespace "+req.Namespace+" on this cluster", http.StatusForbidden)
+			return
+		}
+	}
+
 	// look up repo name
 	var repoName string
 	if req.RepoID > 0 {
@@ -221,26 +329,20 @@ func CreateDeployment(w http.ResponseWriter, r *http.Request) {
 
 	res, err := database.DB.Exec(
 		`INSERT INTO gitops_deployments
-		 (name, repo_id, repo_name, deploy_type, namespace, chart_path, values_override, manifest_path, kube_context, workspace_id)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		 (name, repo_id, repo_name, deploy_type, namespace, chart_path, values_override, manifest_path, kube_context, workspace_id,
+		  sync_interval, cluster_id, created_by)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		req.Name, nullInt(req.RepoID), nullStr(repoName), req.DeployType, req.Namespace,
 		nullStr(req.ChartPath), nullStr(req.ValuesOverride), nullStr(req.ManifestPath),
-		nullStr(req.KubeContext), nullStr(req.WorkspaceID))
+		nullStr(req.KubeContext), nullStr(req.WorkspaceID), req.SyncInterval,
+		nullInt(req.ClusterID), nullInt(user.ID))
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
 	id, _ := res.LastInsertId()
 
-	var d GitopsDeployment
-	database.DB.QueryRow(
-		`SELECT id, name, repo_id, repo_name, deploy_type, namespace,
-		        chart_path, values_override, manifest_path, kube_context,
-		        status, last_output, workspace_id, deployed_at, created_at
-		 FROM gitops_deployments WHERE id = ?`, id).
-		Scan(&d.ID, &d.Name, &d.RepoID, &d.RepoName, &d.DeployType,
-			&d.Namespace, &d.ChartPath, &d.ValuesOverride, &d.ManifestPath, &d.KubeContext,
-			&d.Status, &d.LastOutput, &d.WorkspaceID, &d.DeployedAt, &d.CreatedAt)
+	d, _ := loadGitopsDeployment(id)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(201)
@@ -249,15 +351,7 @@ func CreateDeployment(w http.ResponseWriter, r *http.Request) {
 
 func GetDeployment(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	var d GitopsDeployment
-	err := database.DB.QueryRow(
-		`SELECT id, name, repo_id, repo_name, deploy_type, namespace,
-		        chart_path, values_override, manifest_path, kube_context,
-		        status, last_output, workspace_id, deployed_at, created_at
-		 FROM gitops_deployments WHERE id = ?`, id).
-		Scan(&d.ID, &d.Name, &d.RepoID, &d.RepoName, &d.DeployType,
-			&d.Namespace, &d.ChartPath, &d.ValuesOverride, &d.ManifestPath, &d.KubeContext,
-			&d.Status, &d.LastOutput, &d.WorkspaceID, &d.DeployedAt, &d.CreatedAt)
+	d, err := loadGitopsDeployment(id)
 	if err != nil {
 		http.Error(w, "Not found", 404)
 		return
@@ -267,62 +361,87 @@ func GetDeployment(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteDeployment(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-	if _, err := database.DB.Exec(`DELETE FROM gitops_deployments WHERE id = ?`, id); err != nil {
+	d, ok := authorizeDeploymentChange(w, r)
+	if !ok {
+		return
+	}
+	if _, err := database.DB.Exec(`DELETE FROM gitops_deployments WHERE id = ?`, d.ID); err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
 	w.WriteHeader(204)
 }
 
-// TriggerDeploy runs the helm or kubectl deploy command and saves output + status.
+// TriggerDeploy checks out the deployment's repo, runs the helm or kubectl
+// deploy command and saves output, status and the deployed commit.
 func TriggerDeploy(w http.ResponseWriter, r *http.Request) {
-	idStr := mux.Vars(r)["id"]
-	id, _ := strconv.Atoi(idStr)
-
-	var d GitopsDeployment
-	err := database.DB.QueryRow(
-		`SELECT id, name, repo_id, repo_name, deploy_type, namespace,
-		        chart_path, values_override, manifest_path, kube_context,
-		        status, last_output, workspace_id, deployed_at, created_at
-		 FROM gitops_deployments WHERE id = ?`, id).
-		Scan(&d.ID, &d.Name, &d.RepoID, &d.RepoName, &d.DeployType,
-			&d.Namespace, &d.ChartPath, &d.ValuesOverride, &d.ManifestPath, &d.KubeContext,
-			&d.Status, &d.LastOutput, &d.WorkspaceID, &d.DeployedAt, &d.CreatedAt)
+	d, ok := authorizeDeploymentChange(w, r)
+	if !ok {
+		return
+	}
+	id := d.ID
+	user, _ := GetUserFromContext(r.Context())
+	if !claimDeploy(d.ID) {
+		http.Error(w, errDeployInProgress.Error(), http.StatusConflict)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	resolved, sha, release, err := checkoutDeployment(ctx, d, "")
 	if err != nil {
-		http.Error(w, "Not found", 404)
+		cancel()
+		releaseDeploy(d.ID)
+		database.DB.Exec(`UPDATE gitops_deployments SET last_sync_error = ? WHERE id = ?`, err.Error(), id)
+		http.Error(w, "Checkout failed: "+err.Error(), http.StatusBadGateway)
 		return
 	}
+	done := func() {
+		release()
+		cancel()
+		releaseDeploy(d.ID)
+	}
+
+	if admissionPoliciesEnabled() {
+		manifest, err := renderDeployment(resolved)
+		if err != nil {
+			done()
+			http.Error(w, "Rendering deployment for admission check: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !admitManifest(w, r, "gitops", deploymentClusterID(d), d.Namespace, manifest) {
+			done()
+			return
+		}
+	}
 
 	// Mark running
 	database.DB.Exec(`UPDATE gitops_deployments SET status = 'running' WHERE id = ?`, id)
 
 	go func() {
-		output, runErr := runDeploy(d)
-		status := "success"
-		if runErr != nil {
-			status = "failed"
-			output = output + "\nERROR: " + runErr.Error()
-		}
-		now := time.Now().Format(time.RFC3339)
-		database.DB.Exec(
-			`UPDATE gitops_deployments SET status = ?, last_output = ?, deployed_at = ? WHERE id = ?`,
-			status, output, now, id)
+		defer done()
+		finishDeployment(resolved, sha, deployTrigger{Kind: "manual", Actor: user.Username})
 	}()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "running", "message": "Deployment triggered"})
+	json.NewEncoder(w).Encode(map[string]string{"status": "running", "message": "Deployment triggered", "commit": sha})
 }
 
-// runDeploy builds and runs the helm or kubectl command.
+// runDeploy builds and runs the helm, kubectl or kustomize command.
+// Deployments targeting a managed cluster use its stored kubeconfig;
+// older ones fall back to kube_context in the server's own kubeconfig.
 func runDeploy(d GitopsDeployment) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
+	target, cleanup, err := deploymentKubeTarget(d)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
 	var cmdArgs []string
 
 	if d.DeployType == "helm" {
-		// helm upgrade --install <name> <chart> -n <ns> [--kube-context <ctx>] [-f <values>]
+		// helm upgrade --install <name> <chart> -n <ns> [--kubeconfig <kc> | --kube-context <ctx>] [-f <values>]
 		chartPath := ""
 		if d.ChartPath != nil {
 			chartPath = *d.ChartPath
@@ -331,38 +450,214 @@ func runDeploy(d GitopsDeployment) (string, error) {
 			return "", fmt.Errorf("chart_path is required for helm deployments")
 		}
 		releaseName := strings.ReplaceAll(strings.ToLower(d.Name), " ", "-")
-		cmdArgs = []string{"upgrade", "--install", releaseName, chartPath, "-n", d.Namespace, "--create-namespace"}
-		if d.KubeContext != nil && *d.KubeContext != "" {
-			cmdArgs = append(cmdArgs, "--kube-context", *d.KubeContext)
+		cmdArgs = []string{"upgrade", "--install", releaseName, chartPath, "-n", d.Namespace}
+		if !target.restricted {
+			// A service account can't create namespaces; assigned ones exist.
+			cmdArgs = append(cmdArgs, "--create-namespace")
 		}
+		cmdArgs = append(cmdArgs, target.helmArgs()...)
 		if d.ValuesOverride != nil && *d.ValuesOverride != "" {
-			// write values to a temp file
-			tmpFile := fmt.Sprintf("/tmp/gitops-values-%d.yaml", d.ID)
-			if err := writeFile(tmpFile, *d.ValuesOverride); err == nil {
-				cmdArgs = append(cmdArgs, "-f", tmpFile)
+			tmpFile, err := writeValuesFile(*d.ValuesOverride)
+			if err != nil {
+				return "", err
 			}
+			defer os.Remove(tmpFile)
+			cmdArgs = append(cmdArgs, "-f", tmpFile)
 		}
 		return runCmd(ctx, "helm", cmdArgs...)
 	}
 
-	if d.DeployType == "kubectl" {
+	if d.DeployType == "kubectl" || d.DeployType == "kustomize" {
 		manifestPath := ""
 		if d.ManifestPath != nil {
 			manifestPath = *d.ManifestPath
 		}
 		if manifestPath == "" {
-			return "", fmt.Errorf("manifest_path is required for kubectl deployments")
+			return "", fmt.Errorf("manifest_path is required for %s deployments", d.DeployType)
 		}
-		cmdArgs = []string{"apply", "-f", manifestPath, "-n", d.Namespace}
-		if d.KubeContext != nil && *d.KubeContext != "" {
-			cmdArgs = append(cmdArgs, "--context", *d.KubeContext)
+		if d.DeployType == "kustomize" {
+			cmdArgs = []string{"apply", "-k", manifestPath, "-n", d.Namespace}
+		} else {
+			cmdArgs = []string{"apply", "-f", manifestPath, "-n", d.Namespace}
+			if info, err := os.Stat(manifestPath); err == nil && info.IsDir() {
+				cmdArgs = append(cmdArgs, "-R")
+			}
 		}
+		cmdArgs = append(cmdArgs, target.kubectlArgs()...)
 		return runCmd(ctx, "kubectl", cmdArgs...)
 	}
 
 	return "", fmt.Errorf("unknown deploy_type: %s", d.DeployType)
 }
 
+// kubeTarget is where a deployment's helm/kubectl commands point: a
+// managed cluster's kubeconfig, or a context of the server's own.
+// restricted targets use a non-admin creator's service account.
+type kubeTarget struct {
+	kubeconfig string
+	context    string
+	restricted bool
+}
+
+func (t kubeTarget) kubectlArgs() []string {
+	switch {
+	case t.kubeconfig != "":
+		return []string{"--kubeconfig", t.kubeconfig}
+	case t.context != "":
+		return []string{"--context", t.context}
+	}
+	return nil
+}
+
+func (t kubeTarget) helmArgs() []string {
+	switch {
+	case t.kubeconfig != "":
+		return []string{"--kubeconfig", t.kubeconfig}
+	case t.context != "":
+		return []string{"--kube-context", t.context}
+	}
+	return nil
+}
+
+// deploymentKubeTarget picks the credentials a deployment runs with. A
+// deployment created by a non-admin runs as that user's service account,
+// bound to their assigned namespaces, so a chart or kustomization can't
+// reach beyond them.
+func deploymentKubeTarget(d GitopsDeployment) (kubeTarget, func(), error) {
+	creator, err := restrictedCreator(d)
+	if err != nil {
+		return kubeTarget{}, nil, err
+	}
+	if creator != nil {
+		if d.ClusterID == nil || *d.ClusterID == 0 {
+			return kubeTarget{}, nil, fmt.Errorf("deployments without a managed cluster require the admin role")
+		}
+		return serviceAccountKubeTarget(*d.ClusterID, *creator)
+	}
+	if d.ClusterID != nil && *d.ClusterID != 0 {
+		path, cleanup, err := writeClusterKubeconfig(*d.ClusterID)
+		if err != nil {
+			return kubeTarget{}, nil, err
+		}
+		return kubeTarget{kubeconfig: path}, cleanup, nil
+	}
+	if d.KubeContext != nil {
+		return kubeTarget{context: *d.KubeContext}, func() {}, nil
+	}
+	return kubeTarget{}, func() {}, nil
+}
+
+// serviceAccountKubeTarget writes a kubeconfig for user's service account on
+// the cluster, bound to the namespaces assigned to them there.
+func serviceAccountKubeTarget(clusterID int, user User) (kubeTarget, func(), error) {
+	assigned, err := assignedNamespaceSet(user, clusterID)
+	if err != nil {
+		return kubeTarget{}, nil, err
+	}
+	namespaces := make([]string, 0, len(assigned))
+	for ns := range assigned {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	kc, err := generateSAKubeconfigContent(strconv.Itoa(clusterID), user.Username, user.Role, namespaces)
+	if err != nil {
+		return kubeTarget{}, nil, fmt.Errorf("preparing the service account of %s: %v", user.Username, err)
+	}
+	path, cleanup, err := writeTempKubeconfig(kc)
+	if err != nil {
+		return kubeTarget{}, nil, err
+	}
+	return kubeTarget{kubeconfig: path, restricted: true}, cleanup, nil
+}
+
+// renderDeployment returns the manifests a deployment would apply, so the
+// admission gate can see its images: the manifest file or directory for
+// kubectl, "kubectl kustomize" output for kustomize and "helm template"
+// output for helm.
+func renderDeployment(d GitopsDeployment) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	switch d.DeployType {
+	case "helm":
+		if d.ChartPath == nil || *d.ChartPath == "" {
+			return nil, fmt.Errorf("chart_path is required for helm deployments")
+		}
+		releaseName := strings.ReplaceAll(strings.ToLower(d.Name), " ", "-")
+		args := []string{"template", releaseName, *d.ChartPath, "-n", d.Namespace}
+		if d.ValuesOverride != nil && *d.ValuesOverride != "" {
+			tmpFile, err := writeValuesFile(*d.ValuesOverride)
+			if err != nil {
+				return nil, err
+			}
+			defer os.Remove(tmpFile)
+			args = append(args, "-f", tmpFile)
+		}
+		cmd := exec.CommandContext(ctx, "helm", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("helm template: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	case "kubectl":
+		if d.ManifestPath == nil || *d.ManifestPath == "" {
+			return nil, fmt.Errorf("manifest_path is required for kubectl deployments")
+		}
+		return readManifests(*d.ManifestPath)
+	case "kustomize":
+		if d.ManifestPath == nil || *d.ManifestPath == "" {
+			return nil, fmt.Errorf("manifest_path is required for kustomize deployments")
+		}
+		cmd := exec.CommandContext(ctx, "kubectl", "kustomize", *d.ManifestPath)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("kubectl kustomize: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown deploy_type: %s", d.DeployType)
+}
+
+// readManifests concatenates a YAML file, or every YAML file under a
+// directory, into one multi-document stream.
+func readManifests(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return os.ReadFile(path)
+	}
+	var buf bytes.Buffer
+	err = filepath.WalkDir(path, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if e.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("\n---\n")
+		buf.Write(data)
+		return nil
+	})
+	return buf.Bytes(), err
+}
+
 func runCmd(ctx context.Context, name string, args ...string) (string, error) {
 	cmd := exec.CommandContext(ctx, name, args...)
 	var buf bytes.Buffer
@@ -372,8 +667,19 @@ func runCmd(ctx context.Context, name string, args ...string) (string, error) {
 	return buf.String(), err
 }
 
-func writeFile(path, content string) error {
-	return os.WriteFile(path, []byte(content), 0644)
+// writeValuesFile stores helm values in a private temp file; the caller
+// removes it once helm has run.
+func writeValuesFile(content string) (string, error) {
+	f, err := os.CreateTemp("", "gitops-values-*.yaml")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
 }
 
 // ─── Helpers ─────────────────────────────────────────────────────────────────
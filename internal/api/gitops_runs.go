@@ -0,0 +1,345 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// Every deploy is recorded in deployment_runs with the commit, a hash of
+// the rendered manifests and the values used, so it can be rolled back
+// to. Drift detection re-renders the deployed commit and asks the cluster
+// for a server-side diff; the result is the deployment's sync_status.
+
+// defaultDriftMinutes applies when "gitops_drift_interval_minutes" is
+// unset. Set it to 0 to turn drift detection off.
+const defaultDriftMinutes = 10
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type DeploymentRun struct {
+	ID             int     `json:"id"`
+	DeploymentID   int     `json:"deployment_id"`
+	CommitSHA      *string `json:"commit_sha"`
+	ManifestHash   *string `json:"manifest_hash"`
+	Trigger        string  `json:"trigger"` // manual, webhook, poll, rollback
+	Actor          string  `json:"actor"`
+	ValuesOverride *string `json:"values_override,omitempty"`
+	Status         string  `json:"status"` // running, success, failed
+	Log            *string `json:"log,omitempty"`
+	DurationMs     int64   `json:"duration_ms"`
+	StartedAt      string  `json:"started_at"`
+	FinishedAt     *string `json:"finished_at"`
+}
+
+// deployTrigger says who or what started a deploy.
+type deployTrigger struct {
+	Kind  string // manual, webhook, poll, rollback
+	Actor string
+}
+
+// ── Runs ────────────────────────────────────────────────────────────────────
+
+func manifestHash(manifest []byte) string {
+	sum := sha256.Sum256(manifest)
+	return hex.EncodeToString(sum[:])
+}
+
+func startDeploymentRun(d GitopsDeployment, sha string, t deployTrigger) int64 {
+	res, err := database.DB.Exec(
+		`INSERT INTO deployment_runs (deployment_id, commit_sha, trigger, actor, values_override, status)
+		 VALUES (?, ?, ?, ?, ?, 'running')`,
+		d.ID, nullStr(sha), t.Kind, t.Actor, d.ValuesOverride)
+	if err != nil {
+		log.Printf("[GitOps] recording run for %s: %v", d.Name, err)
+		return 0
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+func finishDeploymentRun(runID int64, status, output, hash string, started time.Time) {
+	if runID == 0 {
+		return
+	}
+	database.DB.Exec(
+		`UPDATE deployment_runs SET status = ?, log = ?, manifest_hash = ?, duration_ms = ?, finished_at = CURRENT_TIMESTAMP
+		 WHERE id = ?`,
+		status, output, nullStr(hash), time.Since(started).Milliseconds(), runID)
+}
+
+func loadDeploymentRun(id interface{}) (DeploymentRun, error) {
+	var run DeploymentRun
+	err := database.DB.QueryRow(
+		`SELECT id, deployment_id, commit_sha, manifest_hash, trigger, actor, values_override, status, log,
+		        duration_ms, started_at, finished_at
+		 FROM deployment_runs WHERE id = ?`, id).
+		Scan(&run.ID, &run.DeploymentID, &run.CommitSHA, &run.ManifestHash, &run.Trigger, &run.Actor,
+			&run.ValuesOverride, &run.Status, &run.Log, &run.DurationMs, &run.StartedAt, &run.FinishedAt)
+	return run, err
+}
+
+// ── Drift ───────────────────────────────────────────────────────────────────
+
+func driftInterval() time.Duration {
+	minutes := defaultDriftMinutes
+	if v, err := database.GetSetting("gitops_drift_interval_minutes"); err == nil && v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			minutes = n
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// diffDeployment renders what was deployed and diffs it against the live
+// objects with "kubectl diff --server-side". kubectl exits 1 when there
+// are differences.
+func diffDeployment(ctx context.Context, d GitopsDeployment) (inSync bool, diff string, err error) {
+	commit := ""
+	if d.DeployedSHA != nil {
+		commit = *d.DeployedSHA
+	}
+	resolved, _, release, err := checkoutDeployment(ctx, d, commit)
+	if err != nil {
+		return false, "", err
+	}
+	defer release()
+
+	manifest, err := renderDeployment(resolved)
+	if err != nil {
+		return false, "", err
+	}
+	tmp, err := os.CreateTemp("", "gitops-rendered-*.yaml")
+	if err != nil {
+		return false, "", err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Write(manifest)
+	tmp.Close()
+
+	target, cleanup, err := deploymentKubeTarget(d)
+	if err != nil {
+		return false, "", err
+	}
+	defer cleanup()
+	args := append([]string{"diff", "--server-side", "-f", tmp.Name(), "-n", d.Namespace}, target.kubectlArgs()...)
+	out, err := runCmd(ctx, "kubectl", args...)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, "", nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, out, nil
+	}
+	return false, "", fmt.Errorf("kubectl diff: %v: %s", err, out)
+}
+
+func checkDeploymentDrift(d GitopsDeployment) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	now := time.Now().Format(time.RFC3339)
+	inSync, diff, err := diffDeployment(ctx, d)
+	if err != nil {
+		database.DB.Exec(
+			`UPDATE gitops_deployments SET sync_status = 'Unknown', drift_checked_at = ?, drift_diff = ? WHERE id = ?`,
+			now, err.Error(), d.ID)
+		return "Unknown", err
+	}
+	status := "Synced"
+	if !inSync {
+		status = "OutOfSync"
+	}
+	database.DB.Exec(
+		`UPDATE gitops_deployments SET sync_status = ?, drift_checked_at = ?, drift_diff = ? WHERE id = ?`,
+		status, now, nullStr(diff), d.ID)
+	return status, nil
+}
+
+// detectDrift checks every successfully deployed deployment that is due.
+func detectDrift() {
+	interval := driftInterval()
+	if interval <= 0 {
+		return
+	}
+	rows, err := database.DB.Query(
+		`SELECT ` + gitopsDeploymentColumns + ` FROM gitops_deployments WHERE status = 'success'`)
+	if err != nil {
+		return
+	}
+	var due []GitopsDeployment
+	for rows.Next() {
+		d, err := scanGitopsDeployment(rows)
+		if err != nil {
+			continue
+		}
+		if d.DriftCheckedAt != nil {
+			if last, err := parseDBTime(*d.DriftCheckedAt); err == nil && time.Since(last) < interval {
+				continue
+			}
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		if !claimDeploy(d.ID) {
+			continue
+		}
+		if status, err := checkDeploymentDrift(d); err != nil {
+			log.Printf("[GitOps] drift check %s: %v", d.Name, err)
+		} else if status == "OutOfSync" {
+			log.Printf("[GitOps] %s is out of sync with the cluster", d.Name)
+		}
+		releaseDeploy(d.ID)
+	}
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// GET /api/cicd/gitops/deployments/{id}/runs
+func ListDeploymentRuns(w http.ResponseWriter, r *http.Request) {
+	rows, err := database.DB.Query(
+		`SELECT id, deployment_id, commit_sha, manifest_hash, trigger, actor, status, duration_ms, started_at, finished_at
+		 FROM deployment_runs WHERE deployment_id = ? ORDER BY id DESC LIMIT 200`, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	runs := []DeploymentRun{}
+	for rows.Next() {
+		var run DeploymentRun
+		if err := rows.Scan(&run.ID, &run.DeploymentID, &run.CommitSHA, &run.ManifestHash, &run.Trigger,
+			&run.Actor, &run.Status, &run.DurationMs, &run.StartedAt, &run.FinishedAt); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// GET /api/cicd/gitops/runs/{id}
+func GetDeploymentRun(w http.ResponseWriter, r *http.Request) {
+	run, err := loadDeploymentRun(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// POST /api/cicd/gitops/deployments/{id}/rollback
+// Body: {"run_id": 12}
+// Redeploys the run's commit and values and pauses automatic sync so the
+// reconciler doesn't immediately roll forward again.
+func RollbackDeployment(w http.ResponseWriter, r *http.Request) {
+	user, _ := GetUserFromContext(r.Context())
+	d, ok := authorizeDeploymentChange(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		RunID int `json:"run_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RunID == 0 {
+		http.Error(w, "run_id is required", 400)
+		return
+	}
+	run, err := loadDeploymentRun(req.RunID)
+	if err != nil || run.DeploymentID != d.ID {
+		http.Error(w, "run not found for this deployment", 404)
+		return
+	}
+	if run.Status != "success" {
+		http.Error(w, "can only roll back to a successful run", 400)
+		return
+	}
+	commit := ""
+	if run.CommitSHA != nil {
+		commit = *run.CommitSHA
+	}
+	d.ValuesOverride = run.ValuesOverride
+
+	if !claimDeploy(d.ID) {
+		http.Error(w, errDeployInProgress.Error(), http.StatusConflict)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	resolved, sha, release, err := checkoutDeployment(ctx, d, commit)
+	if err != nil {
+		cancel()
+		releaseDeploy(d.ID)
+		http.Error(w, "Checkout failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	done := func() {
+		release()
+		cancel()
+		releaseDeploy(d.ID)
+	}
+	if admissionPoliciesEnabled() {
+		manifest, err := renderDeployment(resolved)
+		if err != nil {
+			done()
+			http.Error(w, "Rendering deployment for admission check: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !admitManifest(w, r, "gitops", deploymentClusterID(d), d.Namespace, manifest) {
+			done()
+			return
+		}
+	}
+
+	database.DB.Exec(`UPDATE gitops_deployments SET status = 'running', paused = 1, values_override = ? WHERE id = ?`,
+		d.ValuesOverride, d.ID)
+	recordActivityLog("gitops_rollback", d.Name,
+		fmt.Sprintf("rolled back to run %d (%s) by %s; auto-sync paused", run.ID, shortSHA(commit), user.Username), "success")
+	go func() {
+		defer done()
+		finishDeployment(resolved, sha, deployTrigger{Kind: "rollback", Actor: user.Username})
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "running", "commit": sha, "paused": true,
+		"message": "Rolling back; automatic sync is paused until resumed",
+	})
+}
+
+// POST /api/cicd/gitops/deployments/{id}/drift
+// Runs a drift check now and returns the diff.
+func CheckDeploymentDrift(w http.ResponseWriter, r *http.Request) {
+	d, err := loadGitopsDeployment(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	if !claimDeploy(d.ID) {
+		http.Error(w, errDeployInProgress.Error(), http.StatusConflict)
+		return
+	}
+	status, err := checkDeploymentDrift(d)
+	releaseDeploy(d.ID)
+	resp := map[string]interface{}{"sync_status": status}
+	if err != nil {
+		resp["error"] = err.Error()
+	} else if d, err = loadGitopsDeployment(d.ID); err == nil && d.DriftDiff != nil {
+		resp["diff"] = *d.DriftDiff
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
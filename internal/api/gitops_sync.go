@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// Deployments backed by a repo are deployed from the server's cached
+// checkout of that repo, with chart_path/manifest_path resolved inside
+// it. The reconciler polls each unpaused deployment with a sync interval
+// and redeploys when the branch head differs from the deployed commit.
+
+// minSyncInterval keeps the reconciler from hammering remotes.
+const minSyncInterval = 30
+
+var errDeployInProgress = errors.New("a deploy of this deployment is already running")
+
+// activeDeploys holds the ids of deployments currently being deployed.
+var activeDeploys sync.Map
+
+func claimDeploy(id int) bool {
+	_, busy := activeDeploys.LoadOrStore(id, true)
+	return !busy
+}
+
+func releaseDeploy(id int) { activeDeploys.Delete(id) }
+
+// checkoutDeployment syncs the deployment's repo, to commit if given,
+// and returns a copy of d whose paths point into the checkout, with the
+// commit it is at. Deployments without a repo keep their paths. release
+// must be called once the paths are no longer needed.
+func checkoutDeployment(ctx context.Context, d GitopsDeployment, commit string) (resolved GitopsDeployment, sha string, release func(), err error) {
+	if d.RepoID == nil || *d.RepoID == 0 {
+		return d, "", func() {}, nil
+	}
+	src, err := loadGitRepoSource(*d.RepoID)
+	if err != nil {
+		return d, "", nil, err
+	}
+	dir, sha, unlock, err := syncGitRepo(ctx, src, commit)
+	if err != nil {
+		return d, "", nil, err
+	}
+	resolve := func(p *string) (*string, error) {
+		if p == nil || *p == "" {
+			return p, nil
+		}
+		full, err := resolveRepoPath(dir, *p)
+		if err != nil {
+			return nil, err
+		}
+		return &full, nil
+	}
+	if d.ChartPath, err = resolve(d.ChartPath); err != nil {
+		unlock()
+		return d, "", nil, err
+	}
+	if d.ManifestPath, err = resolve(d.ManifestPath); err != nil {
+		unlock()
+		return d, "", nil, err
+	}
+	return d, sha, unlock, nil
+}
+
+// finishDeployment runs a checked-out deployment and records the outcome
+// on the deployment and as a deployment run.
+func finishDeployment(d GitopsDeployment, sha string, t deployTrigger) {
+	started := time.Now()
+	runID := startDeploymentRun(d, sha, t)
+	hash := ""
+	if manifest, err := renderDeployment(d); err == nil {
+		hash = manifestHash(manifest)
+	}
+	output, runErr := runDeploy(d)
+	status := "success"
+	var syncErr interface{}
+	if runErr != nil {
+		status = "failed"
+		output = output + "\nERROR: " + runErr.Error()
+		syncErr = runErr.Error()
+	}
+	now := time.Now().Format(time.RFC3339)
+	if runErr == nil && sha != "" {
+		database.DB.Exec(
+			`UPDATE gitops_deployments SET status = ?, last_output = ?, deployed_at = ?, deployed_sha = ?,
+			        last_sync_at = ?, last_sync_error = NULL, sync_status = 'Synced', drift_checked_at = ?,
+			        drift_diff = NULL WHERE id = ?`,
+			status, output, now, sha, now, now, d.ID)
+	} else {
+		database.DB.Exec(
+			`UPDATE gitops_deployments SET status = ?, last_output = ?, deployed_at = ?,
+			        last_sync_at = ?, last_sync_error = ? WHERE id = ?`,
+			status, output, now, now, syncErr, d.ID)
+	}
+	finishDeploymentRun(runID, status, output, hash, started)
+	database.LogActivity("gitops_deploy", d.Name, status)
+}
+
+// ── Reconciler ──────────────────────────────────────────────────────────────
+
+// StartGitopsReconciler checks repo-backed deployments for new commits
+// and deployed ones for drift.
+func StartGitopsReconciler() {
+	go func() {
+		ticker := time.NewTicker(minSyncInterval * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			reconcileDeployments()
+			detectDrift()
+		}
+	}()
+}
+
+func reconcileDeployments() {
+	rows, err := database.DB.Query(
+		`SELECT ` + gitopsDeploymentColumns + ` FROM gitops_deployments
+		 WHERE repo_id IS NOT NULL AND sync_interval > 0 AND paused = 0`)
+	if err != nil {
+		return
+	}
+	var due []GitopsDeployment
+	for rows.Next() {
+		d, err := scanGitopsDeployment(rows)
+		if err != nil {
+			continue
+		}
+		if d.LastSyncAt != nil {
+			if last, err := parseDBTime(*d.LastSyncAt); err == nil &&
+				time.Since(last) < time.Duration(d.SyncInterval)*time.Second {
+				continue
+			}
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		if !claimDeploy(d.ID) {
+			continue
+		}
+		reconcileDeployment(d)
+		releaseDeploy(d.ID)
+	}
+}
+
+func reconcileDeployment(d GitopsDeployment) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	now := time.Now().Format(time.RFC3339)
+	fail := func(err error) {
+		log.Printf("[GitOps] reconcile %s: %v", d.Name, err)
+		database.DB.Exec(`UPDATE gitops_deployments SET last_sync_at = ?, last_sync_error = ? WHERE id = ?`,
+			now, err.Error(), d.ID)
+	}
+
+	if err := creatorMayDeploy(d); err != nil {
+		fail(err)
+		return
+	}
+	src, err := loadGitRepoSource(*d.RepoID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	head, err := remoteHeadSHA(ctx, src)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if d.DeployedSHA != nil && *d.DeployedSHA == head {
+		database.DB.Exec(`UPDATE gitops_deployments SET last_sync_at = ?, last_sync_error = NULL WHERE id = ?`,
+			now, d.ID)
+		return
+	}
+
+	log.Printf("[GitOps] %s: %s moved to %s, redeploying", d.Name, src.Branch, shortSHA(head))
+	if err := deployHead(ctx, d, deployTrigger{Kind: "poll", Actor: "reconciler"}); err != nil {
+		fail(err)
+	}
+}
+
+// deployHead deploys the head of the deployment's branch for triggers
+// nobody is watching, marking it blocked when the admission gate refuses
+// the rendered manifest.
+func deployHead(ctx context.Context, d GitopsDeployment, t deployTrigger) error {
+	resolved, sha, release, err := checkoutDeployment(ctx, d, "")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if admissionPoliciesEnabled() {
+		manifest, err := renderDeployment(resolved)
+		if err != nil {
+			return fmt.Errorf("rendering for admission check: %v", err)
+		}
+		if reasons, blocked := admissionBlocksManifest("gitops", deploymentClusterID(d), d.Namespace, manifest, t.Actor); blocked {
+			database.DB.Exec(`UPDATE gitops_deployments SET status = 'blocked', last_output = ? WHERE id = ?`,
+				"Refused by admission policy: "+reasons, d.ID)
+			return fmt.Errorf("refused by admission policy: %s", reasons)
+		}
+	}
+
+	database.DB.Exec(`UPDATE gitops_deployments SET status = 'running' WHERE id = ?`, d.ID)
+	finishDeployment(resolved, sha, t)
+	return nil
+}
+
+func deploymentClusterID(d GitopsDeployment) int {
+	if d.ClusterID == nil {
+		return 0
+	}
+	return *d.ClusterID
+}
+
+// creatorMayDeploy re-checks, for unattended syncs, that a non-admin
+// creator still has the role and access to the deployment's namespace.
+func creatorMayDeploy(d GitopsDeployment) error {
+	u, err := restrictedCreator(d)
+	if err != nil || u == nil {
+		return err
+	}
+	if !HasRole(u.Role, "user_k8s_full") {
+		return fmt.Errorf("%s no longer has the user_k8s_full role", u.Username)
+	}
+	if d.ClusterID == nil || !checkNamespaceAccess(*u, *d.ClusterID, d.Namespace) {
+		return fmt.Errorf("%s no longer has access to namespace %s", u.Username, d.Namespace)
+	}
+	return nil
+}
+
+// restrictedCreator returns the creator of a deployment when they are not
+// an admin, or nil. Deployments created before creators were recorded run
+// as admin.
+func restrictedCreator(d GitopsDeployment) (*User, error) {
+	if d.CreatedBy == nil {
+		return nil, nil
+	}
+	var u User
+	err := database.DB.QueryRow(`SELECT id, username, role FROM users WHERE id = ?`, *d.CreatedBy).
+		Scan(&u.ID, &u.Username, &u.Role)
+	if err != nil {
+		return nil, fmt.Errorf("creator of deployment %s no longer exists", d.Name)
+	}
+	if HasRole(u.Role, "admin") {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// authorizeDeploymentChange loads a deployment for a change, a deploy or a
+// rollback. Non-admins need the user_k8s_full role and access to its
+// namespace; deployments that aren't bound to a managed cluster are
+// admin-only.
+func authorizeDeploymentChange(w http.ResponseWriter, r *http.Request) (GitopsDeployment, bool) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return GitopsDeployment{}, false
+	}
+	d, err := loadGitopsDeployment(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return d, false
+	}
+	if !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_k8s_full") {
+		http.Error(w, "this action requires the user_k8s_full role", http.StatusForbidden)
+		return d, false
+	}
+	if !HasRole(user.Role, "admin") && (d.ClusterID == nil || !checkNamespaceAccess(user, *d.ClusterID, d.Namespace)) {
+		http.Error(w, "no access to namespace "+d.Namespace+" on this cluster", http.StatusForbidden)
+		return d, false
+	}
+	return d, true
+}
+
+func setDeploymentPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	d, ok := authorizeDeploymentChange(w, r)
+	if !ok {
+		return
+	}
+	id := strconv.Itoa(d.ID)
+	if _, err := database.DB.Exec(`UPDATE gitops_deployments SET paused = ? WHERE id = ?`, boolInt(paused), d.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	action := "gitops_resume"
+	if paused {
+		action = "gitops_pause"
+	}
+	database.LogActivity(action, id, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "paused": paused})
+}
+
+// POST /api/cicd/gitops/deployments/{id}/pause
+func PauseDeployment(w http.ResponseWriter, r *http.Request) { setDeploymentPaused(w, r, true) }
+
+// POST /api/cicd/gitops/deployments/{id}/resume
+func ResumeDeployment(w http.ResponseWriter, r *http.Request) { setDeploymentPaused(w, r, false) }
+
+// PUT /api/cicd/gitops/deployments/{id}/sync
+// Body: {"sync_interval": 300}  (seconds; 0 turns automatic sync off)
+func UpdateDeploymentSync(w http.ResponseWriter, r *http.Request) {
+	d, ok := authorizeDeploymentChange(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		SyncInterval int `json:"sync_interval"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", 400)
+		return
+	}
+	if req.SyncInterval != 0 && req.SyncInterval < minSyncInterval {
+		http.Error(w, "sync_interval must be 0 or at least "+strconv.Itoa(minSyncInterval)+" seconds", 400)
+		return
+	}
+	if _, err := database.DB.Exec(`UPDATE gitops_deployments SET sync_interval = ? WHERE id = ?`,
+		req.SyncInterval, d.ID); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "sync_interval": req.SyncInterval})
+}
+
+// removeRepoCache drops a repo's cached checkout and deploy key.
+func removeRepoCache(id int) {
+	os.RemoveAll(filepath.Join(gitCacheDir, fmt.Sprintf("repo-%d", id)))
+	os.Remove(filepath.Join(gitCacheDir, "keys", fmt.Sprintf("repo-%d", id)))
+}
@@ -0,0 +1,620 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"github.com/gorilla/mux"
+)
+
+// Git hosts POST push events to /api/webhooks/git/{repoId}. The endpoint
+// sits outside AuthMiddleware; a delivery is only acted on when it is
+// signed with the repo's webhook secret (HMAC-SHA256 for GitHub and
+// Gitea, the shared token for GitLab). A push to the repo's tracked
+// branch redeploys every unpaused deployment of the repo and, when
+// build_on_push is set, re-runs the repo's last successful image build.
+// Every delivery is stored raw so it can be inspected and replayed; a
+// provider's redelivery of one already stored is acknowledged and ignored.
+
+const maxWebhookPayload = 5 << 20
+
+// maxRejectedPayload caps what is kept of an unsigned delivery: enough to
+// see what was sent without letting anyone fill the database.
+const maxRejectedPayload = 4 << 10
+
+// maxRejectedDeliveries is how many rejected deliveries are kept per repo;
+// older ones are pruned as new ones arrive.
+const maxRejectedDeliveries = 50
+
+// ── Models ──────────────────────────────────────────────────────────────────
+
+type WebhookDelivery struct {
+	ID             int               `json:"id"`
+	RepoID         int               `json:"repo_id"`
+	Provider       string            `json:"provider"` // github, gitlab, gitea
+	Event          string            `json:"event"`
+	DeliveryID     string            `json:"delivery_id"`
+	Ref            string            `json:"ref"`
+	CommitSHA      string            `json:"commit_sha"`
+	SignatureValid bool              `json:"signature_valid"`
+	Status         string            `json:"status"` // received, rejected, ignored, processed, failed
+	Result         string            `json:"result"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Payload        string            `json:"payload,omitempty"`
+	ReplayOf       *int              `json:"replay_of"`
+	CreatedAt      string            `json:"created_at"`
+}
+
+// gitPush is the provider-neutral part of a push payload.
+type gitPush struct {
+	Ref   string
+	After string
+	URLs  []string
+}
+
+// ── Verification ────────────────────────────────────────────────────────────
+
+// webhookProvider identifies the sender from its event headers. Gitea also
+// sends X-GitHub-Event for compatibility, so it is checked first.
+func webhookProvider(h http.Header) (provider, event, deliveryID string) {
+	switch {
+	case h.Get("X-Gitea-Event") != "":
+		return "gitea", h.Get("X-Gitea-Event"), h.Get("X-Gitea-Delivery")
+	case h.Get("X-Gitlab-Event") != "":
+		return "gitlab", h.Get("X-Gitlab-Event"), h.Get("X-Gitlab-Event-UUID")
+	case h.Get("X-GitHub-Event") != "":
+		return "github", h.Get("X-GitHub-Event"), h.Get("X-GitHub-Delivery")
+	}
+	return "", "", ""
+}
+
+func verifyWebhook(provider string, h http.Header, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	switch provider {
+	case "gitlab":
+		return subtle.ConstantTimeCompare([]byte(h.Get("X-Gitlab-Token")), []byte(secret)) == 1
+	case "gitea":
+		if sig := h.Get("X-Gitea-Signature"); sig != "" {
+			return validHMAC(sig, body, secret)
+		}
+	}
+	sig := h.Get("X-Hub-Signature-256")
+	if !strings.HasPrefix(sig, "sha256=") {
+		return false
+	}
+	return validHMAC(strings.TrimPrefix(sig, "sha256="), body, secret)
+}
+
+func validHMAC(sigHex string, body []byte, secret string) bool {
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// webhookHeaders keeps the headers worth looking at when debugging a
+// delivery. GitLab's token is the secret itself and is never stored.
+func webhookHeaders(h http.Header) map[string]string {
+	kept := map[string]string{}
+	for name := range h {
+		lower := strings.ToLower(name)
+		switch {
+		case lower == "x-gitlab-token":
+			kept[name] = "[redacted]"
+		case lower == "content-type", lower == "user-agent",
+			strings.HasPrefix(lower, "x-github-"), strings.HasPrefix(lower, "x-gitea-"),
+			strings.HasPrefix(lower, "x-gitlab-"), strings.HasPrefix(lower, "x-hub-signature"):
+			kept[name] = h.Get(name)
+		}
+	}
+	return kept
+}
+
+// ── Payloads ────────────────────────────────────────────────────────────────
+
+func isPushEvent(provider, event string) bool {
+	if provider == "gitlab" {
+		return event == "Push Hook"
+	}
+	return event == "push"
+}
+
+func parseGitPush(body []byte) (gitPush, error) {
+	var p struct {
+		Ref        string `json:"ref"`
+		After      string `json:"after"`
+		Repository struct {
+			CloneURL   string `json:"clone_url"`
+			SSHURL     string `json:"ssh_url"`
+			HTMLURL    string `json:"html_url"`
+			GitHTTPURL string `json:"git_http_url"`
+			GitSSHURL  string `json:"git_ssh_url"`
+		} `json:"repository"`
+		Project struct {
+			GitHTTPURL string `json:"git_http_url"`
+			GitSSHURL  string `json:"git_ssh_url"`
+			WebURL     string `json:"web_url"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return gitPush{}, fmt.Errorf("invalid push payload: %v", err)
+	}
+	if p.Ref == "" {
+		return gitPush{}, fmt.Errorf("push payload has no ref")
+	}
+	push := gitPush{Ref: p.Ref, After: p.After}
+	for _, u := range []string{
+		p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL,
+		p.Repository.GitHTTPURL, p.Repository.GitSSHURL,
+		p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL,
+	} {
+		if u != "" {
+			push.URLs = append(push.URLs, u)
+		}
+	}
+	return push, nil
+}
+
+// normalizeRepoURL reduces https, ssh:// and scp-style git URLs to
+// host/path so the different forms of one repository compare equal.
+func normalizeRepoURL(u string) string {
+	u = strings.TrimSpace(u)
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	} else if colon := strings.Index(u, ":"); colon > 0 && !strings.Contains(u[:colon], "/") {
+		u = u[:colon] + "/" + u[colon+1:]
+	}
+	host, path := u, ""
+	if slash := strings.Index(u, "/"); slash >= 0 {
+		host, path = u[:slash], u[slash:]
+	}
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if colon := strings.Index(host, ":"); colon >= 0 {
+		host = host[:colon]
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git")
+	return strings.ToLower(host + path)
+}
+
+func pushMatchesRepo(push gitPush, repoURL string) bool {
+	if len(push.URLs) == 0 {
+		return true
+	}
+	want := normalizeRepoURL(repoURL)
+	for _, u := range push.URLs {
+		if normalizeRepoURL(u) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// ── Processing ──────────────────────────────────────────────────────────────
+
+// processGitWebhook acts on a verified delivery and returns the delivery
+// status and a summary of what was triggered.
+func processGitWebhook(src gitRepoSource, buildOnPush bool, provider, event string, body []byte, actor string) (push gitPush, status, result string) {
+	if !isPushEvent(provider, event) {
+		return push, "ignored", fmt.Sprintf("%s event ignored", event)
+	}
+	push, err := parseGitPush(body)
+	if err != nil {
+		return push, "failed", err.Error()
+	}
+	if strings.Trim(push.After, "0") == "" {
+		return push, "ignored", "branch deleted"
+	}
+	if push.Ref != "refs/heads/"+src.Branch {
+		return push, "ignored", fmt.Sprintf("push to %s, tracking refs/heads/%s", push.Ref, src.Branch)
+	}
+	if !pushMatchesRepo(push, src.URL) {
+		return push, "ignored", fmt.Sprintf("payload is for %s, not %s", push.URLs[0], src.URL)
+	}
+
+	notes := triggerWebhookDeploys(src.ID, push.After, deployTrigger{Kind: "webhook", Actor: actor})
+	if buildOnPush {
+		notes = append(notes, triggerPushBuild(src.ID, actor))
+	}
+	if len(notes) == 0 {
+		return push, "processed", "no deployments or builds use this repository"
+	}
+	return push, "processed", strings.Join(notes, "; ")
+}
+
+// triggerWebhookDeploys starts a deploy of each unpaused deployment of the
+// repo that isn't already at sha, and reports what happened to each.
+func triggerWebhookDeploys(repoID int, sha string, t deployTrigger) []string {
+	rows, err := database.DB.Query(
+		`SELECT `+gitopsDeploymentColumns+` FROM gitops_deployments WHERE repo_id = ? AND paused = 0`, repoID)
+	if err != nil {
+		return []string{"listing deployments: " + err.Error()}
+	}
+	var deployments []GitopsDeployment
+	for rows.Next() {
+		if d, err := scanGitopsDeployment(rows); err == nil {
+			deployments = append(deployments, d)
+		}
+	}
+	rows.Close()
+
+	var notes []string
+	for _, d := range deployments {
+		if d.DeployedSHA != nil && *d.DeployedSHA == sha {
+			notes = append(notes, fmt.Sprintf("%s: already at %s", d.Name, shortSHA(sha)))
+			continue
+		}
+		if err := creatorMayDeploy(d); err != nil {
+			notes = append(notes, fmt.Sprintf("%s: %v", d.Name, err))
+			continue
+		}
+		if !claimDeploy(d.ID) {
+			notes = append(notes, fmt.Sprintf("%s: deploy already running", d.Name))
+			continue
+		}
+		go func(d GitopsDeployment) {
+			defer releaseDeploy(d.ID)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+			if err := deployHead(ctx, d, t); err != nil {
+				log.Printf("[GitOps] webhook deploy %s: %v", d.Name, err)
+				database.DB.Exec(`UPDATE gitops_deployments SET last_sync_at = ?, last_sync_error = ? WHERE id = ?`,
+					time.Now().Format(time.RFC3339), err.Error(), d.ID)
+			}
+		}(d)
+		notes = append(notes, fmt.Sprintf("%s: deploying", d.Name))
+	}
+	return notes
+}
+
+// triggerPushBuild re-runs the repo's most recent successful git build
+// with the same options against the new branch head.
+func triggerPushBuild(repoID int, actor string) string {
+	b, err := scanImageBuild(database.DB.QueryRow(
+		`SELECT `+imageBuildColumns+` FROM image_builds
+		 WHERE repo_id = ? AND source_type = 'git' AND status = 'success'
+		 ORDER BY id DESC LIMIT 1`, repoID))
+	if err == sql.ErrNoRows {
+		return "build: no previous successful build to repeat"
+	}
+	if err != nil {
+		return "build: " + err.Error()
+	}
+	req := ImageBuildRequest{
+		RepoID:     repoID,
+		Subpath:    b.ContextPath,
+		Dockerfile: b.Dockerfile,
+		Tags:       b.Tags,
+		BuildArgs:  b.BuildArgs,
+		Target:     b.Target,
+		Labels:     b.Labels,
+		NoCache:    b.NoCache,
+	}
+	if b.RegistryID != nil && b.PushRef != "" {
+		req.RegistryID = *b.RegistryID
+		_, req.PushRepository = splitRegistryHost(b.PushRef)
+	}
+	id, err := queueImageBuild(b.HostID, "git", req, "", actor)
+	if err != nil {
+		return "build: " + err.Error()
+	}
+	return fmt.Sprintf("build #%d queued (repeating #%d)", id, b.ID)
+}
+
+func loadRepoWebhook(id int) (src gitRepoSource, secret string, buildOnPush bool, err error) {
+	if src, err = loadGitRepoSource(id); err != nil {
+		return src, "", false, err
+	}
+	var s sql.NullString
+	var build int
+	err = database.DB.QueryRow(`SELECT webhook_secret, build_on_push FROM gitops_repos WHERE id = ?`, id).
+		Scan(&s, &build)
+	return src, database.OpenNullSecret(s), build == 1, err
+}
+
+func recordWebhookDelivery(d WebhookDelivery) int64 {
+	headers, _ := json.Marshal(d.Headers)
+	res, err := database.DB.Exec(
+		`INSERT INTO webhook_deliveries (repo_id, provider, event, delivery_id, ref, commit_sha, signature_valid,
+		                                 status, result, headers, payload, replay_of)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.RepoID, d.Provider, d.Event, d.DeliveryID, d.Ref, d.CommitSHA, boolInt(d.SignatureValid),
+		d.Status, d.Result, string(headers), d.Payload, d.ReplayOf)
+	if err != nil {
+		log.Printf("[GitOps] recording webhook delivery: %v", err)
+		return 0
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+const webhookDeliveryColumns = `id, repo_id, provider, event, delivery_id, ref, commit_sha, signature_valid,
+	status, result, replay_of, created_at`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var valid int
+	err := row.Scan(&d.ID, &d.RepoID, &d.Provider, &d.Event, &d.DeliveryID, &d.Ref, &d.CommitSHA, &valid,
+		&d.Status, &d.Result, &d.ReplayOf, &d.CreatedAt)
+	d.SignatureValid = valid == 1
+	return d, err
+}
+
+// pruneRejectedDeliveries keeps the newest maxRejectedDeliveries rejected
+// deliveries of a repo.
+func pruneRejectedDeliveries(repoID int) {
+	database.DB.Exec(
+		`DELETE FROM webhook_deliveries WHERE repo_id = ? AND status = 'rejected' AND id NOT IN (
+		   SELECT id FROM webhook_deliveries WHERE repo_id = ? AND status = 'rejected' ORDER BY id DESC LIMIT ?)`,
+		repoID, repoID, maxRejectedDeliveries)
+}
+
+// seenDelivery returns the stored signed delivery with the provider's
+// delivery ID, or 0.
+func seenDelivery(repoID int, deliveryID string) int64 {
+	if deliveryID == "" {
+		return 0
+	}
+	var id int64
+	database.DB.QueryRow(
+		`SELECT id FROM webhook_deliveries
+		 WHERE repo_id = ? AND delivery_id = ? AND signature_valid = 1 AND replay_of IS NULL
+		 ORDER BY id LIMIT 1`, repoID, deliveryID).Scan(&id)
+	return id
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/webhooks/git/{id}
+// Unauthenticated; the body must be signed with the repo's webhook secret.
+func ReceiveGitWebhook(w http.ResponseWriter, r *http.Request) {
+	repoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	src, secret, buildOnPush, err := loadRepoWebhook(repoID)
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	provider, event, deliveryID := webhookProvider(r.Header)
+	if provider == "" {
+		http.Error(w, "Unrecognised webhook sender", 400)
+		return
+	}
+
+	delivery := WebhookDelivery{
+		RepoID: repoID, Provider: provider, Event: event, DeliveryID: deliveryID,
+		Headers: webhookHeaders(r.Header), Payload: string(body),
+	}
+	delivery.SignatureValid = verifyWebhook(provider, r.Header, body, secret)
+	if !delivery.SignatureValid {
+		delivery.Status = "rejected"
+		delivery.Result = "invalid signature"
+		if secret == "" {
+			delivery.Result = "webhooks are not enabled for this repository"
+		}
+		// The sender is anonymous, so rejections only go to the pruned
+		// delivery list, not the activity log.
+		delivery.Payload = truncate(delivery.Payload, maxRejectedPayload)
+		recordWebhookDelivery(delivery)
+		pruneRejectedDeliveries(repoID)
+		http.Error(w, delivery.Result, http.StatusUnauthorized)
+		return
+	}
+	if id := seenDelivery(repoID, deliveryID); id != 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"delivery": id, "status": "duplicate",
+			"result": "delivery " + deliveryID + " was already received"})
+		return
+	}
+
+	push, status, result := processGitWebhook(src, buildOnPush, provider, event, body, "webhook:"+provider)
+	delivery.Ref, delivery.CommitSHA, delivery.Status, delivery.Result = push.Ref, push.After, status, result
+	id := recordWebhookDelivery(delivery)
+	if status == "processed" {
+		database.LogActivity("gitops_webhook", src.Name, "success")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"delivery": id, "status": status, "result": result})
+}
+
+// GET /api/cicd/gitops/repos/{id}/webhook
+func GetRepoWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	_, secret, buildOnPush, err := loadRepoWebhook(id)
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       secret != "",
+		"url":           fmt.Sprintf("/api/webhooks/git/%d", id),
+		"build_on_push": buildOnPush,
+	})
+}
+
+// POST /api/cicd/gitops/repos/{id}/webhook
+// Body: {"build_on_push": true, "rotate_secret": false}
+// Enables the webhook, generating a secret on first use or when rotating.
+// The secret is only ever returned by this call.
+func ConfigureRepoWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	src, secret, _, err := loadRepoWebhook(id)
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	var req struct {
+		BuildOnPush  bool `json:"build_on_push"`
+		RotateSecret bool `json:"rotate_secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", 400)
+		return
+	}
+	resp := map[string]interface{}{
+		"enabled":       true,
+		"url":           fmt.Sprintf("/api/webhooks/git/%d", id),
+		"build_on_push": req.BuildOnPush,
+	}
+	if secret == "" || req.RotateSecret {
+		if secret, err = generateToken(); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		resp["secret"] = secret
+	}
+	sealed, err := vault.Seal(secret)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if _, err := database.DB.Exec(`UPDATE gitops_repos SET webhook_secret = ?, build_on_push = ? WHERE id = ?`,
+		sealed, boolInt(req.BuildOnPush), id); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if resp["secret"] != nil {
+		recordActivityLog("gitops_webhook_secret", src.Name, "webhook secret generated by "+user.Username, "success")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DELETE /api/cicd/gitops/repos/{id}/webhook
+func DisableRepoWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if _, err := database.DB.Exec(`UPDATE gitops_repos SET webhook_secret = NULL, build_on_push = 0 WHERE id = ?`, id); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	database.LogActivity("gitops_webhook_disable", id, "success")
+	w.WriteHeader(204)
+}
+
+// GET /api/cicd/gitops/repos/{id}/webhook/deliveries?limit=50
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	rows, err := database.DB.Query(
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE repo_id = ? ORDER BY id DESC LIMIT ?`,
+		mux.Vars(r)["id"], limit)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		if d, err := scanWebhookDelivery(rows); err == nil {
+			deliveries = append(deliveries, d)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func loadWebhookDelivery(id string) (WebhookDelivery, error) {
+	var headers string
+	var d WebhookDelivery
+	var valid int
+	err := database.DB.QueryRow(
+		`SELECT `+webhookDeliveryColumns+`, headers, payload FROM webhook_deliveries WHERE id = ?`, id).
+		Scan(&d.ID, &d.RepoID, &d.Provider, &d.Event, &d.DeliveryID, &d.Ref, &d.CommitSHA, &valid,
+			&d.Status, &d.Result, &d.ReplayOf, &d.CreatedAt, &headers, &d.Payload)
+	d.SignatureValid = valid == 1
+	json.Unmarshal([]byte(headers), &d.Headers)
+	return d, err
+}
+
+// GET /api/cicd/gitops/webhook-deliveries/{id}
+// Includes the stored headers and raw payload.
+func GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	d, err := loadWebhookDelivery(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// POST /api/cicd/gitops/webhook-deliveries/{id}/replay
+// Processes a stored payload again as if it had just arrived. The replay is
+// recorded as a new delivery pointing at the original.
+func ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	orig, err := loadWebhookDelivery(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	if !orig.SignatureValid {
+		http.Error(w, "only deliveries with a valid signature can be replayed", http.StatusConflict)
+		return
+	}
+	src, _, buildOnPush, err := loadRepoWebhook(orig.RepoID)
+	if err != nil {
+		http.Error(w, "repository no longer exists", 404)
+		return
+	}
+
+	push, status, result := processGitWebhook(src, buildOnPush, orig.Provider, orig.Event, []byte(orig.Payload), "replay:"+user.Username)
+	replay := WebhookDelivery{
+		RepoID: orig.RepoID, Provider: orig.Provider, Event: orig.Event, DeliveryID: orig.DeliveryID,
+		Ref: push.Ref, CommitSHA: push.After, SignatureValid: true, Status: status, Result: result,
+		Headers: orig.Headers, Payload: orig.Payload, ReplayOf: &orig.ID,
+	}
+	id := recordWebhookDelivery(replay)
+	recordActivityLog("gitops_webhook_replay", src.Name,
+		fmt.Sprintf("delivery %d replayed by %s: %s", orig.ID, user.Username, result), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"delivery": id, "status": status, "result": result})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"ref":"refs/heads/main","after":"abc123"}`)
+	sign := func(key string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name     string
+		provider string
+		headers  map[string]string
+		secret   string
+		want     bool
+	}{
+		{"github valid", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign(secret)}, secret, true},
+		{"github wrong secret", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign("other")}, secret, false},
+		{"github missing prefix", "github", map[string]string{"X-Hub-Signature-256": sign(secret)}, secret, false},
+		{"github not hex", "github", map[string]string{"X-Hub-Signature-256": "sha256=zz"}, secret, false},
+		{"github unsigned", "github", nil, secret, false},
+		{"gitlab valid", "gitlab", map[string]string{"X-Gitlab-Token": secret}, secret, true},
+		{"gitlab wrong token", "gitlab", map[string]string{"X-Gitlab-Token": "guess"}, secret, false},
+		{"gitlab hmac not accepted", "gitlab", map[string]string{"X-Hub-Signature-256": "sha256=" + sign(secret)}, secret, false},
+		{"gitea valid", "gitea", map[string]string{"X-Gitea-Signature": sign(secret)}, secret, true},
+		{"gitea wrong secret", "gitea", map[string]string{"X-Gitea-Signature": sign("other")}, secret, false},
+		{"gitea github-style header", "gitea", map[string]string{"X-Hub-Signature-256": "sha256=" + sign(secret)}, secret, true},
+		{"webhooks disabled", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign("")}, "", false},
+		{"gitlab empty token with no secret", "gitlab", map[string]string{"X-Gitlab-Token": ""}, "", false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.headers {
+			h.Set(k, v)
+		}
+		if got := verifyWebhook(tt.provider, h, body, tt.secret); got != tt.want {
+			t.Errorf("%s: verifyWebhook = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookProvider(t *testing.T) {
+	tests := []struct {
+		headers                   map[string]string
+		provider, event, delivery string
+	}{
+		{map[string]string{"X-GitHub-Event": "push", "X-GitHub-Delivery": "d1"}, "github", "push", "d1"},
+		{map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Event-UUID": "d2"}, "gitlab", "Push Hook", "d2"},
+		// Gitea sends X-GitHub-Event too and must not be taken for GitHub.
+		{map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push", "X-Gitea-Delivery": "d3"}, "gitea", "push", "d3"},
+		{map[string]string{"User-Agent": "curl"}, "", "", ""},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.headers {
+			h.Set(k, v)
+		}
+		provider, event, delivery := webhookProvider(h)
+		if provider != tt.provider || event != tt.event || delivery != tt.delivery {
+			t.Errorf("webhookProvider(%v) = %q, %q, %q, want %q, %q, %q",
+				tt.headers, provider, event, delivery, tt.provider, tt.event, tt.delivery)
+		}
+	}
+}
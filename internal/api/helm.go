@@ -0,0 +1,1051 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Helm releases of managed clusters. Releases are read straight from the
+// release Secrets helm stores in each namespace (owner=helm), so listing and
+// inspecting them needs neither the helm binary nor cluster-wide access.
+// Changes (install, upgrade, rollback, uninstall) run the helm CLI as
+// background operations with a streamed log: with the cluster's admin
+// kubeconfig for admins, and for everyone else with their own
+// namespace-scoped service account, so the cluster enforces their scope.
+
+const helmDefaultTimeout = 5 * time.Minute
+
+// helmReleaseName is what helm accepts as a release name.
+var helmReleaseName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// helmRelease is the part of helm's stored release record we show.
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Info      struct {
+		FirstDeployed string `json:"first_deployed"`
+		LastDeployed  string `json:"last_deployed"`
+		Status        string `json:"status"`
+		Description   string `json:"description"`
+		Notes         string `json:"notes"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+		Values map[string]interface{} `json:"values"`
+	} `json:"chart"`
+	Config   map[string]interface{} `json:"config"`
+	Manifest string                 `json:"manifest"`
+}
+
+// HelmReleaseSummary is one release revision as "helm list" and "helm
+// history" show it.
+type HelmReleaseSummary struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	Revision     int    `json:"revision"`
+	Status       string `json:"status"`
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chart_version"`
+	AppVersion   string `json:"app_version"`
+	Updated      string `json:"updated"`
+	Description  string `json:"description"`
+}
+
+func (rel *helmRelease) summary() HelmReleaseSummary {
+	return HelmReleaseSummary{
+		Name:         rel.Name,
+		Namespace:    rel.Namespace,
+		Revision:     rel.Version,
+		Status:       rel.Info.Status,
+		Chart:        rel.Chart.Metadata.Name,
+		ChartVersion: rel.Chart.Metadata.Version,
+		AppVersion:   rel.Chart.Metadata.AppVersion,
+		Updated:      rel.Info.LastDeployed,
+		Description:  rel.Info.Description,
+	}
+}
+
+// decodeHelmRelease unpacks a release Secret: its "release" key holds the
+// base64 of a gzipped JSON record.
+func decodeHelmRelease(secret map[string]interface{}) (*helmRelease, error) {
+	data, err := base64.StdEncoding.DecodeString(nestedString(secret, "data", "release"))
+	if err != nil {
+		return nil, err
+	}
+	if data, err = base64.StdEncoding.DecodeString(string(data)); err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	var rel helmRelease
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return nil, err
+	}
+	return &rel, nil
+}
+
+// helmReleaseSecrets lists the release Secrets of namespace ("" for all),
+// of one release when name is set.
+func helmReleaseSecrets(ctx context.Context, c *k8sClient, namespace, name string) ([]map[string]interface{}, error) {
+	selector := "owner=helm"
+	if name != "" {
+		selector += ",name=" + name
+	}
+	list, err := c.list(ctx, mustK8sResource("secrets"), namespace, k8sListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func helmSecretRevision(secret map[string]interface{}) int {
+	n, _ := strconv.Atoi(nestedString(secret, "metadata", "labels", "version"))
+	return n
+}
+
+// helmReleaseRevisions decodes every revision of a release, oldest first.
+func helmReleaseRevisions(ctx context.Context, c *k8sClient, namespace, name string) ([]*helmRelease, error) {
+	secrets, err := helmReleaseSecrets(ctx, c, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []*helmRelease
+	for _, s := range secrets {
+		rel, err := decodeHelmRelease(s)
+		if err != nil {
+			log.Printf("[Helm] cluster %s: skipping unreadable release secret %s/%s: %v",
+				c.clusterID, namespace, nestedString(s, "metadata", "name"), err)
+			continue
+		}
+		revisions = append(revisions, rel)
+	}
+	if len(revisions) == 0 {
+		return nil, &k8sAPIError{Code: http.StatusNotFound, Reason: "NotFound",
+			Message: fmt.Sprintf("release %s not found in namespace %s", name, namespace)}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version < revisions[j].Version })
+	return revisions, nil
+}
+
+// helmAccess checks the caller may read (write false) or change releases
+// in namespace: changes take the admin or user_k8s_full role, and
+// non-admins are held to their assigned namespaces. It writes the error
+// response itself.
+func helmAccess(w http.ResponseWriter, r *http.Request, namespace string, write bool) bool {
+	user, _ := GetUserFromContext(r.Context())
+	if write && !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_k8s_full") {
+		http.Error(w, "this action requires the user_k8s_full role", http.StatusForbidden)
+		return false
+	}
+	clusterID, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if !HasRole(user.Role, "admin") && !checkNamespaceAccess(user, clusterID, namespace) {
+		http.Error(w, "Forbidden: no access to this namespace", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ── Releases ────────────────────────────────────────────────────────────────
+
+// ListHelmReleases lists the latest revision of every release in the
+// namespaces the caller may see.
+// GET /api/k0s/clusters/{id}/helm/releases?namespace=
+func ListHelmReleases(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["id"]
+	clusterIDInt, _ := strconv.Atoi(clusterID)
+	user, _ := GetUserFromContext(r.Context())
+
+	namespaces := []string{r.URL.Query().Get("namespace")}
+	if namespaces[0] == "all" {
+		namespaces[0] = ""
+	}
+	if !HasRole(user.Role, "admin") {
+		if namespaces[0] == "" {
+			assigned, err := assignedNamespaceSet(user, clusterIDInt)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			namespaces = namespaces[:0]
+			for ns := range assigned {
+				namespaces = append(namespaces, ns)
+			}
+		} else if !helmAccess(w, r, namespaces[0], false) {
+			return
+		}
+	}
+
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	latest := map[string]map[string]interface{}{} // "ns/name" → newest release secret
+	for _, ns := range namespaces {
+		secrets, err := helmReleaseSecrets(r.Context(), c, ns, "")
+		if err != nil {
+			writeK8sError(w, err)
+			return
+		}
+		for _, s := range secrets {
+			key := nestedString(s, "metadata", "namespace") + "/" + nestedString(s, "metadata", "labels", "name")
+			if cur, ok := latest[key]; !ok || helmSecretRevision(s) > helmSecretRevision(cur) {
+				latest[key] = s
+			}
+		}
+	}
+
+	releases := []HelmReleaseSummary{}
+	for _, s := range latest {
+		rel, err := decodeHelmRelease(s)
+		if err != nil {
+			continue
+		}
+		releases = append(releases, rel.summary())
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].Namespace != releases[j].Namespace {
+			return releases[i].Namespace < releases[j].Namespace
+		}
+		return releases[i].Name < releases[j].Name
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(releases)
+}
+
+// GetHelmRelease shows a release revision (the latest by default): its
+// values, the chart's default values, the rendered manifest and notes.
+// GET /api/k0s/clusters/{id}/helm/releases/{namespace}/{name}?revision=
+func GetHelmRelease(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !helmAccess(w, r, vars["namespace"], false) {
+		return
+	}
+	c, err := newK8sClient(vars["id"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	revisions, err := helmReleaseRevisions(r.Context(), c, vars["namespace"], vars["name"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	rel := revisions[len(revisions)-1]
+	if rev := r.URL.Query().Get("revision"); rev != "" {
+		rel = nil
+		for _, candidate := range revisions {
+			if strconv.Itoa(candidate.Version) == rev {
+				rel = candidate
+			}
+		}
+		if rel == nil {
+			http.Error(w, fmt.Sprintf("revision %s of release %s not found", rev, vars["name"]), http.StatusNotFound)
+			return
+		}
+	}
+	values := rel.Config
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"release":        rel.summary(),
+		"values":         values,
+		"chart_values":   rel.Chart.Values,
+		"manifest":       rel.Manifest,
+		"notes":          rel.Info.Notes,
+		"first_deployed": rel.Info.FirstDeployed,
+	})
+}
+
+// GetHelmReleaseHistory lists a release's revisions, oldest first.
+// GET /api/k0s/clusters/{id}/helm/releases/{namespace}/{name}/history
+func GetHelmReleaseHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !helmAccess(w, r, vars["namespace"], false) {
+		return
+	}
+	c, err := newK8sClient(vars["id"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	revisions, err := helmReleaseRevisions(r.Context(), c, vars["namespace"], vars["name"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	history := make([]HelmReleaseSummary, len(revisions))
+	for i, rel := range revisions {
+		history[i] = rel.summary()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// ── Chart sources ───────────────────────────────────────────────────────────
+
+// helmChartRequest selects a chart: by name from a chart repository, or by
+// repository path from an OCI registry of cicd_registries.
+type helmChartRequest struct {
+	RepositoryID int    `json:"repository_id"`
+	RegistryID   int    `json:"registry_id"`
+	Chart        string `json:"chart"`
+	Version      string `json:"version"`
+}
+
+// helmChart is a resolved chart: the chart argument and flags to pass helm.
+type helmChart struct {
+	ref     string
+	args    []string
+	label   string // e.g. "bitnami/nginx"
+	version string
+	cleanup func()
+}
+
+// resolveHelmChart downloads a repository chart, or prepares the
+// reference and credentials of an OCI chart. The caller calls cleanup.
+func resolveHelmChart(req helmChartRequest, logs *logStream) (*helmChart, error) {
+	if req.Chart == "" {
+		return nil, fmt.Errorf("chart is required")
+	}
+	switch {
+	case req.RepositoryID != 0:
+		repo, password, err := loadHelmRepository(req.RepositoryID)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := helmRepoIndex(repo, password, false)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := idx.find(req.Chart, req.Version)
+		if err != nil {
+			return nil, err
+		}
+		logs.Line(fmt.Sprintf("Downloading chart %s/%s %s", repo.Name, cv.Name, cv.Version))
+		file, err := downloadHelmChart(repo, password, cv)
+		if err != nil {
+			return nil, err
+		}
+		return &helmChart{ref: file, label: repo.Name + "/" + cv.Name, version: cv.Version,
+			cleanup: func() { os.Remove(file) }}, nil
+
+	case req.RegistryID != 0:
+		reg, password, err := loadRegistryCredentials(req.RegistryID)
+		if err != nil {
+			return nil, err
+		}
+		base := strings.TrimRight(buildRegistryBaseURL(reg.URL, true), "/")
+		base = strings.TrimPrefix(base, "https://")
+		if base == "" {
+			base = registryHost(reg)
+		}
+		chart := &helmChart{ref: "oci://" + base + "/" + strings.Trim(req.Chart, "/"),
+			label: reg.Name + "/" + strings.Trim(req.Chart, "/"), version: req.Version, cleanup: func() {}}
+		if req.Version != "" {
+			chart.args = append(chart.args, "--version", req.Version)
+		}
+		if reg.InsecureSkipVerify {
+			chart.args = append(chart.args, "--insecure-skip-tls-verify")
+		}
+		if !reg.SSLEnabled {
+			chart.args = append(chart.args, "--plain-http")
+		}
+		username := reg.Username
+		if reg.Type == "aws" {
+			if username, password, err = ecrCredentials(reg, password); err != nil {
+				return nil, err
+			}
+		}
+		if username != "" {
+			// A registry config of our own, so no login state is left behind.
+			auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+			cfg, _ := json.Marshal(map[string]interface{}{"auths": map[string]interface{}{registryHost(reg): map[string]string{"auth": auth}}})
+			f, err := os.CreateTemp("", "helm-registry-*.json")
+			if err != nil {
+				return nil, err
+			}
+			f.Chmod(0600)
+			f.Write(cfg)
+			f.Close()
+			chart.args = append(chart.args, "--registry-config", f.Name())
+			chart.cleanup = func() { os.Remove(f.Name()) }
+		}
+		return chart, nil
+	}
+	return nil, fmt.Errorf("repository_id or registry_id is required")
+}
+
+// helmScopeIssues lists the objects of a rendered manifest a non-admin may
+// not manage: cluster-scoped ones and those outside the assigned namespaces.
+func helmScopeIssues(ctx context.Context, c *k8sClient, manifest, namespace string, assigned map[string]bool) []string {
+	docs, err := parseManifestDocuments([]byte(manifest))
+	if err != nil {
+		return []string{"rendered manifest: " + err.Error()}
+	}
+	var issues []string
+	for _, doc := range docs {
+		p, err := prepareK8sObject(ctx, c, doc.Object, namespace)
+		switch {
+		case err != nil:
+			issues = append(issues, p.ref+": "+err.Error())
+		case !p.rs.Namespaced:
+			issues = append(issues, p.ref+": cluster-scoped resources require the admin role")
+		case !assigned[p.namespace]:
+			issues = append(issues, fmt.Sprintf("%s: namespace %q is not assigned to you", p.ref, p.namespace))
+		}
+	}
+	return issues
+}
+
+// ── Operations ──────────────────────────────────────────────────────────────
+
+// HelmOperation is one install, upgrade, rollback or uninstall run.
+type HelmOperation struct {
+	ID         int     `json:"id"`
+	ClusterID  int     `json:"cluster_id"`
+	Namespace  string  `json:"namespace"`
+	Release    string  `json:"release"`
+	Action     string  `json:"action"`
+	Chart      string  `json:"chart"`
+	Version    string  `json:"version"`
+	Username   string  `json:"username"`
+	Status     string  `json:"status"` // running, success, failed
+	Error      *string `json:"error"`
+	Log        *string `json:"log,omitempty"`
+	StartedAt  string  `json:"started_at"`
+	FinishedAt *string `json:"finished_at"`
+}
+
+// helmOperationRequest is the body of install, upgrade and rollback.
+type helmOperationRequest struct {
+	helmChartRequest
+	Release         string `json:"release"`
+	Namespace       string `json:"namespace"`
+	Values          string `json:"values"` // YAML
+	ReuseValues     bool   `json:"reuse_values"`
+	CreateNamespace bool   `json:"create_namespace"`
+	Wait            bool   `json:"wait"`
+	TimeoutSeconds  int    `json:"timeout_seconds"`
+	Revision        int    `json:"revision"`
+}
+
+// helmRun is the state of an operation in progress.
+type helmRun struct {
+	id         int64
+	c          *k8sClient
+	kubeconfig string
+	namespace  string
+	release    string
+	restricted bool
+	assigned   map[string]bool
+	logs       *logStream
+	chart      string
+	version    string
+}
+
+// activeHelmReleases holds the releases with an operation running, keyed
+// "cluster/namespace/release".
+var activeHelmReleases sync.Map
+
+func helmLogKey(id int64) string { return fmt.Sprintf("helm:%d", id) }
+
+// helm runs the helm CLI against the cluster, logging its output.
+func (run *helmRun) helm(ctx context.Context, args ...string) error {
+	run.logs.Line("$ helm " + strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, "helm", append(args, "--kubeconfig", run.kubeconfig)...)
+	cmd.Stdout = run.logs
+	cmd.Stderr = run.logs
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("helm %s timed out", args[0])
+		}
+		return fmt.Errorf("helm %s failed: %v", args[0], err)
+	}
+	return nil
+}
+
+// checkRendered renders the chart like the real run would and refuses
+// objects a restricted user may not manage. It gives a readable error up
+// front; the service account the run uses is what enforces the scope.
+func (run *helmRun) checkRendered(ctx context.Context, chartArgs []string) error {
+	if !run.restricted {
+		return nil
+	}
+	run.logs.Line("Checking the rendered chart stays within your namespaces")
+	args := append([]string{"template", run.release}, chartArgs...)
+	cmd := exec.CommandContext(ctx, "helm", append(args, "--include-crds", "--kubeconfig", run.kubeconfig)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("helm template failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if issues := helmScopeIssues(ctx, run.c, string(out), run.namespace, run.assigned); len(issues) > 0 {
+		return fmt.Errorf("chart rejected:\n  %s", strings.Join(issues, "\n  "))
+	}
+	return nil
+}
+
+// startHelmOperation records an operation and runs job in the background.
+// It writes the response: 202 with the operation ID, or the error.
+func startHelmOperation(w http.ResponseWriter, r *http.Request, action, namespace, release, chart string,
+	timeout time.Duration, job func(ctx context.Context, run *helmRun) error) {
+	clusterID := mux.Vars(r)["id"]
+	clusterIDInt, _ := strconv.Atoi(clusterID)
+	user, _ := GetUserFromContext(r.Context())
+
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	run := &helmRun{c: c, namespace: namespace, release: release, chart: chart, restricted: !HasRole(user.Role, "admin")}
+	if run.restricted {
+		if run.assigned, err = assignedNamespaceSet(user, clusterIDInt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	cleanup := func() {}
+	if !run.restricted {
+		if run.kubeconfig, cleanup, err = writeClusterKubeconfig(clusterIDInt); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	key := clusterID + "/" + namespace + "/" + release
+	if _, busy := activeHelmReleases.LoadOrStore(key, true); busy {
+		cleanup()
+		http.Error(w, fmt.Sprintf("another operation on release %s is in progress", release), http.StatusConflict)
+		return
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO helm_operations (cluster_id, namespace, release, action, chart, username, status) VALUES (?, ?, ?, ?, ?, ?, 'running')`,
+		clusterIDInt, namespace, release, action, chart, user.Username)
+	if err != nil {
+		activeHelmReleases.Delete(key)
+		cleanup()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	run.id, _ = res.LastInsertId()
+	run.logs = startLogStream(helmLogKey(run.id))
+	log.Printf("[Helm] #%d cluster=%s %s %s/%s by %s", run.id, clusterID, action, namespace, release, user.Username)
+
+	go func() {
+		defer activeHelmReleases.Delete(key)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout+2*time.Minute)
+		defer cancel()
+
+		var err error
+		if run.restricted {
+			var release func()
+			if release, err = run.useServiceAccount(clusterID, user); err == nil {
+				defer release()
+			}
+		}
+		if err == nil {
+			err = job(ctx, run)
+		}
+		status := "success"
+		var errMsg interface{}
+		if err != nil {
+			status, errMsg = "failed", err.Error()
+			run.logs.Line("Error: " + err.Error())
+		}
+		database.DB.Exec(`UPDATE helm_operations SET status = ?, error = ?, log = ?, chart = ?, version = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			status, errMsg, run.logs.String(), run.chart, run.version, run.id)
+		finishLogStream(helmLogKey(run.id), run.logs)
+
+		details := strings.TrimSpace(run.chart+" "+run.version) + " by " + user.Username
+		if err != nil {
+			details += ": " + err.Error()
+			status = "error"
+		}
+		recordActivityLog("helm_"+action, fmt.Sprintf("cluster %s: %s/%s", clusterID, namespace, release), details, status)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "operation_id": run.id})
+}
+
+// useServiceAccount points a restricted run at the user's service account,
+// bound to their assigned namespaces only. The returned func removes the
+// kubeconfig file.
+func (run *helmRun) useServiceAccount(clusterID string, user User) (func(), error) {
+	run.logs.Line("Running helm as your namespace-scoped service account")
+	namespaces := make([]string, 0, len(run.assigned))
+	for ns := range run.assigned {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	kc, err := generateSAKubeconfigContent(clusterID, user.Username, user.Role, namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("preparing your service account: %v", err)
+	}
+	path, cleanup, err := writeTempKubeconfig(kc)
+	if err != nil {
+		return nil, err
+	}
+	run.kubeconfig = path
+	return cleanup, nil
+}
+
+// RecoverHelmOperations fails operations left running by a previous server
+// process; their helm processes died with it.
+func RecoverHelmOperations() {
+	database.DB.Exec(
+		`UPDATE helm_operations SET status = 'failed', error = 'interrupted by server restart', finished_at = CURRENT_TIMESTAMP
+		 WHERE status = 'running'`)
+}
+
+// decodeHelmOperationRequest reads and checks the body shared by install
+// and upgrade.
+func decodeHelmOperationRequest(w http.ResponseWriter, r *http.Request) (helmOperationRequest, time.Duration, bool) {
+	var req helmOperationRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return req, 0, false
+		}
+	}
+	if req.Values != "" {
+		var v map[string]interface{}
+		if err := yaml.Unmarshal([]byte(req.Values), &v); err != nil {
+			http.Error(w, "values must be a YAML mapping: "+err.Error(), http.StatusBadRequest)
+			return req, 0, false
+		}
+	}
+	timeout := helmDefaultTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	return req, timeout, true
+}
+
+// chartArgs resolves the requested chart and returns the arguments helm
+// install/upgrade/template share.
+func (run *helmRun) chartArgs(req helmOperationRequest) ([]string, func(), error) {
+	chart, err := resolveHelmChart(req.helmChartRequest, run.logs)
+	if err != nil {
+		return nil, nil, err
+	}
+	run.chart, run.version = chart.label, chart.version
+	args := append([]string{chart.ref, "--namespace", run.namespace}, chart.args...)
+	cleanup := chart.cleanup
+	if req.Values != "" {
+		file, err := helmValuesFile(req.Values)
+		if err != nil {
+			chart.cleanup()
+			return nil, nil, err
+		}
+		args = append(args, "--values", file)
+		cleanup = func() { chart.cleanup(); os.Remove(file) }
+	}
+	return args, cleanup, nil
+}
+
+// helmValuesFile writes values to a private temporary file for --values.
+// The caller removes it.
+func helmValuesFile(values string) (string, error) {
+	f, err := os.CreateTemp("", "helm-values-*.yaml")
+	if err != nil {
+		return "", err
+	}
+	f.Chmod(0600)
+	f.WriteString(values)
+	f.Close()
+	return f.Name(), nil
+}
+
+// admitHelmChart renders the chart an install or upgrade would deploy and
+// runs it through the admission gate, writing the refusal itself. With
+// reuse, the values of the release's latest revision go under req.Values
+// as --reuse-values would. A repository chart's version is pinned to the
+// one checked so the operation deploys what was admitted.
+func admitHelmChart(w http.ResponseWriter, r *http.Request, req *helmOperationRequest, release, namespace string, reuse bool) bool {
+	if !admissionPoliciesEnabled() {
+		return true
+	}
+	clusterID := mux.Vars(r)["id"]
+	clusterIDInt, _ := strconv.Atoi(clusterID)
+	chart, err := resolveHelmChart(req.helmChartRequest, &logStream{})
+	if err != nil {
+		http.Error(w, "Resolving chart for admission check: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	defer chart.cleanup()
+
+	args := append([]string{"template", release, chart.ref, "--namespace", namespace, "--include-crds"}, chart.args...)
+	var values []string
+	if reuse {
+		c, err := newK8sClient(clusterID)
+		if err != nil {
+			writeK8sError(w, err)
+			return false
+		}
+		revisions, err := helmReleaseRevisions(r.Context(), c, namespace, release)
+		if err != nil {
+			writeK8sError(w, err)
+			return false
+		}
+		if config := revisions[len(revisions)-1].Config; len(config) > 0 {
+			data, _ := yaml.Marshal(config)
+			values = append(values, string(data))
+		}
+	}
+	if req.Values != "" {
+		values = append(values, req.Values)
+	}
+	for _, v := range values {
+		file, err := helmValuesFile(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		defer os.Remove(file)
+		args = append(args, "--values", file)
+	}
+
+	cmd := exec.CommandContext(r.Context(), "helm", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	manifest, err := cmd.Output()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Rendering chart for admission check: %v: %s", err, strings.TrimSpace(stderr.String())), http.StatusBadRequest)
+		return false
+	}
+	if !admitManifest(w, r, "helm", clusterIDInt, namespace, manifest) {
+		return false
+	}
+	if req.RepositoryID != 0 {
+		req.Version = chart.version
+	}
+	return true
+}
+
+func waitArgs(wait bool, timeout time.Duration) []string {
+	args := []string{"--timeout", timeout.String()}
+	if wait {
+		args = append(args, "--wait")
+	}
+	return args
+}
+
+// InstallHelmRelease installs a chart as a new release.
+// POST /api/k0s/clusters/{id}/helm/releases
+// body: {"release","namespace","repository_id"|"registry_id","chart","version","values","create_namespace","wait","timeout_seconds"}
+func InstallHelmRelease(w http.ResponseWriter, r *http.Request) {
+	req, timeout, ok := decodeHelmOperationRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Namespace == "" {
+		req.Namespace = "default"
+	}
+	if len(req.Release) > 53 || !helmReleaseName.MatchString(req.Release) {
+		http.Error(w, "release must be a lowercase DNS label of at most 53 characters", http.StatusBadRequest)
+		return
+	}
+	if !helmAccess(w, r, req.Namespace, true) {
+		return
+	}
+	user, _ := GetUserFromContext(r.Context())
+	if req.CreateNamespace && !HasRole(user.Role, "admin") {
+		http.Error(w, "create_namespace requires the admin role", http.StatusForbidden)
+		return
+	}
+	if !admitHelmChart(w, r, &req, req.Release, req.Namespace, false) {
+		return
+	}
+
+	startHelmOperation(w, r, "install", req.Namespace, req.Release, req.Chart, timeout, func(ctx context.Context, run *helmRun) error {
+		args, cleanup, err := run.chartArgs(req)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		if err := run.checkRendered(ctx, args); err != nil {
+			return err
+		}
+		install := append([]string{"install", run.release}, args...)
+		if req.CreateNamespace {
+			install = append(install, "--create-namespace")
+		}
+		return run.helm(ctx, append(install, waitArgs(req.Wait, timeout)...)...)
+	})
+}
+
+// UpgradeHelmRelease upgrades a release to a chart version and/or values.
+// POST /api/k0s/clusters/{id}/helm/releases/{namespace}/{name}/upgrade
+// body: {"repository_id"|"registry_id","chart","version","values","reuse_values","wait","timeout_seconds"}
+func UpgradeHelmRelease(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	req, timeout, ok := decodeHelmOperationRequest(w, r)
+	if !ok || !helmAccess(w, r, vars["namespace"], true) {
+		return
+	}
+	if !admitHelmChart(w, r, &req, vars["name"], vars["namespace"], req.ReuseValues) {
+		return
+	}
+	startHelmOperation(w, r, "upgrade", vars["namespace"], vars["name"], req.Chart, timeout, func(ctx context.Context, run *helmRun) error {
+		if _, err := helmReleaseRevisions(ctx, run.c, run.namespace, run.release); err != nil {
+			return err
+		}
+		args, cleanup, err := run.chartArgs(req)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		if err := run.checkRendered(ctx, args); err != nil {
+			return err
+		}
+		upgrade := append([]string{"upgrade", run.release}, args...)
+		if req.ReuseValues {
+			upgrade = append(upgrade, "--reuse-values")
+		}
+		return run.helm(ctx, append(upgrade, waitArgs(req.Wait, timeout)...)...)
+	})
+}
+
+// releaseInScope checks, for a restricted user, that a stored release
+// revision only holds objects the user may manage.
+func (run *helmRun) releaseInScope(ctx context.Context, rel *helmRelease) error {
+	if !run.restricted {
+		return nil
+	}
+	if issues := helmScopeIssues(ctx, run.c, rel.Manifest, run.namespace, run.assigned); len(issues) > 0 {
+		return fmt.Errorf("revision %d manages objects outside your namespaces:\n  %s", rel.Version, strings.Join(issues, "\n  "))
+	}
+	return nil
+}
+
+// rollbackTarget picks the revision a rollback to revision restores: the
+// one before the latest when revision is 0.
+func rollbackTarget(revisions []*helmRelease, revision int) (*helmRelease, error) {
+	name := revisions[0].Name
+	if revision == 0 {
+		if len(revisions) < 2 {
+			return nil, fmt.Errorf("release %s has no previous revision", name)
+		}
+		return revisions[len(revisions)-2], nil
+	}
+	for _, rel := range revisions {
+		if rel.Version == revision {
+			return rel, nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d of release %s not found", revision, name)
+}
+
+// RollbackHelmRelease rolls a release back to a revision (the previous one
+// when revision is 0).
+// POST /api/k0s/clusters/{id}/helm/releases/{namespace}/{name}/rollback   body: {"revision":0,"wait":false}
+func RollbackHelmRelease(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	req, timeout, ok := decodeHelmOperationRequest(w, r)
+	if !ok || !helmAccess(w, r, vars["namespace"], true) {
+		return
+	}
+	if admissionPoliciesEnabled() {
+		c, err := newK8sClient(vars["id"])
+		if err != nil {
+			writeK8sError(w, err)
+			return
+		}
+		revisions, err := helmReleaseRevisions(r.Context(), c, vars["namespace"], vars["name"])
+		if err != nil {
+			writeK8sError(w, err)
+			return
+		}
+		rel, err := rollbackTarget(revisions, req.Revision)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		clusterIDInt, _ := strconv.Atoi(vars["id"])
+		if !admitManifest(w, r, "helm", clusterIDInt, vars["namespace"], []byte(rel.Manifest)) {
+			return
+		}
+		req.Revision = rel.Version
+	}
+	startHelmOperation(w, r, "rollback", vars["namespace"], vars["name"], "", timeout, func(ctx context.Context, run *helmRun) error {
+		revisions, err := helmReleaseRevisions(ctx, run.c, run.namespace, run.release)
+		if err != nil {
+			return err
+		}
+		rel, err := rollbackTarget(revisions, req.Revision)
+		if err != nil {
+			return err
+		}
+		run.chart, run.version = rel.Chart.Metadata.Name, rel.Chart.Metadata.Version
+		if err := run.releaseInScope(ctx, rel); err != nil {
+			return err
+		}
+		args := []string{"rollback", run.release, strconv.Itoa(rel.Version), "--namespace", run.namespace}
+		return run.helm(ctx, append(args, waitArgs(req.Wait, timeout)...)...)
+	})
+}
+
+// UninstallHelmRelease removes a release and its objects.
+// DELETE /api/k0s/clusters/{id}/helm/releases/{namespace}/{name}?wait=1
+func UninstallHelmRelease(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !helmAccess(w, r, vars["namespace"], true) {
+		return
+	}
+	wait := r.URL.Query().Get("wait") == "1"
+	startHelmOperation(w, r, "uninstall", vars["namespace"], vars["name"], "", helmDefaultTimeout, func(ctx context.Context, run *helmRun) error {
+		revisions, err := helmReleaseRevisions(ctx, run.c, run.namespace, run.release)
+		if err != nil {
+			return err
+		}
+		latest := revisions[len(revisions)-1]
+		run.chart, run.version = latest.Chart.Metadata.Name, latest.Chart.Metadata.Version
+		if err := run.releaseInScope(ctx, latest); err != nil {
+			return err
+		}
+		args := []string{"uninstall", run.release, "--namespace", run.namespace}
+		return run.helm(ctx, append(args, waitArgs(wait, helmDefaultTimeout)...)...)
+	})
+}
+
+// ── Operation log ───────────────────────────────────────────────────────────
+
+// loadHelmOperation reads an operation of the cluster in the URL and
+// checks the caller may see its namespace. It writes the error response
+// itself.
+func loadHelmOperation(w http.ResponseWriter, r *http.Request) (*HelmOperation, bool) {
+	vars := mux.Vars(r)
+	var op HelmOperation
+	err := database.DB.QueryRow(
+		`SELECT id, cluster_id, namespace, release, action, chart, version, username, status, error, log, started_at, finished_at
+		 FROM helm_operations WHERE id = ? AND cluster_id = ?`, vars["opId"], vars["id"]).
+		Scan(&op.ID, &op.ClusterID, &op.Namespace, &op.Release, &op.Action, &op.Chart, &op.Version,
+			&op.Username, &op.Status, &op.Error, &op.Log, &op.StartedAt, &op.FinishedAt)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !helmAccess(w, r, op.Namespace, false) {
+		return nil, false
+	}
+	return &op, true
+}
+
+// ListHelmOperations lists a cluster's helm operations, newest first,
+// without their logs.
+// GET /api/k0s/clusters/{id}/helm/operations?namespace=&release=
+func ListHelmOperations(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["id"]
+	clusterIDInt, _ := strconv.Atoi(clusterID)
+	user, _ := GetUserFromContext(r.Context())
+	var assigned map[string]bool
+	if !HasRole(user.Role, "admin") {
+		var err error
+		if assigned, err = assignedNamespaceSet(user, clusterIDInt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	query := `SELECT id, cluster_id, namespace, release, action, chart, version, username, status, error, started_at, finished_at
+		FROM helm_operations WHERE cluster_id = ?`
+	args := []interface{}{clusterIDInt}
+	if ns := r.URL.Query().Get("namespace"); ns != "" {
+		query += " AND namespace = ?"
+		args = append(args, ns)
+	}
+	if rel := r.URL.Query().Get("release"); rel != "" {
+		query += " AND release = ?"
+		args = append(args, rel)
+	}
+	rows, err := database.DB.Query(query+" ORDER BY id DESC LIMIT 200", args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	ops := []HelmOperation{}
+	for rows.Next() {
+		var op HelmOperation
+		if err := rows.Scan(&op.ID, &op.ClusterID, &op.Namespace, &op.Release, &op.Action, &op.Chart, &op.Version,
+			&op.Username, &op.Status, &op.Error, &op.StartedAt, &op.FinishedAt); err != nil {
+			continue
+		}
+		if assigned == nil || assigned[op.Namespace] {
+			ops = append(ops, op)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ops)
+}
+
+// GetHelmOperation returns an operation and its log.
+// GET /api/k0s/clusters/{id}/helm/operations/{opId}
+func GetHelmOperation(w http.ResponseWriter, r *http.Request) {
+	op, ok := loadHelmOperation(w, r)
+	if !ok {
+		return
+	}
+	if v, ok := activeLogStreams.Load(helmLogKey(int64(op.ID))); ok {
+		text := v.(*logStream).String()
+		op.Log = &text
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op)
+}
+
+// StreamHelmOperationLogs streams an operation's log.
+// GET /api/k0s/clusters/{id}/helm/operations/{opId}/logs (WebSocket)
+func StreamHelmOperationLogs(w http.ResponseWriter, r *http.Request) {
+	op, ok := loadHelmOperation(w, r)
+	if !ok {
+		return
+	}
+	serveLogStream(w, r, helmLogKey(int64(op.ID)), func() (string, bool) {
+		var text sql.NullString
+		if err := database.DB.QueryRow(`SELECT log FROM helm_operations WHERE id = ?`, op.ID).Scan(&text); err != nil {
+			return "", false
+		}
+		return text.String, true
+	})
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Chart repositories: classic Helm repositories serving an index.yaml. The
+// index is fetched on demand and cached for helmIndexTTL; charts are
+// downloaded here and handed to helm as local archives, so the server
+// keeps no "helm repo add" state.
+
+const (
+	helmIndexTTL     = 10 * time.Minute
+	helmFetchTimeout = 2 * time.Minute
+)
+
+// HelmRepository is a configured chart repository.
+type HelmRepository struct {
+	ID                 int    `json:"id"`
+	Name               string `json:"name"`
+	URL                string `json:"url"`
+	Username           string `json:"username"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	CreatedAt          string `json:"created_at"`
+}
+
+// helmChartVersion is one chart version of a repository index.
+type helmChartVersion struct {
+	Name        string   `yaml:"name" json:"name"`
+	Version     string   `yaml:"version" json:"version"`
+	AppVersion  string   `yaml:"appVersion" json:"app_version"`
+	Description string   `yaml:"description" json:"description"`
+	Icon        string   `yaml:"icon" json:"icon,omitempty"`
+	Deprecated  bool     `yaml:"deprecated" json:"deprecated,omitempty"`
+	Created     string   `yaml:"created" json:"created"`
+	Digest      string   `yaml:"digest" json:"digest,omitempty"`
+	URLs        []string `yaml:"urls" json:"-"`
+}
+
+type helmIndex struct {
+	Entries map[string][]helmChartVersion `yaml:"entries"`
+	fetched time.Time
+}
+
+var (
+	helmIndexMu    sync.Mutex
+	helmIndexCache = map[int]*helmIndex{}
+)
+
+// loadHelmRepository reads a repository together with its password.
+func loadHelmRepository(id int) (HelmRepository, string, error) {
+	var repo HelmRepository
+	var password string
+	var insecure int
+	err := database.DB.QueryRow(
+		`SELECT id, name, url, username, COALESCE(password,''), insecure_skip_verify, created_at FROM helm_repositories WHERE id = ?`, id,
+	).Scan(&repo.ID, &repo.Name, &repo.URL, &repo.Username, &password, &insecure, &repo.CreatedAt)
+	if err != nil {
+		return repo, "", fmt.Errorf("chart repository %d not found", id)
+	}
+	repo.InsecureSkipVerify = insecure == 1
+	return repo, database.OpenSecret(password), nil
+}
+
+// helmRepoClients are shared by all fetches so connections are reused:
+// one verifies TLS, the other serves repositories with InsecureSkipVerify.
+var helmRepoClients = map[bool]*http.Client{
+	false: newHelmRepoClient(false),
+	true:  newHelmRepoClient(true),
+}
+
+func newHelmRepoClient(insecure bool) *http.Client {
+	return &http.Client{
+		Timeout:   helmFetchTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}}, //nolint:gosec
+	}
+}
+
+// helmRepoGet fetches a URL of the repository. Credentials are only sent
+// to the repository's own host, like helm without --pass-credentials.
+func helmRepoGet(repo HelmRepository, password, target string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	base, _ := url.Parse(repo.URL)
+	if u, _ := url.Parse(target); repo.Username != "" && base != nil && u != nil && u.Host == base.Host {
+		req.SetBasicAuth(repo.Username, password)
+	}
+	resp, err := helmRepoClients[repo.InsecureSkipVerify].Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return resp, nil
+}
+
+// helmRepoIndex returns the repository's index, from the cache unless it
+// is older than helmIndexTTL or refresh is set.
+func helmRepoIndex(repo HelmRepository, password string, refresh bool) (*helmIndex, error) {
+	helmIndexMu.Lock()
+	cached := helmIndexCache[repo.ID]
+	helmIndexMu.Unlock()
+	if cached != nil && !refresh && time.Since(cached.fetched) < helmIndexTTL {
+		return cached, nil
+	}
+
+	resp, err := helmRepoGet(repo, password, strings.TrimRight(repo.URL, "/")+"/index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var idx helmIndex
+	if err := yaml.NewDecoder(resp.Body).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("reading index.yaml of %s: %v", repo.Name, err)
+	}
+	idx.fetched = time.Now()
+	helmIndexMu.Lock()
+	helmIndexCache[repo.ID] = &idx
+	helmIndexMu.Unlock()
+	return &idx, nil
+}
+
+// find returns the requested version of chart, or the newest stable one
+// when version is empty.
+func (idx *helmIndex) find(chart, version string) (helmChartVersion, error) {
+	versions, ok := idx.Entries[chart]
+	if !ok || len(versions) == 0 {
+		return helmChartVersion{}, fmt.Errorf("chart %q not found in repository", chart)
+	}
+	for _, v := range versions {
+		if version == "" && !strings.Contains(v.Version, "-") || version != "" && (v.Version == version || "v"+v.Version == version) {
+			return v, nil
+		}
+	}
+	if version == "" {
+		return versions[0], nil
+	}
+	return helmChartVersion{}, fmt.Errorf("version %s of chart %q not found in repository", version, chart)
+}
+
+// downloadHelmChart saves a chart archive from the repository to a temp
+// file. The caller removes it.
+func downloadHelmChart(repo HelmRepository, password string, cv helmChartVersion) (string, error) {
+	if len(cv.URLs) == 0 {
+		return "", fmt.Errorf("chart %s %s has no download URL", cv.Name, cv.Version)
+	}
+	target, err := url.Parse(cv.URLs[0])
+	if err != nil {
+		return "", err
+	}
+	if !target.IsAbs() {
+		base, err := url.Parse(strings.TrimRight(repo.URL, "/") + "/")
+		if err != nil {
+			return "", err
+		}
+		target = base.ResolveReference(target)
+	}
+	resp, err := helmRepoGet(repo, password, target.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.CreateTemp("", "chart-*-"+path.Base(target.Path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("downloading %s: %v", target, err)
+	}
+	return f.Name(), nil
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// ListHelmRepositories lists the chart repositories.
+// GET /api/helm/repositories
+func ListHelmRepositories(w http.ResponseWriter, r *http.Request) {
+	rows, err := database.DB.Query(`SELECT id, name, url, username, insecure_skip_verify, created_at FROM helm_repositories ORDER BY name`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	repos := []HelmRepository{}
+	for rows.Next() {
+		var repo HelmRepository
+		var insecure int
+		if err := rows.Scan(&repo.ID, &repo.Name, &repo.URL, &repo.Username, &insecure, &repo.CreatedAt); err != nil {
+			continue
+		}
+		repo.InsecureSkipVerify = insecure == 1
+		repos = append(repos, repo)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(repos)
+}
+
+// CreateHelmRepository adds a chart repository after checking its index
+// can be read.
+// POST /api/helm/repositories   body: {"name","url","username","password","insecure_skip_verify"}
+func CreateHelmRepository(w http.ResponseWriter, r *http.Request) {
+	user, _ := GetUserFromContext(r.Context())
+	if !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden: admin role required", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		HelmRepository
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.URL = strings.TrimRight(strings.TrimSpace(req.URL), "/")
+	if u, err := url.Parse(req.URL); req.Name == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		http.Error(w, "name and an http(s) url are required", http.StatusBadRequest)
+		return
+	}
+	idx, err := helmRepoIndex(req.HelmRepository, req.Password, true)
+	if err != nil {
+		http.Error(w, "Repository check failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	password, err := vault.Seal(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	insecure := 0
+	if req.InsecureSkipVerify {
+		insecure = 1
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO helm_repositories (name, url, username, password, insecure_skip_verify) VALUES (?, ?, ?, ?, ?)`,
+		req.Name, req.URL, req.Username, password, insecure)
+	if err != nil {
+		http.Error(w, "Error creating repository: "+err.Error(), http.StatusConflict)
+		return
+	}
+	id, _ := res.LastInsertId()
+	// The check above ran without an ID; cache the index under the new one.
+	helmIndexMu.Lock()
+	delete(helmIndexCache, 0)
+	helmIndexCache[int(id)] = idx
+	helmIndexMu.Unlock()
+
+	recordActivityLog("helm_repo_add", req.Name, req.URL+" by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id, "charts": len(idx.Entries)})
+}
+
+// DeleteHelmRepository removes a chart repository.
+// DELETE /api/helm/repositories/{id}
+func DeleteHelmRepository(w http.ResponseWriter, r *http.Request) {
+	user, _ := GetUserFromContext(r.Context())
+	if !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden: admin role required", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	repo, _, err := loadHelmRepository(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if _, err := database.DB.Exec(`DELETE FROM helm_repositories WHERE id = ?`, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	helmIndexMu.Lock()
+	delete(helmIndexCache, id)
+	helmIndexMu.Unlock()
+	recordActivityLog("helm_repo_remove", repo.Name, "by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// ListHelmRepositoryCharts lists a repository's charts with their newest
+// version, or every version of one chart with ?chart=.
+// GET /api/helm/repositories/{id}/charts?chart=&refresh=1
+func ListHelmRepositoryCharts(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	repo, password, err := loadHelmRepository(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	idx, err := helmRepoIndex(repo, password, r.URL.Query().Get("refresh") == "1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if chart := r.URL.Query().Get("chart"); chart != "" {
+		versions, ok := idx.Entries[chart]
+		if !ok {
+			http.Error(w, fmt.Sprintf("chart %q not found in repository", chart), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(versions)
+		return
+	}
+	charts := []helmChartVersion{}
+	for name := range idx.Entries {
+		if latest, err := idx.find(name, ""); err == nil {
+			charts = append(charts, latest)
+		}
+	}
+	sort.Slice(charts, func(i, j int) bool { return charts[i].Name < charts[j].Name })
+	json.NewEncoder(w).Encode(charts)
+}
@@ -0,0 +1,501 @@
+package api
+
+import (
+	"archive/tar"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/gorilla/mux"
+)
+
+// maxBuildContextUpload caps uploaded build contexts.
+const maxBuildContextUpload = 512 << 20
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type ImageBuild struct {
+	ID          int               `json:"id"`
+	HostID      int               `json:"host_id"`
+	SourceType  string            `json:"source_type"` // upload, git
+	RepoID      *int              `json:"repo_id"`
+	ContextPath string            `json:"context_path"`
+	CommitSHA   string            `json:"commit_sha"`
+	Dockerfile  string            `json:"dockerfile"`
+	Tags        []string          `json:"tags"`
+	BuildArgs   map[string]string `json:"build_args"`
+	Target      string            `json:"target"`
+	Labels      map[string]string `json:"labels"`
+	NoCache     bool              `json:"no_cache"`
+	RegistryID  *int              `json:"registry_id"`
+	PushRef     string            `json:"push_ref"`
+	Status      string            `json:"status"` // queued, running, success, failed
+	ImageID     string            `json:"image_id"`
+	Digest      string            `json:"digest"`
+	Error       *string           `json:"error"`
+	DurationMs  int64             `json:"duration_ms"`
+	CreatedBy   string            `json:"created_by"`
+	CreatedAt   string            `json:"created_at"`
+	StartedAt   *string           `json:"started_at"`
+	FinishedAt  *string           `json:"finished_at"`
+}
+
+// ImageBuildRequest is the JSON body of POST /api/images/build, or the
+// "options" form field when the context is uploaded as multipart.
+type ImageBuildRequest struct {
+	RepoID         int               `json:"repo_id"`
+	Subpath        string            `json:"subpath"`
+	Dockerfile     string            `json:"dockerfile"`
+	Tags           []string          `json:"tags"`
+	BuildArgs      map[string]string `json:"build_args"`
+	Target         string            `json:"target"`
+	Labels         map[string]string `json:"labels"`
+	NoCache        bool              `json:"no_cache"`
+	RegistryID     int               `json:"registry_id"`
+	PushRepository string            `json:"push_repository"` // e.g. "team/app:1.2" inside the registry
+}
+
+const imageBuildColumns = `id, host_id, source_type, repo_id, context_path, commit_sha, dockerfile,
+	tags, build_args, target, labels, no_cache, registry_id, push_ref, status, image_id, digest,
+	error, duration_ms, created_by, created_at, started_at, finished_at`
+
+func scanImageBuild(row interface{ Scan(...interface{}) error }) (ImageBuild, error) {
+	var b ImageBuild
+	var tags, buildArgs, labels string
+	var noCache int
+	err := row.Scan(&b.ID, &b.HostID, &b.SourceType, &b.RepoID, &b.ContextPath, &b.CommitSHA, &b.Dockerfile,
+		&tags, &buildArgs, &b.Target, &labels, &noCache, &b.RegistryID, &b.PushRef, &b.Status, &b.ImageID, &b.Digest,
+		&b.Error, &b.DurationMs, &b.CreatedBy, &b.CreatedAt, &b.StartedAt, &b.FinishedAt)
+	if err != nil {
+		return b, err
+	}
+	json.Unmarshal([]byte(tags), &b.Tags)           //nolint:errcheck
+	json.Unmarshal([]byte(buildArgs), &b.BuildArgs) //nolint:errcheck
+	json.Unmarshal([]byte(labels), &b.Labels)       //nolint:errcheck
+	b.NoCache = noCache == 1
+	return b, nil
+}
+
+func buildLogKey(id int64) string { return fmt.Sprintf("build:%d", id) }
+
+// ── Docker JSON stream ──────────────────────────────────────────────────────
+
+// pumpDockerStream decodes the JSON message stream returned by build, pull
+// and push calls, writes human readable lines to out and hands every aux
+// payload to onAux. Per-layer progress is only written when its status or
+// rough percentage changes so the log stays readable. The first error
+// message in the stream is returned.
+func pumpDockerStream(r io.Reader, out io.Writer, onAux func(json.RawMessage)) error {
+	dec := json.NewDecoder(r)
+	last := map[string]string{}
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != nil {
+			fmt.Fprintf(out, "ERROR: %s\n", msg.Error.Message)
+			return errors.New(msg.Error.Message)
+		}
+		if msg.Aux != nil && onAux != nil {
+			onAux(*msg.Aux)
+		}
+		if msg.Stream != "" {
+			io.WriteString(out, msg.Stream)
+		}
+		if msg.Status == "" {
+			continue
+		}
+		state := msg.Status
+		if p := msg.Progress; p != nil && p.Total > 0 {
+			state += fmt.Sprintf(" %d%%", p.Current*100/p.Total/10*10)
+		}
+		if msg.ID != "" {
+			if last[msg.ID] == state {
+				continue
+			}
+			last[msg.ID] = state
+			fmt.Fprintf(out, "%s: %s\n", msg.ID, state)
+		} else {
+			fmt.Fprintln(out, state)
+		}
+	}
+}
+
+// ── Build context ───────────────────────────────────────────────────────────
+
+// tarDirectory streams dir as an uncompressed tar archive, skipping .git.
+func tarDirectory(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ── Build execution ─────────────────────────────────────────────────────────
+
+// queueImageBuild records a build and starts it in the background.
+func queueImageBuild(hostID int, sourceType string, req ImageBuildRequest, uploadPath, createdBy string) (int64, error) {
+	tags, _ := json.Marshal(req.Tags)
+	buildArgs, _ := json.Marshal(req.BuildArgs)
+	labels, _ := json.Marshal(req.Labels)
+	noCache := 0
+	if req.NoCache {
+		noCache = 1
+	}
+	contextPath := req.Subpath
+	if sourceType == "upload" {
+		contextPath = ""
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO image_builds (host_id, source_type, repo_id, context_path, dockerfile, tags, build_args,
+		                           target, labels, no_cache, registry_id, status, created_by)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'queued', ?)`,
+		hostID, sourceType, nullInt(req.RepoID), contextPath, req.Dockerfile, string(tags), string(buildArgs),
+		req.Target, string(labels), noCache, nullInt(req.RegistryID), createdBy)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+	log.Printf("[Build] #%d queued by %s on host %d (%s)", id, createdBy, hostID, sourceType)
+
+	// Register the stream now so viewers that connect before the build
+	// starts get the live log rather than an empty stored one.
+	logs := startLogStream(buildLogKey(id))
+	go runImageBuild(id, logs, hostID, req, uploadPath)
+
+	return id, nil
+}
+
+// runImageBuild executes a queued build. uploadPath is the saved context
+// archive for uploads and is removed when the build ends.
+func runImageBuild(id int64, logs *logStream, hostID int, req ImageBuildRequest, uploadPath string) {
+	start := time.Now()
+	database.DB.Exec(`UPDATE image_builds SET status = 'running', started_at = ? WHERE id = ?`,
+		start.Format(time.RFC3339), id)
+
+	imageID, digest, pushRef, commit, err := executeImageBuild(logs, hostID, req, uploadPath)
+
+	status := "success"
+	var errMsg interface{}
+	if err != nil {
+		status = "failed"
+		errMsg = err.Error()
+		logs.Line("ERROR: " + err.Error())
+	} else {
+		logs.Line("Build finished in " + time.Since(start).Round(time.Second).String())
+	}
+	database.DB.Exec(
+		`UPDATE image_builds SET status = ?, image_id = ?, digest = ?, push_ref = ?, commit_sha = ?,
+		        error = ?, log = ?, duration_ms = ?, finished_at = ? WHERE id = ?`,
+		status, imageID, digest, pushRef, commit, errMsg, logs.String(),
+		time.Since(start).Milliseconds(), time.Now().Format(time.RFC3339), id)
+	finishLogStream(buildLogKey(id), logs)
+	database.LogActivity("build_image", strings.Join(req.Tags, ","), status)
+}
+
+func executeImageBuild(logs *logStream, hostID int, req ImageBuildRequest, uploadPath string) (imageID, digest, pushRef, commit string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	cli, err := GetClientByHostID(hostID)
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	// Build context
+	var buildCtx io.Reader
+	if uploadPath != "" {
+		defer os.Remove(uploadPath)
+		f, err := os.Open(uploadPath)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		defer f.Close()
+		buildCtx = f
+	} else {
+		src, err := loadGitRepoSource(req.RepoID)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		logs.Line(fmt.Sprintf("Cloning %s (%s)...", src.URL, src.Branch))
+		dir, sha, err := checkoutGitRepo(ctx, src)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		defer os.RemoveAll(dir)
+		commit = sha
+		logs.Line("Checked out " + sha)
+
+		ctxDir, err := resolveRepoPath(dir, req.Subpath)
+		if err != nil {
+			return "", "", "", commit, err
+		}
+		pr, pw := io.Pipe()
+		go func() { pw.CloseWithError(tarDirectory(ctxDir, pw)) }()
+		defer pr.Close()
+		buildCtx = pr
+	}
+
+	buildArgs := map[string]*string{}
+	for k, v := range req.BuildArgs {
+		buildArgs[k] = &v
+	}
+	opts := types.ImageBuildOptions{
+		Tags:        req.Tags,
+		Dockerfile:  req.Dockerfile,
+		BuildArgs:   buildArgs,
+		Target:      req.Target,
+		Labels:      req.Labels,
+		NoCache:     req.NoCache,
+		Remove:      true,
+		ForceRemove: true,
+	}
+
+	logs.Line("Sending build context to Docker host...")
+	resp, err := cli.ImageBuild(ctx, buildCtx, opts)
+	if err != nil {
+		return "", "", "", commit, err
+	}
+	defer resp.Body.Close()
+
+	err = pumpDockerStream(resp.Body, logs, func(aux json.RawMessage) {
+		var res struct{ ID string }
+		if json.Unmarshal(aux, &res) == nil && res.ID != "" {
+			imageID = res.ID
+		}
+	})
+	if err != nil {
+		return imageID, "", "", commit, err
+	}
+	if imageID == "" && len(req.Tags) > 0 {
+		if info, _, ierr := cli.ImageInspectWithRaw(ctx, req.Tags[0]); ierr == nil {
+			imageID = info.ID
+		}
+	}
+
+	if req.RegistryID == 0 {
+		return imageID, "", "", commit, nil
+	}
+
+	// Optional tag + push
+	reg, password, err := loadRegistryCredentials(req.RegistryID)
+	if err != nil {
+		return imageID, "", "", commit, err
+	}
+	pushRef, digest, _, err = pushToRegistry(ctx, cli, imageID, reg, password, req.PushRepository, logs)
+	return imageID, digest, pushRef, commit, err
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/images/build
+// Either JSON (ImageBuildRequest with repo_id) or multipart/form-data with a
+// "context" file (tar or tar.gz) and an optional "options" JSON field.
+func buildImage(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ImageBuildRequest
+	uploadPath := ""
+	sourceType := "git"
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBuildContextUpload)
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts := r.FormValue("options"); opts != "" {
+			if err := json.Unmarshal([]byte(opts), &req); err != nil {
+				http.Error(w, "Invalid options", http.StatusBadRequest)
+				return
+			}
+		}
+		file, _, err := r.FormFile("context")
+		if err != nil {
+			http.Error(w, "context file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		tmp, err := os.CreateTemp("", "build-context-*")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, err = io.Copy(tmp, file)
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		uploadPath = tmp.Name()
+		sourceType = "upload"
+		req.RepoID = 0
+	} else {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.RepoID == 0 {
+			http.Error(w, "repo_id is required (or upload a context archive)", http.StatusBadRequest)
+			return
+		}
+		if _, err := loadGitRepoSource(req.RepoID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	fail := func(msg string, code int) {
+		if uploadPath != "" {
+			os.Remove(uploadPath)
+		}
+		http.Error(w, msg, code)
+	}
+	if req.Dockerfile == "" {
+		req.Dockerfile = "Dockerfile"
+	}
+	if req.RegistryID != 0 {
+		if req.PushRepository == "" {
+			fail("push_repository is required when registry_id is set", http.StatusBadRequest)
+			return
+		}
+		if !canUseRegistryCredentials(user.Role) {
+			fail("Forbidden: pushing to a stored registry requires the user_cicd_full role", http.StatusForbidden)
+			return
+		}
+		if _, _, err := loadRegistryCredentials(req.RegistryID); err != nil {
+			fail(err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	hostID := hostIDFromRequest(r)
+	if _, err := GetClientByHostID(hostID); err != nil {
+		fail(err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := queueImageBuild(hostID, sourceType, req, uploadPath, user.Username)
+	if err != nil {
+		fail(err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      id,
+		"status":  "queued",
+	})
+}
+
+// GET /api/images/builds?host_id=1
+func listImageBuilds(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + imageBuildColumns + ` FROM image_builds WHERE 1=1`
+	args := []interface{}{}
+	if h := r.URL.Query().Get("host_id"); h != "" {
+		query += " AND host_id = ?"
+		args = append(args, h)
+	}
+	query += " ORDER BY id DESC LIMIT 200"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []ImageBuild{}
+	for rows.Next() {
+		b, err := scanImageBuild(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, b)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GET /api/images/builds/{id}
+func getImageBuild(w http.ResponseWriter, r *http.Request) {
+	b, err := scanImageBuild(database.DB.QueryRow(
+		`SELECT `+imageBuildColumns+` FROM image_builds WHERE id = ?`, mux.Vars(r)["id"]))
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// GET /api/images/builds/{id}/logs (WebSocket)
+func streamImageBuildLogs(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	serveLogStream(w, r, "build:"+id, func() (string, bool) {
+		var text sql.NullString
+		if err := database.DB.QueryRow(`SELECT log FROM image_builds WHERE id = ?`, id).Scan(&text); err != nil {
+			return "", false
+		}
+		return text.String, true
+	})
+}
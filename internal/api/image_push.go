@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/gorilla/mux"
+)
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type ImagePush struct {
+	ID         int     `json:"id"`
+	HostID     int     `json:"host_id"`
+	Image      string  `json:"image"`
+	RegistryID int     `json:"registry_id"`
+	TargetRef  string  `json:"target_ref"`
+	Status     string  `json:"status"` // running, success, failed
+	Digest     string  `json:"digest"`
+	SizeBytes  int64   `json:"size_bytes"`
+	Error      *string `json:"error"`
+	CreatedBy  string  `json:"created_by"`
+	CreatedAt  string  `json:"created_at"`
+	FinishedAt *string `json:"finished_at"`
+}
+
+const imagePushColumns = `id, host_id, image, registry_id, target_ref, status, digest, size_bytes,
+	error, created_by, created_at, finished_at`
+
+func scanImagePush(row interface{ Scan(...interface{}) error }) (ImagePush, error) {
+	var p ImagePush
+	err := row.Scan(&p.ID, &p.HostID, &p.Image, &p.RegistryID, &p.TargetRef, &p.Status, &p.Digest, &p.SizeBytes,
+		&p.Error, &p.CreatedBy, &p.CreatedAt, &p.FinishedAt)
+	return p, err
+}
+
+func pushLogKey(id int64) string { return fmt.Sprintf("push:%d", id) }
+
+// ── Reference helpers ───────────────────────────────────────────────────────
+
+// splitRegistryHost separates a leading registry host from an image
+// reference, using the same rule as the Docker CLI: the first path
+// component is a host when it contains "." or ":" or is "localhost".
+func splitRegistryHost(ref string) (host, rest string) {
+	first, remainder, ok := strings.Cut(ref, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, remainder
+	}
+	return "", ref
+}
+
+// refHasTag reports whether ref already carries a tag or digest.
+func refHasTag(ref string) bool {
+	if strings.Contains(ref, "@") {
+		return true
+	}
+	_, rest := splitRegistryHost(ref)
+	return strings.Contains(rest[strings.LastIndex(rest, "/")+1:], ":")
+}
+
+// qualifyRegistryRef prefixes ref with the registry host unless it already
+// names that host.
+func qualifyRegistryRef(reg CicdRegistry, ref string) string {
+	host := registryHost(reg)
+	if h, _ := splitRegistryHost(ref); h == host {
+		return ref
+	}
+	return host + "/" + strings.TrimPrefix(ref, "/")
+}
+
+// ── Push ────────────────────────────────────────────────────────────────────
+
+// pushToRegistry tags source as repository inside reg and pushes it,
+// writing progress to out. repository may be empty, in which case the
+// source reference (minus any registry host) is reused. It returns the
+// pushed reference and the digest and size reported by the daemon.
+func pushToRegistry(ctx context.Context, cli *client.Client, source string, reg CicdRegistry, password, repository string, out io.Writer) (ref, digest string, size int64, err error) {
+	if repository == "" {
+		if strings.HasPrefix(source, "sha256:") {
+			return "", "", 0, fmt.Errorf("repository is required when pushing an image ID")
+		}
+		_, repository = splitRegistryHost(source)
+	}
+	ref = qualifyRegistryRef(reg, repository)
+	if !refHasTag(ref) {
+		ref += ":latest"
+	}
+	if err := cli.ImageTag(ctx, source, ref); err != nil {
+		return ref, "", 0, err
+	}
+	auth, err := registryAuthHeader(reg, password)
+	if err != nil {
+		return ref, "", 0, err
+	}
+	fmt.Fprintf(out, "Pushing %s to %s...\n", ref, reg.Name)
+	rc, err := cli.ImagePush(ctx, ref, image.PushOptions{RegistryAuth: auth})
+	if err != nil {
+		return ref, "", 0, err
+	}
+	defer rc.Close()
+	err = pumpDockerStream(rc, out, func(aux json.RawMessage) {
+		var res struct {
+			Digest string
+			Size   int64
+		}
+		if json.Unmarshal(aux, &res) == nil && res.Digest != "" {
+			digest, size = res.Digest, res.Size
+		}
+	})
+	if err == nil && digest != "" {
+		fmt.Fprintf(out, "Pushed %s@%s\n", ref, digest)
+	}
+	return ref, digest, size, err
+}
+
+func runImagePush(id int64, logs *logStream, hostID int, source string, reg CicdRegistry, password, repository string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	var ref, digest string
+	var size int64
+	cli, err := GetClientByHostID(hostID)
+	if err == nil {
+		ref, digest, size, err = pushToRegistry(ctx, cli, source, reg, password, repository, logs)
+	}
+
+	status := "success"
+	var errMsg interface{}
+	if err != nil {
+		status = "failed"
+		errMsg = err.Error()
+		logs.Line("ERROR: " + err.Error())
+	}
+	database.DB.Exec(
+		`UPDATE image_pushes SET status = ?, target_ref = ?, digest = ?, size_bytes = ?, error = ?, log = ?, finished_at = ?
+		 WHERE id = ?`,
+		status, ref, digest, size, errMsg, logs.String(), time.Now().Format(time.RFC3339), id)
+	finishLogStream(pushLogKey(id), logs)
+	database.LogActivity("push_image", source+" -> "+ref, status)
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/images/push
+// Body: {"image": "app:1.0", "registry_id": 3, "repository": "team/app:1.0"}
+func pushImage(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Image      string `json:"image"`
+		RegistryID int    `json:"registry_id"`
+		Repository string `json:"repository"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Image == "" || req.RegistryID == 0 {
+		http.Error(w, "image and registry_id are required", http.StatusBadRequest)
+		return
+	}
+	if !canUseRegistryCredentials(user.Role) {
+		http.Error(w, "Forbidden: pushing to a stored registry requires the user_cicd_full role", http.StatusForbidden)
+		return
+	}
+	reg, password, err := loadRegistryCredentials(req.RegistryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hostID := hostIDFromRequest(r)
+	cli, err := GetClientByHostID(hostID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, _, err := cli.ImageInspectWithRaw(r.Context(), req.Image); err != nil {
+		http.Error(w, "Image not found: "+req.Image, http.StatusNotFound)
+		return
+	}
+
+	res, err := database.DB.Exec(
+		`INSERT INTO image_pushes (host_id, image, registry_id, status, created_by) VALUES (?, ?, ?, 'running', ?)`,
+		hostID, req.Image, req.RegistryID, user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+	logs := startLogStream(pushLogKey(id))
+	go runImagePush(id, logs, hostID, req.Image, reg, password, req.Repository)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      id,
+		"status":  "running",
+	})
+}
+
+// GET /api/images/pushes?registry_id=3
+func listImagePushes(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + imagePushColumns + ` FROM image_pushes WHERE 1=1`
+	args := []interface{}{}
+	if v := r.URL.Query().Get("registry_id"); v != "" {
+		query += " AND registry_id = ?"
+		args = append(args, v)
+	}
+	if h := r.URL.Query().Get("host_id"); h != "" {
+		query += " AND host_id = ?"
+		args = append(args, h)
+	}
+	query += " ORDER BY id DESC LIMIT 200"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []ImagePush{}
+	for rows.Next() {
+		p, err := scanImagePush(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, p)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GET /api/images/pushes/{id}
+func getImagePush(w http.ResponseWriter, r *http.Request) {
+	p, err := scanImagePush(database.DB.QueryRow(
+		`SELECT `+imagePushColumns+` FROM image_pushes WHERE id = ?`, mux.Vars(r)["id"]))
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// GET /api/images/pushes/{id}/logs (WebSocket)
+func streamImagePushLogs(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	serveLogStream(w, r, "push:"+id, func() (string, bool) {
+		var text sql.NullString
+		if err := database.DB.QueryRow(`SELECT log FROM image_pushes WHERE id = ?`, id).Scan(&text); err != nil {
+			return "", false
+		}
+		return text.String, true
+	})
+}
@@ -0,0 +1,331 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/docker/docker/api/types/container"
+)
+
+// defaultRescanHours applies when the "image_rescan_interval_hours"
+// setting is unset. Set it to 0 to turn scheduled rescans off.
+const defaultRescanHours = 24
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type VulnMatch struct {
+	ID           string   `json:"id"`
+	Aliases      []string `json:"aliases,omitempty"`
+	Package      string   `json:"package"`
+	Version      string   `json:"version"`
+	FixedVersion string   `json:"fixed_version,omitempty"`
+	Severity     string   `json:"severity"`
+	CVSS         float64  `json:"cvss,omitempty"`
+	Summary      string   `json:"summary,omitempty"`
+	Ecosystem    string   `json:"ecosystem"`
+	Type         string   `json:"type"`
+	Path         string   `json:"path,omitempty"`
+}
+
+// imageScanResult is what the built-in scanner stores in result_json.
+type imageScanResult struct {
+	Scanner         string        `json:"scanner"`
+	Image           string        `json:"image"`
+	ImageID         string        `json:"image_id"`
+	HostID          int           `json:"host_id"`
+	OS              ImageOS       `json:"os"`
+	Packages        []SBOMPackage `json:"packages"`
+	Vulnerabilities []VulnMatch   `json:"vulnerabilities"`
+}
+
+// ── Matching ────────────────────────────────────────────────────────────────
+
+// fixedVersion returns the lowest "fixed" event above version, if any.
+func fixedVersion(ecosystem, version string, ranges []osvRange) string {
+	best := ""
+	for _, r := range ranges {
+		for _, e := range r.Events {
+			if e.Fixed == "" || compareVersions(ecosystem, e.Fixed, version) <= 0 {
+				continue
+			}
+			if best == "" || compareVersions(ecosystem, e.Fixed, best) < 0 {
+				best = e.Fixed
+			}
+		}
+	}
+	return best
+}
+
+// matchVulnerabilities looks every package up in the advisory database.
+// OS packages are matched by source package, which is how distributions
+// publish their advisories.
+func matchVulnerabilities(pkgs []SBOMPackage) []VulnMatch {
+	type key struct{ eco, name string }
+	cache := map[key][]vulnAdvisory{}
+	lookup := func(eco, name string) []vulnAdvisory {
+		k := key{eco, name}
+		if adv, ok := cache[k]; ok {
+			return adv
+		}
+		adv, _ := findAdvisories(eco, name)
+		for i := range adv {
+			cveSeverity(&adv[i])
+		}
+		cache[k] = adv
+		return adv
+	}
+
+	var out []VulnMatch
+	for _, p := range pkgs {
+		if p.Ecosystem == "" {
+			continue
+		}
+		name, version := p.Name, p.Version
+		if p.Source != "" {
+			name, version = p.Source, p.SourceVersion
+		}
+		seen := map[string]bool{}
+		for _, a := range lookup(p.Ecosystem, name) {
+			if seen[a.VulnID] || !osvAffected(a.Ecosystem, version, a.Ranges, a.Versions) {
+				continue
+			}
+			seen[a.VulnID] = true
+			out = append(out, VulnMatch{
+				ID:           a.VulnID,
+				Aliases:      a.Aliases,
+				Package:      p.Name,
+				Version:      p.Version,
+				FixedVersion: fixedVersion(a.Ecosystem, version, a.Ranges),
+				Severity:     a.Severity,
+				CVSS:         a.CVSS,
+				Summary:      a.Summary,
+				Ecosystem:    p.Ecosystem,
+				Type:         p.Type,
+				Path:         p.Path,
+			})
+		}
+	}
+	rank := map[string]int{"critical": 0, "high": 1, "medium": 2, "low": 3, "info": 4}
+	sort.SliceStable(out, func(i, j int) bool { return rank[out[i].Severity] < rank[out[j].Severity] })
+	return out
+}
+
+// ── Scanning ────────────────────────────────────────────────────────────────
+
+// createImageScanReport inserts a running report for imageRef.
+func createImageScanReport(imageRef, workspaceID string) (int64, error) {
+	res, err := database.DB.Exec(
+		`INSERT INTO cicd_scan_reports (scan_type, target, status, summary, workspace_id, source)
+		 VALUES ('image', ?, 'running', 'Scan in progress', ?, 'scanner')`, imageRef, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// runImageScan extracts the image's SBOM, matches it and completes the
+// report.
+func runImageScan(reportID int64, hostID int, imageRef string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	fail := func(err error) {
+		log.Printf("[Scan] report %d (%s): %v", reportID, imageRef, err)
+		database.DB.Exec(`UPDATE cicd_scan_reports SET status = 'failed', summary = ? WHERE id = ?`,
+			"Scan failed: "+err.Error(), reportID)
+		database.LogActivity("scan_image", imageRef, "error")
+	}
+
+	cli, err := GetClientByHostID(hostID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := ensureImage(ctx, cli, imageRef); err != nil {
+		fail(err)
+		return
+	}
+	info, _, err := cli.ImageInspectWithRaw(ctx, imageRef)
+	if err != nil {
+		fail(err)
+		return
+	}
+	sbom, err := extractImageSBOM(ctx, cli, imageRef)
+	if err != nil {
+		fail(err)
+		return
+	}
+	vulns := matchVulnerabilities(sbom.Packages)
+	findings := vulnMatchFindings(vulns)
+	normalizeFindings(findings)
+	counts := severityCounts(findings)
+	result := imageScanResult{
+		Scanner:         "builtin",
+		Image:           imageRef,
+		ImageID:         info.ID,
+		HostID:          hostID,
+		OS:              sbom.OS,
+		Packages:        sbom.Packages,
+		Vulnerabilities: vulns,
+	}
+	if result.Packages == nil {
+		result.Packages = []SBOMPackage{}
+	}
+	if result.Vulnerabilities == nil {
+		result.Vulnerabilities = []VulnMatch{}
+	}
+	data, _ := json.Marshal(result)
+
+	status := "clean"
+	if len(vulns) > 0 {
+		status = "findings"
+	}
+	osName := sbom.OS.Pretty
+	if osName == "" {
+		osName = "unknown OS"
+	}
+	summary := fmt.Sprintf("%d packages, %d vulnerabilities (%s)", len(sbom.Packages), len(vulns), osName)
+	database.DB.Exec(
+		`UPDATE cicd_scan_reports SET status = ?, critical = ?, high = ?, medium = ?, low = ?, info = ?,
+		        summary = ?, result_json = ? WHERE id = ?`,
+		status, counts["critical"], counts["high"], counts["medium"], counts["low"], counts["info"],
+		summary, string(data), reportID)
+	if err := saveScanFindings(reportID, findings); err != nil {
+		log.Printf("[Scan] report %d: saving findings: %v", reportID, err)
+	}
+	database.LogActivity("scan_image", imageRef, "success")
+}
+
+// ── Scheduled rescans ───────────────────────────────────────────────────────
+
+func imageRescanInterval() time.Duration {
+	hours := defaultRescanHours
+	if v, err := database.GetSetting("image_rescan_interval_hours"); err == nil && v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			hours = n
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// StartImageRescanScheduler periodically rescans the images of running
+// containers on every host so new advisories surface without a rebuild.
+func StartImageRescanScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			rescanRunningImages()
+		}
+	}()
+}
+
+func rescanRunningImages() {
+	interval := imageRescanInterval()
+	if interval <= 0 {
+		return
+	}
+	rows, err := database.DB.Query(`SELECT id FROM docker_hosts`)
+	if err != nil {
+		return
+	}
+	var hosts []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			hosts = append(hosts, id)
+		}
+	}
+	rows.Close()
+
+	cutoff := time.Now().UTC().Add(-interval).Format("2006-01-02 15:04:05")
+	for _, hostID := range hosts {
+		cli, err := GetClientByHostID(hostID)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		containers, err := cli.ContainerList(ctx, container.ListOptions{})
+		cancel()
+		if err != nil {
+			continue
+		}
+		images := map[string]bool{}
+		for _, c := range containers {
+			if c.Labels["docker-management.scan"] == "true" {
+				continue
+			}
+			images[c.Image] = true
+		}
+		for ref := range images {
+			var recent int
+			database.DB.QueryRow(
+				`SELECT COUNT(*) FROM cicd_scan_reports WHERE scan_type = 'image' AND target = ?
+				 AND (status = 'running' OR created_at > ?)`, ref, cutoff).Scan(&recent)
+			if recent > 0 {
+				continue
+			}
+			id, err := createImageScanReport(ref, "")
+			if err != nil {
+				continue
+			}
+			log.Printf("[Scan] Scheduled rescan of %s on host %d (report %d)", ref, hostID, id)
+			runImageScan(id, hostID, ref)
+		}
+	}
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/cicd/scans/image
+// Body: {"image": "nginx:1.27", "host_id": 1, "workspace_id": ""}
+func ScanImage(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if HasRole(user.Role, "user_cicd_view") && !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_cicd_full") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		Image       string `json:"image"`
+		HostID      int    `json:"host_id"`
+		WorkspaceID string `json:"workspace_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	req.Image = strings.TrimSpace(req.Image)
+	if req.Image == "" {
+		http.Error(w, "image is required", http.StatusBadRequest)
+		return
+	}
+	if req.HostID == 0 {
+		req.HostID = hostIDFromRequest(r)
+	}
+	if _, err := GetClientByHostID(req.HostID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := createImageScanReport(req.Image, req.WorkspaceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	go runImageScan(id, req.HostID, req.Image)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id, "status": "running"})
+}
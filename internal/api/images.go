@@ -74,7 +74,8 @@ func listImages(w http.ResponseWriter, r *http.Request) {
 // Pull image from registry
 func pullImage(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Image string `json:"image"` // format: "image:tag" or just "image"
+		Image      string `json:"image"`       // format: "image:tag" or just "image"
+		RegistryID int    `json:"registry_id"` // optional: pull from a stored CI/CD registry
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -87,8 +88,29 @@ func pullImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Resolve against the stored registry and use its credentials
+	pullOpts := image.PullOptions{}
+	if req.RegistryID != 0 {
+		if user, ok := GetUserFromContext(r.Context()); !ok || !canUseRegistryCredentials(user.Role) {
+			http.Error(w, "Forbidden: pulling from a stored registry requires the user_cicd_full role", http.StatusForbidden)
+			return
+		}
+		reg, password, err := loadRegistryCredentials(req.RegistryID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		auth, err := registryAuthHeader(reg, password)
+		if err != nil {
+			http.Error(w, "Registry authentication failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		req.Image = qualifyRegistryRef(reg, req.Image)
+		pullOpts.RegistryAuth = auth
+	}
+
 	// Add :latest if no tag specified
-	if !strings.Contains(req.Image, ":") {
+	if !refHasTag(req.Image) {
 		req.Image += ":latest"
 	}
 
@@ -99,7 +121,7 @@ func pullImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, err := cli.ImagePull(context.Background(), req.Image, image.PullOptions{})
+	out, err := cli.ImagePull(context.Background(), req.Image, pullOpts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		database.LogActivity("pull_image", req.Image, "error")
@@ -107,8 +129,12 @@ func pullImage(w http.ResponseWriter, r *http.Request) {
 	}
 	defer out.Close()
 
-	// Read and discard output (in production, you might want to stream this)
-	io.Copy(io.Discard, out)
+	// Drain the progress stream; errors such as "manifest unknown" arrive in it
+	if err := pumpDockerStream(out, io.Discard, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		database.LogActivity("pull_image", req.Image, "error")
+		return
+	}
 
 	database.LogActivity("pull_image", req.Image, "success")
 
@@ -15,6 +15,7 @@ import (
 
 	"github.com/adisaputra10/docker-management/internal/database"
 	"github.com/adisaputra10/docker-management/internal/models"
+	"github.com/adisaputra10/docker-management/internal/vault"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/ssh"
 )
@@ -66,10 +67,21 @@ func CreateK0sCluster(w http.ResponseWriter, r *http.Request) {
 		req.Type = "controller"
 	}
 
+	password, err := vault.Seal(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sshKey, err := vault.Seal(req.SSHKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Insert into database
 	result, err := database.DB.Exec(
 		"INSERT INTO k0s_clusters (name, ip_address, username, password, auth_method, ssh_key, status, created_at, type) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		req.Name, req.IP, req.Username, req.Password, req.AuthMethod, req.SSHKey, "provisioning", time.Now().Format("2006-01-02 15:04:05"), req.Type,
+		req.Name, req.IP, req.Username, password, req.AuthMethod, sshKey, "provisioning", time.Now().Format("2006-01-02 15:04:05"), req.Type,
 	)
 	if err != nil {
 		log.Printf("Error inserting cluster: %v", err)
@@ -251,7 +263,10 @@ func provisionK0sCluster(id int, req models.K0sClusterRequest) {
 				kubeconfig = strings.ReplaceAll(kubeconfig, "localhost", req.IP)
 				kubeconfig = strings.ReplaceAll(kubeconfig, "127.0.0.1", req.IP)
 				kubeconfig = strings.ReplaceAll(kubeconfig, "10.0.2.15", req.IP)
-				_, dbErr := database.DB.Exec("UPDATE k0s_clusters SET kubeconfig = ? WHERE id = ?", kubeconfig, id)
+				sealed, dbErr := vault.Seal(kubeconfig)
+				if dbErr == nil {
+					_, dbErr = database.DB.Exec("UPDATE k0s_clusters SET kubeconfig = ? WHERE id = ?", sealed, id)
+				}
 				if dbErr != nil {
 					log.Printf("WARNING: Failed to save kubeconfig to DB: %v", dbErr)
 				} else {
@@ -476,6 +491,10 @@ func DeployOnK0s(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !admitDeploy(w, r, admissionRequest{Kind: "k0s_deploy", ClusterID: req.ClusterID, Namespace: "default", Images: []string{req.Image}}) {
+		return
+	}
+
 	if req.Replicas == 0 {
 		req.Replicas = 1
 	}
@@ -609,6 +628,7 @@ func AddWorkerNode(w http.ResponseWriter, r *http.Request) {
 		// Get controller password from DB
 		var controllerPassword string
 		database.DB.QueryRow("SELECT password FROM k0s_clusters WHERE id = ?", clusterID).Scan(&controllerPassword)
+		controllerPassword = database.OpenSecret(controllerPassword)
 		log.Printf("[DEBUG] Controller password retrieved from database")
 
 		// Get controller kubeconfig and token
@@ -900,9 +920,20 @@ func AddWorkerNode(w http.ResponseWriter, r *http.Request) {
 
 		// Insert worker node to k0s_nodes with hostname
 		log.Printf("[DATABASE] Step 13: Inserting worker node record (IP: %s, Hostname: %s, Role: worker)...", req.IP, hostname)
+		// Keep the worker's SSH access for upgrades and replacement
+		sealedPassword, err := vault.Seal(req.Password)
+		if err != nil {
+			log.Printf("[DATABASE] ERROR: Failed to seal worker password: %v", err)
+			return
+		}
+		sealedKey, err := vault.Seal(req.SSHKey)
+		if err != nil {
+			log.Printf("[DATABASE] ERROR: Failed to seal worker SSH key: %v", err)
+			return
+		}
 		_, err = database.DB.Exec(
-			"INSERT OR REPLACE INTO k0s_nodes (cluster_id, ip_address, hostname, role, status) VALUES (?, ?, ?, ?, ?)",
-			clusterID, req.IP, hostname, "worker", "active",
+			"INSERT OR REPLACE INTO k0s_nodes (cluster_id, ip_address, hostname, role, status, username, password, auth_method, ssh_key) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			clusterID, req.IP, hostname, "worker", "active", req.Username, sealedPassword, authMethod, sealedKey,
 		)
 		if err != nil {
 			log.Printf("[DATABASE] ERROR: Failed to insert worker node: %v", err)
@@ -975,6 +1006,19 @@ func DeleteWorkerNode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The worker is reached with its own credentials when it has them,
+	// otherwise with the cluster's.
+	workerUser, workerCredential, workerAuth := cluster.Username, database.OpenSecret(password), "password"
+	if cl, err := loadK0sClusterAccess(cluster.ID); err == nil {
+		workerUser, workerCredential, workerAuth = cl.Username, cl.Credential, cl.AuthMethod
+		nodes, _ := loadK0sNodes(cl)
+		for _, n := range nodes {
+			if strconv.Itoa(n.ID) == nodeID {
+				workerUser, workerCredential, workerAuth = n.Username, n.Credential, n.AuthMethod
+			}
+		}
+	}
+
 	// Delete in background
 	go func() {
 		log.Printf("=====================================")
@@ -1021,6 +1065,7 @@ func DeleteWorkerNode(w http.ResponseWriter, r *http.Request) {
 		// Get controller password from DB
 		var controllerPassword string
 		database.DB.QueryRow("SELECT password FROM k0s_clusters WHERE id = ?", clusterID).Scan(&controllerPassword)
+		controllerPassword = database.OpenSecret(controllerPassword)
 		log.Printf("[DEBUG] Controller password retrieved from database")
 
 		// Connect to controller
@@ -1068,8 +1113,7 @@ func DeleteWorkerNode(w http.ResponseWriter, r *http.Request) {
 
 		// Connect to worker node to stop k0s
 		log.Printf("[WORKER %s] Step 3: Connecting to worker to cleanup...", req.IP)
-		workerPassword := password // Use same password as controller for now
-		workerClient, err := connectSSH(req.IP, cluster.Username, workerPassword, "password")
+		workerClient, err := connectSSH(req.IP, workerUser, workerCredential, workerAuth)
 		if err != nil {
 			log.Printf("[WORKER %s] WARNING: Failed to connect to worker: %v (will skip cleanup, DB will still be cleaned)", req.IP, err)
 		} else {
@@ -1108,6 +1152,35 @@ func DeleteWorkerNode(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// fetchK0sAdminKubeconfig reads the admin kubeconfig of a k0s controller
+// over SSH and points it at the controller's address.
+func fetchK0sAdminKubeconfig(ip, username, credential, auth string) (string, error) {
+	client, err := connectSSH(ip, username, credential, auth)
+	if err != nil {
+		return "", fmt.Errorf("SSH connect failed: %v", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("SSH session failed: %v", err)
+	}
+	defer session.Close()
+
+	var output, errOut strings.Builder
+	session.Stdout = &output
+	session.Stderr = &errOut
+	if err := session.Run("sudo cat /var/lib/k0s/pki/admin.conf"); err != nil {
+		return "", fmt.Errorf("reading admin.conf: %v: %s", err, strings.TrimSpace(errOut.String()))
+	}
+
+	kubeconfig := output.String()
+	kubeconfig = strings.ReplaceAll(kubeconfig, "localhost", ip)
+	kubeconfig = strings.ReplaceAll(kubeconfig, "127.0.0.1", ip)
+	kubeconfig = strings.ReplaceAll(kubeconfig, "10.0.2.15", ip)
+	return kubeconfig, nil
+}
+
 // DownloadKubeconfig downloads the kubeconfig for a cluster
 func DownloadKubeconfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -1131,14 +1204,15 @@ func DownloadKubeconfig(w http.ResponseWriter, r *http.Request) {
 	if auth == "" {
 		auth = "password"
 	}
-	credential := password.String
+	credential := database.OpenSecret(password.String)
 	if auth == "ssh-key" {
-		credential = sshKey.String
+		credential = database.OpenSecret(sshKey.String)
 	}
 
 	// Check if kubeconfig is already stored in DB
 	var storedKubeconfig sql.NullString
 	database.DB.QueryRow("SELECT kubeconfig FROM k0s_clusters WHERE id = ?", clusterID).Scan(&storedKubeconfig)
+	storedKubeconfig.String = database.OpenSecret(storedKubeconfig.String)
 
 	var kubeconfig string
 	if storedKubeconfig.Valid && strings.TrimSpace(storedKubeconfig.String) != "" {
@@ -1148,35 +1222,17 @@ func DownloadKubeconfig(w http.ResponseWriter, r *http.Request) {
 		// Fall back to SSH
 		log.Printf("DownloadKubeconfig: no cached kubeconfig, connecting to %s@%s (auth=%s)", cluster.Username, cluster.IPAddress, auth)
 
-		client, err := connectSSH(cluster.IPAddress, cluster.Username, credential, auth)
-		if err != nil {
-			http.Error(w, "Failed to connect to cluster", http.StatusInternalServerError)
-			return
-		}
-		defer client.Close()
-
-		session, err := client.NewSession()
-		if err != nil {
-			http.Error(w, "Failed to create SSH session", http.StatusInternalServerError)
-			return
-		}
-		defer session.Close()
-
-		var output strings.Builder
-		session.Stdout = &output
-		err = session.Run("sudo cat /var/lib/k0s/pki/admin.conf")
+		kubeconfig, err = fetchK0sAdminKubeconfig(cluster.IPAddress, cluster.Username, credential, auth)
 		if err != nil {
+			log.Printf("DownloadKubeconfig: %v", err)
 			http.Error(w, "Failed to get kubeconfig", http.StatusInternalServerError)
 			return
 		}
 
-		kubeconfig = output.String()
-		kubeconfig = strings.ReplaceAll(kubeconfig, "localhost", cluster.IPAddress)
-		kubeconfig = strings.ReplaceAll(kubeconfig, "127.0.0.1", cluster.IPAddress)
-		kubeconfig = strings.ReplaceAll(kubeconfig, "10.0.2.15", cluster.IPAddress)
-
 		// Save to DB for next time
-		database.DB.Exec("UPDATE k0s_clusters SET kubeconfig = ? WHERE id = ?", kubeconfig, clusterID)
+		if sealed, err := vault.Seal(kubeconfig); err == nil {
+			database.DB.Exec("UPDATE k0s_clusters SET kubeconfig = ? WHERE id = ?", sealed, clusterID)
+		}
 		log.Printf("DownloadKubeconfig: kubeconfig fetched via SSH and cached to DB")
 	}
 
@@ -1253,6 +1309,12 @@ func ImportK0sCluster(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	sealedKC, err := vault.Seal(req.Kubeconfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Check if cluster with this name already exists – update kubeconfig if so
 	var existingID int
 	existErr := database.DB.QueryRow("SELECT id FROM k0s_clusters WHERE name = ?", req.Name).Scan(&existingID)
@@ -1260,7 +1322,7 @@ func ImportK0sCluster(w http.ResponseWriter, r *http.Request) {
 		// Cluster exists – update kubeconfig, status and ip
 		_, err := database.DB.Exec(
 			"UPDATE k0s_clusters SET kubeconfig = ?, ip_address = ?, status = 'running', type = ? WHERE id = ?",
-			req.Kubeconfig, ipAddress, req.Type, existingID,
+			sealedKC, ipAddress, req.Type, existingID,
 		)
 		if err != nil {
 			log.Printf("Error updating cluster kubeconfig: %v", err)
@@ -1282,7 +1344,7 @@ func ImportK0sCluster(w http.ResponseWriter, r *http.Request) {
 	// New cluster – insert
 	result, err := database.DB.Exec(
 		"INSERT INTO k0s_clusters (name, ip_address, username, status, created_at, kubeconfig, type) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		req.Name, ipAddress, "", "running", time.Now().Format("2006-01-02 15:04:05"), req.Kubeconfig, req.Type,
+		req.Name, ipAddress, "", "running", time.Now().Format("2006-01-02 15:04:05"), sealedKC, req.Type,
 	)
 	if err != nil {
 		log.Printf("Error importing cluster: %v", err)
@@ -1337,8 +1399,13 @@ func UpdateClusterKubeconfig(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	sealedKC, err := vault.Seal(req.Kubeconfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	query := "UPDATE k0s_clusters SET kubeconfig = ?, status = 'running'"
-	args := []interface{}{req.Kubeconfig}
+	args := []interface{}{sealedKC}
 	if ipAddress != "" {
 		query += ", ip_address = ?"
 		args = append(args, ipAddress)
@@ -1346,7 +1413,7 @@ func UpdateClusterKubeconfig(w http.ResponseWriter, r *http.Request) {
 	query += " WHERE id = ?"
 	args = append(args, clusterID)
 
-	_, err := database.DB.Exec(query, args...)
+	_, err = database.DB.Exec(query, args...)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1362,7 +1429,7 @@ func GetClusterNodes(w http.ResponseWriter, r *http.Request) {
 	clusterID := vars["id"]
 
 	rows, err := database.DB.Query(
-		"SELECT id, ip_address, hostname, role, status, created_at FROM k0s_nodes WHERE cluster_id = ? ORDER BY role DESC, created_at ASC",
+		"SELECT id, ip_address, hostname, role, status, created_at, version, progress, progress_message FROM k0s_nodes WHERE cluster_id = ? ORDER BY role DESC, created_at ASC",
 		clusterID,
 	)
 	if err != nil {
@@ -1379,13 +1446,17 @@ func GetClusterNodes(w http.ResponseWriter, r *http.Request) {
 		Role      string `json:"role"`
 		Status    string `json:"status"`
 		CreatedAt string `json:"created_at"`
+		Version   string `json:"version,omitempty"`
+		// State in the latest lifecycle operation that touched the node
+		Progress        string `json:"progress,omitempty"`
+		ProgressMessage string `json:"progress_message,omitempty"`
 	}
 
 	nodes := []Node{}
 	for rows.Next() {
 		var node Node
-		var hostname sql.NullString
-		err := rows.Scan(&node.ID, &node.IPAddress, &hostname, &node.Role, &node.Status, &node.CreatedAt)
+		var hostname, version, progress, progressMessage sql.NullString
+		err := rows.Scan(&node.ID, &node.IPAddress, &hostname, &node.Role, &node.Status, &node.CreatedAt, &version, &progress, &progressMessage)
 		if err != nil {
 			log.Printf("Error scanning node: %v", err)
 			continue
@@ -1393,6 +1464,9 @@ func GetClusterNodes(w http.ResponseWriter, r *http.Request) {
 		if hostname.Valid {
 			node.Hostname = hostname.String
 		}
+		node.Version = version.String
+		node.Progress = progress.String
+		node.ProgressMessage = progressMessage.String
 		nodes = append(nodes, node)
 	}
 
@@ -0,0 +1,1186 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/ssh"
+)
+
+// k0s cluster lifecycle: rolling upgrades, extra controllers for an HA
+// control plane and node replacement. Each runs as a k0s_operations row
+// whose log streams under "k0s-op:<id>"; the progress of every node it
+// touches is kept on the node's k0s_nodes row, so the node list shows
+// where a rollout stands.
+
+const (
+	k0sOperationTimeout  = 4 * time.Hour
+	k0sJoinTokenFile     = "/etc/k0s/join-token"
+	defaultHealthTimeout = 600
+	defaultDrainTimeout  = 300
+)
+
+// k0sVersionPattern matches a k0s release such as v1.31.1+k0s.0.
+var k0sVersionPattern = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)\+k0s\.(\d+)$`)
+
+// activeK0sOperations holds the clusters with a lifecycle operation
+// running; there is at most one per cluster.
+var activeK0sOperations sync.Map
+
+func k0sOpLogKey(id int64) string { return fmt.Sprintf("k0s-op:%d", id) }
+
+// parseK0sVersion splits a k0s version into major, minor, patch and k0s
+// build numbers.
+func parseK0sVersion(v string) ([4]int, bool) {
+	var parts [4]int
+	m := k0sVersionPattern.FindStringSubmatch(strings.TrimSpace(v))
+	if m == nil {
+		return parts, false
+	}
+	for i := range parts {
+		parts[i], _ = strconv.Atoi(m[i+1])
+	}
+	return parts, true
+}
+
+func compareK0sVersions(a, b [4]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// ── Cluster and node access ─────────────────────────────────────────────────
+
+// k0sClusterAccess is a cluster's API address and the SSH credentials it
+// was created with.
+type k0sClusterAccess struct {
+	ID         int
+	Name       string
+	IP         string
+	Type       string
+	Version    string
+	Username   string
+	Credential string // the password, or the private key for ssh-key auth
+	AuthMethod string
+}
+
+func loadK0sClusterAccess(id int) (k0sClusterAccess, error) {
+	cl := k0sClusterAccess{ID: id}
+	var password, sshKey string
+	err := database.DB.QueryRow(
+		"SELECT name, COALESCE(ip_address,''), COALESCE(type,''), COALESCE(version,''), COALESCE(username,''), COALESCE(password,''), COALESCE(auth_method,'password'), COALESCE(ssh_key,'') FROM k0s_clusters WHERE id = ?",
+		id,
+	).Scan(&cl.Name, &cl.IP, &cl.Type, &cl.Version, &cl.Username, &password, &cl.AuthMethod, &sshKey)
+	if err != nil {
+		return cl, fmt.Errorf("cluster %d not found", id)
+	}
+	cl.Credential = database.OpenSecret(password)
+	if cl.AuthMethod == "ssh-key" {
+		cl.Credential = database.OpenSecret(sshKey)
+	}
+	return cl, nil
+}
+
+// k0sNode is a k0s_nodes row with the SSH access to reach the machine.
+type k0sNode struct {
+	ID         int
+	IP         string
+	Hostname   string
+	Role       string
+	Status     string
+	Version    string
+	Username   string
+	Credential string
+	AuthMethod string
+}
+
+// nodeName is the node's name in Kubernetes.
+func (n k0sNode) nodeName() string { return strings.ToLower(n.Hostname) }
+
+// loadK0sNodes returns the cluster's nodes, controllers first with the one
+// serving the cluster's API address leading. Nodes stored without
+// credentials share the cluster's.
+func loadK0sNodes(cl k0sClusterAccess) ([]k0sNode, error) {
+	rows, err := database.DB.Query(
+		`SELECT id, ip_address, COALESCE(hostname,''), role, COALESCE(status,''), COALESCE(version,''),
+		 COALESCE(username,''), COALESCE(password,''), COALESCE(auth_method,''), COALESCE(ssh_key,'')
+		 FROM k0s_nodes WHERE cluster_id = ? ORDER BY created_at, id`, cl.ID)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []k0sNode
+	for rows.Next() {
+		var n k0sNode
+		var password, sshKey string
+		if err := rows.Scan(&n.ID, &n.IP, &n.Hostname, &n.Role, &n.Status, &n.Version,
+			&n.Username, &password, &n.AuthMethod, &sshKey); err != nil {
+			continue
+		}
+		if n.Username == "" {
+			n.Username, n.Credential, n.AuthMethod = cl.Username, cl.Credential, cl.AuthMethod
+		} else if n.AuthMethod == "ssh-key" {
+			n.Credential = database.OpenSecret(sshKey)
+		} else {
+			n.AuthMethod, n.Credential = "password", database.OpenSecret(password)
+		}
+		nodes = append(nodes, n)
+	}
+	rows.Close()
+
+	rank := func(n k0sNode) int {
+		switch {
+		case n.Role == "controller" && n.IP == cl.IP:
+			return 0
+		case n.Role == "controller":
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return rank(nodes[i]) < rank(nodes[j]) })
+	if len(nodes) == 0 || rank(nodes[0]) != 0 {
+		return nil, fmt.Errorf("cluster %s has no controller at %s in its node list", cl.Name, cl.IP)
+	}
+	return nodes, nil
+}
+
+// k0sNodeRequest is the body naming a new machine and how to reach it.
+type k0sNodeRequest struct {
+	IP           string `json:"ip"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	SSHKey       string `json:"sshKey"`
+	AuthMethod   string `json:"authMethod"`
+	EnableWorker bool   `json:"enable_worker"`
+}
+
+// node returns the machine as a k0sNode with the given role.
+func (req k0sNodeRequest) node(role string) k0sNode {
+	n := k0sNode{IP: req.IP, Role: role, Username: req.Username, AuthMethod: req.AuthMethod, Credential: req.Password}
+	if req.AuthMethod == "ssh-key" {
+		n.Credential = req.SSHKey
+	}
+	return n
+}
+
+func decodeK0sNodeRequest(w http.ResponseWriter, r *http.Request) (k0sNodeRequest, bool) {
+	var req k0sNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	req.IP = strings.TrimSpace(req.IP)
+	if req.IP == "" || req.Username == "" {
+		http.Error(w, "IP and Username are required", http.StatusBadRequest)
+		return req, false
+	}
+	req.AuthMethod = strings.ToLower(strings.TrimSpace(req.AuthMethod))
+	if req.AuthMethod != "ssh-key" {
+		req.AuthMethod = "password"
+	}
+	if req.AuthMethod == "password" && req.Password == "" || req.AuthMethod == "ssh-key" && req.SSHKey == "" {
+		http.Error(w, "Password or SSH Key is required", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// insertK0sNode records a machine joining the cluster, with its
+// credentials sealed, and returns its row id.
+func insertK0sNode(clusterID int, req k0sNodeRequest, role, version string) (int, error) {
+	password, err := vault.Seal(req.Password)
+	if err != nil {
+		return 0, err
+	}
+	sshKey, err := vault.Seal(req.SSHKey)
+	if err != nil {
+		return 0, err
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO k0s_nodes (cluster_id, ip_address, role, status, username, password, auth_method, ssh_key, version)
+		 VALUES (?, ?, ?, 'provisioning', ?, ?, ?, ?, ?)`,
+		clusterID, req.IP, role, req.Username, password, req.AuthMethod, sshKey, version)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+	return int(id), nil
+}
+
+func recountK0sNodes(clusterID int) {
+	var count int
+	database.DB.QueryRow("SELECT COUNT(*) FROM k0s_nodes WHERE cluster_id = ?", clusterID).Scan(&count)
+	database.DB.Exec("UPDATE k0s_clusters SET node_count = ? WHERE id = ?", count, clusterID)
+}
+
+// k0sNodeSSH is an SSH connection to a node. Commands started with run
+// are echoed to the operation log; their output is not, so join tokens
+// stay out of it.
+type k0sNodeSSH struct {
+	*ssh.Client
+	node k0sNode
+	logs *logStream
+}
+
+func dialK0sNode(n k0sNode, logs *logStream) (*k0sNodeSSH, error) {
+	client, err := connectSSH(n.IP, n.Username, n.Credential, n.AuthMethod)
+	if err != nil {
+		return nil, fmt.Errorf("SSH to %s failed: %v", n.IP, err)
+	}
+	return &k0sNodeSSH{Client: client, node: n, logs: logs}, nil
+}
+
+// output runs cmd with stdin as its input and returns its trimmed output.
+func (s *k0sNodeSSH) output(cmd, stdin string) (string, error) {
+	session, err := s.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("SSH session on %s failed: %v", s.node.IP, err)
+	}
+	defer session.Close()
+	var out, errOut strings.Builder
+	session.Stdout = &out
+	session.Stderr = &errOut
+	if stdin != "" {
+		session.Stdin = strings.NewReader(stdin)
+	}
+	if err := session.Run(cmd); err != nil {
+		return "", fmt.Errorf("%s on %s: %v: %s", cmd, s.node.IP, err, strings.TrimSpace(errOut.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+func (s *k0sNodeSSH) run(cmd string) (string, error) {
+	s.logs.Line(fmt.Sprintf("[%s] $ %s", s.node.IP, cmd))
+	return s.output(cmd, "")
+}
+
+// write stores content in a root-owned file readable only by root.
+func (s *k0sNodeSSH) write(file, content string) error {
+	s.logs.Line(fmt.Sprintf("[%s] writing %s", s.node.IP, file))
+	_, err := s.output(fmt.Sprintf("sudo sh -c 'mkdir -p /etc/k0s && umask 077 && cat > %s'", file), content)
+	return err
+}
+
+// version returns the k0s version installed on the node.
+func (s *k0sNodeSSH) version() (string, error) {
+	out, err := s.output("sudo k0s version", "")
+	if err != nil {
+		return "", err
+	}
+	if _, ok := parseK0sVersion(out); !ok {
+		return "", fmt.Errorf("%s reports an unknown k0s version %q", s.node.IP, out)
+	}
+	return out, nil
+}
+
+// hostname reads the node's hostname and stores it on its row.
+func (s *k0sNodeSSH) hostname() string {
+	name, err := s.output("hostname", "")
+	if err == nil && name != "" {
+		s.node.Hostname = name
+		if s.node.ID != 0 {
+			database.DB.Exec("UPDATE k0s_nodes SET hostname = ? WHERE id = ?", name, s.node.ID)
+		}
+	}
+	return s.node.Hostname
+}
+
+// primaryVersion reads the k0s version of the cluster's first controller
+// and stores it as the cluster's version.
+func primaryVersion(cl k0sClusterAccess, primary k0sNode) (string, error) {
+	s, err := dialK0sNode(primary, nil)
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+	version, err := s.version()
+	if err == nil && version != cl.Version {
+		database.DB.Exec("UPDATE k0s_clusters SET version = ? WHERE id = ?", version, cl.ID)
+	}
+	return version, err
+}
+
+// ── Health ──────────────────────────────────────────────────────────────────
+
+func k8sNodeReady(node map[string]interface{}) bool {
+	for _, cond := range nestedSlice(node, "status", "conditions") {
+		cm, _ := cond.(map[string]interface{})
+		if nestedString(cm, "type") == "Ready" {
+			return nestedString(cm, "status") == "True"
+		}
+	}
+	return false
+}
+
+// k0sClusterHealthy checks the API server is ready and every node Ready.
+func k0sClusterHealthy(ctx context.Context, c *k8sClient) error {
+	if _, err := c.raw(ctx, "/readyz", nil); err != nil {
+		return fmt.Errorf("API server is not ready: %v", err)
+	}
+	nodes, err := c.list(ctx, mustK8sResource("nodes"), "", k8sListOptions{})
+	if err != nil {
+		return err
+	}
+	var notReady []string
+	for _, n := range nodes.Items {
+		if !k8sNodeReady(n) {
+			notReady = append(notReady, nestedString(n, "metadata", "name"))
+		}
+	}
+	if len(notReady) > 0 {
+		return fmt.Errorf("node(s) not Ready: %s", strings.Join(notReady, ", "))
+	}
+	return nil
+}
+
+// k0sNodeHealthIssue returns what keeps the node from counting as healthy
+// on version, or "" when it is: k0s runs that version, the API server is
+// ready and, for a node with a kubelet, the node is Ready and its kubelet
+// reports the matching Kubernetes version.
+func k0sNodeHealthIssue(ctx context.Context, c *k8sClient, s *k0sNodeSSH, version string, kubelet bool) string {
+	status, err := s.output("sudo k0s status", "")
+	if err != nil {
+		return "k0s is not running"
+	}
+	running := ""
+	for _, line := range strings.Split(status, "\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(k) == "Version" {
+			running = strings.TrimSpace(v)
+		}
+	}
+	if running != version {
+		return "k0s runs version " + running
+	}
+	if _, err := c.raw(ctx, "/readyz", nil); err != nil {
+		return "API server is not ready"
+	}
+	if !kubelet {
+		return ""
+	}
+	node, err := c.get(ctx, mustK8sResource("nodes"), "", s.node.nodeName())
+	if err != nil {
+		return "node " + s.node.nodeName() + " is not registered"
+	}
+	if !k8sNodeReady(node) {
+		return "node " + s.node.nodeName() + " is not Ready"
+	}
+	kubeletVersion := nestedString(node, "status", "nodeInfo", "kubeletVersion")
+	if strings.SplitN(kubeletVersion, "+", 2)[0] != strings.SplitN(version, "+", 2)[0] {
+		return "kubelet reports " + kubeletVersion
+	}
+	return ""
+}
+
+// waitK0sNodeHealthy polls k0sNodeHealthIssue until the node is healthy
+// or timeout passes.
+func waitK0sNodeHealthy(ctx context.Context, c *k8sClient, s *k0sNodeSSH, version string, kubelet bool, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	last := ""
+	for {
+		issue := k0sNodeHealthIssue(ctx, c, s, version, kubelet)
+		if issue == "" {
+			s.logs.Line(fmt.Sprintf("[%s] healthy on %s", s.node.IP, version))
+			return nil
+		}
+		if issue != last {
+			s.logs.Line(fmt.Sprintf("[%s] waiting: %s", s.node.IP, issue))
+			last = issue
+		}
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("not healthy after %s: %s", timeout, issue)
+		}
+	}
+}
+
+// ── Operations ──────────────────────────────────────────────────────────────
+
+// k0sPlanStep is one node's part in an operation.
+type k0sPlanStep struct {
+	NodeID   int    `json:"node_id"`
+	IP       string `json:"ip_address"`
+	Hostname string `json:"hostname,omitempty"`
+	Role     string `json:"role"`
+	Action   string `json:"action"` // upgrade, skip, join, remove
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Kubelet  bool   `json:"kubelet"` // the node also runs workloads
+}
+
+// k0sOp is a running lifecycle operation.
+type k0sOp struct {
+	id      int64
+	cluster k0sClusterAccess
+	logs    *logStream
+}
+
+// progress records a node's state in the operation on its k0s_nodes row
+// and in the log.
+func (op *k0sOp) progress(step k0sPlanStep, state, message string) {
+	database.DB.Exec(`UPDATE k0s_nodes SET operation_id = ?, progress = ?, progress_message = ?, progress_at = ? WHERE id = ?`,
+		op.id, state, message, time.Now().Format(time.RFC3339), step.NodeID)
+	line := fmt.Sprintf("==> %s %s: %s", step.Role, step.IP, state)
+	if message != "" {
+		line += " (" + message + ")"
+	}
+	op.logs.Line(line)
+}
+
+// setCordoned records whether the operation has left the node
+// unschedulable, so that a cordon outlives neither a failed uncordon nor
+// a server restart unnoticed.
+func (op *k0sOp) setCordoned(n k0sNode, cordoned bool) {
+	database.DB.Exec("UPDATE k0s_nodes SET cordoned = ? WHERE id = ?", cordoned, n.ID)
+}
+
+// RecoverK0sOperations fails operations left running by a previous server
+// process, along with the steps they had in flight, and uncordons the
+// nodes they had cordoned. The uncordon needs the cluster's API and runs
+// in the background.
+func RecoverK0sOperations() {
+	type cordonedNode struct {
+		id        int
+		clusterID string
+		name      string
+	}
+	var nodes []cordonedNode
+	rows, err := database.DB.Query(
+		`SELECT n.id, n.cluster_id, LOWER(COALESCE(n.hostname,'')) FROM k0s_nodes n
+		 JOIN k0s_operations o ON o.id = n.operation_id
+		 WHERE o.status = 'running' AND n.cordoned = 1`)
+	if err == nil {
+		for rows.Next() {
+			var n cordonedNode
+			if rows.Scan(&n.id, &n.clusterID, &n.name) == nil && n.name != "" {
+				nodes = append(nodes, n)
+			}
+		}
+		rows.Close()
+	}
+
+	database.DB.Exec(
+		`UPDATE k0s_nodes SET progress = 'cancelled', progress_message = 'not started: interrupted by server restart'
+		 WHERE progress = 'pending' AND operation_id IN (SELECT id FROM k0s_operations WHERE status = 'running')`)
+	database.DB.Exec(
+		`UPDATE k0s_nodes SET progress = 'failed', progress_message = 'interrupted by server restart'
+		 WHERE progress NOT IN ('done', 'skipped', 'failed', 'cancelled')
+		   AND operation_id IN (SELECT id FROM k0s_operations WHERE status = 'running')`)
+	database.DB.Exec(
+		`UPDATE k0s_operations SET status = 'failed', error = 'interrupted by server restart', finished_at = CURRENT_TIMESTAMP
+		 WHERE status = 'running'`)
+
+	if len(nodes) == 0 {
+		return
+	}
+	go func() {
+		for _, n := range nodes {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			c, err := newK8sClient(n.clusterID)
+			if err == nil {
+				err = setNodeUnschedulable(ctx, c, n.name, false)
+			}
+			cancel()
+			if err != nil {
+				log.Printf("[k0s] node/%s in cluster %s left cordoned by an interrupted operation: %v", n.name, n.clusterID, err)
+				continue
+			}
+			database.DB.Exec("UPDATE k0s_nodes SET cordoned = 0 WHERE id = ?", n.id)
+			log.Printf("[k0s] node/%s in cluster %s uncordoned after an interrupted operation", n.name, n.clusterID)
+		}
+	}()
+}
+
+// startK0sOperation records an operation with its plan and runs job in
+// the background. It answers 409 and returns false when the cluster
+// already has an operation running.
+func startK0sOperation(w http.ResponseWriter, r *http.Request, cl k0sClusterAccess, action, version string,
+	plan []k0sPlanStep, job func(ctx context.Context, op *k0sOp) error) bool {
+	user, _ := GetUserFromContext(r.Context())
+	if _, busy := activeK0sOperations.LoadOrStore(cl.ID, true); busy {
+		http.Error(w, fmt.Sprintf("another operation on cluster %s is in progress", cl.Name), http.StatusConflict)
+		return false
+	}
+	planJSON, _ := json.Marshal(plan)
+	res, err := database.DB.Exec(
+		`INSERT INTO k0s_operations (cluster_id, action, target_version, plan, username, status) VALUES (?, ?, ?, ?, ?, 'running')`,
+		cl.ID, action, version, string(planJSON), user.Username)
+	if err != nil {
+		activeK0sOperations.Delete(cl.ID)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	op := &k0sOp{cluster: cl}
+	op.id, _ = res.LastInsertId()
+	op.logs = startLogStream(k0sOpLogKey(op.id))
+	log.Printf("[k0s] #%d cluster=%d %s %s by %s", op.id, cl.ID, action, version, user.Username)
+	for _, step := range plan {
+		if step.Action == "skip" {
+			op.progress(step, "skipped", "already on "+step.From)
+		} else {
+			op.progress(step, "pending", "")
+		}
+	}
+
+	go func() {
+		defer activeK0sOperations.Delete(cl.ID)
+		ctx, cancel := context.WithTimeout(context.Background(), k0sOperationTimeout)
+		defer cancel()
+
+		err := job(ctx, op)
+		status := "success"
+		var errMsg interface{}
+		if err != nil {
+			status, errMsg = "failed", err.Error()
+			op.logs.Line("Error: " + err.Error())
+			database.DB.Exec(`UPDATE k0s_nodes SET progress = 'cancelled', progress_message = 'not started: the operation failed' WHERE operation_id = ? AND progress = 'pending'`, op.id)
+		}
+		database.DB.Exec(`UPDATE k0s_operations SET status = ?, error = ?, log = ?, finished_at = ? WHERE id = ?`,
+			status, errMsg, op.logs.String(), time.Now().Format(time.RFC3339), op.id)
+		finishLogStream(k0sOpLogKey(op.id), op.logs)
+
+		details := strings.TrimSpace(version + " by " + user.Username)
+		if err != nil {
+			details += ": " + err.Error()
+			status = "error"
+		}
+		recordActivityLog("k0s_"+strings.ReplaceAll(action, "-", "_"), cl.Name, details, status)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "operation_id": op.id, "plan": plan})
+	return true
+}
+
+// lifecycleCluster loads the cluster of the request for a lifecycle
+// operation, which needs SSH access to its machines.
+func lifecycleCluster(w http.ResponseWriter, r *http.Request) (k0sClusterAccess, bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	cl, err := loadK0sClusterAccess(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return cl, false
+	}
+	if cl.Type == "external" || cl.Username == "" {
+		http.Error(w, "this cluster was imported without SSH access to its machines, so k0s cannot manage its lifecycle", http.StatusBadRequest)
+		return cl, false
+	}
+	return cl, true
+}
+
+// ── Upgrades ────────────────────────────────────────────────────────────────
+
+// planK0sUpgrade orders the upgrade to target: controllers first, then
+// workers. Kubernetes supports upgrading one minor version at a time, so
+// larger jumps and downgrades are refused.
+func planK0sUpgrade(nodes []k0sNode, kubelets map[string]bool, target string) ([]k0sPlanStep, error) {
+	to, _ := parseK0sVersion(target)
+	var plan []k0sPlanStep
+	upgrades := 0
+	for _, n := range nodes {
+		step := k0sPlanStep{NodeID: n.ID, IP: n.IP, Hostname: n.Hostname, Role: n.Role, From: n.Version, To: target,
+			Action: "upgrade", Kubelet: kubelets[n.nodeName()]}
+		from, ok := parseK0sVersion(n.Version)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%s %s reports an unknown k0s version %q", n.Role, n.IP, n.Version)
+		case compareK0sVersions(to, from) == 0:
+			step.Action = "skip"
+		case compareK0sVersions(to, from) < 0:
+			return nil, fmt.Errorf("%s %s runs %s; downgrading to %s is not supported", n.Role, n.IP, n.Version, target)
+		case to[0] != from[0] || to[1] > from[1]+1:
+			return nil, fmt.Errorf("%s %s runs %s; upgrade one Kubernetes minor version at a time (to v%d.%d first)",
+				n.Role, n.IP, n.Version, from[0], from[1]+1)
+		default:
+			upgrades++
+		}
+		plan = append(plan, step)
+	}
+	if upgrades == 0 {
+		return nil, fmt.Errorf("every node already runs %s", target)
+	}
+	return plan, nil
+}
+
+type k0sUpgradeOptions struct {
+	DrainTimeoutSeconds  int `json:"drain_timeout_seconds"`
+	HealthTimeoutSeconds int `json:"health_timeout_seconds"`
+}
+
+// upgradeK0sNode upgrades one node in place. A node with a kubelet is
+// drained first and uncordoned once it passes its health gate.
+func upgradeK0sNode(ctx context.Context, op *k0sOp, c *k8sClient, n k0sNode, step k0sPlanStep, opts k0sUpgradeOptions) error {
+	s, err := dialK0sNode(n, op.logs)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if step.Kubelet {
+		op.progress(step, "draining", "")
+		op.setCordoned(n, true)
+		drain := drainOptions{IgnoreDaemonSets: true, DeleteEmptyDirData: true, TimeoutSeconds: opts.DrainTimeoutSeconds}
+		if err := runNodeDrain(c, n.nodeName(), drain, op.logs); err != nil {
+			if setNodeUnschedulable(ctx, c, n.nodeName(), false) == nil {
+				op.setCordoned(n, false)
+			}
+			return fmt.Errorf("drain failed, node left unchanged: %v", err)
+		}
+	}
+
+	op.progress(step, "upgrading", step.From+" → "+step.To)
+	if _, err := s.run("sudo k0s stop"); err != nil {
+		return err
+	}
+	if _, err := s.run(fmt.Sprintf("curl -sSLf https://get.k0s.sh | sudo K0S_VERSION=%s sh", step.To)); err != nil {
+		s.run("sudo k0s start") // bring the old binary back up
+		return err
+	}
+	if _, err := s.run("sudo k0s start"); err != nil {
+		return err
+	}
+
+	op.progress(step, "verifying", "")
+	if err := waitK0sNodeHealthy(ctx, c, s, step.To, step.Kubelet, time.Duration(opts.HealthTimeoutSeconds)*time.Second); err != nil {
+		return err
+	}
+	if step.Kubelet {
+		if err := setNodeUnschedulable(ctx, c, n.nodeName(), false); err != nil {
+			return fmt.Errorf("uncordon failed: %v", err)
+		}
+		op.setCordoned(n, false)
+		op.logs.Line("node/" + n.nodeName() + " uncordoned")
+	}
+	database.DB.Exec("UPDATE k0s_nodes SET version = ? WHERE id = ?", step.To, n.ID)
+	op.progress(step, "done", step.To)
+	return nil
+}
+
+// UpgradeK0sCluster upgrades the cluster to another k0s version one node
+// at a time, controllers first and then workers. Each node must pass its
+// health gate before the next one starts; the first failure stops the
+// rollout. With dry_run only the plan is returned.
+// POST /api/k0s/clusters/{id}/upgrade
+// body: {"version":"v1.31.1+k0s.0","dry_run":false,"drain_timeout_seconds":300,"health_timeout_seconds":600}
+func UpgradeK0sCluster(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	cl, ok := lifecycleCluster(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		k0sUpgradeOptions
+		Version string `json:"version"`
+		DryRun  bool   `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Version = strings.TrimSpace(req.Version)
+	if _, ok := parseK0sVersion(req.Version); !ok {
+		http.Error(w, "version must be a k0s release such as v1.31.1+k0s.0", http.StatusBadRequest)
+		return
+	}
+	if req.DrainTimeoutSeconds <= 0 {
+		req.DrainTimeoutSeconds = defaultDrainTimeout
+	}
+	if req.HealthTimeoutSeconds <= 0 {
+		req.HealthTimeoutSeconds = defaultHealthTimeout
+	}
+
+	nodes, err := loadK0sNodes(cl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := newK8sClient(strconv.Itoa(cl.ID))
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	if err := k0sClusterHealthy(r.Context(), c); err != nil {
+		http.Error(w, "Cluster is not healthy, fix it before upgrading: "+err.Error(), http.StatusConflict)
+		return
+	}
+	k8sNodes, err := c.list(r.Context(), mustK8sResource("nodes"), "", k8sListOptions{})
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	kubelets := map[string]bool{}
+	for _, n := range k8sNodes.Items {
+		kubelets[nestedString(n, "metadata", "name")] = true
+	}
+	for i := range nodes {
+		s, err := dialK0sNode(nodes[i], nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		nodes[i].Hostname = s.hostname()
+		nodes[i].Version, err = s.version()
+		s.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		database.DB.Exec("UPDATE k0s_nodes SET version = ? WHERE id = ?", nodes[i].Version, nodes[i].ID)
+	}
+	plan, err := planK0sUpgrade(nodes, kubelets, req.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "plan": plan})
+		return
+	}
+
+	startK0sOperation(w, r, cl, "upgrade", req.Version, plan, func(ctx context.Context, op *k0sOp) error {
+		for i, step := range plan {
+			if step.Action != "upgrade" {
+				continue
+			}
+			if err := upgradeK0sNode(ctx, op, c, nodes[i], step, req.k0sUpgradeOptions); err != nil {
+				op.progress(step, "failed", err.Error())
+				return fmt.Errorf("%s %s: %v", step.Role, step.IP, err)
+			}
+		}
+		database.DB.Exec("UPDATE k0s_clusters SET version = ? WHERE id = ?", req.Version, cl.ID)
+		return nil
+	})
+}
+
+// ── Joining nodes ───────────────────────────────────────────────────────────
+
+// joinK0sNode installs k0s version on a new machine and joins it with a
+// token created on the primary controller.
+func joinK0sNode(primary, s *k0sNodeSSH, cl k0sClusterAccess, version string, enableWorker bool) error {
+	role := s.node.Role
+	token, err := primary.run(fmt.Sprintf("sudo k0s token create --role=%s --expiry=1h", role))
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return fmt.Errorf("k0s returned an empty %s token", role)
+	}
+	if _, err := s.run(fmt.Sprintf("curl -sSLf https://get.k0s.sh | sudo K0S_VERSION=%s sh", version)); err != nil {
+		return err
+	}
+	// Clear whatever an earlier install left behind.
+	s.run("sudo k0s stop || true")
+	s.run("sudo k0s reset || true")
+	if err := s.write(k0sJoinTokenFile, token); err != nil {
+		return err
+	}
+
+	install := "sudo k0s install worker --token-file " + k0sJoinTokenFile
+	if role == "controller" {
+		// Same configuration as the first controller, but advertising
+		// its own address.
+		k0sConfig := fmt.Sprintf(
+			"apiVersion: k0s.k0sproject.io/v1beta1\nkind: ClusterConfig\nmetadata:\n  name: k0s\nspec:\n  api:\n    address: %s\n    externalAddress: %s\n",
+			s.node.IP, cl.IP,
+		)
+		if err := s.write("/etc/k0s/k0s.yaml", k0sConfig); err != nil {
+			return err
+		}
+		install = "sudo k0s install controller --token-file " + k0sJoinTokenFile + " -c /etc/k0s/k0s.yaml"
+		if enableWorker {
+			install += " --enable-worker"
+		}
+	}
+	if _, err := s.run(install); err != nil {
+		return err
+	}
+	_, err = s.run("sudo k0s start")
+	return err
+}
+
+// waitEtcdMember waits until ip shows up in the etcd member list.
+func waitEtcdMember(ctx context.Context, primary *k0sNodeSSH, ip string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		out, err := primary.output("sudo k0s etcd member-list", "")
+		if err == nil && strings.Contains(out, "://"+ip+":") {
+			primary.logs.Line(fmt.Sprintf("[%s] %s is an etcd member", primary.node.IP, ip))
+			return nil
+		}
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("%s did not join etcd within %s", ip, timeout)
+		}
+	}
+}
+
+// runK0sJoin joins the node of step and waits until it is healthy.
+func runK0sJoin(ctx context.Context, op *k0sOp, c *k8sClient, primary k0sNode, n k0sNode, step k0sPlanStep) error {
+	p, err := dialK0sNode(primary, op.logs)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	s, err := dialK0sNode(n, op.logs)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	step.Hostname = s.hostname()
+
+	op.progress(step, "joining", step.To)
+	if err := joinK0sNode(p, s, op.cluster, step.To, step.Kubelet); err != nil {
+		return err
+	}
+	op.progress(step, "verifying", "")
+	timeout := time.Duration(defaultHealthTimeout) * time.Second
+	if n.Role == "controller" {
+		if err := waitEtcdMember(ctx, p, n.IP, timeout); err != nil {
+			return err
+		}
+	}
+	if err := waitK0sNodeHealthy(ctx, c, s, step.To, step.Kubelet, timeout); err != nil {
+		return err
+	}
+	database.DB.Exec("UPDATE k0s_nodes SET status = 'active', version = ? WHERE id = ?", step.To, n.ID)
+	op.progress(step, "done", "")
+	return nil
+}
+
+// newNodeOperation checks the machine of req can join cl and records it.
+// It returns the k8s client, the cluster's nodes, the k0s version to
+// install and the new node.
+func newNodeOperation(w http.ResponseWriter, cl k0sClusterAccess, req k0sNodeRequest, role string) (*k8sClient, []k0sNode, string, k0sNode, bool) {
+	var n k0sNode
+	nodes, err := loadK0sNodes(cl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, "", n, false
+	}
+	for _, existing := range nodes {
+		if existing.IP == req.IP {
+			http.Error(w, req.IP+" is already a node of this cluster", http.StatusConflict)
+			return nil, nil, "", n, false
+		}
+	}
+	c, err := newK8sClient(strconv.Itoa(cl.ID))
+	if err != nil {
+		writeK8sError(w, err)
+		return nil, nil, "", n, false
+	}
+	version, err := primaryVersion(cl, nodes[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return nil, nil, "", n, false
+	}
+	n = req.node(role)
+	if n.ID, err = insertK0sNode(cl.ID, req, role, version); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, "", n, false
+	}
+	return c, nodes, version, n, true
+}
+
+// AddK0sController joins another controller to the cluster for a highly
+// available control plane. The machine gets the cluster's k0s version and
+// a token from `k0s token create --role=controller`, and counts once it
+// is an etcd member. An odd number of controllers is what keeps quorum.
+// POST /api/k0s/clusters/{id}/controllers
+// body: {"ip","username","password","sshKey","authMethod","enable_worker":false}
+func AddK0sController(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	cl, ok := lifecycleCluster(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeK0sNodeRequest(w, r)
+	if !ok {
+		return
+	}
+	c, nodes, version, n, ok := newNodeOperation(w, cl, req, "controller")
+	if !ok {
+		return
+	}
+	step := k0sPlanStep{NodeID: n.ID, IP: n.IP, Role: n.Role, Action: "join", To: version, Kubelet: req.EnableWorker}
+	started := startK0sOperation(w, r, cl, "add-controller", version, []k0sPlanStep{step}, func(ctx context.Context, op *k0sOp) error {
+		err := runK0sJoin(ctx, op, c, nodes[0], n, step)
+		if err != nil {
+			database.DB.Exec("UPDATE k0s_nodes SET status = 'failed' WHERE id = ?", n.ID)
+			op.progress(step, "failed", err.Error())
+			return err
+		}
+		recountK0sNodes(cl.ID)
+		controllers := 1
+		for _, existing := range nodes {
+			if existing.Role == "controller" {
+				controllers++
+			}
+		}
+		if controllers%2 == 0 {
+			op.logs.Line(fmt.Sprintf("Warning: the cluster now has %d controllers; with an even count etcd tolerates no more failures than with %d", controllers, controllers-1))
+		}
+		return nil
+	})
+	if !started {
+		database.DB.Exec("DELETE FROM k0s_nodes WHERE id = ?", n.ID)
+	}
+}
+
+// removeK0sNode takes a node out of the cluster: drained if it runs a
+// kubelet, removed from etcd if it is a controller, deleted from the API
+// and reset. The machine may already be gone, so the reset is best effort.
+func removeK0sNode(ctx context.Context, op *k0sOp, c *k8sClient, primary, n k0sNode, step k0sPlanStep) error {
+	op.progress(step, "removing", "")
+	if step.Kubelet {
+		op.setCordoned(n, true)
+		drain := drainOptions{IgnoreDaemonSets: true, DeleteEmptyDirData: true, Force: true, TimeoutSeconds: defaultDrainTimeout}
+		if err := runNodeDrain(c, n.nodeName(), drain, op.logs); err != nil {
+			return fmt.Errorf("drain failed: %v", err)
+		}
+	}
+	if n.Role == "controller" {
+		p, err := dialK0sNode(primary, op.logs)
+		if err != nil {
+			return err
+		}
+		_, err = p.run("sudo k0s etcd leave --peer-address " + n.IP)
+		p.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if n.Hostname != "" {
+		if err := c.delete(ctx, mustK8sResource("nodes"), "", n.nodeName()); err != nil && !isK8sNotFound(err) {
+			return err
+		}
+	}
+	if s, err := dialK0sNode(n, op.logs); err != nil {
+		op.logs.Line(fmt.Sprintf("Warning: %v; reset the machine by hand if it comes back", err))
+	} else {
+		s.run("sudo k0s stop || true")
+		s.run("sudo k0s reset || true")
+		s.Close()
+	}
+	database.DB.Exec("DELETE FROM k0s_nodes WHERE id = ?", n.ID)
+	op.logs.Line(fmt.Sprintf("==> %s %s: removed", n.Role, n.IP))
+	return nil
+}
+
+// ReplaceK0sNode swaps a node for a new machine. The new node joins with
+// the same role and k0s version and must be healthy before the old one is
+// taken out. The controller serving the cluster's API address cannot be
+// replaced this way.
+// POST /api/k0s/clusters/{id}/nodes/{nodeId}/replace
+// body: {"ip","username","password","sshKey","authMethod","enable_worker":false}
+func ReplaceK0sNode(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	cl, ok := lifecycleCluster(w, r)
+	if !ok {
+		return
+	}
+	nodeID, _ := strconv.Atoi(mux.Vars(r)["nodeId"])
+	current, err := loadK0sNodes(cl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var old *k0sNode
+	for i := range current {
+		if current[i].ID == nodeID {
+			old = &current[i]
+		}
+	}
+	if old == nil {
+		http.Error(w, "Node not found", http.StatusNotFound)
+		return
+	}
+	if old.ID == current[0].ID {
+		http.Error(w, fmt.Sprintf("the cluster's API address %s is this controller; put a load balancer in front of the controllers before replacing it", cl.IP), http.StatusBadRequest)
+		return
+	}
+	req, ok := decodeK0sNodeRequest(w, r)
+	if !ok {
+		return
+	}
+	c, nodes, version, n, ok := newNodeOperation(w, cl, req, old.Role)
+	if !ok {
+		return
+	}
+
+	kubelet := old.Role == "worker" || req.EnableWorker
+	oldKubelet := old.Role == "worker"
+	if old.Hostname != "" {
+		_, err := c.get(r.Context(), mustK8sResource("nodes"), "", old.nodeName())
+		oldKubelet = err == nil
+	}
+	plan := []k0sPlanStep{
+		{NodeID: n.ID, IP: n.IP, Role: n.Role, Action: "join", To: version, Kubelet: kubelet},
+		{NodeID: old.ID, IP: old.IP, Hostname: old.Hostname, Role: old.Role, Action: "remove", From: old.Version, Kubelet: oldKubelet},
+	}
+	started := startK0sOperation(w, r, cl, "replace-node", version, plan, func(ctx context.Context, op *k0sOp) error {
+		if err := runK0sJoin(ctx, op, c, nodes[0], n, plan[0]); err != nil {
+			database.DB.Exec("UPDATE k0s_nodes SET status = 'failed' WHERE id = ?", n.ID)
+			op.progress(plan[0], "failed", err.Error())
+			return err
+		}
+		defer recountK0sNodes(cl.ID)
+		if err := removeK0sNode(ctx, op, c, nodes[0], *old, plan[1]); err != nil {
+			op.progress(plan[1], "failed", err.Error())
+			return fmt.Errorf("%s joined, but removing %s failed: %v", n.IP, old.IP, err)
+		}
+		return nil
+	})
+	if !started {
+		database.DB.Exec("DELETE FROM k0s_nodes WHERE id = ?", n.ID)
+	}
+}
+
+// ── Operation history ───────────────────────────────────────────────────────
+
+// K0sOperation is one lifecycle operation of a cluster.
+type K0sOperation struct {
+	ID            int             `json:"id"`
+	ClusterID     int             `json:"cluster_id"`
+	Action        string          `json:"action"` // upgrade, add-controller, replace-node
+	TargetVersion *string         `json:"target_version"`
+	Plan          json.RawMessage `json:"plan"`
+	Username      string          `json:"username"`
+	Status        string          `json:"status"` // running, success, failed
+	Error         *string         `json:"error"`
+	Log           *string         `json:"log,omitempty"`
+	StartedAt     string          `json:"started_at"`
+	FinishedAt    *string         `json:"finished_at"`
+	Nodes         []K0sNodeStatus `json:"nodes,omitempty"`
+}
+
+// K0sNodeStatus is a node's progress in an operation.
+type K0sNodeStatus struct {
+	ID              int     `json:"id"`
+	IPAddress       string  `json:"ip_address"`
+	Hostname        *string `json:"hostname"`
+	Role            string  `json:"role"`
+	Status          string  `json:"status"`
+	Version         *string `json:"version"`
+	Progress        *string `json:"progress"`
+	ProgressMessage *string `json:"progress_message"`
+	ProgressAt      *string `json:"progress_at"`
+	Cordoned        bool    `json:"cordoned"`
+}
+
+const k0sOperationColumns = `id, cluster_id, action, target_version, COALESCE(plan,'[]'), username, status, error, started_at, finished_at`
+
+func scanK0sOperation(row interface{ Scan(...interface{}) error }, op *K0sOperation, extra ...interface{}) error {
+	var plan string
+	dest := append([]interface{}{&op.ID, &op.ClusterID, &op.Action, &op.TargetVersion, &plan, &op.Username, &op.Status, &op.Error, &op.StartedAt, &op.FinishedAt}, extra...)
+	err := row.Scan(dest...)
+	op.Plan = json.RawMessage(plan)
+	return err
+}
+
+// ListK0sOperations lists a cluster's lifecycle operations, newest first.
+// GET /api/k0s/clusters/{id}/operations
+func ListK0sOperations(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	rows, err := database.DB.Query(`SELECT `+k0sOperationColumns+` FROM k0s_operations WHERE cluster_id = ? ORDER BY id DESC LIMIT 100`, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	ops := []K0sOperation{}
+	for rows.Next() {
+		var op K0sOperation
+		if err := scanK0sOperation(rows, &op); err != nil {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ops)
+}
+
+// GetK0sOperation returns an operation with its log and the progress of
+// its nodes.
+// GET /api/k0s/clusters/{id}/operations/{opId}
+func GetK0sOperation(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	var op K0sOperation
+	var text sql.NullString
+	row := database.DB.QueryRow(`SELECT `+k0sOperationColumns+`, log FROM k0s_operations WHERE id = ? AND cluster_id = ?`, vars["opId"], vars["id"])
+	if err := scanK0sOperation(row, &op, &text); err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	op.Log = &text.String
+	if v, ok := activeLogStreams.Load(k0sOpLogKey(int64(op.ID))); ok {
+		live := v.(*logStream).String()
+		op.Log = &live
+	}
+
+	rows, err := database.DB.Query(
+		`SELECT id, ip_address, hostname, role, COALESCE(status,''), version, progress, progress_message, progress_at, cordoned
+		 FROM k0s_nodes WHERE operation_id = ? ORDER BY id`, op.ID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var n K0sNodeStatus
+			if rows.Scan(&n.ID, &n.IPAddress, &n.Hostname, &n.Role, &n.Status, &n.Version, &n.Progress, &n.ProgressMessage, &n.ProgressAt, &n.Cordoned) == nil {
+				op.Nodes = append(op.Nodes, n)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op)
+}
+
+// StreamK0sOperationLogs streams an operation's log.
+// GET /api/k0s/clusters/{id}/operations/{opId}/logs (WebSocket)
+func StreamK0sOperationLogs(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	opID, _ := strconv.ParseInt(vars["opId"], 10, 64)
+	serveLogStream(w, r, k0sOpLogKey(opID), func() (string, bool) {
+		var text sql.NullString
+		if err := database.DB.QueryRow(`SELECT log FROM k0s_operations WHERE id = ? AND cluster_id = ?`,
+			opID, vars["id"]).Scan(&text); err != nil {
+			return "", false
+		}
+		return text.String, true
+	})
+}
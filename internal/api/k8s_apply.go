@@ -0,0 +1,494 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest apply support for ApplyClusterResource: validation errors
+// mapped back to the document and line they came from, dry-run diffs
+// against the live objects, and the per-cluster apply history.
+
+// ── Issues ──────────────────────────────────────────────────────────────────
+
+// manifestIssue is a problem with one object of a submitted manifest.
+type manifestIssue struct {
+	Document int    `json:"document"`
+	Line     int    `json:"line"`
+	Object   string `json:"object,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (i manifestIssue) String() string {
+	s := fmt.Sprintf("document %d, line %d", i.Document, i.Line)
+	if i.Object != "" {
+		s += " (" + i.Object + ")"
+	}
+	if i.Field != "" && !strings.Contains(i.Message, i.Field) {
+		return s + ": " + i.Field + ": " + i.Message
+	}
+	return s + ": " + i.Message
+}
+
+func joinManifestIssues(issues []manifestIssue) string {
+	lines := make([]string, len(issues))
+	for i, issue := range issues {
+		lines[i] = issue.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Field paths in API server messages: strict decoding ("unknown field
+// \"spec.foo\"") and server-side apply (".spec.foo: field not declared in
+// schema").
+var (
+	quotedFieldRe = regexp.MustCompile(`(?:unknown|duplicate) field "([^"]+)"`)
+	typedFieldRe  = regexp.MustCompile(`(?:^|\s)(\.[A-Za-z0-9_-]+(?:\.[A-Za-z0-9_-]+|\[[^\]]*\])*): `)
+)
+
+// manifestIssues turns the error of one document into issues, pointing at
+// the line of each field the API server complained about.
+func manifestIssues(doc manifestDocument, ref string, err error) []manifestIssue {
+	issue := func(field, msg string) manifestIssue {
+		line := doc.Line
+		if field != "" {
+			if l := yamlPathLine(doc.Node, field); l > 0 {
+				line = l
+			}
+		}
+		return manifestIssue{Document: doc.Index, Line: line, Object: ref, Field: strings.TrimPrefix(field, "."), Message: msg}
+	}
+
+	if apiErr, ok := err.(*k8sAPIError); ok && len(apiErr.Causes) > 0 {
+		issues := make([]manifestIssue, 0, len(apiErr.Causes))
+		for _, cause := range apiErr.Causes {
+			issues = append(issues, issue(cause.Field, cause.Message))
+		}
+		return issues
+	}
+
+	msg := err.Error()
+	var fields []string
+	for _, m := range quotedFieldRe.FindAllStringSubmatch(msg, -1) {
+		fields = append(fields, m[1])
+	}
+	for _, m := range typedFieldRe.FindAllStringSubmatch(msg, -1) {
+		fields = append(fields, m[1])
+	}
+	if len(fields) == 0 {
+		return []manifestIssue{issue("", msg)}
+	}
+	issues := make([]manifestIssue, 0, len(fields))
+	for _, f := range fields {
+		issues = append(issues, issue(f, msg))
+	}
+	return issues
+}
+
+// yamlPathLine returns the line of a field path such as
+// "spec.template.spec.containers[0].image" or
+// `.spec.containers[name="web"].imagee` in an object's YAML node. When the
+// path only partly exists, the line of the deepest existing part is used;
+// 0 means nothing matched.
+func yamlPathLine(node *yaml.Node, path string) int {
+	line := 0
+	rest := strings.TrimPrefix(path, ".")
+	for rest != "" && node != nil {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 || node.Kind != yaml.SequenceNode {
+				return line
+			}
+			selector := rest[1:end]
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+			var next *yaml.Node
+			if i, err := strconv.Atoi(selector); err == nil {
+				if i >= 0 && i < len(node.Content) {
+					next = node.Content[i]
+				}
+			} else if key, value, ok := strings.Cut(selector, "="); ok {
+				value = strings.Trim(value, `"`)
+				for _, item := range node.Content {
+					if v := yamlMappingValue(item, key); v != nil && v.Value == value {
+						next = item
+						break
+					}
+				}
+			}
+			if next == nil {
+				return line
+			}
+			node, line = next, next.Line
+			continue
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		key := rest
+		if end >= 0 {
+			key, rest = rest[:end], rest[end:]
+			rest = strings.TrimPrefix(rest, ".")
+		} else {
+			rest = ""
+		}
+		if node.Kind != yaml.MappingNode {
+			return line
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return line
+		}
+		node = next
+	}
+	return line
+}
+
+// ── Dry run ─────────────────────────────────────────────────────────────────
+
+// dryRunK8sObject server-side applies p with dryRun=All and diffs the
+// result against the live object. pendingNamespaces are namespaces created
+// by earlier documents of the same manifest: objects in them can't be
+// dry-run yet, so their submitted form is shown instead.
+func dryRunK8sObject(ctx context.Context, c *k8sClient, p preparedK8sObject, pendingNamespaces map[string]bool) (action, diff string, err error) {
+	live, err := c.get(ctx, p.rs, p.namespace, p.name)
+	if err != nil && !isK8sNotFound(err) {
+		return "", "", err
+	}
+	if err != nil {
+		live = nil
+	}
+	result, err := c.apply(ctx, p.rs, p.namespace, p.name, p.obj, true)
+	if err != nil {
+		if !isK8sNotFound(err) || !pendingNamespaces[p.namespace] {
+			return "", "", err
+		}
+		result = p.obj
+	}
+
+	result = diffableK8sObject(result)
+	if live != nil {
+		live = diffableK8sObject(live)
+	}
+	if p.rs.Group == "" && p.rs.Kind == "Secret" {
+		maskSecretValues(live, result)
+	}
+	before, after := "", renderYAML(result)
+	if live != nil {
+		before = renderYAML(live)
+	}
+	switch {
+	case live == nil:
+		action = "created"
+	case before == after:
+		action = "unchanged"
+	default:
+		action = "configured"
+	}
+	return action, unifiedDiff("live/"+p.ref, "applied/"+p.ref, before, after), nil
+}
+
+// diffableK8sObject returns a copy of obj without managedFields, which
+// would otherwise dominate every diff.
+func diffableK8sObject(obj map[string]interface{}) map[string]interface{} {
+	b, _ := json.Marshal(obj)
+	var out map[string]interface{}
+	json.Unmarshal(b, &out)
+	if meta := nestedMap(out, "metadata"); meta != nil {
+		delete(meta, "managedFields")
+	}
+	return out
+}
+
+// maskSecretValues hides Secret values in a diff the way "kubectl diff"
+// does, while still showing which keys changed.
+func maskSecretValues(before, after map[string]interface{}) {
+	for _, field := range []string{"data", "stringData"} {
+		b, a := nestedMap(before, field), nestedMap(after, field)
+		for k, v := range a {
+			old, ok := b[k]
+			switch {
+			case ok && old != v:
+				b[k], a[k] = "*** (before)", "*** (after)"
+			case ok:
+				b[k], a[k] = "***", "***"
+			default:
+				a[k] = "***"
+			}
+		}
+		for k, v := range b {
+			if v != "*** (before)" {
+				b[k] = "***"
+			}
+		}
+	}
+}
+
+func renderYAML(obj map[string]interface{}) string {
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(obj); err != nil {
+		return fmt.Sprintf("# %v\n", err)
+	}
+	enc.Close()
+	return b.String()
+}
+
+// diffMaxCells bounds the line-by-line comparison of unifiedDiff; larger
+// inputs are shown as a full replacement.
+const diffMaxCells = 4_000_000
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff renders the differences between two texts as a unified diff
+// with three lines of context. Equal texts give "".
+func unifiedDiff(fromName, toName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// Lines of a and b consumed before each op, for the hunk headers.
+	aPos, bPos := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	const ctxLines = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	floor := 0
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := max(i-ctxLines, floor)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*ctxLines {
+				end = min(end+ctxLines, len(ops))
+				break
+			}
+			end = run
+		}
+		aCount, bCount := aPos[end]-aPos[start], bPos[end]-bPos[start]
+		aStart, bStart := aPos[start], bPos[start]
+		if aCount > 0 {
+			aStart++
+		}
+		if bCount > 0 {
+			bStart++
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+		i, floor = end, end
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a minimal line edit script using the longest common
+// subsequence.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	ops := make([]diffOp, 0, n+m)
+	if (n+1)*(m+1) > diffMaxCells {
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+	// lcs[i*(m+1)+j] is the LCS length of a[i:] and b[j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// ── History ─────────────────────────────────────────────────────────────────
+
+// ApplyHistoryEntry is one manifest applied to a cluster. Versions count
+// up per cluster.
+type ApplyHistoryEntry struct {
+	ID               int    `json:"id"`
+	ClusterID        int    `json:"cluster_id"`
+	Version          int    `json:"version"`
+	Username         string `json:"username"`
+	DefaultNamespace string `json:"default_namespace"`
+	Manifest         string `json:"manifest,omitempty"`
+	ManifestHash     string `json:"manifest_hash"`
+	Objects          string `json:"objects"` // one reference per line
+	Status           string `json:"status"`  // success, failed, partial
+	Output           string `json:"output"`
+	CreatedAt        string `json:"created_at"`
+}
+
+// recordApplyHistory stores an applied manifest (sealed, since it may hold
+// Secrets) as the cluster's next version and returns that version.
+func recordApplyHistory(e ApplyHistoryEntry) int {
+	sealed, err := vault.Seal(e.Manifest)
+	if err != nil {
+		log.Printf("[ApplyHistory] sealing manifest: %v", err)
+		return 0
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("[ApplyHistory] %v", err)
+		return 0
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) + 1 FROM k8s_apply_history WHERE cluster_id = ?", e.ClusterID).Scan(&version); err != nil {
+		log.Printf("[ApplyHistory] %v", err)
+		return 0
+	}
+	_, err = tx.Exec(
+		`INSERT INTO k8s_apply_history (cluster_id, version, username, default_namespace, manifest, manifest_hash, objects, status, output)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ClusterID, version, e.Username, e.DefaultNamespace, sealed, manifestHash([]byte(e.Manifest)), e.Objects, e.Status, e.Output)
+	if err != nil {
+		log.Printf("[ApplyHistory] recording cluster %d: %v", e.ClusterID, err)
+		return 0
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ApplyHistory] %v", err)
+		return 0
+	}
+	return version
+}
+
+// applyHistoryScope restricts non-admin users to their own entries.
+func applyHistoryScope(r *http.Request) (string, []interface{}) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || HasRole(user.Role, "admin") {
+		return "", nil
+	}
+	return " AND username = ?", []interface{}{user.Username}
+}
+
+// ListApplyHistory lists a cluster's applied manifests, newest first,
+// without their content.
+// GET /api/k0s/clusters/{id}/k8s/apply-history
+func ListApplyHistory(w http.ResponseWriter, r *http.Request) {
+	scope, scopeArgs := applyHistoryScope(r)
+	args := append([]interface{}{mux.Vars(r)["id"]}, scopeArgs...)
+	rows, err := database.DB.Query(
+		`SELECT id, cluster_id, version, username, default_namespace, manifest_hash, objects, status, output, created_at
+		 FROM k8s_apply_history WHERE cluster_id = ?`+scope+` ORDER BY version DESC LIMIT 200`, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	entries := []ApplyHistoryEntry{}
+	for rows.Next() {
+		var e ApplyHistoryEntry
+		if err := rows.Scan(&e.ID, &e.ClusterID, &e.Version, &e.Username, &e.DefaultNamespace, &e.ManifestHash,
+			&e.Objects, &e.Status, &e.Output, &e.CreatedAt); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// GetApplyHistoryVersion returns one applied manifest with its content.
+// GET /api/k0s/clusters/{id}/k8s/apply-history/{version}
+func GetApplyHistoryVersion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scope, scopeArgs := applyHistoryScope(r)
+	args := append([]interface{}{vars["id"], vars["version"]}, scopeArgs...)
+	var e ApplyHistoryEntry
+	err := database.DB.QueryRow(
+		`SELECT id, cluster_id, version, username, default_namespace, manifest, manifest_hash, objects, status, output, created_at
+		 FROM k8s_apply_history WHERE cluster_id = ? AND version = ?`+scope, args...).
+		Scan(&e.ID, &e.ClusterID, &e.Version, &e.Username, &e.DefaultNamespace, &e.Manifest, &e.ManifestHash,
+			&e.Objects, &e.Status, &e.Output, &e.CreatedAt)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	e.Manifest = database.OpenSecret(e.Manifest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,814 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// The cluster admin handlers talk to the Kubernetes API directly, using the
+// credentials of the cluster's admin kubeconfig (see parseKubeconfigCreds),
+// so the server needs no kubectl binary.
+
+const (
+	// k8sPageSize is the page size used when listing; longer lists are
+	// read page by page with continue tokens.
+	k8sPageSize = 500
+	// k8sCallTimeout bounds a single, non-streaming API call.
+	k8sCallTimeout = 60 * time.Second
+	// k8sFieldManager names this server in the managedFields of the
+	// objects it applies.
+	k8sFieldManager = "docker-manager"
+)
+
+// ── Errors ──────────────────────────────────────────────────────────────────
+
+// k8sAPIError is a failed Kubernetes API call. Code is the HTTP status the
+// API server answered with (502 when it could not be reached); Reason and
+// Message come from the returned Status object.
+type k8sAPIError struct {
+	Code    int
+	Reason  string
+	Message string
+	// Causes are the field-level details of an Invalid error.
+	Causes []k8sStatusCause
+}
+
+// k8sStatusCause is one entry of a Status object's details.causes.
+type k8sStatusCause struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Field   string `json:"field"`
+}
+
+func (e *k8sAPIError) Error() string { return e.Message }
+
+// k8sErrorCode returns the HTTP status to report for err.
+func k8sErrorCode(err error) int {
+	var apiErr *k8sAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+func isK8sNotFound(err error) bool { return k8sErrorCode(err) == http.StatusNotFound }
+
+// writeK8sError reports err with the status code of the failed API call.
+func writeK8sError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), k8sErrorCode(err))
+}
+
+// k8sStatusError builds the error for a non-2xx API response.
+func k8sStatusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &k8sAPIError{Code: resp.StatusCode}
+	var st struct {
+		Kind    string `json:"kind"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+		Details struct {
+			Causes []k8sStatusCause `json:"causes"`
+		} `json:"details"`
+	}
+	if json.Unmarshal(body, &st) == nil && st.Kind == "Status" {
+		e.Reason, e.Message, e.Causes = st.Reason, st.Message, st.Details.Causes
+	}
+	if e.Message == "" {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+// k8sTransportError wraps a failure to reach the API server.
+func k8sTransportError(err error) error {
+	var certErr *tls.CertificateVerificationError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	if errors.As(err, &certErr) || errors.As(err, &hostErr) || errors.As(err, &authErr) {
+		return &k8sAPIError{
+			Code:   http.StatusBadGateway,
+			Reason: "TLSVerificationFailed",
+			Message: fmt.Sprintf("API server certificate could not be verified (%v); add the cluster CA as "+
+				"certificate-authority-data or set insecure-skip-tls-verify in the cluster kubeconfig", err),
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &k8sAPIError{Code: http.StatusGatewayTimeout, Reason: "Timeout", Message: "Kubernetes API request timed out"}
+	}
+	return &k8sAPIError{Code: http.StatusBadGateway, Reason: "Unreachable", Message: "Kubernetes API unreachable: " + err.Error()}
+}
+
+// ── Resources ───────────────────────────────────────────────────────────────
+
+// k8sResource identifies a resource type of the Kubernetes API.
+type k8sResource struct {
+	Group      string // "" for the core group
+	Version    string
+	Name       string // plural, as used in URLs
+	Kind       string
+	Namespaced bool
+}
+
+func (rs k8sResource) apiVersion() string {
+	if rs.Group == "" {
+		return rs.Version
+	}
+	return rs.Group + "/" + rs.Version
+}
+
+// path returns the URL path of the collection (name "") or of one object.
+// An empty namespace addresses the collection across all namespaces.
+func (rs k8sResource) path(namespace, name string) string {
+	var b strings.Builder
+	if rs.Group == "" {
+		b.WriteString("/api/" + rs.Version)
+	} else {
+		b.WriteString("/apis/" + rs.Group + "/" + rs.Version)
+	}
+	if rs.Namespaced && namespace != "" {
+		b.WriteString("/namespaces/" + url.PathEscape(namespace))
+	}
+	b.WriteString("/" + rs.Name)
+	if name != "" {
+		b.WriteString("/" + url.PathEscape(name))
+	}
+	return b.String()
+}
+
+// builtinK8sResources are the resource types the cluster admin knows
+// without asking the API server.
+var builtinK8sResources = []k8sResource{
+	{"", "v1", "namespaces", "Namespace", false},
+	{"", "v1", "nodes", "Node", false},
+	{"", "v1", "pods", "Pod", true},
+	{"", "v1", "services", "Service", true},
+	{"", "v1", "endpoints", "Endpoints", true},
+	{"", "v1", "configmaps", "ConfigMap", true},
+	{"", "v1", "secrets", "Secret", true},
+	{"", "v1", "serviceaccounts", "ServiceAccount", true},
+	{"", "v1", "persistentvolumeclaims", "PersistentVolumeClaim", true},
+	{"", "v1", "persistentvolumes", "PersistentVolume", false},
+	{"", "v1", "events", "Event", true},
+	{"", "v1", "resourcequotas", "ResourceQuota", true},
+	{"", "v1", "limitranges", "LimitRange", true},
+	{"apps", "v1", "deployments", "Deployment", true},
+	{"apps", "v1", "replicasets", "ReplicaSet", true},
+	{"apps", "v1", "statefulsets", "StatefulSet", true},
+	{"apps", "v1", "daemonsets", "DaemonSet", true},
+	{"apps", "v1", "controllerrevisions", "ControllerRevision", true},
+	{"batch", "v1", "jobs", "Job", true},
+	{"batch", "v1", "cronjobs", "CronJob", true},
+	{"networking.k8s.io", "v1", "ingresses", "Ingress", true},
+	{"networking.k8s.io", "v1", "networkpolicies", "NetworkPolicy", true},
+	{"policy", "v1", "poddisruptionbudgets", "PodDisruptionBudget", true},
+	{"autoscaling", "v2", "horizontalpodautoscalers", "HorizontalPodAutoscaler", true},
+	{"storage.k8s.io", "v1", "storageclasses", "StorageClass", false},
+	{"rbac.authorization.k8s.io", "v1", "roles", "Role", true},
+	{"rbac.authorization.k8s.io", "v1", "rolebindings", "RoleBinding", true},
+	{"rbac.authorization.k8s.io", "v1", "clusterroles", "ClusterRole", false},
+	{"rbac.authorization.k8s.io", "v1", "clusterrolebindings", "ClusterRoleBinding", false},
+}
+
+// k8sResourceByName finds a built-in resource type by its plural name.
+func k8sResourceByName(name string) (k8sResource, bool) {
+	for _, rs := range builtinK8sResources {
+		if rs.Name == name {
+			return rs, true
+		}
+	}
+	return k8sResource{}, false
+}
+
+// mustK8sResource is k8sResourceByName for names known to be built in.
+func mustK8sResource(name string) k8sResource {
+	rs, ok := k8sResourceByName(name)
+	if !ok {
+		panic("unknown built-in resource " + name)
+	}
+	return rs
+}
+
+// resourceFor maps an object's apiVersion and kind to its resource type,
+// asking the API server's discovery for kinds that are not built in.
+func (c *k8sClient) resourceFor(ctx context.Context, apiVersion, kind string) (k8sResource, error) {
+	for _, rs := range builtinK8sResources {
+		if rs.Kind == kind && rs.apiVersion() == apiVersion {
+			return rs, nil
+		}
+	}
+	group, version, found := strings.Cut(apiVersion, "/")
+	path := "/apis/" + apiVersion
+	if !found {
+		group, version, path = "", apiVersion, "/api/"+apiVersion
+	}
+	var discovery struct {
+		Resources []struct {
+			Name       string `json:"name"`
+			Kind       string `json:"kind"`
+			Namespaced bool   `json:"namespaced"`
+		} `json:"resources"`
+	}
+	if err := c.call(ctx, http.MethodGet, path, nil, "", nil, &discovery); err != nil {
+		if isK8sNotFound(err) {
+			return k8sResource{}, &k8sAPIError{Code: http.StatusBadRequest, Reason: "BadRequest",
+				Message: fmt.Sprintf("apiVersion %s is not served by the cluster", apiVersion)}
+		}
+		return k8sResource{}, err
+	}
+	for _, res := range discovery.Resources {
+		if res.Kind == kind && !strings.Contains(res.Name, "/") {
+			return k8sResource{Group: group, Version: version, Name: res.Name, Kind: kind, Namespaced: res.Namespaced}, nil
+		}
+	}
+	return k8sResource{}, &k8sAPIError{Code: http.StatusBadRequest, Reason: "BadRequest",
+		Message: fmt.Sprintf("kind %s is not served by %s", kind, apiVersion)}
+}
+
+// ── Client ──────────────────────────────────────────────────────────────────
+
+// k8sClient makes REST calls to one cluster's API server.
+type k8sClient struct {
+	clusterID string
+	creds     *clusterK8sCreds
+}
+
+// newK8sClient returns a client for the cluster. Errors are *k8sAPIError,
+// so handlers can pass them to writeK8sError.
+func newK8sClient(clusterID string) (*k8sClient, error) {
+	creds, err := loadClusterK8sCreds(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	return &k8sClient{clusterID: clusterID, creds: creds}, nil
+}
+
+// loadClusterK8sCreds parses the cluster's stored admin kubeconfig. A k0s
+// cluster provisioned by this server that has none stored yet gets its
+// admin.conf fetched over SSH and cached.
+func loadClusterK8sCreds(clusterID string) (*clusterK8sCreds, error) {
+	var ip, username, password, authMethod, sshKey, kubeconfig string
+	err := database.DB.QueryRow(
+		"SELECT COALESCE(ip_address,''), COALESCE(username,''), COALESCE(password,''), COALESCE(auth_method,'password'), COALESCE(ssh_key,''), COALESCE(kubeconfig,'') FROM k0s_clusters WHERE id = ?",
+		clusterID,
+	).Scan(&ip, &username, &password, &authMethod, &sshKey, &kubeconfig)
+	if err == sql.ErrNoRows {
+		return nil, &k8sAPIError{Code: http.StatusNotFound, Reason: "NotFound", Message: "Cluster not found"}
+	}
+	if err != nil {
+		return nil, &k8sAPIError{Code: http.StatusInternalServerError, Reason: "InternalError", Message: err.Error()}
+	}
+	kubeconfig = database.OpenSecret(kubeconfig)
+
+	if strings.TrimSpace(kubeconfig) == "" {
+		if ip == "" || username == "" {
+			return nil, &k8sAPIError{Code: http.StatusBadRequest, Reason: "BadRequest",
+				Message: "Cluster kubeconfig not available — fetch or import it first"}
+		}
+		credential := database.OpenSecret(password)
+		if authMethod == "ssh-key" {
+			credential = database.OpenSecret(sshKey)
+		}
+		if authMethod == "" {
+			authMethod = "password"
+		}
+		kubeconfig, err = fetchK0sAdminKubeconfig(ip, username, credential, authMethod)
+		if err != nil {
+			return nil, &k8sAPIError{Code: http.StatusBadGateway, Reason: "Unreachable",
+				Message: "Cluster kubeconfig not available and could not be fetched: " + err.Error()}
+		}
+		if sealed, err := vault.Seal(kubeconfig); err == nil {
+			database.DB.Exec("UPDATE k0s_clusters SET kubeconfig = ? WHERE id = ?", sealed, clusterID)
+		}
+		log.Printf("[K8sClient] cluster %s: admin kubeconfig fetched over SSH and cached", clusterID)
+	}
+
+	creds, err := parseKubeconfigCreds(clusterID, kubeconfig)
+	if err != nil {
+		return nil, &k8sAPIError{Code: http.StatusInternalServerError, Reason: "InternalError",
+			Message: "Failed to parse cluster kubeconfig: " + err.Error()}
+	}
+	return creds, nil
+}
+
+// do sends one request and returns the response of a successful call; the
+// caller closes its body. Failed calls are returned as *k8sAPIError.
+func (c *k8sClient) do(ctx context.Context, method, path string, query url.Values, contentType string, body []byte) (*http.Response, error) {
+	target := c.creds.serverURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, &k8sAPIError{Code: http.StatusBadRequest, Reason: "BadRequest", Message: err.Error()}
+	}
+	if c.creds.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.creds.bearerToken)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", k8sFieldManager)
+
+	resp, err := c.creds.httpClient.Do(req)
+	if err != nil {
+		return nil, k8sTransportError(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		err := k8sStatusError(resp)
+		log.Printf("[K8sClient] cluster %s: %s %s → %d %v", c.clusterID, method, path, resp.StatusCode, err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// call makes a non-streaming request and decodes the JSON response into
+// out (*[]byte receives the raw body; nil discards it).
+func (c *k8sClient) call(ctx context.Context, method, path string, query url.Values, contentType string, body []byte, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, k8sCallTimeout)
+	defer cancel()
+	resp, err := c.do(ctx, method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch dst := out.(type) {
+	case nil:
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		return nil
+	case *[]byte:
+		if *dst, err = io.ReadAll(resp.Body); err != nil {
+			return k8sTransportError(err)
+		}
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &k8sAPIError{Code: http.StatusBadGateway, Reason: "InvalidResponse", Message: "decoding API response: " + err.Error()}
+	}
+	return nil
+}
+
+// k8sListOptions narrow and page a list call.
+type k8sListOptions struct {
+	LabelSelector string
+	FieldSelector string
+	Limit         int    // page size; 0 means k8sPageSize
+	Continue      string // token of the page to read
+}
+
+// k8sList is a list response. Items keep their full JSON structure.
+type k8sList struct {
+	APIVersion string                   `json:"apiVersion"`
+	Kind       string                   `json:"kind"`
+	Metadata   k8sListMeta              `json:"metadata"`
+	Items      []map[string]interface{} `json:"items"`
+}
+
+type k8sListMeta struct {
+	ResourceVersion    string `json:"resourceVersion,omitempty"`
+	Continue           string `json:"continue,omitempty"`
+	RemainingItemCount *int64 `json:"remainingItemCount,omitempty"`
+}
+
+// listPage reads one page of a collection. namespace "" lists across all
+// namespaces. Items get apiVersion and kind set, as kubectl shows them.
+func (c *k8sClient) listPage(ctx context.Context, rs k8sResource, namespace string, opts k8sListOptions) (*k8sList, error) {
+	q := url.Values{}
+	if opts.LabelSelector != "" {
+		q.Set("labelSelector", opts.LabelSelector)
+	}
+	if opts.FieldSelector != "" {
+		q.Set("fieldSelector", opts.FieldSelector)
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = k8sPageSize
+	}
+	q.Set("limit", strconv.Itoa(limit))
+	if opts.Continue != "" {
+		q.Set("continue", opts.Continue)
+	}
+	var list k8sList
+	if err := c.call(ctx, http.MethodGet, rs.path(namespace, ""), q, "", nil, &list); err != nil {
+		return nil, err
+	}
+	if list.Items == nil {
+		list.Items = []map[string]interface{}{}
+	}
+	for _, item := range list.Items {
+		item["apiVersion"] = rs.apiVersion()
+		item["kind"] = rs.Kind
+	}
+	return &list, nil
+}
+
+// list reads a whole collection, following continue tokens.
+func (c *k8sClient) list(ctx context.Context, rs k8sResource, namespace string, opts k8sListOptions) (*k8sList, error) {
+	all, err := c.listPage(ctx, rs, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	for all.Metadata.Continue != "" {
+		opts.Continue = all.Metadata.Continue
+		page, err := c.listPage(ctx, rs, namespace, opts)
+		if err != nil {
+			return nil, err
+		}
+		all.Items = append(all.Items, page.Items...)
+		all.Metadata = page.Metadata
+	}
+	all.Metadata.RemainingItemCount = nil
+	return all, nil
+}
+
+// count returns the number of objects in a collection, reading a single
+// item when the API server reports how many remain.
+func (c *k8sClient) count(ctx context.Context, rs k8sResource, namespace string, opts k8sListOptions) (int, error) {
+	opts.Limit = 1
+	page, err := c.listPage(ctx, rs, namespace, opts)
+	if err != nil {
+		return 0, err
+	}
+	if page.Metadata.Continue == "" {
+		return len(page.Items), nil
+	}
+	if page.Metadata.RemainingItemCount != nil {
+		return len(page.Items) + int(*page.Metadata.RemainingItemCount), nil
+	}
+	opts.Limit = 0
+	all, err := c.list(ctx, rs, namespace, opts)
+	if err != nil {
+		return 0, err
+	}
+	return len(all.Items), nil
+}
+
+// get reads one object.
+func (c *k8sClient) get(ctx context.Context, rs k8sResource, namespace, name string) (map[string]interface{}, error) {
+	var obj map[string]interface{}
+	if err := c.call(ctx, http.MethodGet, rs.path(namespace, name), nil, "", nil, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// create creates obj in the collection.
+func (c *k8sClient) create(ctx context.Context, rs k8sResource, namespace string, obj interface{}) (map[string]interface{}, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	q := url.Values{"fieldManager": {k8sFieldManager}}
+	if err := c.call(ctx, http.MethodPost, rs.path(namespace, ""), q, "application/json", body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// update replaces one object. A metadata.resourceVersion in obj makes the
+// API server reject the update with 409 Conflict if the object changed
+// since it was read.
+func (c *k8sClient) update(ctx context.Context, rs k8sResource, namespace, name string, obj interface{}) (map[string]interface{}, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	q := url.Values{"fieldManager": {k8sFieldManager}}
+	if err := c.call(ctx, http.MethodPut, rs.path(namespace, name), q, "application/json", body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// delete deletes one object, letting the garbage collector remove its
+// dependents in the background.
+func (c *k8sClient) delete(ctx context.Context, rs k8sResource, namespace, name string) error {
+	body := []byte(`{"kind":"DeleteOptions","apiVersion":"v1","propagationPolicy":"Background"}`)
+	return c.call(ctx, http.MethodDelete, rs.path(namespace, name), nil, "application/json", body, nil)
+}
+
+// Patch content types accepted by the API server.
+const (
+	k8sJSONPatch      = "application/json-patch+json"
+	k8sMergePatch     = "application/merge-patch+json"
+	k8sStrategicPatch = "application/strategic-merge-patch+json"
+	k8sApplyPatch     = "application/apply-patch+yaml"
+)
+
+// patch patches one object with the given patch type.
+func (c *k8sClient) patch(ctx context.Context, rs k8sResource, namespace, name, patchType string, patch interface{}) (map[string]interface{}, error) {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	q := url.Values{"fieldManager": {k8sFieldManager}}
+	if err := c.call(ctx, http.MethodPatch, rs.path(namespace, name), q, patchType, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// apply creates or updates obj with server-side apply, taking over fields
+// other managers own (like "kubectl apply" does for its own changes).
+// Fields the schema does not know are rejected rather than dropped. With
+// dryRun the API server validates and returns the result without
+// persisting it.
+func (c *k8sClient) apply(ctx context.Context, rs k8sResource, namespace, name string, obj interface{}, dryRun bool) (map[string]interface{}, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	q := url.Values{"fieldManager": {k8sFieldManager}, "force": {"true"}, "fieldValidation": {"Strict"}}
+	if dryRun {
+		q.Set("dryRun", "All")
+	}
+	if err := c.call(ctx, http.MethodPatch, rs.path(namespace, name), q, k8sApplyPatch, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// raw GETs an arbitrary API path and returns the response body.
+func (c *k8sClient) raw(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	var out []byte
+	err := c.call(ctx, http.MethodGet, path, query, "", nil, &out)
+	return out, err
+}
+
+// podLogs reads a pod's log; query takes the options of the log
+// subresource (container, tailLines, previous, ...).
+func (c *k8sClient) podLogs(ctx context.Context, namespace, pod string, query url.Values) ([]byte, error) {
+	return c.raw(ctx, mustK8sResource("pods").path(namespace, pod)+"/log", query)
+}
+
+// streamPodLogs opens a pod's log for reading as it is written (query
+// usually has follow=true). It is bounded only by ctx; the caller closes
+// the returned body.
+func (c *k8sClient) streamPodLogs(ctx context.Context, namespace, pod string, query url.Values) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, mustK8sResource("pods").path(namespace, pod)+"/log", query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// watch opens a watch stream on a collection, starting after
+// resourceVersion and asking for bookmarks. The API server ends the stream
+// after timeout; the caller reads newline-delimited watch events from the
+// response body and closes it.
+func (c *k8sClient) watch(ctx context.Context, rs k8sResource, namespace, resourceVersion string, timeout time.Duration) (*http.Response, error) {
+	q := url.Values{}
+	q.Set("watch", "1")
+	q.Set("allowWatchBookmarks", "true")
+	q.Set("resourceVersion", resourceVersion)
+	q.Set("timeoutSeconds", strconv.Itoa(int(timeout/time.Second)))
+	return c.do(ctx, http.MethodGet, rs.path(namespace, ""), q, "", nil)
+}
+
+// serverVersion returns the API server's gitVersion.
+func (c *k8sClient) serverVersion(ctx context.Context) (string, error) {
+	var v struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/version", nil, "", nil, &v); err != nil {
+		return "", err
+	}
+	return v.GitVersion, nil
+}
+
+// ── Object helpers ──────────────────────────────────────────────────────────
+
+// nestedMap walks obj along fields and returns the map found there.
+func nestedMap(obj map[string]interface{}, fields ...string) map[string]interface{} {
+	cur := obj
+	for _, f := range fields {
+		next, ok := cur[f].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
+
+// nestedString returns the string at the end of fields, or "".
+func nestedString(obj map[string]interface{}, fields ...string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	parent := nestedMap(obj, fields[:len(fields)-1]...)
+	s, _ := parent[fields[len(fields)-1]].(string)
+	return s
+}
+
+// nestedSlice returns the list at the end of fields, or nil.
+func nestedSlice(obj map[string]interface{}, fields ...string) []interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+	parent := nestedMap(obj, fields[:len(fields)-1]...)
+	s, _ := parent[fields[len(fields)-1]].([]interface{})
+	return s
+}
+
+// nestedInt returns the number at the end of fields, or 0.
+func nestedInt(obj map[string]interface{}, fields ...string) int64 {
+	if len(fields) == 0 {
+		return 0
+	}
+	parent := nestedMap(obj, fields[:len(fields)-1]...)
+	switch n := parent[fields[len(fields)-1]].(type) {
+	case float64:
+		return int64(n)
+	case int:
+		return int64(n)
+	case int64:
+		return n
+	}
+	return 0
+}
+
+// decodeK8sItems converts list items into typed structs.
+func decodeK8sItems(items []map[string]interface{}, out interface{}) error {
+	b, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// ── Manifests ───────────────────────────────────────────────────────────────
+
+// manifestDocument is one object of a YAML manifest, with where it starts
+// and its YAML node for locating fields in error messages.
+type manifestDocument struct {
+	Index  int // 1-based document number
+	Line   int // line of the object in the manifest
+	Object map[string]interface{}
+	Node   *yaml.Node
+}
+
+// parseManifestDocuments splits a YAML manifest into its objects. Empty
+// documents are skipped and List objects are expanded into their items.
+func parseManifestDocuments(manifest []byte) ([]manifestDocument, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(manifest))
+	var docs []manifestDocument
+	for index := 1; ; index++ {
+		var root yaml.Node
+		err := dec.Decode(&root)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", index, err)
+		}
+		if len(root.Content) == 0 {
+			continue
+		}
+		node := root.Content[0]
+		var obj map[string]interface{}
+		if err := node.Decode(&obj); err != nil {
+			return nil, fmt.Errorf("document %d, line %d: %v", index, node.Line, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		if obj["kind"] != "List" {
+			docs = append(docs, manifestDocument{Index: index, Line: node.Line, Object: obj, Node: node})
+			continue
+		}
+		items := yamlMappingValue(node, "items")
+		if items == nil {
+			continue
+		}
+		for _, item := range items.Content {
+			var m map[string]interface{}
+			if err := item.Decode(&m); err != nil {
+				return nil, fmt.Errorf("document %d, line %d: %v", index, item.Line, err)
+			}
+			docs = append(docs, manifestDocument{Index: index, Line: item.Line, Object: m, Node: item})
+		}
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("manifest contains no objects")
+	}
+	return docs, nil
+}
+
+// yamlMappingValue returns the value node of key in a mapping node.
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// decodeManifestObjects is parseManifestDocuments for callers that only
+// need the objects.
+func decodeManifestObjects(manifest []byte) ([]map[string]interface{}, error) {
+	docs, err := parseManifestDocuments(manifest)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		objects[i] = doc.Object
+	}
+	return objects, nil
+}
+
+// preparedK8sObject is a manifest object ready to be applied.
+type preparedK8sObject struct {
+	rs        k8sResource
+	namespace string
+	name      string
+	ref       string // kubectl-style reference, e.g. "deployment.apps/web"
+	obj       map[string]interface{}
+}
+
+// prepareK8sObject resolves a manifest object's resource type and places
+// namespaced objects without a namespace in defaultNS. The returned ref is
+// set even when preparing fails.
+func prepareK8sObject(ctx context.Context, c *k8sClient, obj map[string]interface{}, defaultNS string) (preparedK8sObject, error) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	meta := nestedMap(obj, "metadata")
+	name, _ := meta["name"].(string)
+	p := preparedK8sObject{name: name, ref: strings.ToLower(kind) + "/" + name, obj: obj}
+	if apiVersion == "" || kind == "" || name == "" {
+		return p, &k8sAPIError{Code: http.StatusBadRequest, Reason: "BadRequest",
+			Message: "every object needs apiVersion, kind and metadata.name"}
+	}
+
+	rs, err := c.resourceFor(ctx, apiVersion, kind)
+	if err != nil {
+		return p, err
+	}
+	p.rs = rs
+	if rs.Group != "" {
+		p.ref = strings.ToLower(kind) + "." + rs.Group + "/" + name
+	}
+
+	if rs.Namespaced {
+		p.namespace, _ = meta["namespace"].(string)
+		if p.namespace == "" {
+			p.namespace = defaultNS
+			meta["namespace"] = p.namespace
+		}
+	} else {
+		delete(meta, "namespace")
+	}
+	// Objects copied from a GET carry server-owned fields that apply
+	// rejects or would treat as preconditions.
+	for _, f := range []string{"managedFields", "resourceVersion", "uid", "creationTimestamp", "generation", "selfLink"} {
+		delete(meta, f)
+	}
+	delete(obj, "status")
+	return p, nil
+}
+
+// applyK8sObject server-side applies one manifest object, placing namespaced
+// objects without a namespace in defaultNS. It returns the object's
+// kubectl-style reference (e.g. "deployment.apps/web").
+func applyK8sObject(ctx context.Context, c *k8sClient, obj map[string]interface{}, defaultNS string) (string, error) {
+	p, err := prepareK8sObject(ctx, c, obj, defaultNS)
+	if err != nil {
+		return p.ref, err
+	}
+	_, err = c.apply(ctx, p.rs, p.namespace, p.name, p.obj, false)
+	return p.ref, err
+}
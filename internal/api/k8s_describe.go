@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Text views of API objects in the layout of "kubectl describe" and
+// "kubectl get events", for the cluster admin's pod details panel.
+
+// describePod renders a pod and its events like "kubectl describe pod".
+func describePod(ctx context.Context, c *k8sClient, namespace, name string) (string, error) {
+	pod, err := c.get(ctx, mustK8sResource("pods"), namespace, name)
+	if err != nil {
+		return "", err
+	}
+	events, err := c.list(ctx, mustK8sResource("events"), namespace, k8sListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + name,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 8, 1, ' ', 0)
+	field := func(label, value string) {
+		if value == "" {
+			value = "<none>"
+		}
+		fmt.Fprintf(tw, "%s:\t%s\n", label, value)
+	}
+
+	meta := nestedMap(pod, "metadata")
+	spec := nestedMap(pod, "spec")
+	status := nestedMap(pod, "status")
+
+	field("Name", nestedString(meta, "name"))
+	field("Namespace", nestedString(meta, "namespace"))
+	field("Service Account", nestedString(spec, "serviceAccountName"))
+	node := nestedString(spec, "nodeName")
+	if hostIP := nestedString(status, "hostIP"); node != "" && hostIP != "" {
+		node += "/" + hostIP
+	}
+	field("Node", node)
+	field("Start Time", nestedString(status, "startTime"))
+	field("Labels", joinStringMap(nestedMap(meta, "labels"), "="))
+	field("Annotations", joinStringMap(nestedMap(meta, "annotations"), ": "))
+	field("Status", nestedString(status, "phase"))
+	field("IP", nestedString(status, "podIP"))
+	var owners []string
+	for _, o := range nestedSlice(meta, "ownerReferences") {
+		if om, ok := o.(map[string]interface{}); ok {
+			owners = append(owners, nestedString(om, "kind")+"/"+nestedString(om, "name"))
+		}
+	}
+	field("Controlled By", strings.Join(owners, ", "))
+	tw.Flush()
+
+	describeContainers(&b, "Init Containers", nestedSlice(spec, "initContainers"), nestedSlice(status, "initContainerStatuses"))
+	describeContainers(&b, "Containers", nestedSlice(spec, "containers"), nestedSlice(status, "containerStatuses"))
+
+	b.WriteString("Conditions:\n")
+	tw = tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  Type\tStatus")
+	for _, cond := range nestedSlice(status, "conditions") {
+		if cm, ok := cond.(map[string]interface{}); ok {
+			fmt.Fprintf(tw, "  %s\t%s\n", nestedString(cm, "type"), nestedString(cm, "status"))
+		}
+	}
+	tw.Flush()
+
+	b.WriteString("Volumes:\n")
+	volumes := nestedSlice(spec, "volumes")
+	if len(volumes) == 0 {
+		b.WriteString("  <none>\n")
+	}
+	for _, v := range volumes {
+		vm, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s:\n", nestedString(vm, "name"))
+		for source := range vm {
+			if source != "name" {
+				fmt.Fprintf(&b, "    Type: %s\n", source)
+			}
+		}
+	}
+
+	tw = tabwriter.NewWriter(&b, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "QoS Class:\t%s\n", orNone(nestedString(status, "qosClass")))
+	fmt.Fprintf(tw, "Node-Selectors:\t%s\n", orNone(joinStringMap(nestedMap(spec, "nodeSelector"), "=")))
+	tw.Flush()
+
+	b.WriteString("Events:")
+	if len(events.Items) == 0 {
+		b.WriteString("  <none>\n")
+	} else {
+		b.WriteString("\n")
+		for _, line := range strings.Split(strings.TrimRight(formatEventTable(events.Items), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// describeContainers writes the containers section of describePod.
+func describeContainers(b *strings.Builder, title string, containers, statuses []interface{}) {
+	if len(containers) == 0 {
+		return
+	}
+	byName := map[string]map[string]interface{}{}
+	for _, s := range statuses {
+		if sm, ok := s.(map[string]interface{}); ok {
+			byName[nestedString(sm, "name")] = sm
+		}
+	}
+	fmt.Fprintf(b, "%s:\n", title)
+	for _, ct := range containers {
+		cm, ok := ct.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := nestedString(cm, "name")
+		st := byName[name]
+		fmt.Fprintf(b, "  %s:\n", name)
+		tw := tabwriter.NewWriter(b, 0, 8, 1, ' ', 0)
+		fmt.Fprintf(tw, "    Image:\t%s\n", nestedString(cm, "image"))
+		var ports []string
+		for _, p := range nestedSlice(cm, "ports") {
+			if pm, ok := p.(map[string]interface{}); ok {
+				ports = append(ports, fmt.Sprintf("%v/%s", pm["containerPort"], orDefault(nestedString(pm, "protocol"), "TCP")))
+			}
+		}
+		fmt.Fprintf(tw, "    Port:\t%s\n", orNone(strings.Join(ports, ", ")))
+		state, detail := containerState(nestedMap(st, "state"))
+		fmt.Fprintf(tw, "    State:\t%s\n", state)
+		if detail != "" {
+			fmt.Fprintf(tw, "      %s\n", detail)
+		}
+		if last, lastDetail := containerState(nestedMap(st, "lastState")); last != "" {
+			fmt.Fprintf(tw, "    Last State:\t%s\n", last)
+			if lastDetail != "" {
+				fmt.Fprintf(tw, "      %s\n", lastDetail)
+			}
+		}
+		fmt.Fprintf(tw, "    Ready:\t%v\n", st["ready"] == true)
+		fmt.Fprintf(tw, "    Restart Count:\t%v\n", orZero(st["restartCount"]))
+		if limits := joinStringMap(nestedMap(cm, "resources", "limits"), ": "); limits != "" {
+			fmt.Fprintf(tw, "    Limits:\t%s\n", limits)
+		}
+		if requests := joinStringMap(nestedMap(cm, "resources", "requests"), ": "); requests != "" {
+			fmt.Fprintf(tw, "    Requests:\t%s\n", requests)
+		}
+		tw.Flush()
+	}
+}
+
+// containerState summarises a container state object.
+func containerState(state map[string]interface{}) (string, string) {
+	if s := nestedMap(state, "running"); s != nil {
+		return "Running", "Started: " + nestedString(s, "startedAt")
+	}
+	if s := nestedMap(state, "waiting"); s != nil {
+		return "Waiting", strings.TrimSpace("Reason: " + nestedString(s, "reason") + " " + nestedString(s, "message"))
+	}
+	if s := nestedMap(state, "terminated"); s != nil {
+		return "Terminated", fmt.Sprintf("Reason: %s, Exit Code: %v", nestedString(s, "reason"), orZero(s["exitCode"]))
+	}
+	return "", ""
+}
+
+// formatEventTable renders events like "kubectl get events", oldest first.
+func formatEventTable(events []map[string]interface{}) string {
+	if len(events) == 0 {
+		return "No resources found.\n"
+	}
+	sort.SliceStable(events, func(i, j int) bool { return eventTime(events[i]).Before(eventTime(events[j])) })
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "LAST SEEN\tTYPE\tREASON\tOBJECT\tMESSAGE")
+	for _, ev := range events {
+		lastSeen := "<unknown>"
+		if t := eventTime(ev); !t.IsZero() {
+			lastSeen = shortDuration(time.Since(t))
+		}
+		object := strings.ToLower(nestedString(ev, "involvedObject", "kind")) + "/" + nestedString(ev, "involvedObject", "name")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", lastSeen, nestedString(ev, "type"), nestedString(ev, "reason"),
+			object, strings.TrimSpace(nestedString(ev, "message")))
+	}
+	tw.Flush()
+	return b.String()
+}
+
+// eventTime is the last time an event was seen.
+func eventTime(ev map[string]interface{}) time.Time {
+	for _, f := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+		if t, err := time.Parse(time.RFC3339, nestedString(ev, f)); err == nil {
+			return t
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, nestedString(ev, "metadata", "creationTimestamp")); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// shortDuration formats an age the way kubectl does (45s, 12m, 3h, 5d).
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// joinStringMap renders a string map as sorted "key<sep>value" entries.
+func joinStringMap(m map[string]interface{}, sep string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s%s%v", k, sep, m[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func orNone(s string) string { return orDefault(s, "<none>") }
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func orZero(v interface{}) interface{} {
+	if v == nil {
+		return 0
+	}
+	return v
+}
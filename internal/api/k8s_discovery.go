@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// API discovery: the resource types a cluster serves — built-in kinds,
+// aggregated APIs and CRDs alike — read from /api and /apis and cached per
+// cluster, so the cluster admin can browse and manage any kind.
+
+// k8sDiscoveryTTL is how long a cluster's discovered resource types are
+// reused before asking the API server again.
+const k8sDiscoveryTTL = 5 * time.Minute
+
+// k8sAPIResource is one entry of a cluster's resource catalog.
+type k8sAPIResource struct {
+	Group      string   `json:"group"`
+	Version    string   `json:"version"`
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`
+	Namespaced bool     `json:"namespaced"`
+	Verbs      []string `json:"verbs"`
+	ShortNames []string `json:"shortNames,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+func (ar k8sAPIResource) resource() k8sResource {
+	return k8sResource{Group: ar.Group, Version: ar.Version, Name: ar.Name, Kind: ar.Kind, Namespaced: ar.Namespaced}
+}
+
+// fullName is the kubectl-style name, e.g. "certificates.cert-manager.io".
+func (ar k8sAPIResource) fullName() string {
+	if ar.Group == "" {
+		return ar.Name
+	}
+	return ar.Name + "." + ar.Group
+}
+
+type k8sDiscovery struct {
+	fetched   time.Time
+	resources []k8sAPIResource
+}
+
+// k8sDiscoveryCache maps a cluster ID to its *k8sDiscovery.
+var k8sDiscoveryCache sync.Map
+
+// discover returns the resource types the cluster serves, in the preferred
+// version of each API group. Groups whose discovery fails (typically an
+// unavailable aggregated API such as metrics.k8s.io) are left out.
+func (c *k8sClient) discover(ctx context.Context, refresh bool) ([]k8sAPIResource, error) {
+	if cached, ok := k8sDiscoveryCache.Load(c.clusterID); ok && !refresh {
+		d := cached.(*k8sDiscovery)
+		if time.Since(d.fetched) < k8sDiscoveryTTL {
+			return d.resources, nil
+		}
+	}
+
+	var groups struct {
+		Groups []struct {
+			Name             string `json:"name"`
+			PreferredVersion struct {
+				Version string `json:"version"`
+			} `json:"preferredVersion"`
+		} `json:"groups"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/apis", nil, "", nil, &groups); err != nil {
+		return nil, err
+	}
+
+	type groupVersion struct{ group, version string }
+	gvs := []groupVersion{{"", "v1"}}
+	for _, g := range groups.Groups {
+		gvs = append(gvs, groupVersion{g.Name, g.PreferredVersion.Version})
+	}
+
+	lists := make([][]k8sAPIResource, len(gvs))
+	errs := make([]error, len(gvs))
+	var wg sync.WaitGroup
+	for i, gv := range gvs {
+		wg.Add(1)
+		go func(i int, gv groupVersion) {
+			defer wg.Done()
+			lists[i], errs[i] = c.discoverGroupVersion(ctx, gv.group, gv.version)
+		}(i, gv)
+	}
+	wg.Wait()
+
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	var resources []k8sAPIResource
+	for i, list := range lists {
+		if errs[i] != nil {
+			log.Printf("[K8sDiscovery] cluster %s: skipping %s/%s: %v", c.clusterID, gvs[i].group, gvs[i].version, errs[i])
+			continue
+		}
+		resources = append(resources, list...)
+	}
+	k8sDiscoveryCache.Store(c.clusterID, &k8sDiscovery{fetched: time.Now(), resources: resources})
+	return resources, nil
+}
+
+// discoverGroupVersion lists the resources of one API group version,
+// without subresources such as pods/log.
+func (c *k8sClient) discoverGroupVersion(ctx context.Context, group, version string) ([]k8sAPIResource, error) {
+	path := "/apis/" + group + "/" + version
+	if group == "" {
+		path = "/api/" + version
+	}
+	var list struct {
+		Resources []k8sAPIResource `json:"resources"`
+	}
+	if err := c.call(ctx, http.MethodGet, path, nil, "", nil, &list); err != nil {
+		return nil, err
+	}
+	out := make([]k8sAPIResource, 0, len(list.Resources))
+	for _, res := range list.Resources {
+		if strings.Contains(res.Name, "/") {
+			continue
+		}
+		res.Group, res.Version = group, version
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// resolveResource maps a resource name from a URL to its type. Built-in
+// kinds are known without discovery; anything else is looked up by plural
+// name, "plural.group" (for kinds served by several groups) or short name.
+func (c *k8sClient) resolveResource(ctx context.Context, name string) (k8sResource, error) {
+	if rs, ok := k8sResourceByName(name); ok {
+		return rs, nil
+	}
+	resources, err := c.discover(ctx, false)
+	if err != nil {
+		return k8sResource{}, err
+	}
+	name = strings.ToLower(name)
+	for _, res := range resources {
+		if res.Name == name || res.fullName() == name {
+			return res.resource(), nil
+		}
+	}
+	for _, res := range resources {
+		for _, short := range res.ShortNames {
+			if short == name {
+				return res.resource(), nil
+			}
+		}
+	}
+	return k8sResource{}, &k8sAPIError{Code: http.StatusNotFound, Reason: "NotFound",
+		Message: fmt.Sprintf("the server doesn't have a resource type %q", name)}
+}
+
+// GetClusterAPIResources returns the cluster's resource catalog, sorted by
+// group and name ("kubectl api-resources"). ?refresh=1 skips the cache.
+// GET /api/k0s/clusters/{id}/k8s/api-resources
+func GetClusterAPIResources(w http.ResponseWriter, r *http.Request) {
+	c, err := newK8sClient(mux.Vars(r)["id"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	resources, err := c.discover(r.Context(), r.URL.Query().Get("refresh") == "1")
+	if err != nil {
+		log.Printf("[K8sDiscovery] cluster %s: %v", c.clusterID, err)
+		writeK8sError(w, err)
+		return
+	}
+	sorted := make([]k8sAPIResource, len(resources))
+	copy(sorted, resources)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Group != sorted[j].Group {
+			return sorted[i].Group < sorted[j].Group
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"items": sorted})
+}
@@ -0,0 +1,465 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// k8sLogRelist is how often a followed log stream looks for new pods
+	// matching its selector, e.g. those created by a rollout.
+	k8sLogRelist = 10 * time.Second
+	// k8sMaxLogStreams caps the containers one viewer follows at once.
+	k8sMaxLogStreams = 30
+	// k8sMaxLogLine is the longest log line read; a longer one ends that
+	// container's stream with an error.
+	k8sMaxLogLine = 256 * 1024
+)
+
+// k8sLogMessage is one WebSocket message of a log stream: a log line
+// ("line"), a notice about the stream ("info", "error") or the end of a
+// stream that doesn't follow ("end").
+type k8sLogMessage struct {
+	Type      string `json:"type"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Line      string `json:"line,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// podLogQuery builds the options of the pods/log subresource from the
+// request: container, previous, since (a duration such as 10m), sinceTime
+// (RFC3339), tailLines (0: all) and timestamps. defaultTail applies when
+// tailLines is not given.
+func podLogQuery(q url.Values, defaultTail int) (url.Values, error) {
+	out := url.Values{}
+	switch tail := q.Get("tailLines"); tail {
+	case "0": // no limit
+	case "":
+		out.Set("tailLines", strconv.Itoa(defaultTail))
+	default:
+		if n, err := strconv.Atoi(tail); err != nil || n < 0 {
+			return nil, fmt.Errorf("tailLines must be a number")
+		}
+		out.Set("tailLines", tail)
+	}
+	if c := q.Get("container"); c != "" {
+		out.Set("container", c)
+	}
+	if q.Get("previous") == "true" || q.Get("previous") == "1" {
+		out.Set("previous", "true")
+	}
+	if q.Get("timestamps") == "true" || q.Get("timestamps") == "1" {
+		out.Set("timestamps", "true")
+	}
+	if since := q.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("since must be a duration such as 30s, 10m or 2h")
+		}
+		out.Set("sinceSeconds", strconv.Itoa(int(d.Round(time.Second)/time.Second)))
+	}
+	if sinceTime := q.Get("sinceTime"); sinceTime != "" {
+		if out.Get("sinceSeconds") != "" {
+			return nil, fmt.Errorf("only one of since and sinceTime may be given")
+		}
+		if _, err := time.Parse(time.RFC3339, sinceTime); err != nil {
+			return nil, fmt.Errorf("sinceTime must be an RFC3339 time")
+		}
+		out.Set("sinceTime", sinceTime)
+	}
+	return out, nil
+}
+
+// logNamespaceAllowed applies checkNamespaceAccess to a log request and
+// writes the 403 itself.
+func logNamespaceAllowed(w http.ResponseWriter, r *http.Request, namespace string) bool {
+	user, _ := GetUserFromContext(r.Context())
+	clusterID, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if !HasRole(user.Role, "admin") && !checkNamespaceAccess(user, clusterID, namespace) {
+		http.Error(w, "Forbidden: no access to this namespace", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// labelSelectorString renders a metav1.LabelSelector in the query syntax
+// of labelSelector=.
+func labelSelectorString(sel map[string]interface{}) string {
+	var parts []string
+	for k, v := range nestedMap(sel, "matchLabels") {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+	}
+	for _, e := range nestedSlice(sel, "matchExpressions") {
+		em, _ := e.(map[string]interface{})
+		key := nestedString(em, "key")
+		var values []string
+		for _, v := range nestedSlice(em, "values") {
+			values = append(values, fmt.Sprint(v))
+		}
+		switch nestedString(em, "operator") {
+		case "In":
+			parts = append(parts, key+" in ("+strings.Join(values, ",")+")")
+		case "NotIn":
+			parts = append(parts, key+" notin ("+strings.Join(values, ",")+")")
+		case "Exists":
+			parts = append(parts, key)
+		case "DoesNotExist":
+			parts = append(parts, "!"+key)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// podLogFollower streams the logs of a set of pods to one viewer. Each
+// container is read by its own goroutine; their lines are interleaved in
+// the order they arrive. While following, a container whose stream ends
+// (it exited or restarted) is picked up again by the next discover, from
+// where its last stream ended.
+type podLogFollower struct {
+	c         *k8sClient
+	namespace string
+	list      k8sListOptions // which pods to follow
+	query     url.Values     // pods/log options
+	follow    bool
+	out       chan k8sLogMessage
+
+	mu      sync.Mutex
+	streams map[string]bool      // "pod/container" → being read (true) or finished (false)
+	ended   map[string]time.Time // "pod/container" → when its last stream ended
+	capped  bool                 // the viewer was told about k8sMaxLogStreams
+	wg      sync.WaitGroup
+}
+
+func (f *podLogFollower) send(ctx context.Context, m k8sLogMessage) bool {
+	select {
+	case f.out <- m:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// discover lists the matching pods and starts reading every container not
+// seen yet. A container whose log can't be read yet (still starting) is
+// retried on the next call.
+func (f *podLogFollower) discover(ctx context.Context) error {
+	pods, err := f.c.list(ctx, mustK8sResource("pods"), f.namespace, f.list)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		name := nestedString(pod, "metadata", "name")
+		var containers []string
+		for _, ct := range nestedSlice(pod, "spec", "containers") {
+			cm, _ := ct.(map[string]interface{})
+			if only := f.query.Get("container"); only == "" || only == nestedString(cm, "name") {
+				containers = append(containers, nestedString(cm, "name"))
+			}
+		}
+		for _, container := range containers {
+			key := name + "/" + container
+			f.mu.Lock()
+			_, seen := f.streams[key]
+			capped := !seen && f.activeLocked() >= k8sMaxLogStreams
+			notify := capped && !f.capped
+			if capped {
+				f.capped = true
+			} else if !seen {
+				f.streams[key] = true
+			}
+			f.mu.Unlock()
+			if notify {
+				f.send(ctx, k8sLogMessage{Type: "info",
+					Message: fmt.Sprintf("more containers match than the %d streamed at once; narrow the selector to see them all", k8sMaxLogStreams)})
+			}
+			if capped {
+				continue
+			}
+			if !seen {
+				f.mu.Lock()
+				since := f.ended[key]
+				f.mu.Unlock()
+				f.wg.Add(1)
+				go f.read(ctx, name, container, since)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *podLogFollower) activeLocked() int {
+	n := 0
+	for _, reading := range f.streams {
+		if reading {
+			n++
+		}
+	}
+	return n
+}
+
+// read copies one container's log to out line by line. A non-zero since
+// resumes after an earlier stream of the container ended.
+func (f *podLogFollower) read(ctx context.Context, pod, container string, since time.Time) {
+	defer f.wg.Done()
+	key := pod + "/" + container
+	q := url.Values{}
+	for k, v := range f.query {
+		q[k] = v
+	}
+	q.Set("container", container)
+	if f.follow {
+		q.Set("follow", "true")
+	}
+	if !since.IsZero() {
+		q.Del("tailLines")
+		q.Del("sinceSeconds")
+		q.Set("sinceTime", since.UTC().Format(time.RFC3339Nano))
+	}
+
+	body, err := f.c.streamPodLogs(ctx, f.namespace, pod, q)
+	if err != nil {
+		f.mu.Lock()
+		delete(f.streams, key) // retried by the next discover
+		f.mu.Unlock()
+		if ctx.Err() == nil && (!f.follow || k8sErrorCode(err) != http.StatusBadRequest) {
+			f.send(ctx, k8sLogMessage{Type: "error", Pod: pod, Container: container, Message: err.Error()})
+		}
+		return
+	}
+	defer body.Close()
+	go func() { // unblock the scanner when the viewer goes away
+		<-ctx.Done()
+		body.Close()
+	}()
+
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 64*1024), k8sMaxLogLine)
+	lines := 0
+	for sc.Scan() {
+		if !f.send(ctx, k8sLogMessage{Type: "line", Pod: pod, Container: container, Line: sc.Text()}) {
+			return
+		}
+		lines++
+	}
+	f.mu.Lock()
+	if f.follow {
+		// Forget the container so the next discover attaches to it again,
+		// e.g. to a restarted one, without repeating what was read.
+		delete(f.streams, key)
+		f.ended[key] = time.Now()
+	} else {
+		f.streams[key] = false
+	}
+	f.mu.Unlock()
+	// A crash-looping container ends an empty stream on every discover;
+	// only say so when there was something to end.
+	if ctx.Err() == nil && f.follow && lines > 0 {
+		msg := "log stream ended"
+		if err := sc.Err(); err != nil {
+			msg += ": " + err.Error()
+		}
+		f.send(ctx, k8sLogMessage{Type: "info", Pod: pod, Container: container, Message: msg})
+	}
+}
+
+// run discovers pods (again every k8sLogRelist while following) until ctx
+// ends, or, without follow, until every log has been read.
+func (f *podLogFollower) run(ctx context.Context) {
+	defer close(f.out)
+	if err := f.discover(ctx); err != nil {
+		f.send(ctx, k8sLogMessage{Type: "error", Message: err.Error()})
+	}
+	if !f.follow {
+		f.wg.Wait()
+		f.send(ctx, k8sLogMessage{Type: "end"})
+		return
+	}
+	f.mu.Lock()
+	none := len(f.streams) == 0
+	f.mu.Unlock()
+	if none {
+		f.send(ctx, k8sLogMessage{Type: "info", Message: "no running containers match yet; waiting for pods…"})
+	}
+	ticker := time.NewTicker(k8sLogRelist)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.discover(ctx); err != nil && ctx.Err() == nil {
+				f.send(ctx, k8sLogMessage{Type: "error", Message: err.Error()})
+			}
+		case <-ctx.Done():
+			f.wg.Wait()
+			return
+		}
+	}
+}
+
+// serveLogFollower upgrades the request and relays f's messages to the
+// viewer until either side ends.
+func serveLogFollower(w http.ResponseWriter, r *http.Request, f *podLogFollower) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[K8sLogs] WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	f.out = make(chan k8sLogMessage, 256)
+	f.streams = map[string]bool{}
+	f.ended = map[string]time.Time{}
+	go f.run(ctx)
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case m, ok := <-f.out:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// StreamPodLogs streams the logs of one pod's containers (all of them
+// unless container is given).
+// GET /api/k0s/clusters/{id}/k8s/pods/{name}/logs/stream (WebSocket)
+// query: namespace, container, follow (default true), previous, since, sinceTime, tailLines (default 100), timestamps
+func StreamPodLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	q := r.URL.Query()
+	namespace := q.Get("namespace")
+	if namespace == "" {
+		namespace = "default"
+	}
+	if !logNamespaceAllowed(w, r, namespace) {
+		return
+	}
+	query, err := podLogQuery(q, 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := newK8sClient(vars["id"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	// Fail with a plain HTTP status for a pod that doesn't exist.
+	if _, err := c.get(r.Context(), mustK8sResource("pods"), namespace, vars["name"]); err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	serveLogFollower(w, r, &podLogFollower{
+		c:         c,
+		namespace: namespace,
+		list:      k8sListOptions{FieldSelector: "metadata.name=" + vars["name"]},
+		query:     query,
+		follow:    q.Get("follow") != "false" && q.Get("follow") != "0" && query.Get("previous") == "",
+	})
+}
+
+// StreamAggregatedLogs streams the logs of every pod matching a label
+// selector, or selected by a workload (owner=deployments/web), including
+// pods that appear while following. Lines carry their pod and container.
+// GET /api/k0s/clusters/{id}/k8s/logs/stream (WebSocket)
+// query: namespace, selector | owner, plus the options of StreamPodLogs
+func StreamAggregatedLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	q := r.URL.Query()
+	namespace := q.Get("namespace")
+	if namespace == "" || namespace == "all" {
+		http.Error(w, "namespace is required", http.StatusBadRequest)
+		return
+	}
+	if !logNamespaceAllowed(w, r, namespace) {
+		return
+	}
+	query, err := podLogQuery(q, 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := newK8sClient(vars["id"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	selector := q.Get("selector")
+	if owner := q.Get("owner"); owner != "" {
+		if selector != "" {
+			http.Error(w, "give either selector or owner, not both", http.StatusBadRequest)
+			return
+		}
+		kind, name, ok := strings.Cut(owner, "/")
+		if !ok || name == "" {
+			http.Error(w, "owner must look like deployments/<name>", http.StatusBadRequest)
+			return
+		}
+		rs, err := c.resolveResource(r.Context(), kind)
+		if err != nil {
+			writeK8sError(w, err)
+			return
+		}
+		switch rs.Name {
+		case "deployments", "statefulsets", "daemonsets", "replicasets", "jobs":
+		default:
+			http.Error(w, "owner must be a deployment, statefulset, daemonset, replicaset or job", http.StatusBadRequest)
+			return
+		}
+		obj, err := c.get(r.Context(), rs, namespace, name)
+		if err != nil {
+			writeK8sError(w, err)
+			return
+		}
+		selector = labelSelectorString(nestedMap(obj, "spec", "selector"))
+	}
+	if selector == "" {
+		http.Error(w, "a selector or owner is required", http.StatusBadRequest)
+		return
+	}
+
+	serveLogFollower(w, r, &podLogFollower{
+		c:         c,
+		namespace: namespace,
+		list:      k8sListOptions{LabelSelector: selector},
+		query:     query,
+		follow:    q.Get("follow") != "false" && q.Get("follow") != "0" && query.Get("previous") == "",
+	})
+}
@@ -0,0 +1,748 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Port-forwarding to pods and services through the management server,
+// like "kubectl port-forward". Each forwarded TCP connection is its own
+// pods/portforward stream on the API server. A forward is reached either
+// directly over a WebSocket (PortForwardWebSocket) or through a temporary
+// TCP listener on this server (CreatePortForward) that expires after a TTL.
+// Listeners bind to loopback unless an admin asks for another address; one
+// reachable from the network only accepts its creator's IP.
+
+const (
+	portForwardDefaultTTL = time.Hour
+	portForwardMaxTTL     = 8 * time.Hour
+	// portForwardMaxPerUser caps the listeners a non-admin may hold open.
+	portForwardMaxPerUser  = 5
+	portForwardDialTimeout = 15 * time.Second
+)
+
+// podPortConn is one TCP connection to a pod port, carried over the API
+// server's WebSocket port-forward protocol (v4.channel.k8s.io). Every
+// binary message starts with its channel byte: 0 carries data, 1 carries
+// errors. The first message on each channel holds the port number (uint16,
+// little endian) and no payload.
+type podPortConn struct {
+	ws       *websocket.Conn
+	wmu      sync.Mutex
+	pending  []byte
+	seenPort [2]bool
+}
+
+// dialPodPort opens a connection to port of pod through the API server.
+func dialPodPort(ctx context.Context, c *k8sClient, namespace, pod string, port int) (*podPortConn, error) {
+	wsServer := strings.NewReplacer("https://", "wss://", "http://", "ws://").Replace(c.creds.serverURL)
+	target := fmt.Sprintf("%s%s/portforward?ports=%d", wsServer, mustK8sResource("pods").path(namespace, pod), port)
+
+	dialer := websocket.Dialer{
+		TLSClientConfig:  c.creds.tlsConfig,
+		Subprotocols:     []string{"v4.channel.k8s.io"},
+		HandshakeTimeout: portForwardDialTimeout,
+	}
+	headers := http.Header{}
+	if c.creds.bearerToken != "" {
+		headers.Set("Authorization", "Bearer "+c.creds.bearerToken)
+	}
+	ws, resp, err := dialer.DialContext(ctx, target, headers)
+	if err != nil {
+		if resp != nil {
+			defer resp.Body.Close()
+			return nil, k8sStatusError(resp)
+		}
+		return nil, k8sTransportError(err)
+	}
+	return &podPortConn{ws: ws}, nil
+}
+
+func (p *podPortConn) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		_, msg, err := p.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if len(msg) == 0 || msg[0] > 1 {
+			continue
+		}
+		channel, data := msg[0], msg[1:]
+		if !p.seenPort[channel] {
+			p.seenPort[channel] = true
+			if len(data) >= 2 {
+				data = data[2:]
+			}
+		}
+		if channel == 1 {
+			if len(data) > 0 {
+				return 0, fmt.Errorf("port-forward: %s", strings.TrimSpace(string(data)))
+			}
+			continue
+		}
+		p.pending = data
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *podPortConn) Write(b []byte) (int, error) {
+	msg := make([]byte, len(b)+1)
+	copy(msg[1:], b) // channel 0: data
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	if err := p.ws.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *podPortConn) Close() error { return p.ws.Close() }
+
+// portForwardTarget names what a forward connects to: a pod, or a service
+// whose port is mapped to a ready pod behind it.
+type portForwardTarget struct {
+	Namespace string `json:"namespace"`
+	Resource  string `json:"resource"` // pods or services
+	Name      string `json:"name"`
+	Port      string `json:"port"` // number or port name
+}
+
+// containerPortByName finds a named container port of pod.
+func containerPortByName(pod map[string]interface{}, name string) (int, bool) {
+	for _, ct := range nestedSlice(pod, "spec", "containers") {
+		cm, _ := ct.(map[string]interface{})
+		for _, p := range nestedSlice(cm, "ports") {
+			pm, _ := p.(map[string]interface{})
+			if nestedString(pm, "name") == name {
+				return int(nestedInt(pm, "containerPort")), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func podReady(pod map[string]interface{}) bool {
+	if nestedString(pod, "status", "phase") != "Running" || nestedString(pod, "metadata", "deletionTimestamp") != "" {
+		return false
+	}
+	for _, cond := range nestedSlice(pod, "status", "conditions") {
+		cm, _ := cond.(map[string]interface{})
+		if nestedString(cm, "type") == "Ready" {
+			return nestedString(cm, "status") == "True"
+		}
+	}
+	return false
+}
+
+// resolve picks the pod and pod port to connect to. Services are resolved
+// on every call, so a forward follows the service to a new pod after a
+// restart.
+func (t portForwardTarget) resolve(ctx context.Context, c *k8sClient) (string, int, error) {
+	badRequest := func(format string, args ...interface{}) error {
+		return &k8sAPIError{Code: http.StatusBadRequest, Reason: "BadRequest", Message: fmt.Sprintf(format, args...)}
+	}
+	pods := mustK8sResource("pods")
+
+	if t.Resource == "pods" {
+		pod, err := c.get(ctx, pods, t.Namespace, t.Name)
+		if err != nil {
+			return "", 0, err
+		}
+		if phase := nestedString(pod, "status", "phase"); phase != "Running" {
+			return "", 0, badRequest("pod %s is not running (phase %s)", t.Name, phase)
+		}
+		if n, err := strconv.Atoi(t.Port); err == nil {
+			return t.Name, n, nil
+		}
+		n, ok := containerPortByName(pod, t.Port)
+		if !ok {
+			return "", 0, badRequest("pod %s has no port named %q", t.Name, t.Port)
+		}
+		return t.Name, n, nil
+	}
+
+	svc, err := c.get(ctx, mustK8sResource("services"), t.Namespace, t.Name)
+	if err != nil {
+		return "", 0, err
+	}
+	var svcPort map[string]interface{}
+	for _, p := range nestedSlice(svc, "spec", "ports") {
+		pm, _ := p.(map[string]interface{})
+		if nestedString(pm, "name") == t.Port || strconv.FormatInt(nestedInt(pm, "port"), 10) == t.Port {
+			svcPort = pm
+			break
+		}
+	}
+	if svcPort == nil {
+		return "", 0, badRequest("service %s has no port %s", t.Name, t.Port)
+	}
+	selector := nestedMap(svc, "spec", "selector")
+	if len(selector) == 0 {
+		return "", 0, badRequest("service %s has no selector to find a pod with", t.Name)
+	}
+	list, err := c.list(ctx, pods, t.Namespace, k8sListOptions{LabelSelector: labelSelectorString(map[string]interface{}{"matchLabels": selector})})
+	if err != nil {
+		return "", 0, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return nestedString(list.Items[i], "metadata", "name") < nestedString(list.Items[j], "metadata", "name")
+	})
+	for _, pod := range list.Items {
+		if !podReady(pod) {
+			continue
+		}
+		name := nestedString(pod, "metadata", "name")
+		switch target := svcPort["targetPort"].(type) {
+		case nil:
+			return name, int(nestedInt(svcPort, "port")), nil
+		case string:
+			if n, ok := containerPortByName(pod, target); ok {
+				return name, n, nil
+			}
+		default:
+			return name, int(nestedInt(svcPort, "targetPort")), nil
+		}
+	}
+	return "", 0, &k8sAPIError{Code: http.StatusServiceUnavailable, Reason: "ServiceUnavailable",
+		Message: fmt.Sprintf("service %s has no ready pod serving port %s", t.Name, t.Port)}
+}
+
+// portForwardAllowed checks the caller may open forwards into namespace:
+// it takes the admin or user_k8s_full role and access to the namespace.
+// It writes the error response itself.
+func portForwardAllowed(w http.ResponseWriter, r *http.Request, namespace string) bool {
+	user, _ := GetUserFromContext(r.Context())
+	if !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_k8s_full") {
+		http.Error(w, "port-forwarding requires the user_k8s_full role", http.StatusForbidden)
+		return false
+	}
+	clusterID, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if !HasRole(user.Role, "admin") && !checkNamespaceAccess(user, clusterID, namespace) {
+		http.Error(w, "Forbidden: no access to this namespace", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// PortForwardWebSocket tunnels one TCP connection to a pod or service port
+// over a WebSocket: binary messages carry the raw bytes in both directions.
+// GET /api/k0s/clusters/{id}/k8s/{resource:pods|services}/{name}/portforward?namespace=default&port=8080 (WebSocket)
+func PortForwardWebSocket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	t := portForwardTarget{
+		Namespace: r.URL.Query().Get("namespace"),
+		Resource:  vars["resource"],
+		Name:      vars["name"],
+		Port:      r.URL.Query().Get("port"),
+	}
+	if t.Namespace == "" {
+		t.Namespace = "default"
+	}
+	if t.Port == "" {
+		http.Error(w, "port is required", http.StatusBadRequest)
+		return
+	}
+	if !portForwardAllowed(w, r, t.Namespace) {
+		return
+	}
+	c, err := newK8sClient(vars["id"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	// Connect to the pod before upgrading, so failures get a plain HTTP status.
+	ctx, cancel := context.WithTimeout(r.Context(), portForwardDialTimeout)
+	pod, port, err := t.resolve(ctx, c)
+	var upstream *podPortConn
+	if err == nil {
+		upstream, err = dialPodPort(ctx, c, t.Namespace, pod, port)
+	}
+	cancel()
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	defer upstream.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[PortForward] WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	user, _ := GetUserFromContext(r.Context())
+	recordActivityLog("k8s_port_forward", fmt.Sprintf("cluster %s: %s/%s/%s:%s", vars["id"], t.Namespace, t.Resource, t.Name, t.Port),
+		fmt.Sprintf("WebSocket tunnel to pod %s port %d by %s", pod, port, user.Username), "success")
+
+	done := make(chan struct{}, 2)
+	go func() { // pod → viewer
+		defer func() { done <- struct{}{} }()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := upstream.Read(buf)
+			if n > 0 {
+				if conn.WriteMessage(websocket.BinaryMessage, buf[:n]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				msg := ""
+				if err != io.EOF {
+					msg = err.Error()
+				}
+				if len(msg) > 120 { // control frames carry at most 125 bytes
+					msg = msg[:120]
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, msg))
+				return
+			}
+		}
+	}()
+	go func() { // viewer → pod
+		defer func() { done <- struct{}{} }()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, err := upstream.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+	<-done
+}
+
+// PortForward describes a temporary TCP listener on the management server
+// that forwards every connection it accepts to a pod or service port.
+type PortForward struct {
+	ID        string `json:"id"`
+	ClusterID string `json:"cluster_id"`
+	portForwardTarget
+	LocalPort   int       `json:"local_port"`
+	Address     string    `json:"address"`                // host:port to connect to
+	AllowedFrom string    `json:"allowed_from,omitempty"` // the only client IP accepted, for non-loopback binds
+	Owner       string    `json:"owner"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Active      int64     `json:"active_connections"`
+	Connections int64     `json:"total_connections"`
+}
+
+// portForwardListener is an open PortForward.
+type portForwardListener struct {
+	info          PortForward
+	active, total int64 // connections, updated atomically
+
+	c         *k8sClient
+	allowedIP net.IP // nil: any client (loopback binds)
+	listener  net.Listener
+	timer     *time.Timer
+	mu        sync.Mutex
+	conns     map[net.Conn]bool
+	closed    bool
+}
+
+var (
+	portForwardsMu sync.Mutex
+	portForwards   = map[string]*portForwardListener{}
+)
+
+// portForwardBindAddress is the interface listeners bind to by default:
+// loopback, or PORT_FORWARD_BIND_ADDRESS when the operator sets it (e.g.
+// 0.0.0.0 so developers can reach forwarded ports from their machines).
+func portForwardBindAddress() string {
+	if addr := os.Getenv("PORT_FORWARD_BIND_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "127.0.0.1"
+}
+
+// isLoopbackAddress reports whether a bind address is only reachable from
+// this host.
+func isLoopbackAddress(addr string) bool {
+	if addr == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// portForwardTrustedProxies parses PORT_FORWARD_TRUSTED_PROXIES, a
+// comma-separated list of IPs or CIDRs of the reverse proxies in front of
+// the server. Requests from them are attributed to the client named in
+// their X-Forwarded-For (or X-Real-IP) header.
+func portForwardTrustedProxies() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("PORT_FORWARD_TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("[PortForward] ignoring invalid trusted proxy %q", entry)
+				continue
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("[PortForward] ignoring invalid trusted proxy %q", entry)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func ipTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIP is the address the request came from. When the peer is a
+// trusted proxy, it is the right-most X-Forwarded-For entry that isn't
+// itself a trusted proxy, or X-Real-IP if there is no X-Forwarded-For.
+func requestIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	trusted := portForwardTrustedProxies()
+	if ip == nil || !ipTrusted(ip, trusted) {
+		return ip
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				return nil
+			}
+			if !ipTrusted(hop, trusted) {
+				return hop
+			}
+		}
+		return nil
+	}
+	if real := r.Header.Get("X-Real-IP"); real != "" {
+		return net.ParseIP(strings.TrimSpace(real))
+	}
+	return ip
+}
+
+// serve accepts connections until the listener is closed.
+func (f *portForwardListener) serve() {
+	for {
+		client, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		if f.allowedIP != nil {
+			if addr, ok := client.RemoteAddr().(*net.TCPAddr); !ok || !addr.IP.Equal(f.allowedIP) {
+				log.Printf("[PortForward] %s: refused connection from %s", f.info.ID, client.RemoteAddr())
+				client.Close()
+				continue
+			}
+		}
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			client.Close()
+			return
+		}
+		f.conns[client] = true
+		f.mu.Unlock()
+		atomic.AddInt64(&f.active, 1)
+		atomic.AddInt64(&f.total, 1)
+		go f.handle(client)
+	}
+}
+
+// handle forwards one accepted connection until either side closes it.
+func (f *portForwardListener) handle(client net.Conn) {
+	defer func() {
+		client.Close()
+		f.mu.Lock()
+		delete(f.conns, client)
+		f.mu.Unlock()
+		atomic.AddInt64(&f.active, -1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), portForwardDialTimeout)
+	pod, port, err := f.info.resolve(ctx, f.c)
+	var upstream *podPortConn
+	if err == nil {
+		upstream, err = dialPodPort(ctx, f.c, f.info.Namespace, pod, port)
+	}
+	cancel()
+	if err != nil {
+		log.Printf("[PortForward] %s: %s: %v", f.info.ID, client.RemoteAddr(), err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(client, upstream) //nolint:errcheck
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(upstream, client) //nolint:errcheck
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// close stops the listener and drops its open connections.
+func (f *portForwardListener) close(reason string) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	f.timer.Stop()
+	f.listener.Close()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.mu.Unlock()
+
+	portForwardsMu.Lock()
+	delete(portForwards, f.info.ID)
+	portForwardsMu.Unlock()
+	log.Printf("[PortForward] %s closed (%s)", f.info.ID, reason)
+}
+
+// snapshot returns the forward's description with current counters.
+func (f *portForwardListener) snapshot() PortForward {
+	info := f.info
+	info.Active = atomic.LoadInt64(&f.active)
+	info.Connections = atomic.LoadInt64(&f.total)
+	return info
+}
+
+// CreatePortForward opens a temporary listener on the management server
+// forwarding to a pod or service port until it expires or is deleted. It
+// binds to portForwardBindAddress; only admins may pass bind_address to
+// choose another interface. A listener that isn't on loopback accepts
+// connections from the creator's IP only, as reported by requestIP, so
+// deployments behind a reverse proxy need PORT_FORWARD_TRUSTED_PROXIES.
+// POST /api/k0s/clusters/{id}/port-forwards
+// body: {"namespace":"default","resource":"services","name":"web","port":"8080","local_port":0,"ttl_minutes":60,"bind_address":""}
+func CreatePortForward(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["id"]
+	var req struct {
+		portForwardTarget
+		LocalPort   int    `json:"local_port"`
+		TTLMinutes  int    `json:"ttl_minutes"`
+		BindAddress string `json:"bind_address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Namespace == "" {
+		req.Namespace = "default"
+	}
+	if req.Resource == "" {
+		req.Resource = "pods"
+	}
+	switch {
+	case req.Resource != "pods" && req.Resource != "services":
+		http.Error(w, "resource must be pods or services", http.StatusBadRequest)
+		return
+	case req.Name == "" || req.Port == "":
+		http.Error(w, "name and port are required", http.StatusBadRequest)
+		return
+	case req.LocalPort != 0 && (req.LocalPort < 1024 || req.LocalPort > 65535):
+		http.Error(w, "local_port must be between 1024 and 65535 (or 0 for any free port)", http.StatusBadRequest)
+		return
+	}
+	ttl := portForwardDefaultTTL
+	if req.TTLMinutes > 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+	if ttl > portForwardMaxTTL {
+		http.Error(w, fmt.Sprintf("ttl_minutes may be at most %d", int(portForwardMaxTTL/time.Minute)), http.StatusBadRequest)
+		return
+	}
+	if !portForwardAllowed(w, r, req.Namespace) {
+		return
+	}
+
+	user, _ := GetUserFromContext(r.Context())
+	bind := portForwardBindAddress()
+	if req.BindAddress != "" {
+		if !HasRole(user.Role, "admin") {
+			http.Error(w, "only admins may choose the bind address", http.StatusForbidden)
+			return
+		}
+		if req.BindAddress != "localhost" && net.ParseIP(req.BindAddress) == nil {
+			http.Error(w, "bind_address must be an IP address", http.StatusBadRequest)
+			return
+		}
+		bind = req.BindAddress
+	}
+	var allowedIP net.IP
+	if !isLoopbackAddress(bind) {
+		if allowedIP = requestIP(r); allowedIP == nil {
+			http.Error(w, "cannot tell the client address to restrict the listener to", http.StatusBadRequest)
+			return
+		}
+	}
+	if !HasRole(user.Role, "admin") {
+		held := 0
+		portForwardsMu.Lock()
+		for _, f := range portForwards {
+			if f.info.Owner == user.Username {
+				held++
+			}
+		}
+		portForwardsMu.Unlock()
+		if held >= portForwardMaxPerUser {
+			http.Error(w, fmt.Sprintf("you already have %d port-forwards open; close one first", held), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	// Check the target now, so a typo fails here and not on first use.
+	if _, _, err := req.portForwardTarget.resolve(r.Context(), c); err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(req.LocalPort)))
+	if err != nil {
+		http.Error(w, "Failed to open listener: "+err.Error(), http.StatusConflict)
+		return
+	}
+	localPort := listener.Addr().(*net.TCPAddr).Port
+	host := bind
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+	}
+
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+	now := time.Now().UTC()
+	f := &portForwardListener{
+		info: PortForward{
+			ID:                hex.EncodeToString(idBytes),
+			ClusterID:         clusterID,
+			portForwardTarget: req.portForwardTarget,
+			LocalPort:         localPort,
+			Address:           net.JoinHostPort(host, strconv.Itoa(localPort)),
+			Owner:             user.Username,
+			CreatedAt:         now,
+			ExpiresAt:         now.Add(ttl),
+		},
+		c:         c,
+		allowedIP: allowedIP,
+		listener:  listener,
+		conns:     map[net.Conn]bool{},
+	}
+	if allowedIP != nil {
+		f.info.AllowedFrom = allowedIP.String()
+	}
+	f.timer = time.AfterFunc(ttl, func() { f.close("expired") })
+	portForwardsMu.Lock()
+	portForwards[f.info.ID] = f
+	portForwardsMu.Unlock()
+	go f.serve()
+
+	info := f.snapshot()
+	target := fmt.Sprintf("cluster %s: %s/%s/%s:%s", clusterID, info.Namespace, info.Resource, info.Name, info.Port)
+	recordActivityLog("k8s_port_forward", target,
+		fmt.Sprintf("listener on %s for %s by %s", net.JoinHostPort(bind, strconv.Itoa(localPort)), ttl, user.Username), "success")
+	log.Printf("[PortForward] %s: %s → %s (expires %s)", info.ID, info.Address, target, info.ExpiresAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// ListPortForwards lists a cluster's open listeners: all of them for
+// admins, the caller's own otherwise.
+// GET /api/k0s/clusters/{id}/port-forwards
+func ListPortForwards(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["id"]
+	user, _ := GetUserFromContext(r.Context())
+	out := []PortForward{}
+	portForwardsMu.Lock()
+	for _, f := range portForwards {
+		if f.info.ClusterID == clusterID && (HasRole(user.Role, "admin") || f.info.Owner == user.Username) {
+			out = append(out, f.snapshot())
+		}
+	}
+	portForwardsMu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// DeletePortForward closes a listener before it expires. Only its owner
+// or an admin may close it.
+// DELETE /api/k0s/clusters/{id}/port-forwards/{forwardId}
+func DeletePortForward(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	portForwardsMu.Lock()
+	f := portForwards[vars["forwardId"]]
+	portForwardsMu.Unlock()
+	user, _ := GetUserFromContext(r.Context())
+	if f == nil || f.info.ClusterID != vars["id"] || (!HasRole(user.Role, "admin") && f.info.Owner != user.Username) {
+		http.Error(w, "Port-forward not found", http.StatusNotFound)
+		return
+	}
+	f.close("closed by " + user.Username)
+	recordActivityLog("k8s_port_forward_close",
+		fmt.Sprintf("cluster %s: %s/%s/%s:%s", f.info.ClusterID, f.info.Namespace, f.info.Resource, f.info.Name, f.info.Port),
+		fmt.Sprintf("listener on port %d closed by %s", f.info.LocalPort, user.Username), "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
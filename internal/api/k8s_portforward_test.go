@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequestIP(t *testing.T) {
+	t.Setenv("PORT_FORWARD_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.5")
+	tests := []struct {
+		remote, xff, realIP string
+		want                string
+	}{
+		{"203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"203.0.113.7:5000", "198.51.100.1", "", "203.0.113.7"},
+		{"10.0.0.2:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"10.0.0.2:5000", "1.2.3.4, 198.51.100.1, 10.0.0.9", "", "198.51.100.1"},
+		{"192.168.1.5:5000", "", "198.51.100.2", "198.51.100.2"},
+		{"10.0.0.2:5000", "", "", "10.0.0.2"},
+		{"10.0.0.2:5000", "10.0.0.3", "", "<nil>"},
+		{"10.0.0.2:5000", "not-an-ip", "", "<nil>"},
+	}
+	for _, tt := range tests {
+		r := &http.Request{RemoteAddr: tt.remote, Header: http.Header{}}
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := requestIP(r).String(); got != tt.want {
+			t.Errorf("requestIP(%s, xff=%q, real=%q) = %s, want %s", tt.remote, tt.xff, tt.realIP, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Live resource views. One shared informer per cluster and resource kind
+// lists the collection once and keeps it current with a watch stream; any
+// number of browsers subscribe to it over WebSocket and receive the current
+// items followed by ADDED / MODIFIED / DELETED deltas, filtered to the
+// namespaces they may see.
+
+const (
+	// k8sWatchTimeout is the server-side timeout of one watch request;
+	// the informer re-watches from the last resourceVersion afterwards.
+	k8sWatchTimeout = 5 * time.Minute
+	// k8sResyncInterval forces a full relist now and then, so changes a
+	// watch might have missed still reach the viewers.
+	k8sResyncInterval = 30 * time.Minute
+	// k8sInformerIdle is how long an informer keeps watching after its
+	// last viewer left, so a page reload does not restart it.
+	k8sInformerIdle = 30 * time.Second
+)
+
+// errK8sWatchExpired means the informer's resourceVersion is too old to
+// watch from (410 Gone) and the collection must be listed again.
+var errK8sWatchExpired = errors.New("watch resourceVersion expired")
+
+// k8sWatchEvent is one message sent to a viewer. The first message is a
+// SYNC carrying the full item list; ERROR reports that the upstream watch
+// is failing (the view may be stale until it recovers).
+type k8sWatchEvent struct {
+	Type            string                   `json:"type"`
+	Object          map[string]interface{}   `json:"object,omitempty"`
+	Items           []map[string]interface{} `json:"items,omitempty"`
+	ResourceVersion string                   `json:"resourceVersion,omitempty"`
+	Message         string                   `json:"message,omitempty"`
+}
+
+// k8sWatcher is one viewer of an informer.
+type k8sWatcher struct {
+	ch      chan k8sWatchEvent
+	visible func(namespace string) bool
+}
+
+// k8sInformer mirrors one resource kind of one cluster, across all
+// namespaces.
+type k8sInformer struct {
+	key       string
+	clusterID string
+	rs        k8sResource
+	cancel    context.CancelFunc
+
+	mu              sync.Mutex
+	store           map[string]map[string]interface{} // "namespace/name" → object
+	resourceVersion string
+	synced          bool
+	err             error // last failure, reported to viewers before the first sync
+	readyOnce       sync.Once
+	ready           chan struct{} // closed after the first list attempt
+	watchers        map[*k8sWatcher]struct{}
+
+	// refs and idle are guarded by k8sInformersMu.
+	refs int
+	idle *time.Timer
+}
+
+var (
+	k8sInformersMu sync.Mutex
+	k8sInformers   = map[string]*k8sInformer{}
+)
+
+// acquireK8sInformer returns the running informer for a cluster and
+// resource, starting one if needed. Callers release it when done.
+func acquireK8sInformer(clusterID string, rs k8sResource) *k8sInformer {
+	key := clusterID + "/" + rs.Group + "/" + rs.Name
+	k8sInformersMu.Lock()
+	defer k8sInformersMu.Unlock()
+	inf := k8sInformers[key]
+	if inf == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		inf = &k8sInformer{
+			key:       key,
+			clusterID: clusterID,
+			rs:        rs,
+			cancel:    cancel,
+			store:     map[string]map[string]interface{}{},
+			ready:     make(chan struct{}),
+			watchers:  map[*k8sWatcher]struct{}{},
+		}
+		k8sInformers[key] = inf
+		log.Printf("[K8sWatch] starting informer %s", key)
+		go inf.run(ctx)
+	}
+	inf.refs++
+	if inf.idle != nil {
+		inf.idle.Stop()
+		inf.idle = nil
+	}
+	return inf
+}
+
+// release drops a reference; the informer stops once it has been unused
+// for k8sInformerIdle.
+func (inf *k8sInformer) release() {
+	k8sInformersMu.Lock()
+	defer k8sInformersMu.Unlock()
+	inf.refs--
+	if inf.refs > 0 {
+		return
+	}
+	inf.idle = time.AfterFunc(k8sInformerIdle, func() {
+		k8sInformersMu.Lock()
+		defer k8sInformersMu.Unlock()
+		if inf.refs == 0 && k8sInformers[inf.key] == inf {
+			delete(k8sInformers, inf.key)
+			inf.cancel()
+			log.Printf("[K8sWatch] stopped idle informer %s", inf.key)
+		}
+	})
+}
+
+// subscribe waits for the first list and registers a viewer. It returns
+// the SYNC event with the items visible to it; deltas follow on the
+// watcher's channel.
+func (inf *k8sInformer) subscribe(ctx context.Context, visible func(string) bool) (*k8sWatcher, k8sWatchEvent, error) {
+	select {
+	case <-inf.ready:
+	case <-ctx.Done():
+		return nil, k8sWatchEvent{}, ctx.Err()
+	}
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	if !inf.synced {
+		return nil, k8sWatchEvent{}, inf.err
+	}
+	w := &k8sWatcher{ch: make(chan k8sWatchEvent, 256), visible: visible}
+	inf.watchers[w] = struct{}{}
+
+	keys := make([]string, 0, len(inf.store))
+	for key, obj := range inf.store {
+		if visible(nestedString(obj, "metadata", "namespace")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	items := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, inf.store[key])
+	}
+	return w, k8sWatchEvent{Type: "SYNC", Items: items, ResourceVersion: inf.resourceVersion}, nil
+}
+
+func (inf *k8sInformer) unsubscribe(w *k8sWatcher) {
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	if _, ok := inf.watchers[w]; ok {
+		delete(inf.watchers, w)
+		close(w.ch)
+	}
+}
+
+// broadcastLocked sends an event to every viewer that may see it. A viewer
+// that can't keep up is dropped; its channel closes and it resubscribes to
+// get a fresh SYNC. Callers hold inf.mu.
+func (inf *k8sInformer) broadcastLocked(ev k8sWatchEvent) {
+	for w := range inf.watchers {
+		if ev.Object != nil && !w.visible(nestedString(ev.Object, "metadata", "namespace")) {
+			continue
+		}
+		select {
+		case w.ch <- ev:
+		default:
+			delete(inf.watchers, w)
+			close(w.ch)
+		}
+	}
+}
+
+// run lists and watches until the informer is stopped, relisting after an
+// expired resourceVersion, a failure or each resync interval.
+func (inf *k8sInformer) run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		c, err := newK8sClient(inf.clusterID)
+		if err == nil {
+			err = inf.relist(ctx, c)
+		}
+		if err == nil {
+			backoff = time.Second
+			err = inf.watchUntilResync(ctx, c)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		log.Printf("[K8sWatch] informer %s: %v (retrying in %s)", inf.key, err, backoff)
+		inf.fail(err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// fail records a list/watch failure and tells the viewers about it.
+func (inf *k8sInformer) fail(err error) {
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	inf.err = err
+	inf.readyOnce.Do(func() { close(inf.ready) })
+	inf.broadcastLocked(k8sWatchEvent{Type: "ERROR", Message: err.Error()})
+}
+
+// relist reads the whole collection. After the first sync, the difference
+// to the previous contents is sent to the viewers as deltas, so they stay
+// consistent without reloading.
+func (inf *k8sInformer) relist(ctx context.Context, c *k8sClient) error {
+	list, err := c.list(ctx, inf.rs, "", k8sListOptions{})
+	if err != nil {
+		return err
+	}
+	fresh := make(map[string]map[string]interface{}, len(list.Items))
+	for _, item := range list.Items {
+		fresh[k8sObjectKey(item)] = item
+	}
+
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	if inf.synced {
+		for key, old := range inf.store {
+			if _, ok := fresh[key]; !ok {
+				inf.broadcastLocked(k8sWatchEvent{Type: "DELETED", Object: old})
+			}
+		}
+		for key, obj := range fresh {
+			old, ok := inf.store[key]
+			switch {
+			case !ok:
+				inf.broadcastLocked(k8sWatchEvent{Type: "ADDED", Object: obj})
+			case nestedString(old, "metadata", "resourceVersion") != nestedString(obj, "metadata", "resourceVersion"):
+				inf.broadcastLocked(k8sWatchEvent{Type: "MODIFIED", Object: obj})
+			}
+		}
+	}
+	inf.store = fresh
+	inf.resourceVersion = list.Metadata.ResourceVersion
+	inf.synced = true
+	inf.err = nil
+	inf.readyOnce.Do(func() { close(inf.ready) })
+	return nil
+}
+
+// watchUntilResync re-opens the watch from the last seen resourceVersion
+// whenever the API server ends it, until the resync interval is up (nil)
+// or the watch fails.
+func (inf *k8sInformer) watchUntilResync(ctx context.Context, c *k8sClient) error {
+	deadline := time.Now().Add(k8sResyncInterval)
+	for time.Now().Before(deadline) {
+		if err := inf.watchOnce(ctx, c); err != nil {
+			if err == errK8sWatchExpired {
+				log.Printf("[K8sWatch] informer %s: resourceVersion expired, relisting", inf.key)
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// watchOnce reads one watch stream to its end.
+func (inf *k8sInformer) watchOnce(ctx context.Context, c *k8sClient) error {
+	inf.mu.Lock()
+	rv := inf.resourceVersion
+	inf.mu.Unlock()
+
+	resp, err := c.watch(ctx, inf.rs, "", rv, k8sWatchTimeout)
+	if err != nil {
+		if k8sErrorCode(err) == http.StatusGone {
+			return errK8sWatchExpired
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev struct {
+			Type   string                 `json:"type"`
+			Object map[string]interface{} `json:"object"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return k8sTransportError(err)
+		}
+		switch ev.Type {
+		case "BOOKMARK":
+			inf.mu.Lock()
+			inf.resourceVersion = nestedString(ev.Object, "metadata", "resourceVersion")
+			inf.mu.Unlock()
+		case "ERROR":
+			code, _ := ev.Object["code"].(float64)
+			if int(code) == http.StatusGone {
+				return errK8sWatchExpired
+			}
+			return &k8sAPIError{Code: int(code), Reason: nestedString(ev.Object, "reason"), Message: nestedString(ev.Object, "message")}
+		case "ADDED", "MODIFIED", "DELETED":
+			inf.apply(ev.Type, ev.Object)
+		}
+	}
+}
+
+// apply folds one watch event into the store and forwards it.
+func (inf *k8sInformer) apply(eventType string, obj map[string]interface{}) {
+	if obj["apiVersion"] == nil {
+		obj["apiVersion"] = inf.rs.apiVersion()
+	}
+	if obj["kind"] == nil {
+		obj["kind"] = inf.rs.Kind
+	}
+	key := k8sObjectKey(obj)
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	if eventType == "DELETED" {
+		delete(inf.store, key)
+	} else {
+		inf.store[key] = obj
+	}
+	if rv := nestedString(obj, "metadata", "resourceVersion"); rv != "" {
+		inf.resourceVersion = rv
+	}
+	inf.broadcastLocked(k8sWatchEvent{Type: eventType, Object: obj})
+}
+
+// k8sObjectKey identifies an object within a resource kind.
+func k8sObjectKey(obj map[string]interface{}) string {
+	return nestedString(obj, "metadata", "namespace") + "/" + nestedString(obj, "metadata", "name")
+}
+
+// WatchClusterResources streams a resource kind over WebSocket: a SYNC
+// message with the current items, then ADDED / MODIFIED / DELETED deltas.
+// Non-admin users only see their assigned namespaces.
+// GET /api/k0s/clusters/{id}/k8s/watch/{resource}?namespace=xxx (WebSocket)
+func WatchClusterResources(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+	clusterIDInt, _ := strconv.Atoi(clusterID)
+
+	// Fail with a plain HTTP status while we still can.
+	c, err := newK8sClient(clusterID)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	rs, err := c.resolveResource(r.Context(), vars["resource"])
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "all" || !rs.Namespaced {
+		namespace = ""
+	}
+	if !resourceAccessAllowed(w, r, clusterIDInt, rs, namespace) {
+		return
+	}
+	visible := func(ns string) bool { return namespace == "" || ns == namespace }
+	user, ok := GetUserFromContext(r.Context())
+	if ok && !HasRole(user.Role, "admin") && rs.Namespaced && namespace == "" {
+		assigned, err := assignedNamespaceSet(user, clusterIDInt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		visible = func(ns string) bool { return assigned[ns] }
+	}
+	inf := acquireK8sInformer(clusterID, rs)
+	defer inf.release()
+	watcher, syncEv, err := inf.subscribe(r.Context(), visible)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	defer inf.unsubscribe(watcher)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[K8sWatch] WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(syncEv); err != nil {
+		return
+	}
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case ev, ok := <-watcher.ch:
+			if !ok {
+				// Dropped for falling behind: the client reconnects for a new SYNC.
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "resync required"))
+				return
+			}
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
@@ -0,0 +1,854 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// Day-2 operations on workloads and nodes, following the kubectl commands
+// of the same names: scale, rollout restart/status/history/undo, cronjob
+// suspend/resume/trigger, and node cordon/uncordon/drain. Changes need the
+// admin or user_k8s_full role (nodes: admin only) and are audited.
+
+// workloadTarget resolves the object of a workload action and checks the
+// caller may perform it. Read-only actions (write false) are open to
+// user_k8s_view; changes need admin or user_k8s_full. kinds lists the
+// resources the action supports. It writes the error response itself.
+func workloadTarget(w http.ResponseWriter, r *http.Request, write bool, kinds ...string) (*k8sClient, k8sResource, string, string, bool) {
+	user, ok := GetUserFromContext(r.Context())
+	if write && ok && !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_k8s_full") {
+		http.Error(w, "this action requires the user_k8s_full role", http.StatusForbidden)
+		return nil, k8sResource{}, "", "", false
+	}
+	c, rs, namespace, allowed := resolveNamedResource(w, r)
+	if !allowed {
+		return nil, k8sResource{}, "", "", false
+	}
+	for _, k := range kinds {
+		if rs.Name == k {
+			return c, rs, namespace, mux.Vars(r)["name"], true
+		}
+	}
+	http.Error(w, fmt.Sprintf("this action is not supported for %s", rs.Name), http.StatusBadRequest)
+	return nil, k8sResource{}, "", "", false
+}
+
+// auditWorkloadAction records a workload action in the activity log.
+func auditWorkloadAction(r *http.Request, action string, rs k8sResource, namespace, name, details string, err error) {
+	user, _ := GetUserFromContext(r.Context())
+	target := "cluster " + mux.Vars(r)["id"] + ": " + rs.Name + "/" + name
+	if namespace != "" {
+		target = "cluster " + mux.Vars(r)["id"] + ": " + namespace + "/" + rs.Name + "/" + name
+	}
+	if details != "" {
+		details += " "
+	}
+	details += "by " + user.Username
+	if err != nil {
+		recordActivityLog("k8s_"+action, target, details+": "+err.Error(), "error")
+		return
+	}
+	recordActivityLog("k8s_"+action, target, details, "success")
+}
+
+// ── Scale / restart ─────────────────────────────────────────────────────────
+
+// ScaleWorkload sets the replica count through the scale subresource.
+// POST /api/k0s/clusters/{id}/k8s/{resource}/{name}/scale   body: {"replicas":3}
+func ScaleWorkload(w http.ResponseWriter, r *http.Request) {
+	c, rs, namespace, name, ok := workloadTarget(w, r, true, "deployments", "statefulsets", "replicasets")
+	if !ok {
+		return
+	}
+	var body struct {
+		Replicas *int `json:"replicas"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Replicas == nil || *body.Replicas < 0 {
+		http.Error(w, "replicas must be a number >= 0", http.StatusBadRequest)
+		return
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"replicas": *body.Replicas}})
+	var scale map[string]interface{}
+	err := c.call(r.Context(), http.MethodPatch, rs.path(namespace, name)+"/scale", nil, k8sMergePatch, patch, &scale)
+	auditWorkloadAction(r, "scale", rs, namespace, name, fmt.Sprintf("to %d replicas", *body.Replicas), err)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"replicas": *body.Replicas,
+		"output":   fmt.Sprintf("%s/%s scaled", strings.TrimSuffix(rs.Name, "s"), name),
+	})
+}
+
+// RestartWorkload triggers a rolling restart by stamping the pod template,
+// like "kubectl rollout restart".
+// POST /api/k0s/clusters/{id}/k8s/{resource}/{name}/restart
+func RestartWorkload(w http.ResponseWriter, r *http.Request) {
+	c, rs, namespace, name, ok := workloadTarget(w, r, true, "deployments", "statefulsets", "daemonsets")
+	if !ok {
+		return
+	}
+	obj, err := c.get(r.Context(), rs, namespace, name)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	if paused, _ := nestedMap(obj, "spec")["paused"].(bool); paused {
+		http.Error(w, "can't restart a paused deployment (resume it first)", http.StatusConflict)
+		return
+	}
+
+	patch := map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{
+			"kubectl.kubernetes.io/restartedAt": time.Now().Format(time.RFC3339),
+		}},
+	}}}
+	_, err = c.patch(r.Context(), rs, namespace, name, k8sStrategicPatch, patch)
+	auditWorkloadAction(r, "rollout_restart", rs, namespace, name, "", err)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"output":  fmt.Sprintf("%s/%s restarted", strings.TrimSuffix(rs.Name, "s"), name),
+	})
+}
+
+// ── Rollouts ────────────────────────────────────────────────────────────────
+
+// rolloutStatus evaluates a workload's rollout the way "kubectl rollout
+// status" does, without waiting. failed is set when the rollout has given
+// up and will not finish on its own.
+func rolloutStatus(rs k8sResource, obj map[string]interface{}) (done, failed bool, message string) {
+	name := nestedString(obj, "metadata", "name")
+	generation := nestedInt(obj, "metadata", "generation")
+	observed := nestedInt(obj, "status", "observedGeneration")
+
+	switch rs.Name {
+	case "deployments":
+		if generation > observed {
+			return false, false, "Waiting for deployment spec update to be observed..."
+		}
+		for _, cond := range nestedSlice(obj, "status", "conditions") {
+			cm, _ := cond.(map[string]interface{})
+			if nestedString(cm, "type") == "Progressing" && nestedString(cm, "reason") == "ProgressDeadlineExceeded" {
+				return false, true, fmt.Sprintf("deployment %q exceeded its progress deadline", name)
+			}
+		}
+		replicas := int64(1)
+		if _, set := nestedMap(obj, "spec")["replicas"]; set {
+			replicas = nestedInt(obj, "spec", "replicas")
+		}
+		updated := nestedInt(obj, "status", "updatedReplicas")
+		total := nestedInt(obj, "status", "replicas")
+		available := nestedInt(obj, "status", "availableReplicas")
+		switch {
+		case updated < replicas:
+			return false, false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...", name, updated, replicas)
+		case total > updated:
+			return false, false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...", name, total-updated)
+		case available < updated:
+			return false, false, fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...", name, available, updated)
+		}
+		return true, false, fmt.Sprintf("deployment %q successfully rolled out", name)
+
+	case "statefulsets":
+		if observed == 0 || generation > observed {
+			return false, false, "Waiting for statefulset spec update to be observed..."
+		}
+		if nestedString(obj, "spec", "updateStrategy", "type") == "OnDelete" {
+			return true, false, "rollout status is only available for RollingUpdate strategy type"
+		}
+		replicas := nestedInt(obj, "spec", "replicas")
+		if ready := nestedInt(obj, "status", "readyReplicas"); ready < replicas {
+			return false, false, fmt.Sprintf("Waiting for %d pods to be ready...", replicas-ready)
+		}
+		updated := nestedInt(obj, "status", "updatedReplicas")
+		if partition := nestedInt(obj, "spec", "updateStrategy", "rollingUpdate", "partition"); partition > 0 {
+			if updated < replicas-partition {
+				return false, false, fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated...", updated, replicas-partition)
+			}
+			return true, false, fmt.Sprintf("partitioned roll out complete: %d new pods have been updated...", updated)
+		}
+		updateRevision := nestedString(obj, "status", "updateRevision")
+		if nestedString(obj, "status", "currentRevision") != updateRevision {
+			return false, false, fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s...", updated, updateRevision)
+		}
+		return true, false, fmt.Sprintf("statefulset rolling update complete %d pods at revision %s...", nestedInt(obj, "status", "currentReplicas"), updateRevision)
+
+	default: // daemonsets
+		if nestedString(obj, "spec", "updateStrategy", "type") == "OnDelete" {
+			return true, false, "rollout status is only available for RollingUpdate strategy type"
+		}
+		if generation > observed {
+			return false, false, "Waiting for daemon set spec update to be observed..."
+		}
+		desired := nestedInt(obj, "status", "desiredNumberScheduled")
+		updated := nestedInt(obj, "status", "updatedNumberScheduled")
+		available := nestedInt(obj, "status", "numberAvailable")
+		switch {
+		case updated < desired:
+			return false, false, fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated...", name, updated, desired)
+		case available < desired:
+			return false, false, fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d of %d updated pods are available...", name, available, desired)
+		}
+		return true, false, fmt.Sprintf("daemon set %q successfully rolled out", name)
+	}
+}
+
+// GetRolloutStatus reports whether a workload's rollout has finished.
+// GET /api/k0s/clusters/{id}/k8s/{resource}/{name}/rollout-status
+func GetRolloutStatus(w http.ResponseWriter, r *http.Request) {
+	c, rs, namespace, name, ok := workloadTarget(w, r, false, "deployments", "statefulsets", "daemonsets")
+	if !ok {
+		return
+	}
+	obj, err := c.get(r.Context(), rs, namespace, name)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	done, failed, message := rolloutStatus(rs, obj)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"done": done, "failed": failed, "message": message})
+}
+
+// rolloutRevision is one entry of a workload's revision history. Template
+// is the pod template (deployments) or template patch (statefulsets and
+// daemonsets) that undo restores.
+type rolloutRevision struct {
+	Revision    int64                  `json:"revision"`
+	Name        string                 `json:"name"`
+	ChangeCause string                 `json:"change_cause"`
+	Images      []string               `json:"images"`
+	Created     string                 `json:"created"`
+	Current     bool                   `json:"current"`
+	Template    map[string]interface{} `json:"-"`
+}
+
+// rolloutHistory lists the revisions of a workload, oldest first: the
+// ReplicaSets of a deployment, or the ControllerRevisions of a statefulset
+// or daemonset.
+func rolloutHistory(ctx context.Context, c *k8sClient, rs k8sResource, obj map[string]interface{}) ([]rolloutRevision, error) {
+	namespace := nestedString(obj, "metadata", "namespace")
+	uid := nestedString(obj, "metadata", "uid")
+	ownedBy := func(item map[string]interface{}) bool {
+		for _, o := range nestedSlice(item, "metadata", "ownerReferences") {
+			if om, _ := o.(map[string]interface{}); nestedString(om, "uid") == uid {
+				return true
+			}
+		}
+		return false
+	}
+	images := func(podSpec map[string]interface{}) []string {
+		out := []string{}
+		for _, ct := range nestedSlice(podSpec, "containers") {
+			cm, _ := ct.(map[string]interface{})
+			out = append(out, nestedString(cm, "image"))
+		}
+		return out
+	}
+
+	var revisions []rolloutRevision
+	if rs.Name == "deployments" {
+		list, err := c.list(ctx, mustK8sResource("replicasets"), namespace, k8sListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		current := nestedString(obj, "metadata", "annotations", "deployment.kubernetes.io/revision")
+		for _, item := range list.Items {
+			if !ownedBy(item) {
+				continue
+			}
+			rev := nestedString(item, "metadata", "annotations", "deployment.kubernetes.io/revision")
+			n, err := strconv.ParseInt(rev, 10, 64)
+			if err != nil {
+				continue
+			}
+			revisions = append(revisions, rolloutRevision{
+				Revision:    n,
+				Name:        nestedString(item, "metadata", "name"),
+				ChangeCause: nestedString(item, "metadata", "annotations", "kubernetes.io/change-cause"),
+				Images:      images(nestedMap(item, "spec", "template", "spec")),
+				Created:     nestedString(item, "metadata", "creationTimestamp"),
+				Current:     rev == current,
+				Template:    nestedMap(item, "spec", "template"),
+			})
+		}
+	} else {
+		list, err := c.list(ctx, mustK8sResource("controllerrevisions"), namespace, k8sListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			if !ownedBy(item) {
+				continue
+			}
+			revisions = append(revisions, rolloutRevision{
+				Revision:    nestedInt(item, "revision"),
+				Name:        nestedString(item, "metadata", "name"),
+				ChangeCause: nestedString(item, "metadata", "annotations", "kubernetes.io/change-cause"),
+				Images:      images(nestedMap(item, "data", "spec", "template", "spec")),
+				Created:     nestedString(item, "metadata", "creationTimestamp"),
+				Template:    nestedMap(item, "data"),
+			})
+		}
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+		updateRevision := nestedString(obj, "status", "updateRevision")
+		for i := range revisions {
+			if updateRevision != "" {
+				revisions[i].Current = revisions[i].Name == updateRevision
+			} else {
+				revisions[i].Current = i == len(revisions)-1
+			}
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+// GetRolloutHistory lists a workload's revisions, oldest first.
+// GET /api/k0s/clusters/{id}/k8s/{resource}/{name}/rollout-history
+func GetRolloutHistory(w http.ResponseWriter, r *http.Request) {
+	c, rs, namespace, name, ok := workloadTarget(w, r, false, "deployments", "statefulsets", "daemonsets")
+	if !ok {
+		return
+	}
+	obj, err := c.get(r.Context(), rs, namespace, name)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	revisions, err := rolloutHistory(r.Context(), c, rs, obj)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	if revisions == nil {
+		revisions = []rolloutRevision{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"items": revisions})
+}
+
+// UndoRollout rolls a workload back to an earlier revision (the previous
+// one when revision is 0), like "kubectl rollout undo".
+// POST /api/k0s/clusters/{id}/k8s/{resource}/{name}/rollout-undo   body: {"revision":0}
+func UndoRollout(w http.ResponseWriter, r *http.Request) {
+	c, rs, namespace, name, ok := workloadTarget(w, r, true, "deployments", "statefulsets", "daemonsets")
+	if !ok {
+		return
+	}
+	var body struct {
+		Revision int64 `json:"revision"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	obj, err := c.get(r.Context(), rs, namespace, name)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	if paused, _ := nestedMap(obj, "spec")["paused"].(bool); paused {
+		http.Error(w, "can't roll back a paused deployment (resume it first)", http.StatusConflict)
+		return
+	}
+	revisions, err := rolloutHistory(r.Context(), c, rs, obj)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+
+	var current, target *rolloutRevision
+	for i := range revisions {
+		if revisions[i].Current {
+			current = &revisions[i]
+		}
+	}
+	for i := len(revisions) - 1; i >= 0; i-- {
+		rev := &revisions[i]
+		if body.Revision == 0 && rev != current && (current == nil || rev.Revision < current.Revision) {
+			target = rev
+			break
+		}
+		if body.Revision != 0 && rev.Revision == body.Revision {
+			target = rev
+			break
+		}
+	}
+	switch {
+	case target == nil && body.Revision == 0:
+		http.Error(w, "no rollout history found to roll back to", http.StatusBadRequest)
+		return
+	case target == nil:
+		http.Error(w, fmt.Sprintf("unable to find specified revision %d in history", body.Revision), http.StatusNotFound)
+		return
+	case target == current:
+		http.Error(w, fmt.Sprintf("revision %d is already the current revision", target.Revision), http.StatusConflict)
+		return
+	}
+
+	if rs.Name == "deployments" {
+		template := target.Template
+		if labels := nestedMap(template, "metadata", "labels"); labels != nil {
+			delete(labels, "pod-template-hash")
+		}
+		ops := []map[string]interface{}{{"op": "replace", "path": "/spec/template", "value": template}}
+		_, err = c.patch(r.Context(), rs, namespace, name, k8sJSONPatch, ops)
+	} else {
+		_, err = c.patch(r.Context(), rs, namespace, name, k8sStrategicPatch, target.Template)
+	}
+	auditWorkloadAction(r, "rollout_undo", rs, namespace, name, fmt.Sprintf("to revision %d", target.Revision), err)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"revision": target.Revision,
+		"output":   fmt.Sprintf("%s/%s rolled back", strings.TrimSuffix(rs.Name, "s"), name),
+	})
+}
+
+// ── CronJobs ────────────────────────────────────────────────────────────────
+
+func setCronJobSuspended(w http.ResponseWriter, r *http.Request, suspend bool) {
+	c, rs, namespace, name, ok := workloadTarget(w, r, true, "cronjobs")
+	if !ok {
+		return
+	}
+	patch := map[string]interface{}{"spec": map[string]interface{}{"suspend": suspend}}
+	_, err := c.patch(r.Context(), rs, namespace, name, k8sMergePatch, patch)
+	action := "cronjob_resume"
+	if suspend {
+		action = "cronjob_suspend"
+	}
+	auditWorkloadAction(r, action, rs, namespace, name, "", err)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "suspended": suspend})
+}
+
+// SuspendCronJob stops a cronjob from scheduling new jobs.
+// POST /api/k0s/clusters/{id}/k8s/cronjobs/{name}/suspend
+func SuspendCronJob(w http.ResponseWriter, r *http.Request) { setCronJobSuspended(w, r, true) }
+
+// ResumeCronJob lets a suspended cronjob schedule jobs again.
+// POST /api/k0s/clusters/{id}/k8s/cronjobs/{name}/resume
+func ResumeCronJob(w http.ResponseWriter, r *http.Request) { setCronJobSuspended(w, r, false) }
+
+// TriggerCronJob runs a cronjob now by creating a job from its template,
+// like "kubectl create job --from=cronjob/<name>".
+// POST /api/k0s/clusters/{id}/k8s/cronjobs/{name}/trigger   body: {"job_name":""} (optional)
+func TriggerCronJob(w http.ResponseWriter, r *http.Request) {
+	c, rs, namespace, name, ok := workloadTarget(w, r, true, "cronjobs")
+	if !ok {
+		return
+	}
+	var body struct {
+		JobName string `json:"job_name"`
+	}
+	if r.ContentLength != 0 {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	jobName := body.JobName
+	if jobName == "" {
+		suffix := fmt.Sprintf("-manual-%d", time.Now().Unix())
+		jobName = name
+		if len(jobName)+len(suffix) > 63 {
+			jobName = jobName[:63-len(suffix)]
+		}
+		jobName += suffix
+	}
+
+	cj, err := c.get(r.Context(), rs, namespace, name)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	annotations := map[string]interface{}{"cronjob.kubernetes.io/instantiate": "manual"}
+	for k, v := range nestedMap(cj, "spec", "jobTemplate", "metadata", "annotations") {
+		annotations[k] = v
+	}
+	job := map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":        jobName,
+			"namespace":   namespace,
+			"labels":      nestedMap(cj, "spec", "jobTemplate", "metadata", "labels"),
+			"annotations": annotations,
+			"ownerReferences": []interface{}{map[string]interface{}{
+				"apiVersion": "batch/v1",
+				"kind":       "CronJob",
+				"name":       name,
+				"uid":        nestedString(cj, "metadata", "uid"),
+				"controller": true,
+			}},
+		},
+		"spec": nestedMap(cj, "spec", "jobTemplate", "spec"),
+	}
+	_, err = c.create(r.Context(), mustK8sResource("jobs"), namespace, job)
+	auditWorkloadAction(r, "cronjob_trigger", rs, namespace, name, "as job "+jobName, err)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"job_name": jobName,
+		"output":   "job.batch/" + jobName + " created",
+	})
+}
+
+// ── Nodes ───────────────────────────────────────────────────────────────────
+
+func setNodeUnschedulable(ctx context.Context, c *k8sClient, node string, unschedulable bool) error {
+	patch := map[string]interface{}{"spec": map[string]interface{}{"unschedulable": unschedulable}}
+	_, err := c.patch(ctx, mustK8sResource("nodes"), "", node, k8sMergePatch, patch)
+	return err
+}
+
+func cordonHandler(w http.ResponseWriter, r *http.Request, cordon bool) {
+	c, rs, _, name, ok := workloadTarget(w, r, true, "nodes")
+	if !ok {
+		return
+	}
+	err := setNodeUnschedulable(r.Context(), c, name, cordon)
+	action := "node_uncordon"
+	if cordon {
+		action = "node_cordon"
+	}
+	auditWorkloadAction(r, action, rs, "", name, "", err)
+	if err != nil {
+		writeK8sError(w, err)
+		return
+	}
+	if !cordon {
+		database.DB.Exec("UPDATE k0s_nodes SET cordoned = 0 WHERE cluster_id = ? AND LOWER(hostname) = ?", c.clusterID, name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "unschedulable": cordon})
+}
+
+// CordonNode marks a node unschedulable.
+// POST /api/k0s/clusters/{id}/k8s/nodes/{name}/cordon
+func CordonNode(w http.ResponseWriter, r *http.Request) { cordonHandler(w, r, true) }
+
+// UncordonNode marks a node schedulable again.
+// POST /api/k0s/clusters/{id}/k8s/nodes/{name}/uncordon
+func UncordonNode(w http.ResponseWriter, r *http.Request) { cordonHandler(w, r, false) }
+
+// drainOptions mirror the flags of "kubectl drain".
+type drainOptions struct {
+	IgnoreDaemonSets   bool `json:"ignore_daemonsets"`
+	DeleteEmptyDirData bool `json:"delete_emptydir_data"`
+	Force              bool `json:"force"`                // also evict pods no controller will recreate
+	GracePeriodSeconds *int `json:"grace_period_seconds"` // nil: each pod's own grace period
+	TimeoutSeconds     int  `json:"timeout_seconds"`
+}
+
+// activeDrains holds the nodes being drained, keyed "cluster/node".
+var activeDrains sync.Map
+
+func drainLogKey(id int64) string { return fmt.Sprintf("drain:%d", id) }
+
+// DrainNode cordons a node and evicts its pods in the background. Eviction
+// goes through the Eviction API, so PodDisruptionBudgets are respected: a
+// blocked eviction is retried until the timeout. Progress streams from
+// StreamNodeDrainLogs.
+// POST /api/k0s/clusters/{id}/k8s/nodes/{name}/drain
+// body: {"ignore_daemonsets":true,"delete_emptydir_data":false,"force":false,"grace_period_seconds":null,"timeout_seconds":300}
+func DrainNode(w http.ResponseWriter, r *http.Request) {
+	c, _, _, node, ok := workloadTarget(w, r, true, "nodes")
+	if !ok {
+		return
+	}
+	opts := drainOptions{IgnoreDaemonSets: true}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.TimeoutSeconds <= 0 {
+		opts.TimeoutSeconds = 300
+	}
+
+	key := c.clusterID + "/" + node
+	if _, busy := activeDrains.LoadOrStore(key, true); busy {
+		http.Error(w, "node "+node+" is already being drained", http.StatusConflict)
+		return
+	}
+	user, _ := GetUserFromContext(r.Context())
+	optsJSON, _ := json.Marshal(opts)
+	res, err := database.DB.Exec(
+		`INSERT INTO node_drains (cluster_id, node, username, options, status) VALUES (?, ?, ?, ?, 'running')`,
+		c.clusterID, node, user.Username, string(optsJSON))
+	if err != nil {
+		activeDrains.Delete(key)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+	logs := startLogStream(drainLogKey(id))
+	log.Printf("[Drain] #%d cluster=%s node=%s started by %s", id, c.clusterID, node, user.Username)
+
+	go func() {
+		defer activeDrains.Delete(key)
+		err := runNodeDrain(c, node, opts, logs)
+		status := "success"
+		var errMsg interface{}
+		if err != nil {
+			status, errMsg = "failed", err.Error()
+			logs.Line("error: " + err.Error())
+		}
+		database.DB.Exec(`UPDATE node_drains SET status = ?, error = ?, log = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			status, errMsg, logs.String(), id)
+		finishLogStream(drainLogKey(id), logs)
+		details := "by " + user.Username
+		if err != nil {
+			details += ": " + err.Error()
+			status = "error"
+		}
+		recordActivityLog("k8s_node_drain", "cluster "+c.clusterID+": nodes/"+node, details, status)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "drain_id": id})
+}
+
+// runNodeDrain cordons node and evicts its pods, following kubectl drain.
+// The node stays cordoned when the drain fails.
+func runNodeDrain(c *k8sClient, node string, opts drainOptions, logs *logStream) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	if err := setNodeUnschedulable(ctx, c, node, true); err != nil {
+		return err
+	}
+	logs.Line("node/" + node + " cordoned")
+
+	pods, err := c.list(ctx, mustK8sResource("pods"), "", k8sListOptions{FieldSelector: "spec.nodeName=" + node})
+	if err != nil {
+		return err
+	}
+	var evict []map[string]interface{}
+	var problems, warnings []string
+	for _, pod := range pods.Items {
+		ref := nestedString(pod, "metadata", "namespace") + "/" + nestedString(pod, "metadata", "name")
+		if nestedString(pod, "metadata", "annotations", "kubernetes.io/config.mirror") != "" {
+			continue // static pods can't be evicted; the kubelet owns them
+		}
+		phase := nestedString(pod, "status", "phase")
+		finished := phase == "Succeeded" || phase == "Failed"
+		controller := ""
+		for _, o := range nestedSlice(pod, "metadata", "ownerReferences") {
+			if om, _ := o.(map[string]interface{}); om["controller"] == true {
+				controller = nestedString(om, "kind")
+			}
+		}
+		if controller == "DaemonSet" {
+			if opts.IgnoreDaemonSets {
+				warnings = append(warnings, "ignoring DaemonSet-managed pod "+ref)
+			} else {
+				problems = append(problems, "DaemonSet-managed pod "+ref+" (use ignore_daemonsets)")
+			}
+			continue
+		}
+		if controller == "" && !finished {
+			if !opts.Force {
+				problems = append(problems, "pod "+ref+" is not managed by a controller (use force)")
+				continue
+			}
+			warnings = append(warnings, "deleting pod "+ref+" that declares no controller")
+		}
+		if !finished {
+			for _, v := range nestedSlice(pod, "spec", "volumes") {
+				if vm, _ := v.(map[string]interface{}); vm["emptyDir"] != nil {
+					if !opts.DeleteEmptyDirData {
+						problems = append(problems, "pod "+ref+" has local storage (use delete_emptydir_data)")
+					} else {
+						warnings = append(warnings, "deleting pod "+ref+" with local storage")
+					}
+					break
+				}
+			}
+		}
+		evict = append(evict, pod)
+	}
+	for _, msg := range warnings {
+		logs.Line("Warning: " + msg)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("cannot drain node %s:\n  %s", node, strings.Join(problems, "\n  "))
+	}
+
+	errs := make([]error, len(evict))
+	var wg sync.WaitGroup
+	for i, pod := range evict {
+		wg.Add(1)
+		go func(i int, pod map[string]interface{}) {
+			defer wg.Done()
+			errs[i] = evictPod(ctx, c, pod, opts.GracePeriodSeconds, logs)
+		}(i, pod)
+	}
+	wg.Wait()
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d pod(s) could not be evicted:\n  %s", len(failed), strings.Join(failed, "\n  "))
+	}
+	logs.Line("node/" + node + " drained")
+	return nil
+}
+
+// evictPod evicts one pod through the Eviction API and waits until it is
+// gone. An eviction refused because of a PodDisruptionBudget (429) is
+// retried every 5 seconds until ctx expires.
+func evictPod(ctx context.Context, c *k8sClient, pod map[string]interface{}, gracePeriod *int, logs *logStream) error {
+	pods := mustK8sResource("pods")
+	namespace := nestedString(pod, "metadata", "namespace")
+	name := nestedString(pod, "metadata", "name")
+	uid := nestedString(pod, "metadata", "uid")
+
+	eviction := map[string]interface{}{
+		"apiVersion": "policy/v1",
+		"kind":       "Eviction",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+	}
+	if gracePeriod != nil {
+		eviction["deleteOptions"] = map[string]interface{}{"gracePeriodSeconds": *gracePeriod}
+	}
+	body, _ := json.Marshal(eviction)
+
+	for {
+		err := c.call(ctx, http.MethodPost, pods.path(namespace, name)+"/eviction", nil, "application/json", body, nil)
+		if err == nil {
+			logs.Line(fmt.Sprintf("evicting pod %s/%s", namespace, name))
+			break
+		}
+		if isK8sNotFound(err) {
+			return nil
+		}
+		if k8sErrorCode(err) != http.StatusTooManyRequests {
+			return fmt.Errorf("pod %s/%s: %v", namespace, name, err)
+		}
+		logs.Line(fmt.Sprintf("error when evicting pod %s/%s (will retry after 5s): %v", namespace, name, err))
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("pod %s/%s: timed out waiting for its disruption budget to allow eviction", namespace, name)
+		}
+	}
+
+	for {
+		live, err := c.get(ctx, pods, namespace, name)
+		if isK8sNotFound(err) || (err == nil && nestedString(live, "metadata", "uid") != uid) {
+			logs.Line(fmt.Sprintf("pod/%s evicted", name))
+			return nil
+		}
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			return fmt.Errorf("pod %s/%s: timed out waiting for it to terminate", namespace, name)
+		}
+	}
+}
+
+// NodeDrain is one drain of a node.
+type NodeDrain struct {
+	ID         int     `json:"id"`
+	ClusterID  int     `json:"cluster_id"`
+	Node       string  `json:"node"`
+	Username   string  `json:"username"`
+	Options    string  `json:"options"`
+	Status     string  `json:"status"` // running, success, failed
+	Error      *string `json:"error"`
+	Log        *string `json:"log,omitempty"`
+	StartedAt  string  `json:"started_at"`
+	FinishedAt *string `json:"finished_at"`
+}
+
+// RecoverNodeDrains fails drains left running by a previous server
+// process. Their nodes stay cordoned, as after any failed drain.
+func RecoverNodeDrains() {
+	database.DB.Exec(
+		`UPDATE node_drains SET status = 'failed', error = 'interrupted by server restart', finished_at = CURRENT_TIMESTAMP
+		 WHERE status = 'running'`)
+}
+
+// GetNodeDrain returns a drain and its log. Like starting one, it is
+// admin-only: the log names pods from every namespace.
+// GET /api/k0s/clusters/{id}/node-drains/{drainId}
+func GetNodeDrain(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	var d NodeDrain
+	err := database.DB.QueryRow(
+		`SELECT id, cluster_id, node, username, options, status, error, log, started_at, finished_at
+		 FROM node_drains WHERE id = ? AND cluster_id = ?`, vars["drainId"], vars["id"]).
+		Scan(&d.ID, &d.ClusterID, &d.Node, &d.Username, &d.Options, &d.Status, &d.Error, &d.Log, &d.StartedAt, &d.FinishedAt)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if v, ok := activeLogStreams.Load("drain:" + vars["drainId"]); ok {
+		text := v.(*logStream).String()
+		d.Log = &text
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// StreamNodeDrainLogs streams a drain's progress.
+// GET /api/k0s/clusters/{id}/node-drains/{drainId}/logs (WebSocket)
+func StreamNodeDrainLogs(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	serveLogStream(w, r, "drain:"+vars["drainId"], func() (string, bool) {
+		var text sql.NullString
+		if err := database.DB.QueryRow(`SELECT log FROM node_drains WHERE id = ? AND cluster_id = ?`,
+			vars["drainId"], vars["id"]).Scan(&text); err != nil {
+			return "", false
+		}
+		return text.String, true
+	})
+}
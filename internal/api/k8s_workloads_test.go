@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRolloutStatusDeployment(t *testing.T) {
+	tests := []struct {
+		name         string
+		obj          string
+		done, failed bool
+	}{
+		{"rolled out", `{"metadata":{"name":"web","generation":2},"spec":{"replicas":2},
+			"status":{"observedGeneration":2,"replicas":2,"updatedReplicas":2,"availableReplicas":2}}`, true, false},
+		{"spec not observed", `{"metadata":{"name":"web","generation":3},"spec":{"replicas":2},
+			"status":{"observedGeneration":2,"replicas":2,"updatedReplicas":2,"availableReplicas":2}}`, false, false},
+		{"old replicas terminating", `{"metadata":{"name":"web","generation":2},"spec":{"replicas":2},
+			"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":2,"availableReplicas":2}}`, false, false},
+		{"progress deadline exceeded", `{"metadata":{"name":"web","generation":2},"spec":{"replicas":2},
+			"status":{"observedGeneration":2,"replicas":2,"updatedReplicas":1,"availableReplicas":1,
+			"conditions":[{"type":"Progressing","status":"False","reason":"ProgressDeadlineExceeded"}]}}`, false, true},
+	}
+	for _, tt := range tests {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.obj), &obj); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		done, failed, message := rolloutStatus(mustK8sResource("deployments"), obj)
+		if done != tt.done || failed != tt.failed {
+			t.Errorf("%s: done=%v failed=%v (%s), want done=%v failed=%v", tt.name, done, failed, message, tt.done, tt.failed)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// logStream collects the output of a long-running background job (image
+// build, push, …) and fans it out to any number of WebSocket viewers. The
+// full text is kept so viewers that join late still see everything and the
+// job can persist it when it finishes.
+type logStream struct {
+	mu     sync.Mutex
+	buf    strings.Builder
+	subs   map[chan []byte]struct{}
+	closed bool
+}
+
+// activeLogStreams maps a job key such as "build:12" to its *logStream
+// while the job is running.
+var activeLogStreams sync.Map
+
+// startLogStream registers a new stream under key.
+func startLogStream(key string) *logStream {
+	s := &logStream{subs: make(map[chan []byte]struct{})}
+	activeLogStreams.Store(key, s)
+	return s
+}
+
+// finishLogStream closes the stream and unregisters it. Callers should
+// persist s.String() before calling this so viewers that connect afterwards
+// can be served from the database.
+func finishLogStream(key string, s *logStream) {
+	s.Close()
+	activeLogStreams.Delete(key)
+}
+
+func (s *logStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return len(p), nil
+	}
+	s.buf.Write(p)
+	for ch := range s.subs {
+		msg := make([]byte, len(p))
+		copy(msg, p)
+		select {
+		case ch <- msg:
+		default:
+			// Viewer can't keep up — drop it; it can reconnect and
+			// receive the backlog again.
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+	return len(p), nil
+}
+
+// Line appends a status line written by the job itself.
+func (s *logStream) Line(msg string) {
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	s.Write([]byte(msg))
+}
+
+func (s *logStream) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+// Subscribe returns everything written so far plus a channel that receives
+// subsequent writes. The channel is closed when the stream finishes.
+func (s *logStream) Subscribe() ([]byte, <-chan []byte, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backlog := []byte(s.buf.String())
+	ch := make(chan []byte, 256)
+	if s.closed {
+		close(ch)
+		return backlog, ch, func() {}
+	}
+	s.subs[ch] = struct{}{}
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subs[ch]; ok {
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+func (s *logStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for ch := range s.subs {
+		close(ch)
+	}
+	s.subs = nil
+}
+
+// serveLogStream upgrades the request to a WebSocket and streams the job
+// log registered under key. If the job is no longer running, stored() is
+// called to fetch the persisted log, which is sent once before closing.
+func serveLogStream(w http.ResponseWriter, r *http.Request, key string, stored func() (string, bool)) {
+	var s *logStream
+	if v, ok := activeLogStreams.Load(key); ok {
+		s = v.(*logStream)
+	}
+	var finished string
+	if s == nil {
+		text, ok := stored()
+		if !ok {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		finished = text
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[LogStream] WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if s == nil {
+		conn.WriteMessage(websocket.TextMessage, []byte(finished))
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "finished"))
+		return
+	}
+
+	backlog, ch, cancel := s.Subscribe()
+	defer cancel()
+
+	// Detect the viewer going away so we stop pumping.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if len(backlog) > 0 {
+		if err := conn.WriteMessage(websocket.TextMessage, backlog); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "finished"))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
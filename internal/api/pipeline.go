@@ -0,0 +1,572 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Pipelines are YAML definitions of stages and jobs, stored inline or read
+// from a path in a GitOps repo at run time. Each run executes its stages in
+// order; the jobs of a stage run in parallel on CI/CD workers picked by
+// label (see pipeline_runner.go).
+//
+//	name: backend-ci
+//	stages: [build, scan]
+//	env: {GOFLAGS: -mod=mod}
+//	jobs:
+//	  compile:
+//	    stage: build
+//	    image: golang:1.22          # needs a docker worker
+//	    runs_on: [linux]
+//	    script: [go build -o bin/app ./cmd/app]
+//	    secrets: {NPM_TOKEN: npm-token}
+//	    artifacts: [bin/app]
+//	    retries: 1
+//	    timeout: 20m
+//	  trivy:
+//	    stage: scan
+//	    image: aquasec/trivy
+//	    script: [trivy fs --format json -o trivy.json .]
+//	    allow_failure: true
+//	    scan: {report: trivy.json, target: backend}
+
+const (
+	defaultJobTimeout = time.Hour
+	maxJobTimeout     = 24 * time.Hour
+	maxJobRetries     = 5
+)
+
+var (
+	pipelineJobNameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	envNameRE         = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ── Models ──────────────────────────────────────────────────────────────────
+
+type Pipeline struct {
+	ID             int     `json:"id"`
+	Name           string  `json:"name"`
+	RepoID         *int    `json:"repo_id"`
+	Definition     *string `json:"definition"`
+	DefinitionPath *string `json:"definition_path"` // path of the YAML inside the repo
+	WorkspaceID    *string `json:"workspace_id"`
+	CreatedBy      string  `json:"created_by"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+}
+
+type PipelineDefinition struct {
+	Name    string                      `yaml:"name"`
+	Stages  []string                    `yaml:"stages"`
+	Env     map[string]string           `yaml:"env"`
+	Secrets map[string]string           `yaml:"secrets"` // env var -> cicd_secrets name
+	Jobs    map[string]*PipelineJobSpec `yaml:"jobs"`
+}
+
+type PipelineJobSpec struct {
+	Name         string            `yaml:"-"`
+	Stage        string            `yaml:"stage"`
+	Image        string            `yaml:"image"`   // run in this container (docker workers only)
+	RunsOn       []string          `yaml:"runs_on"` // worker labels, all required
+	Script       []string          `yaml:"script"`
+	Env          map[string]string `yaml:"env"`
+	Secrets      map[string]string `yaml:"secrets"`
+	Artifacts    []string          `yaml:"artifacts"` // paths relative to the workspace
+	Retries      int               `yaml:"retries"`
+	Timeout      string            `yaml:"timeout"`
+	AllowFailure bool              `yaml:"allow_failure"`
+	Scan         *PipelineScanSpec `yaml:"scan"`
+
+	timeout time.Duration
+}
+
+// PipelineScanSpec makes a job a scan step: after the script, the report
+// file is read back and stored in cicd_scan_reports with the pipeline id.
+type PipelineScanSpec struct {
+	Report   string `yaml:"report"`
+	Format   string `yaml:"format"` // trivy, grype, sarif, zap; detected when empty
+	Target   string `yaml:"target"`
+	ScanType string `yaml:"scan_type"`
+}
+
+// parsePipelineDefinition parses and validates a pipeline YAML.
+func parsePipelineDefinition(data []byte) (*PipelineDefinition, error) {
+	var def PipelineDefinition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %v", err)
+	}
+	if len(def.Jobs) == 0 {
+		return nil, fmt.Errorf("pipeline has no jobs")
+	}
+	if len(def.Stages) == 0 {
+		def.Stages = []string{"main"}
+	}
+	stages := map[string]bool{}
+	for _, s := range def.Stages {
+		if s == "" || stages[s] {
+			return nil, fmt.Errorf("stage names must be unique and non-empty")
+		}
+		stages[s] = true
+	}
+	if err := validateEnv(def.Env, def.Secrets); err != nil {
+		return nil, err
+	}
+	for name, job := range def.Jobs {
+		if job == nil {
+			return nil, fmt.Errorf("job %s is empty", name)
+		}
+		job.Name = name
+		if !pipelineJobNameRE.MatchString(name) {
+			return nil, fmt.Errorf("invalid job name %q", name)
+		}
+		if job.Stage == "" {
+			job.Stage = def.Stages[0]
+		}
+		if !stages[job.Stage] {
+			return nil, fmt.Errorf("job %s: unknown stage %q", name, job.Stage)
+		}
+		if len(job.Script) == 0 {
+			return nil, fmt.Errorf("job %s: script is required", name)
+		}
+		if job.Retries < 0 || job.Retries > maxJobRetries {
+			return nil, fmt.Errorf("job %s: retries must be between 0 and %d", name, maxJobRetries)
+		}
+		job.timeout = defaultJobTimeout
+		if job.Timeout != "" {
+			d, err := time.ParseDuration(job.Timeout)
+			if err != nil || d <= 0 || d > maxJobTimeout {
+				return nil, fmt.Errorf("job %s: timeout must be a duration up to %s", name, maxJobTimeout)
+			}
+			job.timeout = d
+		}
+		if err := validateEnv(job.Env, job.Secrets); err != nil {
+			return nil, fmt.Errorf("job %s: %v", name, err)
+		}
+		for _, p := range job.Artifacts {
+			if !isWorkspacePath(p) {
+				return nil, fmt.Errorf("job %s: artifact path %q must be relative to the workspace", name, p)
+			}
+		}
+		if job.Scan != nil && !isWorkspacePath(job.Scan.Report) {
+			return nil, fmt.Errorf("job %s: scan.report must be a path relative to the workspace", name)
+		}
+	}
+	return &def, nil
+}
+
+func validateEnv(env, secrets map[string]string) error {
+	for k := range env {
+		if !envNameRE.MatchString(k) {
+			return fmt.Errorf("invalid env name %q", k)
+		}
+	}
+	for k, v := range secrets {
+		if !envNameRE.MatchString(k) {
+			return fmt.Errorf("invalid env name %q", k)
+		}
+		if v == "" {
+			return fmt.Errorf("secret for %s has no name", k)
+		}
+	}
+	return nil
+}
+
+func isWorkspacePath(p string) bool {
+	if p == "" || path.IsAbs(p) {
+		return false
+	}
+	clean := path.Clean(p)
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// stageJobs groups the jobs by stage, in stage order, sorted by name.
+func (def *PipelineDefinition) stageJobs() [][]*PipelineJobSpec {
+	out := make([][]*PipelineJobSpec, len(def.Stages))
+	index := map[string]int{}
+	for i, s := range def.Stages {
+		index[s] = i
+	}
+	for _, job := range def.Jobs {
+		i := index[job.Stage]
+		out[i] = append(out[i], job)
+	}
+	for _, jobs := range out {
+		sort.Slice(jobs, func(a, b int) bool { return jobs[a].Name < jobs[b].Name })
+	}
+	return out
+}
+
+// jobEnv merges pipeline and job env with the job's secrets, resolved
+// from cicd_secrets. The secret values are returned separately so they can
+// be masked in the log.
+func (def *PipelineDefinition) jobEnv(job *PipelineJobSpec, secrets map[string]string) (env map[string]string, masked []string, err error) {
+	env = map[string]string{}
+	for k, v := range def.Env {
+		env[k] = v
+	}
+	for k, v := range job.Env {
+		env[k] = v
+	}
+	refs := map[string]string{}
+	for k, v := range def.Secrets {
+		refs[k] = v
+	}
+	for k, v := range job.Secrets {
+		refs[k] = v
+	}
+	for envName, secretName := range refs {
+		value, ok := secrets[secretName]
+		if !ok {
+			return nil, nil, fmt.Errorf("secret %q is not defined", secretName)
+		}
+		env[envName] = value
+		if value != "" {
+			masked = append(masked, value)
+		}
+	}
+	return env, masked, nil
+}
+
+func loadCicdSecrets() (map[string]string, error) {
+	rows, err := database.DB.Query(`SELECT name, value FROM cicd_secrets`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	secrets := map[string]string{}
+	for rows.Next() {
+		var name, value string
+		if rows.Scan(&name, &value) != nil {
+			continue
+		}
+		if secrets[name], err = vault.Open(value); err != nil {
+			return nil, fmt.Errorf("secret %s: %v", name, err)
+		}
+	}
+	return secrets, nil
+}
+
+const pipelineColumns = `id, name, repo_id, definition, definition_path, workspace_id, created_by, created_at, updated_at`
+
+func scanPipeline(row interface{ Scan(...interface{}) error }) (Pipeline, error) {
+	var p Pipeline
+	err := row.Scan(&p.ID, &p.Name, &p.RepoID, &p.Definition, &p.DefinitionPath, &p.WorkspaceID,
+		&p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+func loadPipeline(id interface{}) (Pipeline, error) {
+	return scanPipeline(database.DB.QueryRow(`SELECT `+pipelineColumns+` FROM pipelines WHERE id = ?`, id))
+}
+
+// canRunPipelines reports whether the user may change or run pipelines.
+// A pipeline runs arbitrary scripts with the CI/CD secrets, so it takes
+// admin or user_cicd_full; every other role is read-only.
+func canRunPipelines(user User) bool {
+	return HasRole(user.Role, "admin") || HasRole(user.Role, "user_cicd_full")
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+type pipelineRequest struct {
+	Name           string `json:"name"`
+	RepoID         int    `json:"repo_id"`
+	Definition     string `json:"definition"`
+	DefinitionPath string `json:"definition_path"`
+	WorkspaceID    string `json:"workspace_id"`
+}
+
+func (req *pipelineRequest) validate() error {
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.DefinitionPath != "" {
+		if req.RepoID == 0 {
+			return fmt.Errorf("definition_path needs a repo_id")
+		}
+		if !isWorkspacePath(req.DefinitionPath) {
+			return fmt.Errorf("definition_path must be relative to the repository root")
+		}
+		return nil
+	}
+	if req.Definition == "" {
+		return fmt.Errorf("definition or definition_path is required")
+	}
+	_, err := parsePipelineDefinition([]byte(req.Definition))
+	return err
+}
+
+// GET /api/cicd/pipelines?workspace_id=
+func ListPipelines(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + pipelineColumns + ` FROM pipelines`
+	args := []interface{}{}
+	if ws := r.URL.Query().Get("workspace_id"); ws != "" {
+		query += ` WHERE workspace_id = ?`
+		args = append(args, ws)
+	}
+	rows, err := database.DB.Query(query+` ORDER BY name`, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	list := []Pipeline{}
+	for rows.Next() {
+		if p, err := scanPipeline(rows); err == nil {
+			list = append(list, p)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// POST /api/cicd/pipelines
+// Body: {"name": "...", "definition": "<yaml>"} or
+//
+//	{"name": "...", "repo_id": 3, "definition_path": ".pipeline.yml"}
+func CreatePipeline(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !canRunPipelines(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req pipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RepoID != 0 {
+		if _, err := loadGitRepoSource(req.RepoID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO pipelines (name, repo_id, definition, definition_path, workspace_id, created_by)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		req.Name, nullInt(req.RepoID), nullStr(req.Definition), nullStr(req.DefinitionPath),
+		nullStr(req.WorkspaceID), user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+	p, _ := loadPipeline(id)
+	database.LogActivity("pipeline_create", req.Name, "success")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// GET /api/cicd/pipelines/{id}
+func GetPipeline(w http.ResponseWriter, r *http.Request) {
+	p, err := loadPipeline(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// PUT /api/cicd/pipelines/{id}
+func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !canRunPipelines(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	var req pipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := database.DB.Exec(
+		`UPDATE pipelines SET name = ?, repo_id = ?, definition = ?, definition_path = ?, workspace_id = ?,
+		        updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		req.Name, nullInt(req.RepoID), nullStr(req.Definition), nullStr(req.DefinitionPath),
+		nullStr(req.WorkspaceID), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	p, _ := loadPipeline(id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// DELETE /api/cicd/pipelines/{id}
+// Removes the pipeline with its runs, jobs and stored artifacts.
+func DeletePipeline(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !canRunPipelines(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	rows, err := database.DB.Query(`SELECT id FROM pipeline_runs WHERE pipeline_id = ?`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var runIDs []int
+	for rows.Next() {
+		var runID int
+		if rows.Scan(&runID) == nil {
+			runIDs = append(runIDs, runID)
+		}
+	}
+	rows.Close()
+	for _, runID := range runIDs {
+		if isPipelineRunActive(runID) {
+			http.Error(w, "pipeline has a run in progress; cancel it first", http.StatusConflict)
+			return
+		}
+	}
+	for _, runID := range runIDs {
+		removeRunArtifacts(runID)
+		database.DB.Exec(`DELETE FROM pipeline_jobs WHERE run_id = ?`, runID)
+	}
+	database.DB.Exec(`DELETE FROM pipeline_runs WHERE pipeline_id = ?`, id)
+	if _, err := database.DB.Exec(`DELETE FROM pipelines WHERE id = ?`, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	database.LogActivity("pipeline_delete", id, "success")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/cicd/pipelines/validate
+// Body: the pipeline YAML. Returns the stage/job layout or the first error.
+func ValidatePipeline(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	def, err := parsePipelineDefinition(data)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"valid": false, "error": err.Error()})
+		return
+	}
+	layout := []map[string]interface{}{}
+	for i, jobs := range def.stageJobs() {
+		names := []string{}
+		for _, j := range jobs {
+			names = append(names, j.Name)
+		}
+		layout = append(layout, map[string]interface{}{"stage": def.Stages[i], "jobs": names})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"valid": true, "stages": layout})
+}
+
+// ── Secrets ─────────────────────────────────────────────────────────────────
+
+// GET /api/cicd/secrets  (admin only)  names only, never values
+func ListCicdSecrets(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	rows, err := database.DB.Query(`SELECT id, name, description, updated_at FROM cicd_secrets ORDER BY name`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	list := []map[string]interface{}{}
+	for rows.Next() {
+		var id int
+		var name, updated string
+		var desc sql.NullString
+		if rows.Scan(&id, &name, &desc, &updated) != nil {
+			continue
+		}
+		list = append(list, map[string]interface{}{
+			"id": id, "name": name, "description": desc.String, "updated_at": updated,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// POST /api/cicd/secrets  (admin only)
+// Body: {"name": "npm-token", "value": "...", "description": ""}
+// Creates the secret or replaces its value.
+func SetCicdSecret(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		Value       string `json:"value"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	value, err := vault.Seal(req.Value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = database.DB.Exec(
+		`INSERT INTO cicd_secrets (name, value, description) VALUES (?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET value = excluded.value, description = excluded.description,
+		                                 updated_at = CURRENT_TIMESTAMP`,
+		req.Name, value, nullStr(req.Description))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordActivityLog("cicd_secret_set", req.Name, "secret set by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "name": req.Name})
+}
+
+// DELETE /api/cicd/secrets/{id}  (admin only)
+func DeleteCicdSecret(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if _, err := database.DB.Exec(`DELETE FROM cicd_secrets WHERE id = ?`, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordActivityLog("cicd_secret_delete", id, "secret deleted by "+user.Username, "success")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,876 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/ssh"
+)
+
+// A pipeline run checks out the pipeline's repo on the server, then runs
+// each job on a worker over SSH: the checkout is streamed into a fresh
+// workspace under /tmp, the job script is written next to it and executed
+// with sh, inside a container of the job's image on docker workers.
+// Output is streamed into a logStream (pipeline-job:<id>) and persisted
+// when the job ends.
+
+// pipelineArtifactDir stores job artifacts as run-<id>/job-<id>.tar.
+// Override with PIPELINE_ARTIFACT_DIR.
+var pipelineArtifactDir = func() string {
+	if dir := os.Getenv("PIPELINE_ARTIFACT_DIR"); dir != "" {
+		return dir
+	}
+	return "./pipeline-artifacts"
+}()
+
+// activeRuns maps a running pipeline run id to the func that cancels it.
+var activeRuns sync.Map
+
+// workerLoad counts the jobs each worker is currently running, so jobs are
+// spread over matching workers.
+var (
+	workerLoadMu sync.Mutex
+	workerLoad   = map[int]int{}
+)
+
+// ── Models ──────────────────────────────────────────────────────────────────
+
+type PipelineRun struct {
+	ID         int           `json:"id"`
+	PipelineID int           `json:"pipeline_id"`
+	Status     string        `json:"status"` // queued, running, success, failed, canceled
+	CommitSHA  string        `json:"commit_sha"`
+	Trigger    string        `json:"trigger"`
+	Actor      string        `json:"actor"`
+	Error      *string       `json:"error"`
+	CreatedAt  string        `json:"created_at"`
+	StartedAt  *string       `json:"started_at"`
+	FinishedAt *string       `json:"finished_at"`
+	Jobs       []PipelineJob `json:"jobs,omitempty"`
+}
+
+type PipelineJob struct {
+	ID           int     `json:"id"`
+	RunID        int     `json:"run_id"`
+	Name         string  `json:"name"`
+	Stage        string  `json:"stage"`
+	StageIndex   int     `json:"stage_index"`
+	WorkerID     *int    `json:"worker_id"`
+	Status       string  `json:"status"` // pending, running, success, failed, canceled, skipped
+	Attempt      int     `json:"attempt"`
+	MaxAttempts  int     `json:"max_attempts"`
+	ExitCode     *int    `json:"exit_code"`
+	Error        *string `json:"error"`
+	HasArtifacts bool    `json:"has_artifacts"`
+	ScanReportID *int    `json:"scan_report_id"`
+	StartedAt    *string `json:"started_at"`
+	FinishedAt   *string `json:"finished_at"`
+}
+
+// pipelineWorker is a cicd_workers row as the runner needs it.
+type pipelineWorker struct {
+	ID                 int
+	Name               string
+	Host               string
+	Port               int
+	User               string
+	Key                string
+	AgentType          string // shell, docker
+	Labels             map[string]bool
+	Status             string
+	MaxJobs            int
+	DockerVersion      string
+	HostKey            string // pinned, authorized_keys format
+	HostKeyFingerprint string
+}
+
+// runContext is what every job of a run shares.
+type runContext struct {
+	runID     int
+	pipeline  Pipeline
+	def       *PipelineDefinition
+	secrets   map[string]string
+	sha       string
+	sourceTar string // checkout archive, empty for pipelines without a repo
+}
+
+func pipelineJobLogKey(id int64) string { return fmt.Sprintf("pipeline-job:%d", id) }
+
+func isPipelineRunActive(id int) bool {
+	_, ok := activeRuns.Load(id)
+	return ok
+}
+
+func runArtifactDir(runID int) string {
+	return filepath.Join(pipelineArtifactDir, fmt.Sprintf("run-%d", runID))
+}
+
+func removeRunArtifacts(runID int) { os.RemoveAll(runArtifactDir(runID)) }
+
+// RecoverPipelineRuns fails runs and jobs left unfinished by a previous
+// server process; their SSH sessions died with it.
+func RecoverPipelineRuns() {
+	now := time.Now().Format(time.RFC3339)
+	database.DB.Exec(
+		`UPDATE pipeline_runs SET status = 'failed', error = 'interrupted by server restart', finished_at = ?
+		 WHERE status IN ('queued', 'running')`, now)
+	database.DB.Exec(
+		`UPDATE pipeline_jobs SET status = 'failed', error = 'interrupted by server restart', finished_at = ?
+		 WHERE status IN ('pending', 'running')`, now)
+}
+
+// ── Workers ─────────────────────────────────────────────────────────────────
+
+const pipelineWorkerColumns = `id, name, host, ssh_port, ssh_user, ssh_private_key, agent_type, labels,
+	status, max_concurrent_jobs, docker_version, host_key, host_key_fingerprint`
+
+func scanPipelineWorker(row interface{ Scan(...interface{}) error }) (pipelineWorker, error) {
+	var wk pipelineWorker
+	var key, labels, status, docker, hostKey, fingerprint sql.NullString
+	err := row.Scan(&wk.ID, &wk.Name, &wk.Host, &wk.Port, &wk.User, &key, &wk.AgentType, &labels,
+		&status, &wk.MaxJobs, &docker, &hostKey, &fingerprint)
+	wk.Key, wk.Status, wk.DockerVersion = database.OpenNullSecret(key), status.String, docker.String
+	wk.HostKey, wk.HostKeyFingerprint = hostKey.String, fingerprint.String
+	wk.Labels = map[string]bool{}
+	for _, l := range strings.FieldsFunc(labels.String, func(r rune) bool { return r == ',' || r == ' ' }) {
+		wk.Labels[strings.ToLower(l)] = true
+	}
+	return wk, err
+}
+
+func loadPipelineWorker(id interface{}) (pipelineWorker, error) {
+	return scanPipelineWorker(database.DB.QueryRow(`SELECT `+pipelineWorkerColumns+` FROM cicd_workers WHERE id = ?`, id))
+}
+
+func loadPipelineWorkers() ([]pipelineWorker, error) {
+	rows, err := database.DB.Query(`SELECT ` + pipelineWorkerColumns + ` FROM cicd_workers`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var workers []pipelineWorker
+	for rows.Next() {
+		wk, err := scanPipelineWorker(rows)
+		if err != nil {
+			continue
+		}
+		workers = append(workers, wk)
+	}
+	return workers, nil
+}
+
+// pickWorker chooses the least busy online worker carrying all of the
+// job's labels (and Docker, when the job names an image) that is below its
+// max_concurrent_jobs. It returns errWorkersBusy when such workers exist
+// but are all full. release must be called when the job is done with it.
+func pickWorker(job *PipelineJobSpec) (wk pipelineWorker, release func(), err error) {
+	workers, err := loadPipelineWorkers()
+	if err != nil {
+		return wk, nil, err
+	}
+	workerLoadMu.Lock()
+	defer workerLoadMu.Unlock()
+	found, busy := false, false
+	for _, cand := range workers {
+		if cand.Status != "online" {
+			continue
+		}
+		if job.Image != "" && (cand.AgentType != "docker" || cand.DockerVersion == "") {
+			continue
+		}
+		if !workerHasLabels(cand, job.RunsOn) {
+			continue
+		}
+		if workerLoad[cand.ID] >= cand.MaxJobs {
+			busy = true
+			continue
+		}
+		if !found || workerLoad[cand.ID] < workerLoad[wk.ID] {
+			wk, found = cand, true
+		}
+	}
+	if !found {
+		if busy {
+			return wk, nil, errWorkersBusy
+		}
+		need := strings.Join(job.RunsOn, ", ")
+		if job.Image != "" {
+			need = strings.Trim("docker, "+need, ", ")
+		}
+		return wk, nil, fmt.Errorf("no online worker matches [%s]", need)
+	}
+	workerLoad[wk.ID]++
+	id := wk.ID
+	return wk, func() {
+		workerLoadMu.Lock()
+		workerLoad[id]--
+		workerLoadMu.Unlock()
+	}, nil
+}
+
+// waitForWorker retries pickWorker while all matching workers are busy.
+func waitForWorker(ctx context.Context, job *PipelineJobSpec, logs *logStream) (pipelineWorker, func(), error) {
+	waiting := false
+	for {
+		wk, release, err := pickWorker(job)
+		if !errors.Is(err, errWorkersBusy) {
+			return wk, release, err
+		}
+		if !waiting {
+			logs.Line("Waiting for a free worker...")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return wk, nil, fmt.Errorf("canceled")
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func workerHasLabels(wk pipelineWorker, labels []string) bool {
+	for _, l := range labels {
+		if !wk.Labels[strings.ToLower(l)] {
+			return false
+		}
+	}
+	return true
+}
+
+// runRemote runs one command in a new session of client.
+func runRemote(client *ssh.Client, cmd string, stdin io.Reader, stdout io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// maskingWriter hides secret values from job output. A secret may arrive
+// split across writes, so output ending in the start of a secret is held
+// back until the next write or Flush shows how it continues. Stdout and
+// stderr share one writer, hence the lock.
+type maskingWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets []string
+	pending string
+}
+
+func (m *maskingWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.pending + string(p)
+	for _, v := range m.secrets {
+		if v != "" {
+			s = strings.ReplaceAll(s, v, "***")
+		}
+	}
+	keep := 0
+	for _, v := range m.secrets {
+		for k := min(len(v)-1, len(s)); k > keep; k-- {
+			if strings.HasSuffix(s, v[:k]) {
+				keep = k
+				break
+			}
+		}
+	}
+	s, m.pending = s[:len(s)-keep], s[len(s)-keep:]
+	if _, err := io.WriteString(m.w, s); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes output held back as the possible start of a secret.
+func (m *maskingWriter) Flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	io.WriteString(m.w, m.pending)
+	m.pending = ""
+}
+
+// ── Execution ───────────────────────────────────────────────────────────────
+
+// executePipelineRun runs the stages of a run in order and records the
+// outcome. ctx is cancelled by CancelPipelineRun.
+func executePipelineRun(ctx context.Context, runID int, p Pipeline, commit string) {
+	defer activeRuns.Delete(runID)
+	database.DB.Exec(`UPDATE pipeline_runs SET status = 'running', started_at = ? WHERE id = ?`,
+		time.Now().Format(time.RFC3339), runID)
+
+	rc, err := preparePipelineRun(ctx, runID, p, commit)
+	if err != nil {
+		finishPipelineRun(runID, p.Name, "failed", err.Error())
+		return
+	}
+	if rc.sourceTar != "" {
+		defer os.Remove(rc.sourceTar)
+	}
+
+	stages := rc.def.stageJobs()
+	jobIDs := make([][]int64, len(stages))
+	for si, jobs := range stages {
+		for _, job := range jobs {
+			res, err := database.DB.Exec(
+				`INSERT INTO pipeline_jobs (run_id, name, stage, stage_index, max_attempts) VALUES (?, ?, ?, ?, ?)`,
+				runID, job.Name, job.Stage, si, job.Retries+1)
+			if err != nil {
+				finishPipelineRun(runID, p.Name, "failed", err.Error())
+				return
+			}
+			id, _ := res.LastInsertId()
+			jobIDs[si] = append(jobIDs[si], id)
+		}
+	}
+
+	status := "success"
+	for si, jobs := range stages {
+		if ctx.Err() != nil {
+			break
+		}
+		results := make([]string, len(jobs))
+		var wg sync.WaitGroup
+		for i, job := range jobs {
+			wg.Add(1)
+			go func(i int, job *PipelineJobSpec) {
+				defer wg.Done()
+				results[i] = runPipelineJob(ctx, rc, job, jobIDs[si][i])
+			}(i, job)
+		}
+		wg.Wait()
+		for i, res := range results {
+			if res != "success" && !jobs[i].AllowFailure {
+				status = "failed"
+			}
+		}
+		if status == "failed" {
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		status = "canceled"
+	}
+
+	leftover := "skipped"
+	if status == "canceled" {
+		leftover = "canceled"
+	}
+	database.DB.Exec(`UPDATE pipeline_jobs SET status = ? WHERE run_id = ? AND status = 'pending'`, leftover, runID)
+	finishPipelineRun(runID, p.Name, status, "")
+}
+
+// preparePipelineRun resolves the run's definition, secrets and source.
+// For repo-backed pipelines the checkout is archived so the repo lock is
+// only held while it is copied.
+func preparePipelineRun(ctx context.Context, runID int, p Pipeline, commit string) (*runContext, error) {
+	rc := &runContext{runID: runID, pipeline: p}
+	var definition []byte
+	if p.Definition != nil {
+		definition = []byte(*p.Definition)
+	}
+	if p.RepoID != nil && *p.RepoID != 0 {
+		src, err := loadGitRepoSource(*p.RepoID)
+		if err != nil {
+			return nil, err
+		}
+		dir, sha, unlock, err := syncGitRepo(ctx, src, commit)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		rc.sha = sha
+		database.DB.Exec(`UPDATE pipeline_runs SET commit_sha = ? WHERE id = ?`, sha, runID)
+		if p.DefinitionPath != nil && *p.DefinitionPath != "" {
+			full, err := resolveRepoPath(dir, *p.DefinitionPath)
+			if err != nil {
+				return nil, err
+			}
+			if definition, err = os.ReadFile(full); err != nil {
+				return nil, fmt.Errorf("reading %s: %v", *p.DefinitionPath, err)
+			}
+		}
+		tmp, err := os.CreateTemp("", "pipeline-source-*.tar")
+		if err != nil {
+			return nil, err
+		}
+		rc.sourceTar = tmp.Name()
+		err = tarDirectory(dir, tmp)
+		tmp.Close()
+		if err != nil {
+			os.Remove(rc.sourceTar)
+			return nil, fmt.Errorf("archiving checkout: %v", err)
+		}
+	}
+
+	def, err := parsePipelineDefinition(definition)
+	if err == nil {
+		rc.secrets, err = loadCicdSecrets()
+	}
+	if err != nil {
+		if rc.sourceTar != "" {
+			os.Remove(rc.sourceTar)
+		}
+		return nil, err
+	}
+	rc.def = def
+	return rc, nil
+}
+
+func finishPipelineRun(runID int, name, status, errMsg string) {
+	database.DB.Exec(`UPDATE pipeline_runs SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+		status, nullStr(errMsg), time.Now().Format(time.RFC3339), runID)
+	database.LogActivity("pipeline_run", name, status)
+}
+
+// jobOutcome is what executeJob learned about one attempt.
+type jobOutcome struct {
+	exitCode     *int
+	artifactPath string
+	scanReportID int64
+}
+
+// runPipelineJob runs a job, retrying failed attempts, and returns its
+// final status.
+func runPipelineJob(ctx context.Context, rc *runContext, job *PipelineJobSpec, jobID int64) string {
+	key := pipelineJobLogKey(jobID)
+	logs := startLogStream(key)
+	status, errMsg := "failed", ""
+	var out jobOutcome
+
+	env, masked, err := rc.def.jobEnv(job, rc.secrets)
+	if err != nil {
+		errMsg = err.Error()
+		logs.Line("ERROR: " + errMsg)
+	} else {
+		env["CI"] = "true"
+		env["CI_PIPELINE_ID"] = strconv.Itoa(rc.pipeline.ID)
+		env["CI_PIPELINE_NAME"] = rc.pipeline.Name
+		env["CI_RUN_ID"] = strconv.Itoa(rc.runID)
+		env["CI_JOB_NAME"] = job.Name
+		env["CI_COMMIT_SHA"] = rc.sha
+		w := &maskingWriter{w: logs, secrets: masked}
+
+		maxAttempts := job.Retries + 1
+		for attempt := 1; attempt <= maxAttempts; attempt++ {
+			if attempt > 1 {
+				logs.Line(fmt.Sprintf("── Retrying (attempt %d/%d) ──", attempt, maxAttempts))
+			}
+			wk, release, err := waitForWorker(ctx, job, logs)
+			if err != nil {
+				errMsg = err.Error()
+				logs.Line("ERROR: " + errMsg)
+				if ctx.Err() != nil {
+					status = "canceled"
+				}
+				break
+			}
+			database.DB.Exec(
+				`UPDATE pipeline_jobs SET status = 'running', worker_id = ?, attempt = ?,
+				        started_at = COALESCE(started_at, ?) WHERE id = ?`,
+				wk.ID, attempt, time.Now().Format(time.RFC3339), jobID)
+			logs.Line(fmt.Sprintf("Running %s on worker %s (%s)", job.Name, wk.Name, wk.AgentType))
+
+			jobCtx, cancel := context.WithTimeout(ctx, job.timeout)
+			out, err = executeJob(jobCtx, wk, rc, job, jobID, env, w)
+			w.Flush()
+			cancel()
+			release()
+			if err == nil {
+				status, errMsg = "success", ""
+				break
+			}
+			errMsg = err.Error()
+			logs.Line("ERROR: " + errMsg)
+			if ctx.Err() != nil {
+				status = "canceled"
+				break
+			}
+		}
+	}
+
+	database.DB.Exec(
+		`UPDATE pipeline_jobs SET status = ?, exit_code = ?, error = ?, log = ?, artifact_path = ?,
+		        scan_report_id = ?, finished_at = ? WHERE id = ?`,
+		status, out.exitCode, nullStr(errMsg), logs.String(), nullStr(out.artifactPath),
+		nullInt(int(out.scanReportID)), time.Now().Format(time.RFC3339), jobID)
+	finishLogStream(key, logs)
+	return status
+}
+
+// jobScript renders the script the worker runs: env exports followed by
+// each command, echoed before it runs.
+func jobScript(env map[string]string, script []string) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	names := make([]string, 0, len(env))
+	for k := range env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(&b, "export %s=%s\n", k, shellQuote(env[k]))
+	}
+	for _, line := range script {
+		fmt.Fprintf(&b, "printf '%%s\\n' %s\n%s\n", shellQuote("$ "+line), line)
+	}
+	return b.String()
+}
+
+// executeJob runs one attempt of a job on wk. The workspace is removed
+// afterwards; artifacts and scan reports are collected before that.
+func executeJob(ctx context.Context, wk pipelineWorker, rc *runContext, job *PipelineJobSpec, jobID int64, env map[string]string, out io.Writer) (jobOutcome, error) {
+	var res jobOutcome
+	client, err := dialWorker(wk)
+	if err != nil {
+		return res, err
+	}
+	defer client.Close()
+
+	dir := fmt.Sprintf("/tmp/dm-job-%d", jobID)
+	container := fmt.Sprintf("dm-job-%d", jobID)
+	qdir := shellQuote(dir)
+	defer runRemote(client, "rm -rf "+qdir, nil, io.Discard)
+
+	// Workspace
+	if err := runRemote(client, "rm -rf "+qdir+" && mkdir -p "+qdir, nil, io.Discard); err != nil {
+		return res, fmt.Errorf("creating workspace: %v", err)
+	}
+	if rc.sourceTar != "" {
+		f, err := os.Open(rc.sourceTar)
+		if err != nil {
+			return res, err
+		}
+		err = runRemote(client, "tar -xf - -C "+qdir, f, io.Discard)
+		f.Close()
+		if err != nil {
+			return res, fmt.Errorf("uploading workspace: %v", err)
+		}
+	}
+	script := strings.NewReader(jobScript(env, job.Script))
+	if err := runRemote(client, "umask 077 && cat > "+qdir+"/.dm-job.sh", script, io.Discard); err != nil {
+		return res, fmt.Errorf("uploading job script: %v", err)
+	}
+
+	// Run
+	cmd := "cd " + qdir + " && setsid -w sh -c 'echo $$ > .dm-pid; exec sh .dm-job.sh'"
+	// TERM the job's process group, then KILL whatever is left after 5s.
+	kill := "pg=-$(cat " + qdir + "/.dm-pid) || exit 0; kill -TERM $pg 2>/dev/null; " +
+		"for i in 1 2 3 4 5; do kill -0 $pg 2>/dev/null || exit 0; sleep 1; done; kill -KILL $pg 2>/dev/null; true"
+	if wk.AgentType == "docker" && job.Image != "" {
+		cmd = fmt.Sprintf("docker run --rm --name %s -v %s:/workspace -w /workspace --entrypoint sh %s /workspace/.dm-job.sh",
+			container, qdir, shellQuote(job.Image))
+		kill = "docker rm -f " + container + " >/dev/null 2>&1; true"
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return res, err
+	}
+	defer session.Close()
+	session.Stdout = out
+	session.Stderr = out
+	if err := session.Start(cmd); err != nil {
+		return res, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	var runErr error
+	select {
+	case runErr = <-done:
+	case <-ctx.Done():
+		runRemote(client, kill, nil, io.Discard)
+		select {
+		case <-done:
+		case <-time.After(15 * time.Second):
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return res, fmt.Errorf("timed out after %s", job.timeout)
+		}
+		return res, fmt.Errorf("canceled")
+	}
+	code := 0
+	var exitErr *ssh.ExitError
+	if errors.As(runErr, &exitErr) {
+		code = exitErr.ExitStatus()
+	} else if runErr != nil {
+		return res, runErr
+	}
+	res.exitCode = &code
+
+	// Scan reports are collected even when the scanner exits non-zero,
+	// which most do when they find something.
+	if job.Scan != nil {
+		id, err := collectScanReport(client, dir, rc, job, out)
+		if err != nil && code == 0 {
+			return res, err
+		}
+		res.scanReportID = id
+	}
+	if code != 0 {
+		return res, fmt.Errorf("script exited with code %d", code)
+	}
+	if len(job.Artifacts) > 0 {
+		if res.artifactPath, err = collectArtifacts(client, dir, rc.runID, jobID, job.Artifacts); err != nil {
+			return res, fmt.Errorf("collecting artifacts: %v", err)
+		}
+		fmt.Fprintf(out, "Saved artifacts: %s\n", strings.Join(job.Artifacts, ", "))
+	}
+	return res, nil
+}
+
+func collectScanReport(client *ssh.Client, dir string, rc *runContext, job *PipelineJobSpec, out io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	lw := &limitedWriter{w: &buf, n: maxScanUpload}
+	if err := runRemote(client, "cat -- "+shellQuote(dir+"/"+job.Scan.Report), nil, lw); err != nil {
+		return 0, fmt.Errorf("reading scan report %s: %v", job.Scan.Report, err)
+	}
+	if lw.n < 0 {
+		return 0, fmt.Errorf("scan report %s is larger than %d bytes", job.Scan.Report, maxScanUpload)
+	}
+	workspace := ""
+	if rc.pipeline.WorkspaceID != nil {
+		workspace = *rc.pipeline.WorkspaceID
+	}
+	stored, err := storeScanReport(buf.Bytes(), scanReportMeta{
+		Format:       job.Scan.Format,
+		Target:       job.Scan.Target,
+		ScanType:     job.Scan.ScanType,
+		PipelineID:   strconv.Itoa(rc.pipeline.ID),
+		PipelineName: rc.pipeline.Name,
+		WorkspaceID:  workspace,
+		Source:       "pipeline",
+	})
+	if err != nil {
+		fmt.Fprintf(out, "Scan report not stored: %v\n", err)
+		return 0, err
+	}
+	fmt.Fprintf(out, "Stored scan report #%d: %d findings from %s\n", stored.ID, stored.Findings, stored.Tool)
+	return stored.ID, nil
+}
+
+// limitedWriter accepts up to n bytes and then fails.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	l.n -= int64(len(p))
+	if l.n < 0 {
+		return 0, errors.New("output too large")
+	}
+	return l.w.Write(p)
+}
+
+func collectArtifacts(client *ssh.Client, dir string, runID int, jobID int64, paths []string) (string, error) {
+	dest := filepath.Join(runArtifactDir(runID), fmt.Sprintf("job-%d.tar", jobID))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	err = runRemote(client, "cd "+shellQuote(dir)+" && tar -cf - -- "+strings.Join(quoted, " "), nil, f)
+	f.Close()
+	if err != nil {
+		os.Remove(dest)
+		return "", err
+	}
+	return dest, nil
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/cicd/pipelines/{id}/run
+// Body (optional): {"commit": "<sha>"}  defaults to the head of the repo's branch
+func RunPipeline(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !canRunPipelines(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	p, err := loadPipeline(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Commit string `json:"commit"`
+	}
+	json.NewDecoder(r.Body).Decode(&req) // body is optional
+	if req.Commit != "" && !gitCommitPattern.MatchString(req.Commit) {
+		http.Error(w, "commit must be a hexadecimal commit id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := database.DB.Exec(
+		`INSERT INTO pipeline_runs (pipeline_id, status, trigger, actor) VALUES (?, 'queued', 'manual', ?)`,
+		p.ID, user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+	runID := int(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	activeRuns.Store(runID, cancel)
+	go func() {
+		defer cancel()
+		executePipelineRun(ctx, runID, p, req.Commit)
+	}()
+	log.Printf("[Pipeline] %s run #%d started by %s", p.Name, runID, user.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": runID, "status": "queued"})
+}
+
+const pipelineRunColumns = `id, pipeline_id, status, commit_sha, trigger, actor, error, created_at, started_at, finished_at`
+
+func scanPipelineRun(row interface{ Scan(...interface{}) error }) (PipelineRun, error) {
+	var run PipelineRun
+	err := row.Scan(&run.ID, &run.PipelineID, &run.Status, &run.CommitSHA, &run.Trigger, &run.Actor,
+		&run.Error, &run.CreatedAt, &run.StartedAt, &run.FinishedAt)
+	return run, err
+}
+
+// GET /api/cicd/pipelines/{id}/runs?limit=50
+func ListPipelineRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	rows, err := database.DB.Query(
+		`SELECT `+pipelineRunColumns+` FROM pipeline_runs WHERE pipeline_id = ? ORDER BY id DESC LIMIT ?`,
+		mux.Vars(r)["id"], limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	runs := []PipelineRun{}
+	for rows.Next() {
+		if run, err := scanPipelineRun(rows); err == nil {
+			runs = append(runs, run)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// GET /api/cicd/pipeline-runs/{id}
+// Returns the run with its jobs (without logs).
+func GetPipelineRun(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	run, err := scanPipelineRun(database.DB.QueryRow(`SELECT `+pipelineRunColumns+` FROM pipeline_runs WHERE id = ?`, id))
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	rows, err := database.DB.Query(
+		`SELECT id, run_id, name, stage, stage_index, worker_id, status, attempt, max_attempts, exit_code, error,
+		        artifact_path, scan_report_id, started_at, finished_at
+		 FROM pipeline_jobs WHERE run_id = ? ORDER BY stage_index, name`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	run.Jobs = []PipelineJob{}
+	for rows.Next() {
+		var j PipelineJob
+		var artifact sql.NullString
+		if rows.Scan(&j.ID, &j.RunID, &j.Name, &j.Stage, &j.StageIndex, &j.WorkerID, &j.Status, &j.Attempt,
+			&j.MaxAttempts, &j.ExitCode, &j.Error, &artifact, &j.ScanReportID, &j.StartedAt, &j.FinishedAt) != nil {
+			continue
+		}
+		j.HasArtifacts = artifact.String != ""
+		run.Jobs = append(run.Jobs, j)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// POST /api/cicd/pipeline-runs/{id}/cancel
+func CancelPipelineRun(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !canRunPipelines(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	v, ok := activeRuns.Load(id)
+	if !ok {
+		http.Error(w, "run is not in progress", http.StatusConflict)
+		return
+	}
+	v.(context.CancelFunc)()
+	database.LogActivity("pipeline_cancel", strconv.Itoa(id), "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "status": "canceling"})
+}
+
+// GET /api/cicd/pipeline-jobs/{id}/logs  (WebSocket)
+func StreamPipelineJobLogs(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	serveLogStream(w, r, "pipeline-job:"+id, func() (string, bool) {
+		var text sql.NullString
+		if err := database.DB.QueryRow(`SELECT log FROM pipeline_jobs WHERE id = ?`, id).Scan(&text); err != nil {
+			return "", false
+		}
+		return text.String, true
+	})
+}
+
+// GET /api/cicd/pipeline-jobs/{id}/artifacts
+// Downloads the job's artifacts as a tar archive.
+func DownloadPipelineArtifacts(w http.ResponseWriter, r *http.Request) {
+	var name string
+	var artifact sql.NullString
+	err := database.DB.QueryRow(`SELECT name, artifact_path FROM pipeline_jobs WHERE id = ?`, mux.Vars(r)["id"]).
+		Scan(&name, &artifact)
+	if err != nil || artifact.String == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"-artifacts.tar"))
+	http.ServeFile(w, r, artifact.String)
+}
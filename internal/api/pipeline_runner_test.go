@@ -0,0 +1,37 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMaskingWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"whole secret", []string{"token=s3cr3t-value\n"}, "token=***\n"},
+		{"split across writes", []string{"token=s3c", "r3t-va", "lue\n"}, "token=***\n"},
+		{"one byte at a time", []string{"s", "3", "c", "r", "3", "t", "-", "v", "a", "l", "u", "e"}, "***"},
+		{"prefix that doesn't continue", []string{"s3cr3t", "-other\n"}, "s3cr3t-other\n"},
+		{"prefix at the end is flushed", []string{"ends with s3c"}, "ends with s3c"},
+		{"two secrets", []string{"p4ss", "word and s3cr3t-value"}, "*** and ***"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		m := &maskingWriter{w: &buf, secrets: []string{"s3cr3t-value", "p4ssword", ""}}
+		for _, s := range tt.writes {
+			if n, err := m.Write([]byte(s)); err != nil || n != len(s) {
+				t.Fatalf("%s: Write = %d, %v", tt.name, n, err)
+			}
+			if bytes.Contains(buf.Bytes(), []byte("s3cr3t-v")) {
+				t.Errorf("%s: secret written unmasked: %q", tt.name, buf.String())
+			}
+		}
+		m.Flush()
+		if buf.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
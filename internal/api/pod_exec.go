@@ -1,15 +1,12 @@
 package api
 
 import (
-	"crypto/tls"
 	"database/sql"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 
 	"github.com/adisaputra10/docker-management/internal/database"
@@ -19,7 +16,7 @@ import (
 )
 
 // PodExec opens a WebSocket-bridged interactive shell inside a pod.
-// For imported clusters (stored kubeconfig) it uses local kubectl exec.
+// For imported clusters (stored kubeconfig) it uses the API server exec WebSocket.
 // For k0s provisioned clusters it uses SSH → k0s kubectl exec.
 // GET /api/k0s/clusters/{id}/k8s/pods/{name}/exec?namespace=xxx&container=xxx&shell=xxx
 func PodExec(w http.ResponseWriter, r *http.Request) {
@@ -59,8 +56,11 @@ func PodExec(w http.ResponseWriter, r *http.Request) {
 		wsSend(fmt.Sprintf("\r\n\x1b[31mError: cluster not found: %v\x1b[0m\r\n", err))
 		return
 	}
+	password.String = database.OpenSecret(password.String)
+	sshKey.String = database.OpenSecret(sshKey.String)
+	storedKC.String = database.OpenSecret(storedKC.String)
 
-	// Imported cluster with a kubeconfig → run kubectl exec locally
+	// Imported cluster with a kubeconfig → exec through the API server
 	if storedKC.Valid && strings.TrimSpace(storedKC.String) != "" {
 		// Capture the authenticated user (if any) for audit logging.
 		execUser, _ := GetUserFromContext(r.Context())
@@ -174,9 +174,6 @@ func PodExec(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[PodExec] SSH session ended for pod=%s ns=%s", podName, namespace)
 }
 
-// podExecViaKubeconfig handles kubectl exec for imported/external clusters that
-// have a stored kubeconfig. Runs kubectl as a local subprocess and bridges
-// its stdin/stdout/stderr to the WebSocket.
 // podExecViaKubeconfig implements pod exec for imported clusters using the
 // Kubernetes WebSocket exec API (v5.channel.k8s.io protocol).
 // This requests tty=true from the API server so the shell inside the pod
@@ -187,38 +184,14 @@ func podExecViaKubeconfig(kubeconfigContent, podName, namespace, container, shel
 		conn.WriteMessage(websocket.TextMessage, []byte(msg))
 	}
 
-	// Write kubeconfig to a temp file so kubectl jsonpath can read it.
-	tmpKC, err := os.CreateTemp("", "kc-exec-*.yaml")
+	// API server URL and credentials come from the kubeconfig; the server
+	// certificate is verified against its CA like every other API call.
+	creds, err := parseKubeconfigCreds(clusterID, kubeconfigContent)
 	if err != nil {
 		wsSendStr(fmt.Sprintf("\r\n\x1b[31mError: %v\x1b[0m\r\n", err))
 		return
 	}
-	defer os.Remove(tmpKC.Name())
-	tmpKC.WriteString(kubeconfigContent) //nolint:errcheck
-	tmpKC.Close()
-	kcPath := tmpKC.Name()
-
-	// Extract API server URL and credentials from kubeconfig.
-	serverURL, err := kubectlRun(kcPath, "config", "view", "--raw", "-o", "jsonpath={.clusters[0].cluster.server}")
-	if err != nil || strings.TrimSpace(serverURL) == "" {
-		wsSendStr("\r\n\x1b[31mError: cannot read API server URL from kubeconfig\x1b[0m\r\n")
-		return
-	}
-	clientCertB64, _ := kubectlRun(kcPath, "config", "view", "--raw", "-o", "jsonpath={.users[0].user.client-certificate-data}")
-	clientKeyB64, _ := kubectlRun(kcPath, "config", "view", "--raw", "-o", "jsonpath={.users[0].user.client-key-data}")
-	token, _ := kubectlRun(kcPath, "config", "view", "--raw", "-o", "jsonpath={.users[0].user.token}")
-
-	// Build TLS config — skip server cert verification (matches kubectl --insecure-skip-tls-verify).
-	tlsCfg := &tls.Config{InsecureSkipVerify: true} //nolint:gosec
-	if strings.TrimSpace(clientCertB64) != "" && strings.TrimSpace(clientKeyB64) != "" {
-		certPEM, err1 := base64.StdEncoding.DecodeString(strings.TrimSpace(clientCertB64))
-		keyPEM, err2 := base64.StdEncoding.DecodeString(strings.TrimSpace(clientKeyB64))
-		if err1 == nil && err2 == nil {
-			if cert, err := tls.X509KeyPair(certPEM, keyPEM); err == nil {
-				tlsCfg.Certificates = []tls.Certificate{cert}
-			}
-		}
-	}
+	serverURL, token, tlsCfg := creds.serverURL, creds.bearerToken, creds.tlsConfig
 
 	// Build the exec WebSocket URL.
 	// wss://<server>/api/v1/namespaces/<ns>/pods/<name>/exec?stdin=true&stdout=true&stderr=true&tty=true&command=<shell>
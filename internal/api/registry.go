@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/gorilla/mux"
 )
 
@@ -66,6 +68,67 @@ func httpClientForRegistry(insecure bool) *http.Client {
 	return &http.Client{Transport: tr, Timeout: 10 * time.Second}
 }
 
+// loadRegistryCredentials fetches a stored registry together with its password.
+func loadRegistryCredentials(id int) (CicdRegistry, string, error) {
+	var reg CicdRegistry
+	var password string
+	var sslInt, insecureInt int
+	err := database.DB.QueryRow(
+		`SELECT id, name, type, url, username, password, ssl_enabled, insecure_skip_verify, extra_config, description, workspace_id, created_at
+		 FROM cicd_registries WHERE id = ?`, id,
+	).Scan(&reg.ID, &reg.Name, &reg.Type, &reg.URL, &reg.Username, &password,
+		&sslInt, &insecureInt, &reg.ExtraConfig, &reg.Description, &reg.WorkspaceID, &reg.CreatedAt)
+	if err != nil {
+		return reg, "", fmt.Errorf("registry %d not found", id)
+	}
+	reg.SSLEnabled = sslInt == 1
+	reg.InsecureSkipVerify = insecureInt == 1
+	reg.ExtraConfig = openRegistryExtra(reg.ExtraConfig)
+	return reg, database.OpenSecret(password), nil
+}
+
+// canUseRegistryCredentials reports whether role may push or pull with a
+// stored registry's credentials; it takes the same role as deleting from
+// the registry.
+func canUseRegistryCredentials(role string) bool {
+	return HasRole(role, "admin") || HasRole(role, "user_cicd_full")
+}
+
+// registryHost returns the host[:port] part used in image references for reg.
+func registryHost(reg CicdRegistry) string {
+	if reg.Type == "aws" && strings.TrimSpace(reg.URL) == "" {
+		var extra map[string]string
+		json.Unmarshal([]byte(reg.ExtraConfig), &extra) //nolint:errcheck
+		return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", extra["aws_account"], extra["aws_region"])
+	}
+	u := strings.TrimSpace(reg.URL)
+	for _, prefix := range []string{"https://", "http://"} {
+		u = strings.TrimPrefix(u, prefix)
+	}
+	if i := strings.Index(u, "/"); i >= 0 {
+		u = u[:i]
+	}
+	return u
+}
+
+// registryAuthHeader encodes the registry credentials as an X-Registry-Auth
+// value for the Docker Engine API. AWS registries exchange the stored keys
+// for an ECR token first.
+func registryAuthHeader(reg CicdRegistry, password string) (string, error) {
+	username := reg.Username
+	if reg.Type == "aws" {
+		var err error
+		if username, password, err = ecrCredentials(reg, password); err != nil {
+			return "", err
+		}
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: registryHost(reg),
+	})
+}
+
 // ── Handlers ────────────────────────────────────────────────────────────────
 
 // GET /api/cicd/registries
@@ -108,6 +171,7 @@ func ListRegistries(w http.ResponseWriter, r *http.Request) {
 		}
 		reg.SSLEnabled = sslInt == 1
 		reg.InsecureSkipVerify = insecureInt == 1
+		reg.ExtraConfig = redactRegistryExtra(reg.ExtraConfig)
 		list = append(list, reg)
 	}
 	if list == nil {
@@ -152,11 +216,22 @@ func CreateRegistry(w http.ResponseWriter, r *http.Request) {
 		insecureInt = 1
 	}
 
+	password, err := vault.Seal(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	extra, err := sealRegistryExtra(req.ExtraConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	result, err := database.DB.Exec(
 		`INSERT INTO cicd_registries (name, type, url, username, password, ssl_enabled, insecure_skip_verify, extra_config, description, workspace_id)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		req.Name, req.Type, req.URL, req.Username, req.Password,
-		sslInt, insecureInt, req.ExtraConfig, req.Description, req.WorkspaceID,
+		req.Name, req.Type, req.URL, req.Username, password,
+		sslInt, insecureInt, extra, req.Description, req.WorkspaceID,
 	)
 	if err != nil {
 		http.Error(w, "Error creating registry: "+err.Error(), http.StatusInternalServerError)
@@ -284,7 +359,7 @@ func testRegistryConnection(req RegistryRequest) map[string]interface{} {
 	}
 }
 
-// GET /api/cicd/registries/{id} — full detail including password (admin only)
+// GET /api/cicd/registries/{id} — full detail, secrets masked (admin only)
 func GetRegistry(w http.ResponseWriter, r *http.Request) {
 	user, ok := GetUserFromContext(r.Context())
 	if !ok {
@@ -317,10 +392,10 @@ func GetRegistry(w http.ResponseWriter, r *http.Request) {
 		"type":                 reg.Type,
 		"url":                  reg.URL,
 		"username":             reg.Username,
-		"password":             password,
+		"password":             maskSecret(password),
 		"ssl_enabled":          reg.SSLEnabled,
 		"insecure_skip_verify": reg.InsecureSkipVerify,
-		"extra_config":         reg.ExtraConfig,
+		"extra_config":         redactRegistryExtra(reg.ExtraConfig),
 		"description":          reg.Description,
 		"workspace_id":         reg.WorkspaceID,
 		"created_at":           reg.CreatedAt,
@@ -0,0 +1,731 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Registry browsing talks the Docker Registry HTTP API v2 directly. Every
+// registry type gets the generic v2 behaviour; Harbor and GitLab wrap it
+// with adapters for the parts their v2 endpoint doesn't offer to regular
+// users (catalog listing, deleting a single tag).
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestAccept = []string{
+	mediaTypeOCIIndex, mediaTypeDockerManifestList, mediaTypeOCIManifest, mediaTypeDockerManifest,
+}
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type ManifestLayer struct {
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	MediaType string `json:"media_type"`
+}
+
+type ManifestPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	Digest       string `json:"digest"`
+	Size         int64  `json:"size"`
+}
+
+type ManifestInfo struct {
+	Repository   string             `json:"repository"`
+	Reference    string             `json:"reference"`
+	Digest       string             `json:"digest"`
+	MediaType    string             `json:"media_type"`
+	Size         int64              `json:"size"` // config + layers, or the index itself for lists
+	OS           string             `json:"os,omitempty"`
+	Architecture string             `json:"architecture,omitempty"`
+	Created      string             `json:"created,omitempty"`
+	ConfigDigest string             `json:"config_digest,omitempty"`
+	Labels       map[string]string  `json:"labels,omitempty"`
+	Layers       []ManifestLayer    `json:"layers,omitempty"`
+	Platforms    []ManifestPlatform `json:"platforms,omitempty"`
+}
+
+// ── v2 client ───────────────────────────────────────────────────────────────
+
+// registryV2Client performs v2 API calls against one stored registry,
+// answering Basic and Bearer auth challenges as they come.
+type registryV2Client struct {
+	reg      CicdRegistry
+	password string
+	baseURL  string
+	http     *http.Client
+	authz    string // Authorization header that last succeeded
+}
+
+func newRegistryV2Client(reg CicdRegistry, password string) *registryV2Client {
+	base := buildRegistryBaseURL(reg.URL, reg.SSLEnabled)
+	if reg.Type == "aws" {
+		base = "https://" + registryHost(reg)
+	}
+	hc := httpClientForRegistry(reg.InsecureSkipVerify)
+	hc.Timeout = 60 * time.Second
+	return &registryV2Client{reg: reg, password: password, baseURL: base, http: hc}
+}
+
+// credentials returns the username/password to present, exchanging AWS
+// keys for an ECR token when needed.
+func (c *registryV2Client) credentials() (string, string, error) {
+	if c.reg.Type == "aws" {
+		return ecrCredentials(c.reg, c.password)
+	}
+	return c.reg.Username, c.password, nil
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header into its scheme and
+// parameters, e.g. Bearer realm="…",service="…",scope="…".
+func parseAuthChallenge(h string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := map[string]string{}
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var val string
+		if strings.HasPrefix(after, `"`) {
+			end := strings.Index(after[1:], `"`)
+			if end < 0 {
+				val, rest = after[1:], ""
+			} else {
+				val, rest = after[1:end+1], after[end+2:]
+			}
+		} else {
+			val, rest, _ = strings.Cut(after, ",")
+			val = strings.TrimSpace(val)
+		}
+		params[key] = val
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return strings.ToLower(scheme), params
+}
+
+// authorize answers a 401 challenge and remembers the resulting header.
+func (c *registryV2Client) authorize(challenge, scope string) error {
+	user, pass, err := c.credentials()
+	if err != nil {
+		return err
+	}
+	scheme, params := parseAuthChallenge(challenge)
+	switch scheme {
+	case "basic":
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(user, pass)
+		c.authz = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		realm := params["realm"]
+		if realm == "" {
+			return fmt.Errorf("bearer challenge without realm")
+		}
+		q := url.Values{}
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		if params["scope"] != "" {
+			scope = params["scope"]
+		}
+		if scope != "" {
+			q.Set("scope", scope)
+		}
+		tokenURL := realm
+		if len(q) > 0 {
+			tokenURL += "?" + q.Encode()
+		}
+		req, err := http.NewRequest("GET", tokenURL, nil)
+		if err != nil {
+			return err
+		}
+		if user != "" || pass != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("token request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("token request: HTTP %d", resp.StatusCode)
+		}
+		var tok struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+			return fmt.Errorf("token response: %v", err)
+		}
+		if tok.Token == "" {
+			tok.Token = tok.AccessToken
+		}
+		c.authz = "Bearer " + tok.Token
+		return nil
+	}
+	return fmt.Errorf("unsupported auth scheme %q", scheme)
+}
+
+// do sends a v2 request. scope is the token scope to ask for if the
+// registry challenges without naming one.
+func (c *registryV2Client) do(method, path, scope string, accept []string) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequest(method, c.baseURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range accept {
+			req.Header.Add("Accept", a)
+		}
+		if c.authz != "" {
+			req.Header.Set("Authorization", c.authz)
+		}
+		return c.http.Do(req)
+	}
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if err := c.authorize(challenge, scope); err != nil {
+		return nil, fmt.Errorf("registry authentication failed: %v", err)
+	}
+	return send()
+}
+
+// getJSON performs a GET and decodes the body, turning non-2xx statuses
+// into errors carrying the registry's message.
+func (c *registryV2Client) getJSON(path, scope string, accept []string, v interface{}) (*http.Response, error) {
+	resp, err := c.do("GET", path, scope, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp, registryError(resp)
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// registryStatusError keeps the upstream status so handlers can map it.
+type registryStatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *registryStatusError) Error() string { return e.Message }
+
+func registryError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var v2 struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &v2) == nil && len(v2.Errors) > 0 {
+		msg = v2.Errors[0].Code + ": " + v2.Errors[0].Message
+	}
+	if msg == "" {
+		msg = resp.Status
+	}
+	return &registryStatusError{Status: resp.StatusCode, Message: fmt.Sprintf("registry returned HTTP %d: %s", resp.StatusCode, msg)}
+}
+
+func repoScope(repo, actions string) string {
+	return "repository:" + repo + ":" + actions
+}
+
+// ── Browser adapters ────────────────────────────────────────────────────────
+
+type registryBrowser interface {
+	// Catalog lists repositories; next is passed back as last for the
+	// following page and is empty on the last page.
+	Catalog(n int, last string) (repos []string, next string, err error)
+	Tags(repo string) ([]string, error)
+	Manifest(repo, ref string) (*ManifestInfo, error)
+	// Delete removes a tag or, for a digest reference, the manifest.
+	Delete(repo, ref string) error
+}
+
+func newRegistryBrowser(reg CicdRegistry, password string) registryBrowser {
+	v2 := &v2Browser{c: newRegistryV2Client(reg, password)}
+	switch reg.Type {
+	case "harbor":
+		return &harborBrowser{v2Browser: v2}
+	case "gitlab":
+		return &gitlabBrowser{v2Browser: v2}
+	}
+	return v2
+}
+
+type v2Browser struct {
+	c *registryV2Client
+}
+
+func (b *v2Browser) Catalog(n int, last string) ([]string, string, error) {
+	q := url.Values{"n": {strconv.Itoa(n)}}
+	if last != "" {
+		q.Set("last", last)
+	}
+	var out struct {
+		Repositories []string `json:"repositories"`
+	}
+	resp, err := b.c.getJSON("/v2/_catalog?"+q.Encode(), "registry:catalog:*", nil, &out)
+	if err != nil {
+		return nil, "", err
+	}
+	// Link: </v2/_catalog?last=foo&n=100>; rel="next"
+	next := ""
+	if link := resp.Header.Get("Link"); strings.Contains(link, `rel="next"`) {
+		start, end := strings.Index(link, "<"), strings.Index(link, ">")
+		if start >= 0 && end > start {
+			if u, err := url.Parse(link[start+1 : end]); err == nil {
+				next = u.Query().Get("last")
+			}
+		}
+	}
+	return out.Repositories, next, nil
+}
+
+func (b *v2Browser) Tags(repo string) ([]string, error) {
+	var out struct {
+		Tags []string `json:"tags"`
+	}
+	if _, err := b.c.getJSON("/v2/"+repo+"/tags/list", repoScope(repo, "pull"), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Tags, nil
+}
+
+func (b *v2Browser) Manifest(repo, ref string) (*ManifestInfo, error) {
+	var m struct {
+		MediaType string `json:"mediaType"`
+		Config    struct {
+			Digest string `json:"digest"`
+			Size   int64  `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+			Size      int64  `json:"size"`
+		} `json:"layers"`
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Size     int64  `json:"size"`
+			Platform struct {
+				OS           string `json:"os"`
+				Architecture string `json:"architecture"`
+				Variant      string `json:"variant"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	resp, err := b.c.getJSON("/v2/"+repo+"/manifests/"+ref, repoScope(repo, "pull"), manifestAccept, &m)
+	if err != nil {
+		return nil, err
+	}
+	info := &ManifestInfo{
+		Repository: repo,
+		Reference:  ref,
+		Digest:     resp.Header.Get("Docker-Content-Digest"),
+		MediaType:  m.MediaType,
+	}
+	if info.MediaType == "" {
+		info.MediaType = strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+	}
+
+	if len(m.Manifests) > 0 {
+		for _, d := range m.Manifests {
+			info.Platforms = append(info.Platforms, ManifestPlatform{
+				OS: d.Platform.OS, Architecture: d.Platform.Architecture, Variant: d.Platform.Variant,
+				Digest: d.Digest, Size: d.Size,
+			})
+			info.Size += d.Size
+		}
+		return info, nil
+	}
+
+	info.ConfigDigest = m.Config.Digest
+	info.Size = m.Config.Size
+	for _, l := range m.Layers {
+		info.Layers = append(info.Layers, ManifestLayer{Digest: l.Digest, Size: l.Size, MediaType: l.MediaType})
+		info.Size += l.Size
+	}
+	if m.Config.Digest != "" {
+		var cfg struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+			Created      string `json:"created"`
+			Config       struct {
+				Labels map[string]string `json:"Labels"`
+			} `json:"config"`
+		}
+		if _, err := b.c.getJSON("/v2/"+repo+"/blobs/"+m.Config.Digest, repoScope(repo, "pull"), nil, &cfg); err == nil {
+			info.OS = cfg.OS
+			info.Architecture = cfg.Architecture
+			info.Created = cfg.Created
+			info.Labels = cfg.Config.Labels
+		}
+	}
+	return info, nil
+}
+
+// resolveDigest returns the manifest digest a tag points to.
+func (b *v2Browser) resolveDigest(repo, ref string) (string, error) {
+	if strings.HasPrefix(ref, "sha256:") {
+		return ref, nil
+	}
+	resp, err := b.c.do("HEAD", "/v2/"+repo+"/manifests/"+ref, repoScope(repo, "pull"), manifestAccept)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", &registryStatusError{Status: resp.StatusCode, Message: fmt.Sprintf("registry returned HTTP %d for %s:%s", resp.StatusCode, repo, ref)}
+	}
+	d := resp.Header.Get("Docker-Content-Digest")
+	if d == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s:%s", repo, ref)
+	}
+	return d, nil
+}
+
+// Delete on a plain v2 registry can only remove manifests, so deleting a
+// tag removes the manifest it points to (and every other tag sharing it).
+func (b *v2Browser) Delete(repo, ref string) error {
+	digest, err := b.resolveDigest(repo, ref)
+	if err != nil {
+		return err
+	}
+	resp, err := b.c.do("DELETE", "/v2/"+repo+"/manifests/"+digest, repoScope(repo, "pull,push,delete"), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return registryError(resp)
+	}
+	return nil
+}
+
+// ── Harbor ──────────────────────────────────────────────────────────────────
+
+// harborBrowser lists repositories and deletes tags through Harbor's own
+// REST API (/api/v2.0), which honours project membership, and falls back to
+// v2 for tags and manifests.
+type harborBrowser struct {
+	*v2Browser
+}
+
+func (b *harborBrowser) api(method, path string, v interface{}) (*http.Response, error) {
+	req, err := http.NewRequest(method, buildRegistryBaseURL(b.c.reg.URL, b.c.reg.SSLEnabled)+"/api/v2.0"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if b.c.reg.Username != "" {
+		req.SetBasicAuth(b.c.reg.Username, b.c.password)
+	}
+	resp, err := b.c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp, registryError(resp)
+	}
+	if v != nil {
+		return resp, json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp, nil
+}
+
+// harborRepoPath splits "project/sub/repo" into the project and the
+// repository name, double-escaped as Harbor requires for nested names.
+func harborRepoPath(repo string) (string, string) {
+	project, name, _ := strings.Cut(repo, "/")
+	return url.PathEscape(project), url.PathEscape(url.PathEscape(name))
+}
+
+// Catalog pages through /api/v2.0/repositories; last is the page number.
+func (b *harborBrowser) Catalog(n int, last string) ([]string, string, error) {
+	page, _ := strconv.Atoi(last)
+	if page < 1 {
+		page = 1
+	}
+	var out []struct {
+		Name string `json:"name"`
+	}
+	resp, err := b.api("GET", fmt.Sprintf("/repositories?page=%d&page_size=%d", page, n), &out)
+	if err != nil {
+		return nil, "", err
+	}
+	repos := make([]string, 0, len(out))
+	for _, r := range out {
+		repos = append(repos, r.Name)
+	}
+	next := ""
+	if total, _ := strconv.Atoi(resp.Header.Get("X-Total-Count")); total > page*n {
+		next = strconv.Itoa(page + 1)
+	}
+	return repos, next, nil
+}
+
+// Delete removes just the tag via Harbor's artifact API; digests delete
+// the whole artifact.
+func (b *harborBrowser) Delete(repo, ref string) error {
+	project, name := harborRepoPath(repo)
+	if strings.HasPrefix(ref, "sha256:") {
+		_, err := b.api("DELETE", fmt.Sprintf("/projects/%s/repositories/%s/artifacts/%s", project, name, ref), nil)
+		return err
+	}
+	_, err := b.api("DELETE", fmt.Sprintf("/projects/%s/repositories/%s/artifacts/%s/tags/%s",
+		project, name, url.PathEscape(ref), url.PathEscape(ref)), nil)
+	return err
+}
+
+// ── GitLab ──────────────────────────────────────────────────────────────────
+
+// gitlabBrowser uses the GitLab REST API for listing and tag deletion.
+// extra_config keys: gitlab_api_url (default https://gitlab.com) and either
+// gitlab_project or gitlab_group (numeric ID or full path). The registry
+// password is used as the PRIVATE-TOKEN.
+type gitlabBrowser struct {
+	*v2Browser
+}
+
+type gitlabRepository struct {
+	ID        int    `json:"id"`
+	Path      string `json:"path"`
+	ProjectID int    `json:"project_id"`
+}
+
+func (b *gitlabBrowser) config() (apiURL, project, group string) {
+	var extra map[string]string
+	json.Unmarshal([]byte(b.c.reg.ExtraConfig), &extra) //nolint:errcheck
+	apiURL = strings.TrimRight(extra["gitlab_api_url"], "/")
+	if apiURL == "" {
+		apiURL = "https://gitlab.com"
+	}
+	return apiURL, extra["gitlab_project"], extra["gitlab_group"]
+}
+
+func (b *gitlabBrowser) api(method, path string, v interface{}) (*http.Response, error) {
+	apiURL, _, _ := b.config()
+	req, err := http.NewRequest(method, apiURL+"/api/v4"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", b.c.password)
+	resp, err := b.c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp, registryError(resp)
+	}
+	if v != nil {
+		return resp, json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp, nil
+}
+
+func (b *gitlabBrowser) repositories(page, perPage int) ([]gitlabRepository, *http.Response, error) {
+	_, project, group := b.config()
+	var base string
+	switch {
+	case project != "":
+		base = "/projects/" + url.PathEscape(project) + "/registry/repositories"
+	case group != "":
+		base = "/groups/" + url.PathEscape(group) + "/registry/repositories"
+	default:
+		return nil, nil, fmt.Errorf("gitlab_project or gitlab_group must be set in extra_config")
+	}
+	var out []gitlabRepository
+	resp, err := b.api("GET", fmt.Sprintf("%s?page=%d&per_page=%d", base, page, perPage), &out)
+	return out, resp, err
+}
+
+// Catalog pages through the registry repositories; last is the page number.
+func (b *gitlabBrowser) Catalog(n int, last string) ([]string, string, error) {
+	page, _ := strconv.Atoi(last)
+	if page < 1 {
+		page = 1
+	}
+	list, resp, err := b.repositories(page, n)
+	if err != nil {
+		return nil, "", err
+	}
+	repos := make([]string, 0, len(list))
+	for _, r := range list {
+		repos = append(repos, r.Path)
+	}
+	return repos, resp.Header.Get("X-Next-Page"), nil
+}
+
+// Delete removes a single tag through the API; digests go through v2.
+func (b *gitlabBrowser) Delete(repo, ref string) error {
+	if strings.HasPrefix(ref, "sha256:") {
+		return b.v2Browser.Delete(repo, ref)
+	}
+	for page := 1; page > 0; {
+		list, resp, err := b.repositories(page, 100)
+		if err != nil {
+			return err
+		}
+		for _, r := range list {
+			if r.Path == repo {
+				_, err := b.api("DELETE", fmt.Sprintf("/projects/%d/registry/repositories/%d/tags/%s",
+					r.ProjectID, r.ID, url.PathEscape(ref)), nil)
+				return err
+			}
+		}
+		page, _ = strconv.Atoi(resp.Header.Get("X-Next-Page"))
+	}
+	return &registryStatusError{Status: http.StatusNotFound, Message: "repository " + repo + " not found in GitLab"}
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// registryBrowserFromRequest loads the registry named by {id}.
+func registryBrowserFromRequest(w http.ResponseWriter, r *http.Request) (registryBrowser, bool) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	reg, password, err := loadRegistryCredentials(id)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil, false
+	}
+	return newRegistryBrowser(reg, password), true
+}
+
+func writeRegistryError(w http.ResponseWriter, err error) {
+	if se, ok := err.(*registryStatusError); ok {
+		switch se.Status {
+		case http.StatusNotFound, http.StatusForbidden, http.StatusMethodNotAllowed:
+			http.Error(w, se.Message, se.Status)
+			return
+		}
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+// GET /api/cicd/registries/{id}/catalog?n=100&last=xxx
+func BrowseRegistryCatalog(w http.ResponseWriter, r *http.Request) {
+	b, ok := registryBrowserFromRequest(w, r)
+	if !ok {
+		return
+	}
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	if n <= 0 || n > 1000 {
+		n = 100
+	}
+	repos, next, err := b.Catalog(n, r.URL.Query().Get("last"))
+	if err != nil {
+		writeRegistryError(w, err)
+		return
+	}
+	if repos == nil {
+		repos = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"repositories": repos, "next": next})
+}
+
+// GET /api/cicd/registries/{id}/tags?repository=team/app
+func BrowseRegistryTags(w http.ResponseWriter, r *http.Request) {
+	b, ok := registryBrowserFromRequest(w, r)
+	if !ok {
+		return
+	}
+	repo := r.URL.Query().Get("repository")
+	if repo == "" {
+		http.Error(w, "repository is required", http.StatusBadRequest)
+		return
+	}
+	tags, err := b.Tags(repo)
+	if err != nil {
+		writeRegistryError(w, err)
+		return
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"repository": repo, "tags": tags})
+}
+
+// GET /api/cicd/registries/{id}/manifest?repository=team/app&reference=1.0
+func InspectRegistryManifest(w http.ResponseWriter, r *http.Request) {
+	b, ok := registryBrowserFromRequest(w, r)
+	if !ok {
+		return
+	}
+	repo, ref := r.URL.Query().Get("repository"), r.URL.Query().Get("reference")
+	if repo == "" || ref == "" {
+		http.Error(w, "repository and reference are required", http.StatusBadRequest)
+		return
+	}
+	info, err := b.Manifest(repo, ref)
+	if err != nil {
+		writeRegistryError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// DELETE /api/cicd/registries/{id}/manifest?repository=team/app&reference=1.0
+// reference may be a tag or a sha256 digest.
+func DeleteRegistryManifest(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_cicd_full") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	b, ok := registryBrowserFromRequest(w, r)
+	if !ok {
+		return
+	}
+	repo, ref := r.URL.Query().Get("repository"), r.URL.Query().Get("reference")
+	if repo == "" || ref == "" {
+		http.Error(w, "repository and reference are required", http.StatusBadRequest)
+		return
+	}
+	target := fmt.Sprintf("registry %s %s:%s", mux.Vars(r)["id"], repo, ref)
+	if err := b.Delete(repo, ref); err != nil {
+		recordActivityLog("registry_delete", target, err.Error(), "error")
+		writeRegistryError(w, err)
+		return
+	}
+	recordActivityLog("registry_delete", target, "deleted by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
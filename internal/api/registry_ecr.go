@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ECR does not accept static credentials for docker login; a short-lived
+// token has to be fetched with GetAuthorizationToken. The call is signed
+// with AWS Signature V4 directly so no AWS SDK is needed.
+//
+// Keys read from the registry's extra_config:
+//   aws_region, aws_account                          – endpoint
+//   aws_access_key_id, aws_secret_access_key         – credentials
+//   aws_session_token                                – optional (STS)
+// When the key pair is missing the registry's username/password are used.
+
+type ecrToken struct {
+	username string
+	password string
+	expires  time.Time
+}
+
+var (
+	ecrTokenMu    sync.Mutex
+	ecrTokenCache = map[int]ecrToken{}
+)
+
+// ecrCredentials returns a docker username/password for an "aws" registry,
+// reusing a cached token until shortly before it expires.
+func ecrCredentials(reg CicdRegistry, password string) (string, string, error) {
+	ecrTokenMu.Lock()
+	defer ecrTokenMu.Unlock()
+	if t, ok := ecrTokenCache[reg.ID]; ok && time.Until(t.expires) > 5*time.Minute {
+		return t.username, t.password, nil
+	}
+
+	var extra map[string]string
+	json.Unmarshal([]byte(reg.ExtraConfig), &extra) //nolint:errcheck
+	region := extra["aws_region"]
+	accessKey := extra["aws_access_key_id"]
+	secretKey := extra["aws_secret_access_key"]
+	if accessKey == "" {
+		accessKey, secretKey = reg.Username, password
+	}
+	if region == "" || accessKey == "" || secretKey == "" {
+		return "", "", fmt.Errorf("aws_region and AWS access keys are required for ECR")
+	}
+
+	body := []byte("{}")
+	host := fmt.Sprintf("api.ecr.%s.amazonaws.com", region)
+	req, err := http.NewRequest("POST", "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	if tok := extra["aws_session_token"]; tok != "" {
+		req.Header.Set("X-Amz-Security-Token", tok)
+	}
+	signAWSv4(req, body, accessKey, secretKey, region, "ecr", time.Now().UTC())
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("ECR GetAuthorizationToken: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("ECR GetAuthorizationToken: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var out struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil || len(out.AuthorizationData) == 0 {
+		return "", "", fmt.Errorf("ECR GetAuthorizationToken: unexpected response")
+	}
+	raw, err := base64.StdEncoding.DecodeString(out.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return "", "", fmt.Errorf("ECR token: %v", err)
+	}
+	user, pass, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return "", "", fmt.Errorf("ECR token: malformed")
+	}
+	t := ecrToken{username: user, password: pass, expires: time.Unix(int64(out.AuthorizationData[0].ExpiresAt), 0)}
+	ecrTokenCache[reg.ID] = t
+	return t.username, t.password, nil
+}
+
+// signAWSv4 adds Signature Version 4 headers to req.
+func signAWSv4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Host", req.URL.Host)
+
+	signed := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if req.Header.Get("X-Amz-Security-Token") != "" {
+		signed = append(signed, "x-amz-security-token")
+		signed[3], signed[4] = signed[4], signed[3] // keep sorted
+	}
+	var canonHeaders strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
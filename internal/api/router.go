@@ -24,6 +24,9 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/auth/oidc/callback", OIDCCallback).Methods("GET")
 	r.HandleFunc("/auth/oidc/begin", OIDCBeginAuth).Methods("GET")
 
+	// Git push webhooks (signed, not session-authenticated)
+	api.HandleFunc("/webhooks/git/{id}", ReceiveGitWebhook).Methods("POST")
+
 	// Users
 	api.HandleFunc("/users", ListUsers).Methods("GET")
 	api.HandleFunc("/users", CreateUser).Methods("POST")
@@ -62,6 +65,14 @@ func NewRouter() *mux.Router {
 	api.HandleFunc("/images/search", searchImages).Methods("GET")
 	api.HandleFunc("/images/tag", tagImage).Methods("POST")
 	api.HandleFunc("/images/prune", pruneImages).Methods("POST")
+	api.HandleFunc("/images/build", buildImage).Methods("POST")
+	api.HandleFunc("/images/builds", listImageBuilds).Methods("GET")
+	api.HandleFunc("/images/builds/{id}", getImageBuild).Methods("GET")
+	api.HandleFunc("/images/builds/{id}/logs", streamImageBuildLogs).Methods("GET")
+	api.HandleFunc("/images/push", pushImage).Methods("POST")
+	api.HandleFunc("/images/pushes", listImagePushes).Methods("GET")
+	api.HandleFunc("/images/pushes/{id}", getImagePush).Methods("GET")
+	api.HandleFunc("/images/pushes/{id}/logs", streamImagePushLogs).Methods("GET")
 	api.HandleFunc("/images/{id}/remove", removeImage).Methods("DELETE")
 	api.HandleFunc("/images/{id}/inspect", inspectImage).Methods("GET")
 
@@ -69,6 +80,16 @@ func NewRouter() *mux.Router {
 	api.HandleFunc("/volumes", listVolumes).Methods("GET")
 	api.HandleFunc("/volumes/create", createVolume).Methods("POST")
 	api.HandleFunc("/volumes/prune", pruneVolumes).Methods("POST")
+	api.HandleFunc("/volumes/backups", listVolumeBackups).Methods("GET")
+	api.HandleFunc("/volumes/backups/{id}", getVolumeBackup).Methods("GET")
+	api.HandleFunc("/volumes/backups/{id}", removeVolumeBackup).Methods("DELETE")
+	api.HandleFunc("/volumes/backups/{id}/download", downloadVolumeBackup).Methods("GET")
+	api.HandleFunc("/volumes/backups/{id}/restore", restoreVolume).Methods("POST")
+	api.HandleFunc("/volumes/backup-schedules", listVolumeBackupSchedules).Methods("GET")
+	api.HandleFunc("/volumes/backup-schedules", saveVolumeBackupSchedule).Methods("POST")
+	api.HandleFunc("/volumes/backup-schedules/{id}", deleteVolumeBackupSchedule).Methods("DELETE")
+	api.HandleFunc("/volumes/{name}/backup", backupVolume).Methods("POST")
+	api.HandleFunc("/volumes/{name}/clone", cloneVolume).Methods("POST")
 	api.HandleFunc("/volumes/{name}/remove", removeVolume).Methods("DELETE")
 	api.HandleFunc("/volumes/{name}/inspect", inspectVolume).Methods("GET")
 
@@ -103,6 +124,11 @@ func NewRouter() *mux.Router {
 	api.HandleFunc("/settings/sso", GetSSOSettings).Methods("GET")
 	api.HandleFunc("/settings/sso", SaveSSOSettings).Methods("POST")
 
+	// Secrets vault
+	api.HandleFunc("/vault/status", GetVaultStatus).Methods("GET")
+	api.HandleFunc("/vault/rotate", RotateVault).Methods("POST")
+	api.HandleFunc("/vault/reveal", RevealSecret).Methods("POST")
+
 	// Load Balancer
 	api.HandleFunc("/lb/routes", ListLBRoutes).Methods("GET")
 	api.HandleFunc("/lb/routes", AddLBRoute).Methods("POST")
@@ -118,6 +144,12 @@ func NewRouter() *mux.Router {
 	api.HandleFunc("/k0s/clusters/{id}/workers", AddWorkerNode).Methods("POST")
 	api.HandleFunc("/k0s/clusters/{id}/workers/{nodeId}", DeleteWorkerNode).Methods("DELETE")
 	api.HandleFunc("/k0s/clusters/{id}/nodes", GetClusterNodes).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/nodes/{nodeId}/replace", ReplaceK0sNode).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/controllers", AddK0sController).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/upgrade", UpgradeK0sCluster).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/operations", ListK0sOperations).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/operations/{opId}", GetK0sOperation).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/operations/{opId}/logs", StreamK0sOperationLogs).Methods("GET") // WebSocket
 	api.HandleFunc("/k0s/clusters/{id}/kubeconfig", DownloadKubeconfig).Methods("GET")
 	api.HandleFunc("/k0s/clusters/{id}/kubeconfig-status", GetKubeconfigStatus).Methods("GET")
 	api.HandleFunc("/k0s/clusters/{id}/my-kubeconfig", DownloadMyKubeconfig).Methods("GET")
@@ -149,20 +181,77 @@ func NewRouter() *mux.Router {
 	api.HandleFunc("/k0s/clusters/{id}/k8s/nodes/{name}", UpdateNodeLabels).Methods("PATCH")
 	api.HandleFunc("/k0s/clusters/{id}/k8s/nodes-metrics", GetNodeMetrics).Methods("GET")
 	api.HandleFunc("/k0s/clusters/{id}/k8s/pods-metrics", GetPodMetrics).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/apply-history", ListApplyHistory).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/apply-history/{version}", GetApplyHistoryVersion).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/api-resources", GetClusterAPIResources).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/watch/{resource}", WatchClusterResources).Methods("GET") // WebSocket
+	api.HandleFunc("/k0s/clusters/{id}/k8s/logs/stream", StreamAggregatedLogs).Methods("GET")       // WebSocket
 	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}", GetClusterResources).Methods("GET")
 	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}", GetClusterResourceByName).Methods("GET")
 	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}", DeleteClusterResource).Methods("DELETE")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}", UpdateClusterResource).Methods("PUT")
 	api.HandleFunc("/k0s/clusters/{id}/k8s/pods/{name}/logs", GetResourceLogs).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/pods/{name}/logs/stream", StreamPodLogs).Methods("GET") // WebSocket
 	api.HandleFunc("/k0s/clusters/{id}/k8s/pods/{name}/describe", GetPodDescribe).Methods("GET")
 	api.HandleFunc("/k0s/clusters/{id}/k8s/pods/{name}/events", GetPodEvents).Methods("GET")
-	api.HandleFunc("/k0s/clusters/{id}/k8s/pods/{name}/exec", PodExec).Methods("GET") // WebSocket
+	api.HandleFunc("/k0s/clusters/{id}/k8s/pods/{name}/exec", PodExec).Methods("GET")                                         // WebSocket
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource:pods|services}/{name}/portforward", PortForwardWebSocket).Methods("GET") // WebSocket
 	api.HandleFunc("/k0s/clusters/{id}/k8s/apply", ApplyClusterResource).Methods("POST")
 
+	// Workload and node actions
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}/scale", ScaleWorkload).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}/restart", RestartWorkload).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}/rollout-status", GetRolloutStatus).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}/rollout-history", GetRolloutHistory).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource}/{name}/rollout-undo", UndoRollout).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource:cronjobs}/{name}/suspend", SuspendCronJob).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource:cronjobs}/{name}/resume", ResumeCronJob).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource:cronjobs}/{name}/trigger", TriggerCronJob).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource:nodes}/{name}/cordon", CordonNode).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource:nodes}/{name}/uncordon", UncordonNode).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/k8s/{resource:nodes}/{name}/drain", DrainNode).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/node-drains/{drainId}", GetNodeDrain).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/node-drains/{drainId}/logs", StreamNodeDrainLogs).Methods("GET") // WebSocket
+	api.HandleFunc("/k0s/clusters/{id}/port-forwards", ListPortForwards).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/port-forwards", CreatePortForward).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/port-forwards/{forwardId}", DeletePortForward).Methods("DELETE")
+
+	// Helm
+	api.HandleFunc("/helm/repositories", ListHelmRepositories).Methods("GET")
+	api.HandleFunc("/helm/repositories", CreateHelmRepository).Methods("POST")
+	api.HandleFunc("/helm/repositories/{id}", DeleteHelmRepository).Methods("DELETE")
+	api.HandleFunc("/helm/repositories/{id}/charts", ListHelmRepositoryCharts).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/helm/releases", ListHelmReleases).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/helm/releases", InstallHelmRelease).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/helm/releases/{namespace}/{name}", GetHelmRelease).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/helm/releases/{namespace}/{name}", UninstallHelmRelease).Methods("DELETE")
+	api.HandleFunc("/k0s/clusters/{id}/helm/releases/{namespace}/{name}/history", GetHelmReleaseHistory).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/helm/releases/{namespace}/{name}/upgrade", UpgradeHelmRelease).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/helm/releases/{namespace}/{name}/rollback", RollbackHelmRelease).Methods("POST")
+	api.HandleFunc("/k0s/clusters/{id}/helm/operations", ListHelmOperations).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/helm/operations/{opId}", GetHelmOperation).Methods("GET")
+	api.HandleFunc("/k0s/clusters/{id}/helm/operations/{opId}/logs", StreamHelmOperationLogs).Methods("GET") // WebSocket
+
+	// Cluster backups
+	api.HandleFunc("/k0s/clusters/{id}/backups", BackupCluster).Methods("POST")
+	api.HandleFunc("/k0s/backups", ListClusterBackups).Methods("GET")
+	api.HandleFunc("/k0s/backups/{id}", GetClusterBackup).Methods("GET")
+	api.HandleFunc("/k0s/backups/{id}", DeleteClusterBackup).Methods("DELETE")
+	api.HandleFunc("/k0s/backups/{id}/download", DownloadClusterBackup).Methods("GET")
+	api.HandleFunc("/k0s/backups/{id}/restore", RestoreClusterBackup).Methods("POST")
+	api.HandleFunc("/k0s/backup-schedules", ListClusterBackupSchedules).Methods("GET")
+	api.HandleFunc("/k0s/backup-schedules", SaveClusterBackupSchedule).Methods("POST")
+	api.HandleFunc("/k0s/backup-schedules/{id}", DeleteClusterBackupSchedule).Methods("DELETE")
+
 	// CI/CD Registries
 	api.HandleFunc("/cicd/registries", ListRegistries).Methods("GET")
 	api.HandleFunc("/cicd/registries", CreateRegistry).Methods("POST")
 	api.HandleFunc("/cicd/registries/test", TestRegistry).Methods("POST")
 	api.HandleFunc("/cicd/registries/{id}", GetRegistry).Methods("GET")
+	api.HandleFunc("/cicd/registries/{id}/catalog", BrowseRegistryCatalog).Methods("GET")
+	api.HandleFunc("/cicd/registries/{id}/tags", BrowseRegistryTags).Methods("GET")
+	api.HandleFunc("/cicd/registries/{id}/manifest", InspectRegistryManifest).Methods("GET")
+	api.HandleFunc("/cicd/registries/{id}/manifest", DeleteRegistryManifest).Methods("DELETE")
 	api.HandleFunc("/cicd/registries/{id}", DeleteRegistry).Methods("DELETE")
 
 	// CI/CD Workers  (admin only)
@@ -172,22 +261,72 @@ func NewRouter() *mux.Router {
 	api.HandleFunc("/cicd/workers/{id}", GetWorker).Methods("GET")
 	api.HandleFunc("/cicd/workers/{id}", DeleteWorker).Methods("DELETE")
 	api.HandleFunc("/cicd/workers/{id}/test", TestWorkerSSH).Methods("POST")
+	api.HandleFunc("/cicd/workers/{id}/host-key", ResetWorkerHostKey).Methods("DELETE")
+	api.HandleFunc("/cicd/workers/{id}/capacity", UpdateWorkerCapacity).Methods("PUT")
 
 	// Security Scan Reports
 	api.HandleFunc("/cicd/scans", ListScanReports).Methods("GET")
 	api.HandleFunc("/cicd/scans/summary", ScanSummary).Methods("GET")
 	api.HandleFunc("/cicd/scans", CreateScanReport).Methods("POST")
+	api.HandleFunc("/cicd/scans/image", ScanImage).Methods("POST")
+	api.HandleFunc("/cicd/scans/ingest", IngestScanReport).Methods("POST")
+	api.HandleFunc("/cicd/scans/diff", DiffScanReports).Methods("GET")
+	api.HandleFunc("/cicd/scans/trend", ScanTrend).Methods("GET")
+	api.HandleFunc("/cicd/scans/triage", ListFindingTriage).Methods("GET")
+	api.HandleFunc("/cicd/scans/triage", TriageFinding).Methods("POST")
+	api.HandleFunc("/cicd/scans/triage/{id}", DeleteFindingTriage).Methods("DELETE")
+	api.HandleFunc("/cicd/vulndb", GetVulnDBStatus).Methods("GET")
+	api.HandleFunc("/cicd/vulndb/import", ImportVulnDB).Methods("POST")
 	api.HandleFunc("/cicd/scans/{id}", GetScanReport).Methods("GET")
+	api.HandleFunc("/cicd/scans/{id}/findings", ListScanFindings).Methods("GET")
 	api.HandleFunc("/cicd/scans/{id}", DeleteScanReport).Methods("DELETE")
 
+	// Admission gate
+	api.HandleFunc("/admission/policies", ListAdmissionPolicies).Methods("GET")
+	api.HandleFunc("/admission/policies", CreateAdmissionPolicy).Methods("POST")
+	api.HandleFunc("/admission/policies/{id}", UpdateAdmissionPolicy).Methods("PUT")
+	api.HandleFunc("/admission/policies/{id}", DeleteAdmissionPolicy).Methods("DELETE")
+	api.HandleFunc("/admission/check", CheckAdmission).Methods("POST")
+	api.HandleFunc("/admission/events", ListAdmissionEvents).Methods("GET")
+
+	// Pipelines
+	api.HandleFunc("/cicd/pipelines", ListPipelines).Methods("GET")
+	api.HandleFunc("/cicd/pipelines", CreatePipeline).Methods("POST")
+	api.HandleFunc("/cicd/pipelines/validate", ValidatePipeline).Methods("POST")
+	api.HandleFunc("/cicd/pipelines/{id}", GetPipeline).Methods("GET")
+	api.HandleFunc("/cicd/pipelines/{id}", UpdatePipeline).Methods("PUT")
+	api.HandleFunc("/cicd/pipelines/{id}", DeletePipeline).Methods("DELETE")
+	api.HandleFunc("/cicd/pipelines/{id}/run", RunPipeline).Methods("POST")
+	api.HandleFunc("/cicd/pipelines/{id}/runs", ListPipelineRuns).Methods("GET")
+	api.HandleFunc("/cicd/pipeline-runs/{id}", GetPipelineRun).Methods("GET")
+	api.HandleFunc("/cicd/pipeline-runs/{id}/cancel", CancelPipelineRun).Methods("POST")
+	api.HandleFunc("/cicd/pipeline-jobs/{id}/logs", StreamPipelineJobLogs).Methods("GET")
+	api.HandleFunc("/cicd/pipeline-jobs/{id}/artifacts", DownloadPipelineArtifacts).Methods("GET")
+	api.HandleFunc("/cicd/secrets", ListCicdSecrets).Methods("GET")
+	api.HandleFunc("/cicd/secrets", SetCicdSecret).Methods("POST")
+	api.HandleFunc("/cicd/secrets/{id}", DeleteCicdSecret).Methods("DELETE")
+
 	// GitOps
 	api.HandleFunc("/cicd/gitops/repos", ListGitopsRepos).Methods("GET")
 	api.HandleFunc("/cicd/gitops/repos", CreateGitopsRepo).Methods("POST")
 	api.HandleFunc("/cicd/gitops/repos/{id}", DeleteGitopsRepo).Methods("DELETE")
+	api.HandleFunc("/cicd/gitops/repos/{id}/webhook", GetRepoWebhook).Methods("GET")
+	api.HandleFunc("/cicd/gitops/repos/{id}/webhook", ConfigureRepoWebhook).Methods("POST")
+	api.HandleFunc("/cicd/gitops/repos/{id}/webhook", DisableRepoWebhook).Methods("DELETE")
+	api.HandleFunc("/cicd/gitops/repos/{id}/webhook/deliveries", ListWebhookDeliveries).Methods("GET")
+	api.HandleFunc("/cicd/gitops/webhook-deliveries/{id}", GetWebhookDelivery).Methods("GET")
+	api.HandleFunc("/cicd/gitops/webhook-deliveries/{id}/replay", ReplayWebhookDelivery).Methods("POST")
 	api.HandleFunc("/cicd/gitops/deployments", ListDeployments).Methods("GET")
 	api.HandleFunc("/cicd/gitops/deployments", CreateDeployment).Methods("POST")
 	api.HandleFunc("/cicd/gitops/deployments/{id}", GetDeployment).Methods("GET")
 	api.HandleFunc("/cicd/gitops/deployments/{id}/deploy", TriggerDeploy).Methods("POST")
+	api.HandleFunc("/cicd/gitops/deployments/{id}/pause", PauseDeployment).Methods("POST")
+	api.HandleFunc("/cicd/gitops/deployments/{id}/resume", ResumeDeployment).Methods("POST")
+	api.HandleFunc("/cicd/gitops/deployments/{id}/sync", UpdateDeploymentSync).Methods("PUT")
+	api.HandleFunc("/cicd/gitops/deployments/{id}/runs", ListDeploymentRuns).Methods("GET")
+	api.HandleFunc("/cicd/gitops/deployments/{id}/rollback", RollbackDeployment).Methods("POST")
+	api.HandleFunc("/cicd/gitops/deployments/{id}/drift", CheckDeploymentDrift).Methods("POST")
+	api.HandleFunc("/cicd/gitops/runs/{id}", GetDeploymentRun).Methods("GET")
 	api.HandleFunc("/cicd/gitops/deployments/{id}", DeleteDeployment).Methods("DELETE")
 
 	return r
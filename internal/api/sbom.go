@@ -0,0 +1,421 @@
+package api
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"debug/buildinfo"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// maxScannedBinary bounds how much of a single executable is buffered to
+// look for Go build info.
+const maxScannedBinary = 256 << 20
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type SBOMPackage struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	Type          string `json:"type"` // deb, apk, rpm, golang, npm, pypi
+	Ecosystem     string `json:"ecosystem"`
+	Source        string `json:"source,omitempty"` // source package for OS packages
+	SourceVersion string `json:"source_version,omitempty"`
+	Path          string `json:"path,omitempty"`
+}
+
+type ImageOS struct {
+	ID        string `json:"id"`
+	VersionID string `json:"version_id"`
+	Pretty    string `json:"pretty_name"`
+}
+
+type ImageSBOM struct {
+	OS       ImageOS       `json:"os"`
+	Packages []SBOMPackage `json:"packages"`
+}
+
+// osEcosystem maps os-release to the OSV ecosystem used by its packages.
+func (o ImageOS) osEcosystem() string {
+	switch o.ID {
+	case "debian":
+		major, _, _ := strings.Cut(o.VersionID, ".")
+		return "Debian:" + major
+	case "ubuntu":
+		return "Ubuntu:" + o.VersionID
+	case "alpine":
+		parts := strings.SplitN(o.VersionID, ".", 3)
+		if len(parts) >= 2 {
+			return "Alpine:v" + parts[0] + "." + parts[1]
+		}
+		return "Alpine"
+	case "rhel", "centos":
+		return "Red Hat"
+	case "rocky":
+		return "Rocky Linux"
+	case "almalinux":
+		return "AlmaLinux"
+	case "opensuse-leap", "opensuse-tumbleweed":
+		return "openSUSE"
+	case "sles":
+		return "SUSE"
+	}
+	return ""
+}
+
+// ── Extraction ──────────────────────────────────────────────────────────────
+
+// extractImageSBOM creates (but never starts) a container from imageRef
+// and walks its exported filesystem once, collecting OS and language
+// packages.
+func extractImageSBOM(ctx context.Context, cli *client.Client, imageRef string) (*ImageSBOM, error) {
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:      imageRef,
+		Entrypoint: []string{"/nonexistent"},
+		Labels:     map[string]string{"docker-management.scan": "true"},
+	}, nil, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("create scan container: %v", err)
+	}
+	defer cli.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true})
+
+	rc, err := cli.ContainerExport(ctx, created.ID)
+	if err != nil {
+		return nil, fmt.Errorf("export filesystem: %v", err)
+	}
+	defer rc.Close()
+	return sbomFromTar(rc)
+}
+
+func sbomFromTar(r io.Reader) (*ImageSBOM, error) {
+	sbom := &ImageSBOM{}
+	var rpmDB []byte
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := "/" + strings.TrimPrefix(path.Clean(hdr.Name), "/")
+		base := path.Base(name)
+
+		switch {
+		case name == "/etc/os-release" || (name == "/usr/lib/os-release" && sbom.OS.ID == ""):
+			data, _ := io.ReadAll(tr)
+			sbom.OS = parseOSRelease(data)
+		case name == "/var/lib/dpkg/status":
+			sbom.Packages = append(sbom.Packages, parseDpkgStatus(tr)...)
+		case strings.HasPrefix(name, "/var/lib/dpkg/status.d/"):
+			// distroless images keep one status file per package
+			sbom.Packages = append(sbom.Packages, parseDpkgStatus(tr)...)
+		case name == "/lib/apk/db/installed":
+			sbom.Packages = append(sbom.Packages, parseApkInstalled(tr)...)
+		case name == "/var/lib/rpm/rpmdb.sqlite" || name == "/usr/lib/sysimage/rpm/rpmdb.sqlite":
+			rpmDB, _ = io.ReadAll(tr)
+		case base == "package.json" && strings.Contains(name, "/node_modules/"):
+			if p, ok := parseNodePackage(tr, name); ok {
+				sbom.Packages = append(sbom.Packages, p)
+			}
+		case base == "METADATA" && strings.HasSuffix(path.Dir(name), ".dist-info"),
+			base == "PKG-INFO" && strings.HasSuffix(path.Dir(name), ".egg-info"):
+			if p, ok := parsePythonMetadata(tr, name); ok {
+				sbom.Packages = append(sbom.Packages, p)
+			}
+		case hdr.Mode&0111 != 0 && hdr.Size > 4 && hdr.Size < maxScannedBinary:
+			sbom.Packages = append(sbom.Packages, parseGoBinary(tr, name, hdr.Size)...)
+		}
+	}
+	if rpmDB != nil {
+		pkgs, err := parseRpmSqlite(rpmDB)
+		if err == nil {
+			sbom.Packages = append(sbom.Packages, pkgs...)
+		}
+	}
+
+	eco := sbom.OS.osEcosystem()
+	for k := range sbom.Packages {
+		switch sbom.Packages[k].Type {
+		case "deb", "apk", "rpm":
+			sbom.Packages[k].Ecosystem = eco
+		}
+	}
+	return sbom, nil
+}
+
+func parseOSRelease(data []byte) ImageOS {
+	var o ImageOS
+	for _, line := range strings.Split(string(data), "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		v = strings.Trim(v, `"'`)
+		switch k {
+		case "ID":
+			o.ID = v
+		case "VERSION_ID":
+			o.VersionID = v
+		case "PRETTY_NAME":
+			o.Pretty = v
+		}
+	}
+	return o
+}
+
+// parseDpkgStatus reads installed packages from a dpkg status file.
+func parseDpkgStatus(r io.Reader) []SBOMPackage {
+	var out []SBOMPackage
+	var cur SBOMPackage
+	installed := true
+	flush := func() {
+		if cur.Name != "" && cur.Version != "" && installed {
+			if cur.Source == "" {
+				cur.Source = cur.Name
+			}
+			if cur.SourceVersion == "" {
+				cur.SourceVersion = cur.Version
+			}
+			cur.Type = "deb"
+			out = append(out, cur)
+		}
+		cur, installed = SBOMPackage{}, true
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		k, v, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "Package":
+			cur.Name = v
+		case "Version":
+			cur.Version = v
+		case "Status":
+			installed = strings.HasSuffix(v, " installed")
+		case "Source":
+			// "Source: openssl (3.0.11-1~deb12u2)" or just "Source: openssl"
+			name, ver, _ := strings.Cut(v, " ")
+			cur.Source = name
+			cur.SourceVersion = strings.Trim(ver, "()")
+		}
+	}
+	flush()
+	return out
+}
+
+// parseApkInstalled reads Alpine's package database.
+func parseApkInstalled(r io.Reader) []SBOMPackage {
+	var out []SBOMPackage
+	var cur SBOMPackage
+	flush := func() {
+		if cur.Name != "" && cur.Version != "" {
+			if cur.Source == "" {
+				cur.Source = cur.Name
+			}
+			cur.SourceVersion = cur.Version
+			cur.Type = "apk"
+			out = append(out, cur)
+		}
+		cur = SBOMPackage{}
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'P':
+			cur.Name = line[2:]
+		case 'V':
+			cur.Version = line[2:]
+		case 'o':
+			cur.Source = line[2:]
+		}
+	}
+	flush()
+	return out
+}
+
+func parseNodePackage(r io.Reader, name string) (SBOMPackage, bool) {
+	var pkg struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, 1<<20)).Decode(&pkg); err != nil || pkg.Name == "" || pkg.Version == "" {
+		return SBOMPackage{}, false
+	}
+	// Only the package's own manifest, not nested fixtures
+	dir := path.Dir(name)
+	if !strings.HasSuffix(dir, "/node_modules/"+pkg.Name) {
+		return SBOMPackage{}, false
+	}
+	return SBOMPackage{Name: pkg.Name, Version: pkg.Version, Type: "npm", Ecosystem: "npm", Path: name}, true
+}
+
+func parsePythonMetadata(r io.Reader, name string) (SBOMPackage, bool) {
+	p := SBOMPackage{Type: "pypi", Ecosystem: "PyPI", Path: name}
+	sc := bufio.NewScanner(io.LimitReader(r, 1<<20))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			break // end of headers
+		}
+		if v, ok := strings.CutPrefix(line, "Name: "); ok {
+			p.Name = strings.ToLower(strings.ReplaceAll(v, "_", "-"))
+		} else if v, ok := strings.CutPrefix(line, "Version: "); ok {
+			p.Version = v
+		}
+	}
+	return p, p.Name != "" && p.Version != ""
+}
+
+// parseGoBinary reports the Go toolchain and module dependencies embedded
+// in an executable's build info.
+func parseGoBinary(r io.Reader, name string, size int64) []SBOMPackage {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil || !bytes.Equal(magic, []byte("\x7fELF")) {
+		return nil
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil
+	}
+	info, err := buildinfo.Read(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	out := []SBOMPackage{{
+		Name: "stdlib", Version: strings.TrimPrefix(info.GoVersion, "go"), Type: "golang", Ecosystem: "Go", Path: name,
+	}}
+	if info.Main.Path != "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		out = append(out, SBOMPackage{Name: info.Main.Path, Version: info.Main.Version, Type: "golang", Ecosystem: "Go", Path: name})
+	}
+	for _, d := range info.Deps {
+		if d.Replace != nil {
+			d = d.Replace
+		}
+		out = append(out, SBOMPackage{Name: d.Path, Version: d.Version, Type: "golang", Ecosystem: "Go", Path: name})
+	}
+	return out
+}
+
+// ── RPM ─────────────────────────────────────────────────────────────────────
+
+// parseRpmSqlite reads the sqlite rpmdb used since RHEL 9 / Fedora 33.
+// Older Berkeley DB and ndb databases are not supported.
+func parseRpmSqlite(data []byte) ([]SBOMPackage, error) {
+	tmp, err := os.CreateTemp("", "rpmdb-*.sqlite")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT blob FROM Packages`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SBOMPackage
+	for rows.Next() {
+		var blob []byte
+		if rows.Scan(&blob) != nil {
+			continue
+		}
+		h := parseRpmHeader(blob)
+		name, version, release := h[1000], h[1001], h[1002]
+		if name == "" || name == "gpg-pubkey" {
+			continue
+		}
+		full := version + "-" + release
+		if epoch := h[1003]; epoch != "" && epoch != "0" {
+			full = epoch + ":" + full
+		}
+		p := SBOMPackage{Name: name, Version: full, Type: "rpm", Source: name, SourceVersion: full}
+		// SOURCERPM: name-version-release.src.rpm
+		if src := strings.TrimSuffix(h[1044], ".src.rpm"); src != "" {
+			if i := strings.LastIndex(src, "-"); i > 0 {
+				if j := strings.LastIndex(src[:i], "-"); j > 0 {
+					p.Source = src[:j]
+				}
+			}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// parseRpmHeader decodes the string/int32 tags of an rpm header blob.
+func parseRpmHeader(blob []byte) map[int]string {
+	out := map[int]string{}
+	if len(blob) < 8 {
+		return out
+	}
+	il := int(binary.BigEndian.Uint32(blob[0:4]))
+	dl := int(binary.BigEndian.Uint32(blob[4:8]))
+	dataStart := 8 + il*16
+	if il <= 0 || dl < 0 || dataStart+dl > len(blob) {
+		return out
+	}
+	data := blob[dataStart : dataStart+dl]
+	for k := 0; k < il; k++ {
+		e := blob[8+k*16 : 8+(k+1)*16]
+		tag := int(binary.BigEndian.Uint32(e[0:4]))
+		typ := binary.BigEndian.Uint32(e[4:8])
+		off := int(binary.BigEndian.Uint32(e[8:12]))
+		if off < 0 || off >= len(data) {
+			continue
+		}
+		switch typ {
+		case 6, 9: // STRING, I18NSTRING
+			end := bytes.IndexByte(data[off:], 0)
+			if end >= 0 {
+				out[tag] = string(data[off : off+end])
+			}
+		case 4: // INT32
+			if off+4 <= len(data) {
+				out[tag] = fmt.Sprint(binary.BigEndian.Uint32(data[off : off+4]))
+			}
+		}
+	}
+	return out
+}
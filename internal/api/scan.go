@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/adisaputra10/docker-management/internal/database"
 	"github.com/gorilla/mux"
@@ -24,6 +25,8 @@ type ScanReport struct {
 	Info         int     `json:"info"`
 	Summary      *string `json:"summary"`
 	WorkspaceID  *string `json:"workspace_id"`
+	Source       string  `json:"source"` // scanner, pipeline or api
+	SubmittedBy  *string `json:"submitted_by"`
 	CreatedAt    string  `json:"created_at"`
 }
 
@@ -58,7 +61,7 @@ func ListScanReports(w http.ResponseWriter, r *http.Request) {
 	scanType := r.URL.Query().Get("type")
 
 	query := `SELECT id, scan_type, target, pipeline_id, pipeline_name, status,
-	           critical, high, medium, low, info, summary, workspace_id, created_at
+	           critical, high, medium, low, info, summary, workspace_id, source, submitted_by, created_at
 	           FROM cicd_scan_reports WHERE 1=1`
 	args := []interface{}{}
 
@@ -84,7 +87,7 @@ func ListScanReports(w http.ResponseWriter, r *http.Request) {
 		var s ScanReport
 		if err := rows.Scan(&s.ID, &s.ScanType, &s.Target, &s.PipelineID, &s.PipelineName,
 			&s.Status, &s.Critical, &s.High, &s.Medium, &s.Low, &s.Info,
-			&s.Summary, &s.WorkspaceID, &s.CreatedAt); err != nil {
+			&s.Summary, &s.WorkspaceID, &s.Source, &s.SubmittedBy, &s.CreatedAt); err != nil {
 			continue
 		}
 		list = append(list, s)
@@ -98,7 +101,7 @@ func ListScanReports(w http.ResponseWriter, r *http.Request) {
 
 // POST /api/cicd/scans
 func CreateScanReport(w http.ResponseWriter, r *http.Request) {
-	_, ok := GetUserFromContext(r.Context())
+	user, ok := GetUserFromContext(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -108,15 +111,29 @@ func CreateScanReport(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	validTypes := map[string]bool{"sbom": true, "trivy": true, "gitleaks": true, "dependency": true}
+	validTypes := map[string]bool{"sbom": true, "trivy": true, "gitleaks": true, "dependency": true, "image": true, "sast": true, "dast": true}
 	if !validTypes[req.ScanType] {
-		http.Error(w, "invalid scan_type; must be sbom|trivy|gitleaks|dependency", http.StatusBadRequest)
+		http.Error(w, "invalid scan_type; must be sbom|trivy|gitleaks|dependency|image|sast|dast", http.StatusBadRequest)
 		return
 	}
 	if req.Target == "" {
 		http.Error(w, "target is required", http.StatusBadRequest)
 		return
 	}
+	// When the raw tool output is attached in a known format, the counts
+	// come from the findings it contains rather than from the caller.
+	var findings []ScanFinding
+	if req.ResultJSON != "" {
+		if format := detectScanFormat([]byte(req.ResultJSON)); format != "" {
+			if parsed, _, err := parseScanFindings(format, []byte(req.ResultJSON)); err == nil {
+				findings = parsed
+				counts := severityCounts(findings)
+				req.Critical, req.High, req.Medium = counts["critical"], counts["high"], counts["medium"]
+				req.Low, req.Info = counts["low"], counts["info"]
+				req.Status = ""
+			}
+		}
+	}
 	if req.Status == "" {
 		req.Status = "clean"
 		if req.Critical+req.High+req.Medium+req.Low+req.Info > 0 {
@@ -126,17 +143,24 @@ func CreateScanReport(w http.ResponseWriter, r *http.Request) {
 
 	result, err := database.DB.Exec(
 		`INSERT INTO cicd_scan_reports
-		 (scan_type, target, pipeline_id, pipeline_name, status, critical, high, medium, low, info, summary, result_json, workspace_id)
-		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		 (scan_type, target, pipeline_id, pipeline_name, status, critical, high, medium, low, info, summary, result_json, workspace_id,
+		  source, submitted_by)
+		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,'api',?)`,
 		req.ScanType, req.Target, req.PipelineID, req.PipelineName,
 		req.Status, req.Critical, req.High, req.Medium, req.Low, req.Info,
-		req.Summary, req.ResultJSON, req.WorkspaceID,
+		req.Summary, req.ResultJSON, req.WorkspaceID, user.Username,
 	)
 	if err != nil {
 		http.Error(w, "Error saving scan report: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	id, _ := result.LastInsertId()
+	if findings != nil {
+		if err := saveScanFindings(id, findings); err != nil {
+			http.Error(w, "Error saving findings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id})
 }
@@ -153,11 +177,11 @@ func GetScanReport(w http.ResponseWriter, r *http.Request) {
 	var resultJSON string
 	err := database.DB.QueryRow(
 		`SELECT id, scan_type, target, pipeline_id, pipeline_name, status,
-		 critical, high, medium, low, info, summary, result_json, workspace_id, created_at
+		 critical, high, medium, low, info, summary, result_json, workspace_id, source, submitted_by, created_at
 		 FROM cicd_scan_reports WHERE id = ?`, id,
 	).Scan(&s.ID, &s.ScanType, &s.Target, &s.PipelineID, &s.PipelineName,
 		&s.Status, &s.Critical, &s.High, &s.Medium, &s.Low, &s.Info,
-		&s.Summary, &resultJSON, &s.WorkspaceID, &s.CreatedAt)
+		&s.Summary, &resultJSON, &s.WorkspaceID, &s.Source, &s.SubmittedBy, &s.CreatedAt)
 	if err != nil {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
@@ -183,11 +207,14 @@ func DeleteScanReport(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	database.DB.Exec("DELETE FROM scan_findings WHERE report_id = ?", id)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
 }
 
-// GET /api/cicd/scans/summary  — aggregate counts per type for current workspace
+// GET /api/cicd/scans/summary  — aggregate finding counts per type for current workspace.
+// Only the latest report of each (scan_type, target) is counted so repeated
+// scans of the same image or repo don't inflate the totals.
 func ScanSummary(w http.ResponseWriter, r *http.Request) {
 	_, ok := GetUserFromContext(r.Context())
 	if !ok {
@@ -196,17 +223,29 @@ func ScanSummary(w http.ResponseWriter, r *http.Request) {
 	}
 	wsID := r.URL.Query().Get("workspace_id")
 
-	query := `SELECT scan_type,
-	           COALESCE(SUM(critical),0), COALESCE(SUM(high),0),
-	           COALESCE(SUM(medium),0),  COALESCE(SUM(low),0),
-	           COALESCE(SUM(info),0),    COUNT(*)
-	           FROM cicd_scan_reports`
-	args := []interface{}{}
+	latest := `SELECT MAX(id) FROM cicd_scan_reports WHERE status IN ('clean', 'findings')`
+	args := []interface{}{time.Now().UTC().Format("2006-01-02 15:04:05")}
 	if wsID != "" {
-		query += " WHERE workspace_id = ?"
+		latest += " AND workspace_id = ?"
 		args = append(args, wsID)
 	}
-	query += " GROUP BY scan_type"
+	latest += " GROUP BY scan_type, target"
+
+	// Reports are counted by their stored findings, less those covered by
+	// an active triage decision. Reports stored without itemised findings
+	// fall back to their own counters.
+	query := `SELECT r.scan_type, r.critical, r.high, r.medium, r.low, r.info,
+	           EXISTS(SELECT 1 FROM scan_findings WHERE report_id = r.id),
+	           COALESCE(SUM(f.severity = 'critical'),0), COALESCE(SUM(f.severity = 'high'),0),
+	           COALESCE(SUM(f.severity = 'medium'),0),   COALESCE(SUM(f.severity = 'low'),0),
+	           COALESCE(SUM(f.severity = 'info'),0)
+	           FROM cicd_scan_reports r
+	           LEFT JOIN scan_findings f ON f.report_id = r.id AND NOT EXISTS (
+	               SELECT 1 FROM finding_triage t
+	               WHERE t.target = r.target AND t.fingerprint = f.fingerprint
+	                 AND (t.expires_at IS NULL OR t.expires_at > ?))
+	           WHERE r.id IN (` + latest + `)
+	           GROUP BY r.id`
 
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
@@ -217,6 +256,7 @@ func ScanSummary(w http.ResponseWriter, r *http.Request) {
 
 	type typeSummary struct {
 		ScanType string `json:"scan_type"`
+		Reports  int    `json:"reports"`
 		Critical int    `json:"critical"`
 		High     int    `json:"high"`
 		Medium   int    `json:"medium"`
@@ -226,11 +266,27 @@ func ScanSummary(w http.ResponseWriter, r *http.Request) {
 	}
 	result := map[string]typeSummary{}
 	for rows.Next() {
-		var ts typeSummary
-		if err := rows.Scan(&ts.ScanType, &ts.Critical, &ts.High, &ts.Medium, &ts.Low, &ts.Info, &ts.Total); err != nil {
+		var scanType string
+		var reported, found [5]int
+		var itemised bool
+		if err := rows.Scan(&scanType, &reported[0], &reported[1], &reported[2], &reported[3], &reported[4],
+			&itemised, &found[0], &found[1], &found[2], &found[3], &found[4]); err != nil {
 			continue
 		}
-		result[ts.ScanType] = ts
+		counts := reported
+		if itemised {
+			counts = found
+		}
+		ts := result[scanType]
+		ts.ScanType = scanType
+		ts.Reports++
+		ts.Critical += counts[0]
+		ts.High += counts[1]
+		ts.Medium += counts[2]
+		ts.Low += counts[3]
+		ts.Info += counts[4]
+		ts.Total = ts.Critical + ts.High + ts.Medium + ts.Low + ts.Info
+		result[scanType] = ts
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
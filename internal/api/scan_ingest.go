@@ -0,0 +1,684 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// maxScanUpload caps raw scanner output accepted by the ingest endpoint.
+const maxScanUpload = 64 << 20
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+// ScanFinding is one normalized result row, whatever tool produced it.
+type ScanFinding struct {
+	ID               int    `json:"id"`
+	ReportID         int    `json:"report_id"`
+	Fingerprint      string `json:"fingerprint"`
+	Tool             string `json:"tool"`
+	RuleID           string `json:"rule_id"`
+	Title            string `json:"title"`
+	Severity         string `json:"severity"`
+	Package          string `json:"package,omitempty"`
+	InstalledVersion string `json:"installed_version,omitempty"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Location         string `json:"location,omitempty"`
+	Description      string `json:"description,omitempty"`
+}
+
+// findingFingerprint identifies "the same problem" across scans: the rule
+// in the same package at the same location. Versions are left out so an
+// upgrade that doesn't fix the issue still counts as the same finding.
+func findingFingerprint(f ScanFinding) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{f.Tool, f.RuleID, f.Package, f.Location}, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// ── Parsers ─────────────────────────────────────────────────────────────────
+
+// detectScanFormat guesses the producer of a scanner JSON document.
+func detectScanFormat(data []byte) string {
+	var probe map[string]json.RawMessage
+	if json.Unmarshal(data, &probe) != nil {
+		return ""
+	}
+	switch {
+	case probe["runs"] != nil && probe["version"] != nil:
+		return "sarif"
+	case probe["matches"] != nil:
+		return "grype"
+	case probe["Results"] != nil || probe["ArtifactName"] != nil:
+		return "trivy"
+	case probe["site"] != nil:
+		return "zap"
+	case probe["scanner"] != nil && probe["vulnerabilities"] != nil:
+		return "builtin"
+	}
+	return ""
+}
+
+// parseScanFindings normalizes a scanner document. tool is the name
+// reported by the document where it carries one.
+func parseScanFindings(format string, data []byte) (findings []ScanFinding, tool string, err error) {
+	switch format {
+	case "trivy":
+		findings, err = parseTrivy(data)
+		tool = "trivy"
+	case "grype":
+		findings, err = parseGrype(data)
+		tool = "grype"
+	case "sarif":
+		findings, tool, err = parseSARIF(data)
+	case "zap":
+		findings, err = parseZAP(data)
+		tool = "zap"
+	case "builtin":
+		findings, err = parseBuiltinScan(data)
+		tool = "builtin"
+	default:
+		return nil, "", fmt.Errorf("unsupported scan format %q", format)
+	}
+	normalizeFindings(findings)
+	return findings, tool, err
+}
+
+// normalizeFindings folds severities, trims long text and computes
+// fingerprints in place.
+func normalizeFindings(findings []ScanFinding) {
+	for i := range findings {
+		findings[i].Severity = normalizeSeverity(findings[i].Severity)
+		findings[i].Title = truncate(findings[i].Title, 300)
+		findings[i].Description = truncate(findings[i].Description, 2000)
+		findings[i].Fingerprint = findingFingerprint(findings[i])
+	}
+}
+
+func parseTrivy(data []byte) ([]ScanFinding, error) {
+	var doc struct {
+		Results []struct {
+			Target          string `json:"Target"`
+			Vulnerabilities []struct {
+				VulnerabilityID  string `json:"VulnerabilityID"`
+				PkgName          string `json:"PkgName"`
+				PkgPath          string `json:"PkgPath"`
+				InstalledVersion string `json:"InstalledVersion"`
+				FixedVersion     string `json:"FixedVersion"`
+				Severity         string `json:"Severity"`
+				Title            string `json:"Title"`
+				Description      string `json:"Description"`
+			} `json:"Vulnerabilities"`
+			Misconfigurations []struct {
+				ID            string `json:"ID"`
+				Title         string `json:"Title"`
+				Description   string `json:"Description"`
+				Message       string `json:"Message"`
+				Severity      string `json:"Severity"`
+				Status        string `json:"Status"`
+				CauseMetadata struct {
+					StartLine int `json:"StartLine"`
+				} `json:"CauseMetadata"`
+			} `json:"Misconfigurations"`
+			Secrets []struct {
+				RuleID    string `json:"RuleID"`
+				Title     string `json:"Title"`
+				Severity  string `json:"Severity"`
+				StartLine int    `json:"StartLine"`
+			} `json:"Secrets"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var out []ScanFinding
+	for _, res := range doc.Results {
+		for _, v := range res.Vulnerabilities {
+			loc := untaggedTarget(res.Target)
+			if v.PkgPath != "" {
+				loc = v.PkgPath
+			}
+			title := v.Title
+			if title == "" {
+				title = v.VulnerabilityID + " in " + v.PkgName
+			}
+			out = append(out, ScanFinding{
+				Tool: "trivy", RuleID: v.VulnerabilityID, Title: title, Severity: v.Severity,
+				Package: v.PkgName, InstalledVersion: v.InstalledVersion, FixedVersion: v.FixedVersion,
+				Location: loc, Description: v.Description,
+			})
+		}
+		for _, m := range res.Misconfigurations {
+			if m.Status == "PASS" {
+				continue
+			}
+			desc := m.Message
+			if desc == "" {
+				desc = m.Description
+			}
+			out = append(out, ScanFinding{
+				Tool: "trivy", RuleID: m.ID, Title: m.Title, Severity: m.Severity,
+				Location: fmt.Sprintf("%s:%d", res.Target, m.CauseMetadata.StartLine), Description: desc,
+			})
+		}
+		for _, s := range res.Secrets {
+			out = append(out, ScanFinding{
+				Tool: "trivy", RuleID: s.RuleID, Title: s.Title, Severity: s.Severity,
+				Location: fmt.Sprintf("%s:%d", res.Target, s.StartLine),
+			})
+		}
+	}
+	return out, nil
+}
+
+// untaggedTarget drops the tag or digest from the image reference that
+// starts a Trivy target such as "nginx:1.25 (debian 12.4)", so a retagged
+// image keeps the fingerprints of its findings.
+func untaggedTarget(target string) string {
+	ref, rest, _ := strings.Cut(target, " ")
+	if at := strings.Index(ref, "@"); at >= 0 {
+		ref = ref[:at]
+	}
+	if colon := strings.LastIndex(ref, ":"); colon > strings.LastIndex(ref, "/") {
+		ref = ref[:colon]
+	}
+	if rest != "" {
+		return ref + " " + rest
+	}
+	return ref
+}
+
+func parseGrype(data []byte) ([]ScanFinding, error) {
+	var doc struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID          string `json:"id"`
+				Severity    string `json:"severity"`
+				Description string `json:"description"`
+				Fix         struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name      string `json:"name"`
+				Version   string `json:"version"`
+				Locations []struct {
+					Path string `json:"path"`
+				} `json:"locations"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var out []ScanFinding
+	for _, m := range doc.Matches {
+		f := ScanFinding{
+			Tool: "grype", RuleID: m.Vulnerability.ID, Severity: m.Vulnerability.Severity,
+			Title:   m.Vulnerability.ID + " in " + m.Artifact.Name,
+			Package: m.Artifact.Name, InstalledVersion: m.Artifact.Version,
+			FixedVersion: strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Description:  m.Vulnerability.Description,
+		}
+		if len(m.Artifact.Locations) > 0 {
+			f.Location = m.Artifact.Locations[0].Path
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// parseSARIF reads SARIF 2.1.0. Severity comes from the rule's
+// "security-severity" property when present (GitHub convention), else
+// from the result/rule level.
+func parseSARIF(data []byte) ([]ScanFinding, string, error) {
+	type message struct {
+		Text string `json:"text"`
+	}
+	var doc struct {
+		Runs []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID               string  `json:"id"`
+						Name             string  `json:"name"`
+						ShortDescription message `json:"shortDescription"`
+						FullDescription  message `json:"fullDescription"`
+						Default          struct {
+							Level string `json:"level"`
+						} `json:"defaultConfiguration"`
+						Properties map[string]interface{} `json:"properties"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string  `json:"ruleId"`
+				RuleIndex *int    `json:"ruleIndex"`
+				Level     string  `json:"level"`
+				Message   message `json:"message"`
+				Locations []struct {
+					Physical struct {
+						Artifact struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, "", err
+	}
+	levelSeverity := map[string]string{"error": "high", "warning": "medium", "note": "low", "none": "info"}
+	var out []ScanFinding
+	tool := "sarif"
+	for _, run := range doc.Runs {
+		driver := strings.ToLower(run.Tool.Driver.Name)
+		if driver != "" {
+			tool = driver
+		}
+		rules := map[string]int{}
+		for i, r := range run.Tool.Driver.Rules {
+			rules[r.ID] = i
+		}
+		for _, res := range run.Results {
+			f := ScanFinding{Tool: tool, RuleID: res.RuleID, Title: res.Message.Text}
+			idx, ok := rules[res.RuleID]
+			// ruleIndex is optional and -1 when unknown; ruleId is the fallback.
+			if res.RuleIndex != nil && *res.RuleIndex >= 0 && *res.RuleIndex < len(run.Tool.Driver.Rules) {
+				idx, ok = *res.RuleIndex, true
+			}
+			level := res.Level
+			if ok {
+				rule := run.Tool.Driver.Rules[idx]
+				if f.RuleID == "" {
+					f.RuleID = rule.ID
+				}
+				if rule.ShortDescription.Text != "" {
+					f.Title = rule.ShortDescription.Text
+				}
+				f.Description = res.Message.Text
+				if f.Description == "" {
+					f.Description = rule.FullDescription.Text
+				}
+				if level == "" {
+					level = rule.Default.Level
+				}
+				if s, ok := rule.Properties["security-severity"]; ok {
+					if score, err := strconv.ParseFloat(fmt.Sprint(s), 64); err == nil {
+						f.Severity = severityFromScore(score)
+					}
+				}
+			}
+			if f.Severity == "" {
+				if level == "" {
+					level = "warning" // SARIF default
+				}
+				f.Severity = levelSeverity[level]
+			}
+			if len(res.Locations) > 0 {
+				pl := res.Locations[0].Physical
+				f.Location = pl.Artifact.URI
+				if pl.Region.StartLine > 0 {
+					f.Location += ":" + strconv.Itoa(pl.Region.StartLine)
+				}
+			}
+			out = append(out, f)
+		}
+	}
+	return out, tool, nil
+}
+
+// parseZAP reads the OWASP ZAP JSON report; every alert instance becomes
+// a finding.
+func parseZAP(data []byte) ([]ScanFinding, error) {
+	var doc struct {
+		Site []struct {
+			Name   string `json:"@name"`
+			Alerts []struct {
+				PluginID  string `json:"pluginid"`
+				Alert     string `json:"alert"`
+				Name      string `json:"name"`
+				RiskCode  string `json:"riskcode"`
+				Desc      string `json:"desc"`
+				Instances []struct {
+					URI    string `json:"uri"`
+					Method string `json:"method"`
+					Param  string `json:"param"`
+				} `json:"instances"`
+			} `json:"alerts"`
+		} `json:"site"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	risk := map[string]string{"3": "high", "2": "medium", "1": "low", "0": "info"}
+	var out []ScanFinding
+	for _, site := range doc.Site {
+		for _, a := range site.Alerts {
+			title := a.Alert
+			if title == "" {
+				title = a.Name
+			}
+			base := ScanFinding{
+				Tool: "zap", RuleID: a.PluginID, Title: title, Severity: risk[a.RiskCode],
+				Description: stripHTMLTags(a.Desc),
+			}
+			if len(a.Instances) == 0 {
+				base.Location = site.Name
+				out = append(out, base)
+				continue
+			}
+			for _, in := range a.Instances {
+				f := base
+				f.Location = strings.TrimSpace(in.Method + " " + in.URI)
+				if in.Param != "" {
+					f.Location += " [" + in.Param + "]"
+				}
+				out = append(out, f)
+			}
+		}
+	}
+	return out, nil
+}
+
+// parseBuiltinScan converts the built-in image scanner's result_json.
+func parseBuiltinScan(data []byte) ([]ScanFinding, error) {
+	var res imageScanResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return vulnMatchFindings(res.Vulnerabilities), nil
+}
+
+func vulnMatchFindings(vulns []VulnMatch) []ScanFinding {
+	out := make([]ScanFinding, 0, len(vulns))
+	for _, v := range vulns {
+		title := v.Summary
+		if title == "" {
+			title = v.ID + " in " + v.Package
+		}
+		out = append(out, ScanFinding{
+			Tool: "builtin", RuleID: v.ID, Title: title, Severity: v.Severity,
+			Package: v.Package, InstalledVersion: v.Version, FixedVersion: v.FixedVersion,
+			Location: v.Path, Description: v.Summary,
+		})
+	}
+	return out
+}
+
+func stripHTMLTags(s string) string {
+	var b strings.Builder
+	in := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			in = true
+		case r == '>':
+			in = false
+		case !in:
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// ── Storage ─────────────────────────────────────────────────────────────────
+
+// severityCounts tallies findings into the report's count columns.
+func severityCounts(findings []ScanFinding) map[string]int {
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	return counts
+}
+
+// saveScanFindings replaces the findings stored for a report. Each finding
+// is marked "new" or "recurring" against the previous report of the same
+// target, keeping the time it was first seen.
+func saveScanFindings(reportID int64, findings []ScanFinding) error {
+	// Look the previous report up before opening the transaction: the
+	// pool has a single connection.
+	previous := map[string]string{}
+	if ref, err := getScanReportRef(reportID); err == nil {
+		previous = firstSeenByFingerprint(previousReportID(ref))
+	}
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if _, err := tx.Exec(`DELETE FROM scan_findings WHERE report_id = ?`, reportID); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		lifecycle, firstSeen := "new", now
+		if seen, ok := previous[f.Fingerprint]; ok {
+			lifecycle = "recurring"
+			if seen != "" {
+				firstSeen = seen
+			}
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO scan_findings (report_id, fingerprint, tool, rule_id, title, severity, package,
+			                            installed_version, fixed_version, location, description,
+			                            lifecycle, first_seen_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			reportID, f.Fingerprint, f.Tool, f.RuleID, f.Title, f.Severity, f.Package,
+			f.InstalledVersion, f.FixedVersion, f.Location, f.Description, lifecycle, firstSeen); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// scanTypeForFormat maps a tool format onto the report's scan_type.
+func scanTypeForFormat(format, tool string) string {
+	switch format {
+	case "trivy":
+		return "trivy"
+	case "grype":
+		return "dependency"
+	case "zap":
+		return "dast"
+	case "builtin":
+		return "image"
+	}
+	if tool == "gitleaks" {
+		return "gitleaks"
+	}
+	return "sast"
+}
+
+// scanReportMeta describes where a raw scanner report came from.
+type scanReportMeta struct {
+	Format       string // trivy, grype, sarif, zap, builtin; detected when empty
+	Target       string
+	ScanType     string // derived from the format when empty
+	PipelineID   string
+	PipelineName string
+	WorkspaceID  string
+	Source       string // scanner, pipeline or api
+	SubmittedBy  string
+}
+
+type storedScanReport struct {
+	ID       int64
+	Format   string
+	Tool     string
+	Findings int
+	Counts   map[string]int
+}
+
+var errScanParse = errors.New("could not parse report")
+
+// storeScanReport parses raw scanner output and saves it as a scan report
+// with its findings.
+func storeScanReport(data []byte, meta scanReportMeta) (storedScanReport, error) {
+	format := meta.Format
+	if format == "" {
+		format = detectScanFormat(data)
+	}
+	findings, tool, err := parseScanFindings(format, data)
+	if err != nil {
+		return storedScanReport{}, fmt.Errorf("%w: %v", errScanParse, err)
+	}
+
+	target := meta.Target
+	if target == "" {
+		target = tool + " report"
+	}
+	scanType := meta.ScanType
+	if scanType == "" {
+		scanType = scanTypeForFormat(format, tool)
+	}
+	counts := severityCounts(findings)
+	status := "clean"
+	if len(findings) > 0 {
+		status = "findings"
+	}
+	summary := fmt.Sprintf("%d findings from %s", len(findings), tool)
+	source := meta.Source
+	if source == "" {
+		source = "api"
+	}
+
+	res, err := database.DB.Exec(
+		`INSERT INTO cicd_scan_reports
+		 (scan_type, target, pipeline_id, pipeline_name, status, critical, high, medium, low, info, summary, result_json, workspace_id,
+		  source, submitted_by)
+		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		scanType, target, meta.PipelineID, meta.PipelineName, status,
+		counts["critical"], counts["high"], counts["medium"], counts["low"], counts["info"],
+		summary, string(data), meta.WorkspaceID, source, nullStr(meta.SubmittedBy))
+	if err != nil {
+		return storedScanReport{}, fmt.Errorf("saving scan report: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	if err := saveScanFindings(id, findings); err != nil {
+		return storedScanReport{}, fmt.Errorf("saving findings: %v", err)
+	}
+	return storedScanReport{ID: id, Format: format, Tool: tool, Findings: len(findings), Counts: counts}, nil
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/cicd/scans/ingest?format=trivy|grype|sarif|zap&target=...&pipeline_id=...
+// Body: the scanner's JSON output (raw, or multipart field "file").
+func IngestScanReport(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if HasRole(user.Role, "user_cicd_view") && !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_cicd_full") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxScanUpload)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	res, err := storeScanReport(data, scanReportMeta{
+		Format:       strings.ToLower(q.Get("format")),
+		Target:       q.Get("target"),
+		ScanType:     q.Get("scan_type"),
+		PipelineID:   q.Get("pipeline_id"),
+		PipelineName: q.Get("pipeline_name"),
+		WorkspaceID:  q.Get("workspace_id"),
+		SubmittedBy:  user.Username,
+	})
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errScanParse) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"id":       res.ID,
+		"format":   res.Format,
+		"tool":     res.Tool,
+		"findings": res.Findings,
+		"counts":   res.Counts,
+	})
+}
+
+// GET /api/cicd/scans/{id}/findings?severity=high&lifecycle=new&open=true
+func ListScanFindings(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	ref, err := getScanReportRef(id)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	findings, err := loadTrackedFindings(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	applyTriage(findings, ref.Target)
+
+	q := r.URL.Query()
+	list := []TrackedFinding{}
+	for _, f := range findings {
+		if sev := q.Get("severity"); sev != "" && f.Severity != sev {
+			continue
+		}
+		if lc := q.Get("lifecycle"); lc != "" && f.Lifecycle != lc {
+			continue
+		}
+		if q.Get("open") == "true" && f.Triage != nil {
+			continue
+		}
+		list = append(list, f)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
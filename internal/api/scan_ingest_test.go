@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseSARIF(t *testing.T) {
+	doc := `{"runs":[{"tool":{"driver":{"name":"Semgrep","rules":[
+		{"id":"sql-injection","shortDescription":{"text":"SQL injection"},"properties":{"security-severity":"9.1"}},
+		{"id":"weak-hash","shortDescription":{"text":"Weak hash"},"defaultConfiguration":{"level":"note"}}
+	]}},"results":[%s]}]}`
+	tests := []struct {
+		name     string
+		result   string
+		ruleID   string
+		title    string
+		severity string
+		location string
+	}{
+		{"rule by id", `{"ruleId":"sql-injection","message":{"text":"tainted"},
+			"locations":[{"physicalLocation":{"artifactLocation":{"uri":"db.go"},"region":{"startLine":12}}}]}`,
+			"sql-injection", "SQL injection", "critical", "db.go:12"},
+		{"rule by index", `{"ruleIndex":1,"message":{"text":"md5"}}`,
+			"weak-hash", "Weak hash", "low", ""},
+		{"ruleIndex -1 falls back to ruleId", `{"ruleId":"weak-hash","ruleIndex":-1,"message":{"text":"md5"}}`,
+			"weak-hash", "Weak hash", "low", ""},
+		{"ruleIndex out of range", `{"ruleId":"unknown","ruleIndex":7,"level":"error","message":{"text":"boom"}}`,
+			"unknown", "boom", "high", ""},
+		{"no level defaults to warning", `{"ruleId":"unknown","message":{"text":"hmm"}}`,
+			"unknown", "hmm", "medium", ""},
+	}
+	for _, tt := range tests {
+		findings, tool, err := parseSARIF([]byte(fmt.Sprintf(doc, tt.result)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tool != "semgrep" || len(findings) != 1 {
+			t.Fatalf("%s: got tool %q and %d findings", tt.name, tool, len(findings))
+		}
+		f := findings[0]
+		if f.RuleID != tt.ruleID || f.Title != tt.title || f.Severity != tt.severity || f.Location != tt.location {
+			t.Errorf("%s: got %q %q %q %q, want %q %q %q %q", tt.name,
+				f.RuleID, f.Title, f.Severity, f.Location, tt.ruleID, tt.title, tt.severity, tt.location)
+		}
+	}
+}
+
+func TestParseTrivy(t *testing.T) {
+	doc := `{"Results":[{"Target":%q,
+		"Vulnerabilities":[{"VulnerabilityID":"CVE-2024-1","PkgName":"openssl","InstalledVersion":"3.0.1","FixedVersion":"3.0.2","Severity":"HIGH"},
+			{"VulnerabilityID":"CVE-2024-2","PkgName":"lodash","PkgPath":"app/node_modules/lodash/package.json","Severity":"LOW","Title":"Prototype pollution"}],
+		"Misconfigurations":[{"ID":"DS002","Title":"Root user","Severity":"HIGH","Status":"FAIL","CauseMetadata":{"StartLine":3}},
+			{"ID":"DS001","Title":"Passed","Status":"PASS"}],
+		"Secrets":[{"RuleID":"aws-access-key-id","Title":"AWS key","Severity":"CRITICAL","StartLine":9}]}]}`
+	findings, err := parseTrivy([]byte(fmt.Sprintf(doc, "nginx:1.25 (debian 12.4)")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ScanFinding{
+		{RuleID: "CVE-2024-1", Title: "CVE-2024-1 in openssl", Location: "nginx (debian 12.4)"},
+		{RuleID: "CVE-2024-2", Title: "Prototype pollution", Location: "app/node_modules/lodash/package.json"},
+		{RuleID: "DS002", Title: "Root user", Location: "nginx:1.25 (debian 12.4):3"},
+		{RuleID: "aws-access-key-id", Title: "AWS key", Location: "nginx:1.25 (debian 12.4):9"},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("got %d findings, want %d", len(findings), len(want))
+	}
+	for i, w := range want {
+		f := findings[i]
+		if f.Tool != "trivy" || f.RuleID != w.RuleID || f.Title != w.Title || f.Location != w.Location {
+			t.Errorf("finding %d: got %q %q %q, want %q %q %q", i, f.RuleID, f.Title, f.Location, w.RuleID, w.Title, w.Location)
+		}
+	}
+
+	// A retag or a digest pin must not turn known vulnerabilities into new ones.
+	normalizeFindings(findings)
+	for _, target := range []string{"nginx:1.26 (debian 12.4)", "nginx@sha256:0123abcd (debian 12.4)"} {
+		retagged, err := parseTrivy([]byte(fmt.Sprintf(doc, target)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		normalizeFindings(retagged)
+		if retagged[0].Fingerprint != findings[0].Fingerprint {
+			t.Errorf("fingerprint changed for target %q", target)
+		}
+	}
+}
+
+func TestUntaggedTarget(t *testing.T) {
+	tests := []struct{ target, want string }{
+		{"nginx:1.25 (debian 12.4)", "nginx (debian 12.4)"},
+		{"registry.local:5000/team/app:v2 (alpine 3.19.1)", "registry.local:5000/team/app (alpine 3.19.1)"},
+		{"registry.local:5000/team/app (alpine 3.19.1)", "registry.local:5000/team/app (alpine 3.19.1)"},
+		{"app@sha256:0123abcd", "app"},
+		{"app:v1@sha256:0123abcd", "app"},
+		{"package-lock.json", "package-lock.json"},
+	}
+	for _, tt := range tests {
+		if got := untaggedTarget(tt.target); got != tt.want {
+			t.Errorf("untaggedTarget(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
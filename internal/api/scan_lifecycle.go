@@ -0,0 +1,473 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// Findings are tracked across reports of the same (scan_type, target) by
+// fingerprint. Each stored finding is "new" when the previous report of
+// that target didn't have it and "recurring" when it did; findings that
+// disappear show up as "fixed" in the diff. Triage decisions
+// (accepted_risk / false_positive) are stored per target+fingerprint, so
+// they carry over to every later report until they expire.
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type FindingTriage struct {
+	ID          int     `json:"id"`
+	Target      string  `json:"target"`
+	Fingerprint string  `json:"fingerprint"`
+	Status      string  `json:"status"` // accepted_risk, false_positive
+	Reason      string  `json:"reason"`
+	ExpiresAt   *string `json:"expires_at"`
+	CreatedBy   string  `json:"created_by"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+type TrackedFinding struct {
+	ScanFinding
+	Lifecycle   string  `json:"lifecycle"` // new, recurring, fixed
+	FirstSeenAt string  `json:"first_seen_at"`
+	Triage      *string `json:"triage"` // active triage status, if any
+}
+
+type scanReportRef struct {
+	ID       int64
+	ScanType string
+	Target   string
+}
+
+func getScanReportRef(id int64) (scanReportRef, error) {
+	ref := scanReportRef{ID: id}
+	err := database.DB.QueryRow(`SELECT scan_type, target FROM cicd_scan_reports WHERE id = ?`, id).
+		Scan(&ref.ScanType, &ref.Target)
+	return ref, err
+}
+
+// previousReportID returns the last completed report of the same target
+// before id, or 0.
+func previousReportID(ref scanReportRef) int64 {
+	var prev sql.NullInt64
+	database.DB.QueryRow(
+		`SELECT MAX(id) FROM cicd_scan_reports
+		 WHERE scan_type = ? AND target = ? AND id < ? AND status IN ('clean', 'findings')`,
+		ref.ScanType, ref.Target, ref.ID).Scan(&prev)
+	return prev.Int64
+}
+
+// firstSeenByFingerprint maps each fingerprint in a report to when it was
+// first seen.
+func firstSeenByFingerprint(reportID int64) map[string]string {
+	out := map[string]string{}
+	if reportID == 0 {
+		return out
+	}
+	rows, err := database.DB.Query(`SELECT fingerprint, first_seen_at FROM scan_findings WHERE report_id = ?`, reportID)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fp string
+		var seen sql.NullString
+		if rows.Scan(&fp, &seen) != nil {
+			continue
+		}
+		// The driver hands DATETIME columns back as RFC3339.
+		if t, err := time.Parse(time.RFC3339, seen.String); err == nil {
+			seen.String = t.UTC().Format("2006-01-02 15:04:05")
+		}
+		out[fp] = seen.String
+	}
+	return out
+}
+
+// activeTriage returns the unexpired triage status per fingerprint for a
+// target.
+func activeTriage(target string) map[string]string {
+	out := map[string]string{}
+	rows, err := database.DB.Query(
+		`SELECT fingerprint, status FROM finding_triage
+		 WHERE target = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		target, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fp, status string
+		if rows.Scan(&fp, &status) == nil {
+			out[fp] = status
+		}
+	}
+	return out
+}
+
+func loadTrackedFindings(reportID int64) ([]TrackedFinding, error) {
+	rows, err := database.DB.Query(
+		`SELECT id, report_id, fingerprint, tool, rule_id, title, severity, package,
+		        installed_version, fixed_version, location, description, lifecycle, COALESCE(first_seen_at, '')
+		 FROM scan_findings WHERE report_id = ?
+		 ORDER BY CASE severity WHEN 'critical' THEN 0 WHEN 'high' THEN 1 WHEN 'medium' THEN 2
+		          WHEN 'low' THEN 3 ELSE 4 END, id`, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []TrackedFinding
+	for rows.Next() {
+		var f TrackedFinding
+		if err := rows.Scan(&f.ID, &f.ReportID, &f.Fingerprint, &f.Tool, &f.RuleID, &f.Title, &f.Severity,
+			&f.Package, &f.InstalledVersion, &f.FixedVersion, &f.Location, &f.Description,
+			&f.Lifecycle, &f.FirstSeenAt); err != nil {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// applyTriage marks findings with their active triage status.
+func applyTriage(findings []TrackedFinding, target string) {
+	triage := activeTriage(target)
+	for i := range findings {
+		if st, ok := triage[findings[i].Fingerprint]; ok {
+			st := st
+			findings[i].Triage = &st
+		}
+	}
+}
+
+// openFindingCounts counts a report's findings by severity, leaving out
+// those covered by an active triage decision.
+func openFindingCounts(reportID int64) (map[string]int, error) {
+	ref, err := getScanReportRef(reportID)
+	if err != nil {
+		return nil, err
+	}
+	findings, err := loadTrackedFindings(reportID)
+	if err != nil {
+		return nil, err
+	}
+	triage := activeTriage(ref.Target)
+	counts := map[string]int{}
+	for _, f := range findings {
+		if _, suppressed := triage[f.Fingerprint]; !suppressed {
+			counts[f.Severity]++
+		}
+	}
+	return counts, nil
+}
+
+// diffFindings compares two reports by fingerprint.
+func diffFindings(base, head []TrackedFinding) (added, fixed, recurring []TrackedFinding) {
+	inBase := map[string]bool{}
+	for _, f := range base {
+		inBase[f.Fingerprint] = true
+	}
+	inHead := map[string]bool{}
+	for _, f := range head {
+		inHead[f.Fingerprint] = true
+		if inBase[f.Fingerprint] {
+			f.Lifecycle = "recurring"
+			recurring = append(recurring, f)
+		} else {
+			f.Lifecycle = "new"
+			added = append(added, f)
+		}
+	}
+	for _, f := range base {
+		if !inHead[f.Fingerprint] {
+			f.Lifecycle = "fixed"
+			fixed = append(fixed, f)
+		}
+	}
+	return
+}
+
+func nonNilFindings(list []TrackedFinding) []TrackedFinding {
+	if list == nil {
+		return []TrackedFinding{}
+	}
+	return list
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// GET /api/cicd/scans/diff?base=12&head=15
+// head defaults to the latest report of base's target; base defaults to
+// the report before head.
+func DiffScanReports(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	baseID, _ := strconv.ParseInt(r.URL.Query().Get("base"), 10, 64)
+	headID, _ := strconv.ParseInt(r.URL.Query().Get("head"), 10, 64)
+	if headID == 0 && baseID == 0 {
+		http.Error(w, "base or head is required", http.StatusBadRequest)
+		return
+	}
+	if headID == 0 {
+		ref, err := getScanReportRef(baseID)
+		if err != nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		database.DB.QueryRow(
+			`SELECT MAX(id) FROM cicd_scan_reports WHERE scan_type = ? AND target = ? AND status IN ('clean', 'findings')`,
+			ref.ScanType, ref.Target).Scan(&headID)
+	}
+	head, err := getScanReportRef(headID)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if baseID == 0 {
+		baseID = previousReportID(head)
+	}
+
+	headFindings, err := loadTrackedFindings(headID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var baseFindings []TrackedFinding
+	if baseID != 0 {
+		if baseFindings, err = loadTrackedFindings(baseID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	added, fixed, recurring := diffFindings(baseFindings, headFindings)
+	applyTriage(added, head.Target)
+	applyTriage(recurring, head.Target)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"base":      baseID,
+		"head":      headID,
+		"target":    head.Target,
+		"new":       nonNilFindings(added),
+		"fixed":     nonNilFindings(fixed),
+		"recurring": nonNilFindings(recurring),
+	})
+}
+
+// GET /api/cicd/scans/trend?target=nginx:1.27[&scan_type=image] | ?pipeline_id=42
+func ScanTrend(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	query := `SELECT r.id, r.scan_type, r.target, r.created_at,
+	          COALESCE(SUM(f.severity = 'critical'),0), COALESCE(SUM(f.severity = 'high'),0),
+	          COALESCE(SUM(f.severity = 'medium'),0), COALESCE(SUM(f.severity = 'low'),0),
+	          COALESCE(SUM(f.severity = 'info'),0), COALESCE(SUM(f.lifecycle = 'new'),0), COUNT(f.id)
+	          FROM cicd_scan_reports r LEFT JOIN scan_findings f ON f.report_id = r.id
+	          WHERE r.status IN ('clean', 'findings')`
+	args := []interface{}{}
+	switch {
+	case q.Get("target") != "":
+		query += " AND r.target = ?"
+		args = append(args, q.Get("target"))
+	case q.Get("pipeline_id") != "":
+		query += " AND r.pipeline_id = ?"
+		args = append(args, q.Get("pipeline_id"))
+	default:
+		http.Error(w, "target or pipeline_id is required", http.StatusBadRequest)
+		return
+	}
+	if st := q.Get("scan_type"); st != "" {
+		query += " AND r.scan_type = ?"
+		args = append(args, st)
+	}
+	query += " GROUP BY r.id ORDER BY r.id DESC LIMIT 100"
+
+	type point struct {
+		ReportID  int64  `json:"report_id"`
+		ScanType  string `json:"scan_type"`
+		Target    string `json:"target"`
+		CreatedAt string `json:"created_at"`
+		Critical  int    `json:"critical"`
+		High      int    `json:"high"`
+		Medium    int    `json:"medium"`
+		Low       int    `json:"low"`
+		Info      int    `json:"info"`
+		New       int    `json:"new"`
+		Fixed     int    `json:"fixed"`
+		Total     int    `json:"total"`
+	}
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var points []point
+	for rows.Next() {
+		var p point
+		if err := rows.Scan(&p.ReportID, &p.ScanType, &p.Target, &p.CreatedAt, &p.Critical, &p.High,
+			&p.Medium, &p.Low, &p.Info, &p.New, &p.Total); err != nil {
+			continue
+		}
+		points = append(points, p)
+	}
+	rows.Close()
+
+	// Oldest first; "fixed" is what the previous report of the same target
+	// had that this one no longer has.
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	lastFP := map[string]map[string]string{}
+	for i := range points {
+		key := points[i].ScanType + "\x00" + points[i].Target
+		cur := firstSeenByFingerprint(points[i].ReportID)
+		if prev, ok := lastFP[key]; ok {
+			for fp := range prev {
+				if _, still := cur[fp]; !still {
+					points[i].Fixed++
+				}
+			}
+		}
+		lastFP[key] = cur
+	}
+	if points == nil {
+		points = []point{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points)
+}
+
+// GET /api/cicd/scans/triage?target=...
+func ListFindingTriage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query := `SELECT id, target, fingerprint, status, reason, expires_at, created_by, created_at FROM finding_triage`
+	args := []interface{}{}
+	if t := r.URL.Query().Get("target"); t != "" {
+		query += " WHERE target = ?"
+		args = append(args, t)
+	}
+	query += " ORDER BY id DESC"
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	list := []FindingTriage{}
+	for rows.Next() {
+		var t FindingTriage
+		if err := rows.Scan(&t.ID, &t.Target, &t.Fingerprint, &t.Status, &t.Reason, &t.ExpiresAt,
+			&t.CreatedBy, &t.CreatedAt); err != nil {
+			continue
+		}
+		list = append(list, t)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// POST /api/cicd/scans/triage
+// Body: {"finding_id": 12} or {"target": "...", "fingerprint": "..."},
+// plus "status" (accepted_risk|false_positive), "reason", optional "expires_at" (RFC3339).
+func TriageFinding(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_cicd_full") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		FindingID   int    `json:"finding_id"`
+		Target      string `json:"target"`
+		Fingerprint string `json:"fingerprint"`
+		Status      string `json:"status"`
+		Reason      string `json:"reason"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Status != "accepted_risk" && req.Status != "false_positive" {
+		http.Error(w, "status must be accepted_risk or false_positive", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	if req.FindingID != 0 {
+		err := database.DB.QueryRow(
+			`SELECT r.target, f.fingerprint FROM scan_findings f JOIN cicd_scan_reports r ON r.id = f.report_id
+			 WHERE f.id = ?`, req.FindingID).Scan(&req.Target, &req.Fingerprint)
+		if err != nil {
+			http.Error(w, "Finding not found", http.StatusNotFound)
+			return
+		}
+	}
+	if req.Target == "" || req.Fingerprint == "" {
+		http.Error(w, "finding_id or target+fingerprint is required", http.StatusBadRequest)
+		return
+	}
+	var expires interface{}
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			http.Error(w, "expires_at must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		expires = t.UTC().Format("2006-01-02 15:04:05")
+	}
+
+	_, err := database.DB.Exec(
+		`INSERT INTO finding_triage (target, fingerprint, status, reason, expires_at, created_by)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(target, fingerprint) DO UPDATE SET status = excluded.status, reason = excluded.reason,
+		   expires_at = excluded.expires_at, created_by = excluded.created_by, created_at = CURRENT_TIMESTAMP`,
+		req.Target, req.Fingerprint, req.Status, req.Reason, expires, user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordActivityLog("finding_triage", req.Target, req.Status+" "+req.Fingerprint+": "+req.Reason, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// DELETE /api/cicd/scans/triage/{id}
+func DeleteFindingTriage(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !HasRole(user.Role, "admin") && !HasRole(user.Role, "user_cicd_full") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if _, err := database.DB.Exec(`DELETE FROM finding_triage WHERE id = ?`, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordActivityLog("finding_triage_delete", id, "removed by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
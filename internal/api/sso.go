@@ -115,13 +115,13 @@ func GetSSOSettings(w http.ResponseWriter, r *http.Request) {
 	val, _ := database.GetSetting("sso_gitlab_enabled")
 	s.GitLabEnabled = val == "true"
 	s.GitLabClientID, _ = database.GetSetting("sso_gitlab_client_id")
-	s.GitLabClientSecret, _ = database.GetSetting("sso_gitlab_client_secret")
+	s.GitLabClientSecret = maskSecretSetting("sso_gitlab_client_secret")
 	s.GitLabRedirectURI, _ = database.GetSetting("sso_gitlab_redirect_uri")
 
 	val, _ = database.GetSetting("sso_entra_enabled")
 	s.EntraEnabled = val == "true"
 	s.EntraClientID, _ = database.GetSetting("sso_entra_client_id")
-	s.EntraClientSecret, _ = database.GetSetting("sso_entra_client_secret")
+	s.EntraClientSecret = maskSecretSetting("sso_entra_client_secret")
 	s.EntraTenantID, _ = database.GetSetting("sso_entra_tenant_id")
 	s.EntraRedirectURI, _ = database.GetSetting("sso_entra_redirect_uri")
 
@@ -130,7 +130,7 @@ func GetSSOSettings(w http.ResponseWriter, r *http.Request) {
 	s.OIDCDisplayName, _ = database.GetSetting("sso_oidc_display_name")
 	s.OIDCIssuer, _ = database.GetSetting("sso_oidc_issuer")
 	s.OIDCClientID, _ = database.GetSetting("sso_oidc_client_id")
-	s.OIDCClientSecret, _ = database.GetSetting("sso_oidc_client_secret")
+	s.OIDCClientSecret = maskSecretSetting("sso_oidc_client_secret")
 	s.OIDCRedirectURI, _ = database.GetSetting("sso_oidc_redirect_uri")
 	s.OIDCDefaultRole, _ = database.GetSetting("sso_oidc_default_role")
 	s.OIDCScopes, _ = database.GetSetting("sso_oidc_scopes")
@@ -155,7 +155,7 @@ func SaveSSOSettings(w http.ResponseWriter, r *http.Request) {
 		database.SetSetting("sso_gitlab_enabled", "false")
 	}
 	database.SetSetting("sso_gitlab_client_id", s.GitLabClientID)
-	database.SetSetting("sso_gitlab_client_secret", s.GitLabClientSecret)
+	setSecretSetting("sso_gitlab_client_secret", s.GitLabClientSecret)
 	database.SetSetting("sso_gitlab_redirect_uri", s.GitLabRedirectURI)
 
 	if s.EntraEnabled {
@@ -164,7 +164,7 @@ func SaveSSOSettings(w http.ResponseWriter, r *http.Request) {
 		database.SetSetting("sso_entra_enabled", "false")
 	}
 	database.SetSetting("sso_entra_client_id", s.EntraClientID)
-	database.SetSetting("sso_entra_client_secret", s.EntraClientSecret)
+	setSecretSetting("sso_entra_client_secret", s.EntraClientSecret)
 	database.SetSetting("sso_entra_tenant_id", s.EntraTenantID)
 	database.SetSetting("sso_entra_redirect_uri", s.EntraRedirectURI)
 
@@ -179,7 +179,7 @@ func SaveSSOSettings(w http.ResponseWriter, r *http.Request) {
 	database.SetSetting("sso_oidc_display_name", s.OIDCDisplayName)
 	database.SetSetting("sso_oidc_issuer", s.OIDCIssuer)
 	database.SetSetting("sso_oidc_client_id", s.OIDCClientID)
-	database.SetSetting("sso_oidc_client_secret", s.OIDCClientSecret)
+	setSecretSetting("sso_oidc_client_secret", s.OIDCClientSecret)
 	database.SetSetting("sso_oidc_redirect_uri", s.OIDCRedirectURI)
 	if s.OIDCDefaultRole == "" {
 		s.OIDCDefaultRole = "user_docker_basic"
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/adisaputra10/docker-management/internal/vault"
+)
+
+// Credentials are stored sealed by the vault (see internal/vault) and are
+// never sent back by the regular endpoints: those report secretMask in
+// their place, and saving the mask back keeps the stored value. Reading a
+// secret needs the admin-only reveal endpoint, which writes an audit entry
+// for every use.
+
+const secretMask = "********"
+
+// maskSecret hides a stored secret while still showing whether one is set.
+func maskSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	return secretMask
+}
+
+// maskSecretSetting reports a sensitive setting as secretMask when set.
+func maskSecretSetting(key string) string {
+	v, _ := database.GetSetting(key)
+	return maskSecret(v)
+}
+
+// setSecretSetting stores a sensitive setting unless v is the mask sent
+// back unchanged by a settings form.
+func setSecretSetting(key, v string) error {
+	if v == secretMask {
+		return nil
+	}
+	return database.SetSetting(key, v)
+}
+
+// sealSecret seals v for storage, mapping "" to NULL.
+func sealSecret(v string) (interface{}, error) {
+	if v == "" {
+		return nil, nil
+	}
+	return vault.Seal(v)
+}
+
+// sealRegistryExtra seals the secret fields of a registry's extra_config.
+func sealRegistryExtra(raw string) (string, error) {
+	return vault.SealFields(raw, database.RegistryExtraSecretFields...)
+}
+
+// openRegistryExtra opens the secret fields of a stored extra_config.
+func openRegistryExtra(raw string) string {
+	out, err := vault.OpenFields(raw, database.RegistryExtraSecretFields...)
+	if err != nil {
+		log.Printf("Vault: registry extra_config: %v", err)
+		return raw
+	}
+	return out
+}
+
+// redactRegistryExtra replaces the secret fields of an extra_config with
+// secretMask.
+func redactRegistryExtra(raw string) string {
+	var obj map[string]interface{}
+	if raw == "" || json.Unmarshal([]byte(raw), &obj) != nil {
+		return raw
+	}
+	changed := false
+	for _, f := range database.RegistryExtraSecretFields {
+		if s, ok := obj[f].(string); ok && s != "" {
+			obj[f] = secretMask
+			changed = true
+		}
+	}
+	if !changed {
+		return raw
+	}
+	b, _ := json.Marshal(obj)
+	return string(b)
+}
+
+// revealable lists, per kind, the table and the fields the reveal endpoint
+// may return.
+var revealable = map[string]struct {
+	table  string
+	fields map[string]bool
+}{
+	"registry":    {"cicd_registries", map[string]bool{"password": true, "aws_secret_access_key": true, "aws_session_token": true}},
+	"worker":      {"cicd_workers", map[string]bool{"ssh_private_key": true}},
+	"gitops_repo": {"gitops_repos", map[string]bool{"auth_token": true, "ssh_key": true, "webhook_secret": true}},
+	"cluster":     {"k0s_clusters", map[string]bool{"password": true, "ssh_key": true, "kubeconfig": true, "sa_token": true}},
+	"cicd_secret": {"cicd_secrets", map[string]bool{"value": true}},
+}
+
+func loadRevealedSecret(kind, id, field string) (string, error) {
+	if kind == "setting" {
+		if !database.IsSensitiveSetting(id) {
+			return "", fmt.Errorf("setting %s is not a secret", id)
+		}
+		return database.GetSetting(id)
+	}
+	spec, ok := revealable[kind]
+	if !ok || !spec.fields[field] {
+		return "", fmt.Errorf("unknown secret %s.%s", kind, field)
+	}
+	column := field
+	if kind == "registry" && field != "password" {
+		column = "extra_config"
+	}
+	var stored string
+	err := database.DB.QueryRow(fmt.Sprintf("SELECT COALESCE(%s,'') FROM %s WHERE id = ?", column, spec.table), id).
+		Scan(&stored)
+	if err != nil {
+		return "", fmt.Errorf("%s %s not found", kind, id)
+	}
+	if column == "extra_config" {
+		var extra map[string]string
+		json.Unmarshal([]byte(stored), &extra) //nolint:errcheck
+		stored = extra[field]
+	}
+	return vault.Open(stored)
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// GET /api/vault/status  (admin only)
+func GetVaultStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vault.CurrentStatus())
+}
+
+// POST /api/vault/rotate  (admin only)
+// Body: {"new_master_key": true, "reencrypt": false}
+// Re-wraps every stored secret under the current master key, first
+// generating a new one when asked (only for a key file managed by the
+// server). reencrypt also gives every secret a new data key.
+func RotateVault(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		NewMasterKey bool `json:"new_master_key"`
+		Reencrypt    bool `json:"reencrypt"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.NewMasterKey {
+		kid, err := vault.GenerateMasterKey()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Vault: new master key %s generated by %s", kid, user.Username)
+	}
+	m, err := database.SealStoredSecrets(req.Reencrypt)
+	status := "success"
+	if err != nil || m.Failed > 0 {
+		status = "failed"
+	}
+	recordActivityLog("vault_rotate", vault.CurrentStatus().KeyID,
+		fmt.Sprintf("by %s: sealed %d, re-wrapped %d, failed %d", user.Username, m.Sealed, m.Rewrapped, m.Failed), status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": m.Failed == 0,
+		"status":  vault.CurrentStatus(),
+		"result":  m,
+	})
+}
+
+// POST /api/vault/reveal  (admin only, audited)
+// Body: {"kind": "registry", "id": "3", "field": "password", "reason": "..."}
+// Kinds: registry, worker, gitops_repo, cluster, cicd_secret, and setting
+// (id is the setting key, field is ignored).
+func RevealSecret(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		Kind   string `json:"kind"`
+		ID     string `json:"id"`
+		Field  string `json:"field"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	target := req.Kind + "/" + req.ID + "/" + req.Field
+	value, err := loadRevealedSecret(req.Kind, req.ID, req.Field)
+	if err != nil {
+		recordActivityLog("vault_reveal", target, "by "+user.Username+": "+err.Error(), "failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recordActivityLog("vault_reveal", target, "by "+user.Username+": "+req.Reason, "success")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{"value": value})
+}
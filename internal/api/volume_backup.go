@@ -0,0 +1,768 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gorilla/mux"
+)
+
+// volumeHelperImage is the image used for the short-lived helper containers
+// that tar up or unpack a volume. It only needs sh, tar and gzip.
+const volumeHelperImage = "alpine:3.20"
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type VolumeBackup struct {
+	ID         int     `json:"id"`
+	HostID     int     `json:"host_id"`
+	VolumeName string  `json:"volume_name"`
+	Storage    string  `json:"storage"`
+	Location   string  `json:"location"`
+	SizeBytes  int64   `json:"size_bytes"`
+	Checksum   string  `json:"checksum"`
+	Status     string  `json:"status"` // running, success, failed
+	Error      *string `json:"error"`
+	Trigger    string  `json:"trigger"` // manual, schedule
+	ScheduleID *int    `json:"schedule_id"`
+	CreatedAt  string  `json:"created_at"`
+	FinishedAt *string `json:"finished_at"`
+}
+
+type VolumeBackupSchedule struct {
+	ID              int     `json:"id"`
+	HostID          int     `json:"host_id"`
+	VolumeName      string  `json:"volume_name"`
+	IntervalMinutes int     `json:"interval_minutes"`
+	Retention       int     `json:"retention"` // number of successful backups to keep
+	Storage         string  `json:"storage"`
+	Enabled         bool    `json:"enabled"`
+	LastRunAt       *string `json:"last_run_at"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+const volumeBackupColumns = `id, host_id, volume_name, storage, location, size_bytes, checksum,
+	status, error, trigger, schedule_id, created_at, finished_at`
+
+func scanVolumeBackup(row interface{ Scan(...interface{}) error }) (VolumeBackup, error) {
+	var b VolumeBackup
+	err := row.Scan(&b.ID, &b.HostID, &b.VolumeName, &b.Storage, &b.Location, &b.SizeBytes, &b.Checksum,
+		&b.Status, &b.Error, &b.Trigger, &b.ScheduleID, &b.CreatedAt, &b.FinishedAt)
+	return b, err
+}
+
+// ── Helper containers ───────────────────────────────────────────────────────
+
+// hostIDFromRequest resolves the Docker host the request targets, using the
+// same header/query/default rules as GetClient.
+func hostIDFromRequest(r *http.Request) int {
+	hostIDStr := r.Header.Get("X-Docker-Host-ID")
+	if hostIDStr == "" {
+		hostIDStr = r.URL.Query().Get("hostId")
+	}
+	hostID, err := strconv.Atoi(hostIDStr)
+	if err != nil || hostID <= 0 {
+		return 1
+	}
+	return hostID
+}
+
+// ensureImage pulls ref on the host if it is not present locally.
+func ensureImage(ctx context.Context, cli *client.Client, ref string) error {
+	if _, _, err := cli.ImageInspectWithRaw(ctx, ref); err == nil {
+		return nil
+	}
+	out, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("pull %s: %v", ref, err)
+	}
+	defer out.Close()
+	_, err = io.Copy(io.Discard, out)
+	return err
+}
+
+// runVolumeHelper starts a throwaway container with volumeName mounted at
+// /volume and runs script in it. stdin (optional) is streamed into the
+// container and its stdout is copied to stdout. The container is always
+// removed afterwards; a non-zero exit code is returned as an error carrying
+// the helper's stderr.
+func runVolumeHelper(ctx context.Context, cli *client.Client, volumeName string, readOnly bool, script string, stdin io.Reader, stdout io.Writer) error {
+	if err := ensureImage(ctx, cli, volumeHelperImage); err != nil {
+		return err
+	}
+
+	cfg := &container.Config{
+		Image:  volumeHelperImage,
+		Cmd:    []string{"sh", "-c", script},
+		Labels: map[string]string{"docker-management.helper": "volume-backup"},
+	}
+	if stdin != nil {
+		cfg.AttachStdin = true
+		cfg.OpenStdin = true
+		cfg.StdinOnce = true
+	}
+	hostCfg := &container.HostConfig{
+		Mounts: []mount.Mount{{
+			Type:     mount.TypeVolume,
+			Source:   volumeName,
+			Target:   "/volume",
+			ReadOnly: readOnly,
+		}},
+		NetworkMode: "none",
+	}
+
+	created, err := cli.ContainerCreate(ctx, cfg, hostCfg, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("create helper container: %v", err)
+	}
+	defer cli.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true})
+
+	attach, err := cli.ContainerAttach(ctx, created.ID, container.AttachOptions{
+		Stream: true,
+		Stdin:  stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("attach helper container: %v", err)
+	}
+	defer attach.Close()
+
+	waitCh, waitErrCh := cli.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+
+	if err := cli.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("start helper container: %v", err)
+	}
+
+	if stdin != nil {
+		go func() {
+			io.Copy(attach.Conn, stdin)
+			attach.CloseWrite()
+		}()
+	}
+
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(stdout, &stderr, attach.Reader); err != nil {
+		return fmt.Errorf("read helper output: %v", err)
+	}
+
+	select {
+	case res := <-waitCh:
+		if res.StatusCode != 0 {
+			return fmt.Errorf("helper exited with code %d: %s", res.StatusCode, strings.TrimSpace(stderr.String()))
+		}
+	case err := <-waitErrCh:
+		return fmt.Errorf("wait helper container: %v", err)
+	}
+	return nil
+}
+
+// streamVolumeArchive writes a gzip-compressed tar of the volume to w.
+func streamVolumeArchive(ctx context.Context, cli *client.Client, volumeName string, w io.Writer) error {
+	return runVolumeHelper(ctx, cli, volumeName, true, "tar czf - -C /volume .", nil, w)
+}
+
+// extractVolumeArchive unpacks a gzip-compressed tar from r into the volume,
+// creating the volume first if it does not exist. With overwrite set the
+// volume is emptied before extraction.
+func extractVolumeArchive(ctx context.Context, cli *client.Client, volumeName string, overwrite bool, r io.Reader) error {
+	if _, err := cli.VolumeInspect(ctx, volumeName); err != nil {
+		if !client.IsErrNotFound(err) {
+			return err
+		}
+		if _, err := cli.VolumeCreate(ctx, volume.CreateOptions{Name: volumeName, Driver: "local"}); err != nil {
+			return fmt.Errorf("create volume %s: %v", volumeName, err)
+		}
+	}
+	script := "tar xzf - -C /volume"
+	if overwrite {
+		script = "find /volume -mindepth 1 -delete && " + script
+	}
+	return runVolumeHelper(ctx, cli, volumeName, false, script, r, nil)
+}
+
+// ── Backup / restore ────────────────────────────────────────────────────────
+
+// createVolumeBackupRecord inserts a 'running' catalog row and returns its ID.
+func createVolumeBackupRecord(hostID int, volumeName, storage, trigger string, scheduleID int) (int64, error) {
+	if storage == "" {
+		storage = "local"
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO volume_backups (host_id, volume_name, storage, trigger, schedule_id, status)
+		 VALUES (?, ?, ?, ?, ?, 'running')`,
+		hostID, volumeName, storage, trigger, nullInt(scheduleID))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// runVolumeBackup archives the volume into the backup store and finalises
+// the catalog row created by createVolumeBackupRecord.
+func runVolumeBackup(backupID int64, hostID int, volumeName, storage string) error {
+	err := func() error {
+		store, err := getBackupStore(storage)
+		if err != nil {
+			return err
+		}
+		cli, err := GetClientByHostID(hostID)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer cancel()
+
+		key := fmt.Sprintf("volumes/host%d/%s/%s.tar.gz", hostID, volumeName, time.Now().Format("20060102_150405"))
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(streamVolumeArchive(ctx, cli, volumeName, pw))
+		}()
+
+		hasher := sha256.New()
+		size, err := store.Put(key, io.TeeReader(pr, hasher))
+		pr.CloseWithError(err)
+		if err != nil {
+			return err
+		}
+
+		_, err = database.DB.Exec(
+			`UPDATE volume_backups SET status = 'success', location = ?, size_bytes = ?, checksum = ?,
+			 finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			key, size, hex.EncodeToString(hasher.Sum(nil)), backupID)
+		return err
+	}()
+
+	if err != nil {
+		database.DB.Exec(
+			`UPDATE volume_backups SET status = 'failed', error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			err.Error(), backupID)
+		database.LogActivity("backup_volume", volumeName, "error")
+		return err
+	}
+	database.LogActivity("backup_volume", volumeName, "success")
+	return nil
+}
+
+// restoreVolumeBackup extracts a catalogued backup into a volume on any host.
+func restoreVolumeBackup(b VolumeBackup, targetHostID int, targetVolume string, overwrite bool) error {
+	if b.Status != "success" {
+		return fmt.Errorf("backup %d is not restorable (status %s)", b.ID, b.Status)
+	}
+	store, err := getBackupStore(b.Storage)
+	if err != nil {
+		return err
+	}
+	cli, err := GetClientByHostID(targetHostID)
+	if err != nil {
+		return err
+	}
+	rc, err := store.Open(b.Location)
+	if err != nil {
+		return fmt.Errorf("open backup archive: %v", err)
+	}
+	defer rc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+	return extractVolumeArchive(ctx, cli, targetVolume, overwrite, rc)
+}
+
+// pruneScheduleBackups enforces a schedule's retention by deleting the oldest
+// successful backups beyond the configured count.
+func pruneScheduleBackups(scheduleID, retention int) {
+	if retention <= 0 {
+		return
+	}
+	rows, err := database.DB.Query(
+		`SELECT `+volumeBackupColumns+` FROM volume_backups
+		 WHERE schedule_id = ? AND status = 'success' ORDER BY id DESC LIMIT -1 OFFSET ?`,
+		scheduleID, retention)
+	if err != nil {
+		log.Printf("[VolumeBackup] retention query for schedule %d: %v", scheduleID, err)
+		return
+	}
+	var expired []VolumeBackup
+	for rows.Next() {
+		if b, err := scanVolumeBackup(rows); err == nil {
+			expired = append(expired, b)
+		}
+	}
+	rows.Close()
+
+	for _, b := range expired {
+		if err := deleteVolumeBackup(b); err != nil {
+			log.Printf("[VolumeBackup] retention delete of backup %d: %v", b.ID, err)
+		}
+	}
+}
+
+// deleteVolumeBackup removes the archive from storage and the catalog row.
+func deleteVolumeBackup(b VolumeBackup) error {
+	if b.Location != "" {
+		store, err := getBackupStore(b.Storage)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(b.Location); err != nil {
+			return err
+		}
+	}
+	_, err := database.DB.Exec("DELETE FROM volume_backups WHERE id = ?", b.ID)
+	return err
+}
+
+func getVolumeBackupByID(id string) (VolumeBackup, error) {
+	return scanVolumeBackup(database.DB.QueryRow(
+		`SELECT `+volumeBackupColumns+` FROM volume_backups WHERE id = ?`, id))
+}
+
+// ── Scheduler ───────────────────────────────────────────────────────────────
+
+// RecoverVolumeBackups fails backups left running by a previous server
+// process, so they can be deleted and pruned.
+func RecoverVolumeBackups() {
+	database.DB.Exec(
+		`UPDATE volume_backups SET status = 'failed', error = 'interrupted by server restart', finished_at = CURRENT_TIMESTAMP
+		 WHERE status = 'running'`)
+}
+
+// activeVolumeBackupSchedules holds the schedules with a backup running.
+var activeVolumeBackupSchedules sync.Map
+
+// StartVolumeBackupScheduler runs due backup schedules once a minute.
+func StartVolumeBackupScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			runDueVolumeBackups()
+		}
+	}()
+}
+
+func runDueVolumeBackups() {
+	rows, err := database.DB.Query(
+		`SELECT id, host_id, volume_name, interval_minutes, retention, storage, last_run_at
+		 FROM volume_backup_schedules WHERE enabled = 1`)
+	if err != nil {
+		log.Printf("[VolumeBackup] scheduler query: %v", err)
+		return
+	}
+	var due []VolumeBackupSchedule
+	now := time.Now().UTC()
+	for rows.Next() {
+		var s VolumeBackupSchedule
+		if err := rows.Scan(&s.ID, &s.HostID, &s.VolumeName, &s.IntervalMinutes, &s.Retention, &s.Storage, &s.LastRunAt); err != nil {
+			continue
+		}
+		if s.LastRunAt != nil {
+			last, err := parseDBTime(*s.LastRunAt)
+			if err == nil && now.Sub(last) < time.Duration(s.IntervalMinutes)*time.Minute {
+				continue
+			}
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+
+	// Each schedule runs on its own, so one large volume doesn't hold up
+	// the others; a schedule still busy from its last run is skipped.
+	for _, s := range due {
+		if _, busy := activeVolumeBackupSchedules.LoadOrStore(s.ID, true); busy {
+			continue
+		}
+		database.DB.Exec("UPDATE volume_backup_schedules SET last_run_at = ? WHERE id = ?",
+			now.Format("2006-01-02 15:04:05"), s.ID)
+
+		go func(s VolumeBackupSchedule) {
+			defer activeVolumeBackupSchedules.Delete(s.ID)
+			id, err := createVolumeBackupRecord(s.HostID, s.VolumeName, s.Storage, "schedule", s.ID)
+			if err != nil {
+				log.Printf("[VolumeBackup] schedule %d: %v", s.ID, err)
+				return
+			}
+			if err := runVolumeBackup(id, s.HostID, s.VolumeName, s.Storage); err != nil {
+				log.Printf("[VolumeBackup] schedule %d backup of %s failed: %v", s.ID, s.VolumeName, err)
+				return
+			}
+			pruneScheduleBackups(s.ID, s.Retention)
+		}(s)
+	}
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/volumes/{name}/backup   body: {"storage":"local"}
+func backupVolume(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var req struct {
+		Storage string `json:"storage"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := getBackupStore(req.Storage); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hostID := hostIDFromRequest(r)
+	cli, err := GetClientByHostID(hostID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := cli.VolumeInspect(context.Background(), name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	id, err := createVolumeBackupRecord(hostID, name, req.Storage, "manual", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	go runVolumeBackup(id, hostID, name, req.Storage)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"id":      id,
+		"status":  "running",
+	})
+}
+
+// GET /api/volumes/backups?volume=xxx&host_id=1
+func listVolumeBackups(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + volumeBackupColumns + ` FROM volume_backups WHERE 1=1`
+	args := []interface{}{}
+	if v := r.URL.Query().Get("volume"); v != "" {
+		query += " AND volume_name = ?"
+		args = append(args, v)
+	}
+	if h := r.URL.Query().Get("host_id"); h != "" {
+		query += " AND host_id = ?"
+		args = append(args, h)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []VolumeBackup{}
+	for rows.Next() {
+		b, err := scanVolumeBackup(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, b)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GET /api/volumes/backups/{id}
+func getVolumeBackup(w http.ResponseWriter, r *http.Request) {
+	b, err := getVolumeBackupByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// GET /api/volumes/backups/{id}/download
+func downloadVolumeBackup(w http.ResponseWriter, r *http.Request) {
+	b, err := getVolumeBackupByID(mux.Vars(r)["id"])
+	if err != nil || b.Status != "success" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	store, err := getBackupStore(b.Storage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rc, err := store.Open(b.Location)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	filename := fmt.Sprintf("%s_%d.tar.gz", b.VolumeName, b.ID)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if b.SizeBytes > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(b.SizeBytes, 10))
+	}
+	io.Copy(w, rc)
+}
+
+// DELETE /api/volumes/backups/{id}
+func removeVolumeBackup(w http.ResponseWriter, r *http.Request) {
+	b, err := getVolumeBackupByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if b.Status == "running" {
+		http.Error(w, "backup is still running", http.StatusConflict)
+		return
+	}
+	if err := deleteVolumeBackup(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		database.LogActivity("delete_volume_backup", b.VolumeName, "error")
+		return
+	}
+	database.LogActivity("delete_volume_backup", b.VolumeName, "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// POST /api/volumes/backups/{id}/restore
+// body: {"host_id":2,"volume":"data-restored","overwrite":false}
+// host_id defaults to the backup's own host and volume to the original name.
+func restoreVolume(w http.ResponseWriter, r *http.Request) {
+	b, err := getVolumeBackupByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		HostID    int    `json:"host_id"`
+		Volume    string `json:"volume"`
+		Overwrite bool   `json:"overwrite"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.HostID == 0 {
+		req.HostID = b.HostID
+	}
+	if req.Volume == "" {
+		req.Volume = b.VolumeName
+	}
+
+	target := fmt.Sprintf("host%d/%s", req.HostID, req.Volume)
+	if err := restoreVolumeBackup(b, req.HostID, req.Volume, req.Overwrite); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		database.LogActivity("restore_volume", target, "error")
+		return
+	}
+	database.LogActivity("restore_volume", target, "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"host_id": req.HostID,
+		"volume":  req.Volume,
+	})
+}
+
+// POST /api/volumes/{name}/clone   body: {"target_name":"data-copy","target_host_id":2}
+// Streams the volume straight into a new (or existing) volume without going
+// through the backup store.
+func cloneVolume(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var req struct {
+		TargetName   string `json:"target_name"`
+		TargetHostID int    `json:"target_host_id"`
+		Overwrite    bool   `json:"overwrite"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	sourceHostID := hostIDFromRequest(r)
+	if req.TargetHostID == 0 {
+		req.TargetHostID = sourceHostID
+	}
+	if req.TargetName == "" {
+		http.Error(w, "target_name is required", http.StatusBadRequest)
+		return
+	}
+	if req.TargetName == name && req.TargetHostID == sourceHostID {
+		http.Error(w, "target must differ from source", http.StatusBadRequest)
+		return
+	}
+
+	srcCli, err := GetClientByHostID(sourceHostID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dstCli, err := GetClientByHostID(req.TargetHostID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(streamVolumeArchive(ctx, srcCli, name, pw))
+	}()
+	err = extractVolumeArchive(ctx, dstCli, req.TargetName, req.Overwrite, pr)
+	pr.CloseWithError(err)
+
+	target := fmt.Sprintf("%s -> host%d/%s", name, req.TargetHostID, req.TargetName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		database.LogActivity("clone_volume", target, "error")
+		return
+	}
+	database.LogActivity("clone_volume", target, "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"host_id": req.TargetHostID,
+		"volume":  req.TargetName,
+	})
+}
+
+// GET /api/volumes/backup-schedules
+func listVolumeBackupSchedules(w http.ResponseWriter, r *http.Request) {
+	rows, err := database.DB.Query(
+		`SELECT id, host_id, volume_name, interval_minutes, retention, storage, enabled, last_run_at, created_at
+		 FROM volume_backup_schedules ORDER BY id`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []VolumeBackupSchedule{}
+	for rows.Next() {
+		var s VolumeBackupSchedule
+		var enabled int
+		if err := rows.Scan(&s.ID, &s.HostID, &s.VolumeName, &s.IntervalMinutes, &s.Retention,
+			&s.Storage, &enabled, &s.LastRunAt, &s.CreatedAt); err != nil {
+			continue
+		}
+		s.Enabled = enabled == 1
+		list = append(list, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// POST /api/volumes/backup-schedules
+// body: {"host_id":1,"volume_name":"pgdata","interval_minutes":1440,"retention":7}
+// An existing schedule for the same host/volume is replaced.
+func saveVolumeBackupSchedule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		HostID          int    `json:"host_id"`
+		VolumeName      string `json:"volume_name"`
+		IntervalMinutes int    `json:"interval_minutes"`
+		Retention       int    `json:"retention"`
+		Storage         string `json:"storage"`
+		Enabled         *bool  `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.VolumeName == "" {
+		http.Error(w, "volume_name is required", http.StatusBadRequest)
+		return
+	}
+	if req.HostID == 0 {
+		req.HostID = hostIDFromRequest(r)
+	}
+	if req.IntervalMinutes < 5 {
+		http.Error(w, "interval_minutes must be at least 5", http.StatusBadRequest)
+		return
+	}
+	if req.Retention <= 0 {
+		req.Retention = 7
+	}
+	if req.Storage == "" {
+		req.Storage = "local"
+	}
+	if _, err := getBackupStore(req.Storage); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	enabled := 1
+	if req.Enabled != nil && !*req.Enabled {
+		enabled = 0
+	}
+
+	_, err := database.DB.Exec(
+		`INSERT INTO volume_backup_schedules (host_id, volume_name, interval_minutes, retention, storage, enabled)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(host_id, volume_name) DO UPDATE SET
+		   interval_minutes = excluded.interval_minutes, retention = excluded.retention,
+		   storage = excluded.storage, enabled = excluded.enabled`,
+		req.HostID, req.VolumeName, req.IntervalMinutes, req.Retention, req.Storage, enabled)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var id int
+	database.DB.QueryRow("SELECT id FROM volume_backup_schedules WHERE host_id = ? AND volume_name = ?",
+		req.HostID, req.VolumeName).Scan(&id)
+	database.LogActivity("schedule_volume_backup", req.VolumeName, "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id})
+}
+
+// DELETE /api/volumes/backup-schedules/{id}
+// Existing backups are kept; they just stop being subject to retention.
+func deleteVolumeBackupSchedule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	res, err := database.DB.Exec("DELETE FROM volume_backup_schedules WHERE id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	database.DB.Exec("UPDATE volume_backups SET schedule_id = NULL WHERE schedule_id = ?", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -0,0 +1,526 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+)
+
+// The scanner works fully offline against advisories an admin imports:
+//   - OSV records (single JSON, JSON array, or the per-ecosystem all.zip
+//     from osv-vulnerabilities) provide the affected package ranges.
+//   - NVD CVE feeds (JSON 1.1 or API 2.0 format) provide CVSS severities
+//     for advisories that don't carry their own, e.g. Debian's.
+
+// ── Models ─────────────────────────────────────────────────────────────────
+
+type vulnAdvisory struct {
+	VulnID    string
+	Aliases   []string
+	Ecosystem string
+	Package   string
+	Ranges    []osvRange
+	Versions  []string
+	Severity  string
+	CVSS      float64
+	Summary   string
+}
+
+type VulnDBImport struct {
+	ID         int    `json:"id"`
+	Source     string `json:"source"`
+	Filename   string `json:"filename"`
+	Records    int    `json:"records"`
+	ImportedBy string `json:"imported_by"`
+	ImportedAt string `json:"imported_at"`
+}
+
+// ── OSV ─────────────────────────────────────────────────────────────────────
+
+type osvRecord struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Modified string   `json:"modified"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges            []osvRange      `json:"ranges"`
+		Versions          []string        `json:"versions"`
+		EcosystemSpecific json.RawMessage `json:"ecosystem_specific"`
+		DatabaseSpecific  json.RawMessage `json:"database_specific"`
+	} `json:"affected"`
+	DatabaseSpecific json.RawMessage `json:"database_specific"`
+}
+
+// severityField pulls a "severity" string out of an OSV *_specific blob.
+func severityField(raw json.RawMessage) string {
+	var v struct {
+		Severity string `json:"severity"`
+	}
+	if len(raw) > 0 && json.Unmarshal(raw, &v) == nil {
+		return v.Severity
+	}
+	return ""
+}
+
+func importOSVRecord(tx *sql.Tx, rec osvRecord) (int, error) {
+	if rec.ID == "" {
+		return 0, nil
+	}
+	score := 0.0
+	for _, s := range rec.Severity {
+		if strings.HasPrefix(s.Type, "CVSS_V3") {
+			if v := cvss3BaseScore(s.Score); v > score {
+				score = v
+			}
+		}
+	}
+	recordSeverity := ""
+	if score > 0 {
+		recordSeverity = severityFromScore(score)
+	} else if s := severityField(rec.DatabaseSpecific); s != "" {
+		recordSeverity = normalizeSeverity(s)
+	}
+	summary := rec.Summary
+	if summary == "" {
+		summary = rec.Details
+	}
+	if len(summary) > 500 {
+		summary = summary[:500]
+	}
+	aliases, _ := json.Marshal(rec.Aliases)
+
+	n := 0
+	for _, a := range rec.Affected {
+		if a.Package.Name == "" || a.Package.Ecosystem == "" {
+			continue
+		}
+		severity := recordSeverity
+		if severity == "" {
+			if s := severityField(a.EcosystemSpecific); s != "" {
+				severity = normalizeSeverity(s)
+			} else if s := severityField(a.DatabaseSpecific); s != "" {
+				severity = normalizeSeverity(s)
+			}
+		}
+		ranges, _ := json.Marshal(a.Ranges)
+		versions, _ := json.Marshal(a.Versions)
+		_, err := tx.Exec(
+			`INSERT INTO vuln_advisories (vuln_id, aliases, ecosystem, package, ranges, versions, severity, cvss_score, summary, modified)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(vuln_id, ecosystem, package) DO UPDATE SET
+			   aliases = excluded.aliases, ranges = excluded.ranges, versions = excluded.versions,
+			   severity = excluded.severity, cvss_score = excluded.cvss_score,
+			   summary = excluded.summary, modified = excluded.modified`,
+			rec.ID, string(aliases), a.Package.Ecosystem, a.Package.Name, string(ranges), string(versions),
+			severity, score, summary, rec.Modified)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ── NVD ─────────────────────────────────────────────────────────────────────
+
+type nvdScore struct {
+	ID       string
+	Score    float64
+	Severity string
+	Summary  string
+	Modified string
+}
+
+// parseNVDFeed understands both the legacy 1.1 feeds ("CVE_Items") and
+// the API 2.0 format ("vulnerabilities").
+func parseNVDFeed(data []byte) ([]nvdScore, error) {
+	var feed struct {
+		CVEItems []struct {
+			CVE struct {
+				Meta struct {
+					ID string `json:"ID"`
+				} `json:"CVE_data_meta"`
+				Description struct {
+					Data []struct {
+						Value string `json:"value"`
+					} `json:"description_data"`
+				} `json:"description"`
+			} `json:"cve"`
+			Impact struct {
+				V3 struct {
+					CVSS struct {
+						BaseScore    float64 `json:"baseScore"`
+						BaseSeverity string  `json:"baseSeverity"`
+					} `json:"cvssV3"`
+				} `json:"baseMetricV3"`
+				V2 struct {
+					CVSS struct {
+						BaseScore float64 `json:"baseScore"`
+					} `json:"cvssV2"`
+					Severity string `json:"severity"`
+				} `json:"baseMetricV2"`
+			} `json:"impact"`
+			LastModified string `json:"lastModifiedDate"`
+		} `json:"CVE_Items"`
+		Vulnerabilities []struct {
+			CVE struct {
+				ID           string `json:"id"`
+				LastModified string `json:"lastModified"`
+				Descriptions []struct {
+					Lang  string `json:"lang"`
+					Value string `json:"value"`
+				} `json:"descriptions"`
+				Metrics map[string][]struct {
+					CVSSData struct {
+						BaseScore    float64 `json:"baseScore"`
+						BaseSeverity string  `json:"baseSeverity"`
+					} `json:"cvssData"`
+					BaseSeverity string `json:"baseSeverity"`
+				} `json:"metrics"`
+			} `json:"cve"`
+		} `json:"vulnerabilities"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+
+	var out []nvdScore
+	for _, it := range feed.CVEItems {
+		s := nvdScore{ID: it.CVE.Meta.ID, Modified: it.LastModified}
+		if len(it.CVE.Description.Data) > 0 {
+			s.Summary = it.CVE.Description.Data[0].Value
+		}
+		if it.Impact.V3.CVSS.BaseScore > 0 {
+			s.Score = it.Impact.V3.CVSS.BaseScore
+			s.Severity = normalizeSeverity(it.Impact.V3.CVSS.BaseSeverity)
+		} else if it.Impact.V2.CVSS.BaseScore > 0 {
+			s.Score = it.Impact.V2.CVSS.BaseScore
+			s.Severity = normalizeSeverity(it.Impact.V2.Severity)
+		}
+		out = append(out, s)
+	}
+	for _, v := range feed.Vulnerabilities {
+		s := nvdScore{ID: v.CVE.ID, Modified: v.CVE.LastModified}
+		for _, d := range v.CVE.Descriptions {
+			if d.Lang == "en" {
+				s.Summary = d.Value
+				break
+			}
+		}
+		for _, key := range []string{"cvssMetricV40", "cvssMetricV31", "cvssMetricV30", "cvssMetricV2"} {
+			if m := v.CVE.Metrics[key]; len(m) > 0 && m[0].CVSSData.BaseScore > 0 {
+				s.Score = m[0].CVSSData.BaseScore
+				sev := m[0].CVSSData.BaseSeverity
+				if sev == "" {
+					sev = m[0].BaseSeverity
+				}
+				s.Severity = normalizeSeverity(sev)
+				if s.Severity == "info" {
+					s.Severity = severityFromScore(s.Score)
+				}
+				break
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func importNVDScores(tx *sql.Tx, scores []nvdScore) (int, error) {
+	n := 0
+	for _, s := range scores {
+		if s.ID == "" || s.Severity == "" {
+			continue
+		}
+		summary := s.Summary
+		if len(summary) > 500 {
+			summary = summary[:500]
+		}
+		_, err := tx.Exec(
+			`INSERT INTO vuln_cve_scores (cve_id, severity, cvss_score, summary, modified) VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(cve_id) DO UPDATE SET severity = excluded.severity, cvss_score = excluded.cvss_score,
+			   summary = excluded.summary, modified = excluded.modified`,
+			s.ID, s.Severity, s.Score, summary, s.Modified)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ── Import ──────────────────────────────────────────────────────────────────
+
+// importVulnDocument imports one JSON document, detecting whether it is an
+// NVD feed, an OSV array or a single OSV record.
+func importVulnDocument(tx *sql.Tx, data []byte) (string, int, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "", 0, nil
+	}
+	if data[0] == '[' {
+		var recs []osvRecord
+		if err := json.Unmarshal(data, &recs); err != nil {
+			return "osv", 0, err
+		}
+		total := 0
+		for _, rec := range recs {
+			n, err := importOSVRecord(tx, rec)
+			if err != nil {
+				return "osv", total, err
+			}
+			total += n
+		}
+		return "osv", total, nil
+	}
+	var probe struct {
+		CVEItems        json.RawMessage `json:"CVE_Items"`
+		Vulnerabilities json.RawMessage `json:"vulnerabilities"`
+	}
+	json.Unmarshal(data, &probe) //nolint:errcheck
+	if probe.CVEItems != nil || probe.Vulnerabilities != nil {
+		scores, err := parseNVDFeed(data)
+		if err != nil {
+			return "nvd", 0, err
+		}
+		n, err := importNVDScores(tx, scores)
+		return "nvd", n, err
+	}
+	var rec osvRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return "osv", 0, err
+	}
+	n, err := importOSVRecord(tx, rec)
+	return "osv", n, err
+}
+
+// importVulnFile imports a .json, .json.gz or .zip snapshot.
+func importVulnFile(path string) (string, int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	source, total := "", 0
+	add := func(data []byte) error {
+		src, n, err := importVulnDocument(tx, data)
+		if src != "" {
+			source = src
+		}
+		total += n
+		return err
+	}
+
+	if zr, zerr := zip.OpenReader(path); zerr == nil {
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !strings.HasSuffix(f.Name, ".json") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return source, total, err
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return source, total, err
+			}
+			if err := add(data); err != nil {
+				return source, total, fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", 0, err
+		}
+		defer f.Close()
+		br := bufio.NewReader(f)
+		var r io.Reader = br
+		if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				return "", 0, err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return "", 0, err
+		}
+		if err := add(data); err != nil {
+			return source, total, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return source, total, err
+	}
+	return source, total, nil
+}
+
+// ── Lookup ──────────────────────────────────────────────────────────────────
+
+// findAdvisories returns advisories for pkg in ecosystem. ecosystem may
+// carry a release ("Debian:12", "Ubuntu:22.04"); OSV records for that
+// release, including longer forms like "Ubuntu:22.04:LTS", match.
+func findAdvisories(ecosystem, pkg string) ([]vulnAdvisory, error) {
+	rows, err := database.DB.Query(
+		`SELECT a.vuln_id, a.aliases, a.ecosystem, a.package, a.ranges, a.versions, a.severity, a.cvss_score, a.summary
+		 FROM vuln_advisories a WHERE a.package = ? AND (a.ecosystem = ? OR a.ecosystem LIKE ?)`,
+		pkg, ecosystem, ecosystem+":%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []vulnAdvisory
+	for rows.Next() {
+		var a vulnAdvisory
+		var aliases, ranges, versions string
+		if err := rows.Scan(&a.VulnID, &aliases, &a.Ecosystem, &a.Package, &ranges, &versions,
+			&a.Severity, &a.CVSS, &a.Summary); err != nil {
+			continue
+		}
+		json.Unmarshal([]byte(aliases), &a.Aliases)   //nolint:errcheck
+		json.Unmarshal([]byte(ranges), &a.Ranges)     //nolint:errcheck
+		json.Unmarshal([]byte(versions), &a.Versions) //nolint:errcheck
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// cveSeverity fills in severity from imported NVD data for advisories that
+// have none, looking at the record ID and its aliases.
+func cveSeverity(a *vulnAdvisory) {
+	if a.Severity != "" {
+		return
+	}
+	for _, id := range append([]string{a.VulnID}, a.Aliases...) {
+		if !strings.HasPrefix(id, "CVE-") {
+			continue
+		}
+		var sev string
+		var score float64
+		if err := database.DB.QueryRow(`SELECT severity, cvss_score FROM vuln_cve_scores WHERE cve_id = ?`, id).
+			Scan(&sev, &score); err == nil {
+			a.Severity, a.CVSS = sev, score
+			return
+		}
+	}
+	a.Severity = "info"
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/cicd/vulndb/import  (multipart "file"; admin only)
+func ImportVulnDB(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		http.Error(w, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, hdr, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	tmp, err := os.CreateTemp("", "vulndb-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, file)
+	tmp.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	source, n, err := importVulnFile(tmp.Name())
+	if err != nil {
+		recordActivityLog("vulndb_import", hdr.Filename, err.Error(), "error")
+		http.Error(w, "Import failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	database.DB.Exec(`INSERT INTO vuln_db_imports (source, filename, records, imported_by) VALUES (?, ?, ?, ?)`,
+		source, hdr.Filename, n, user.Username)
+	recordActivityLog("vulndb_import", hdr.Filename, fmt.Sprintf("%d %s records", n, source), "success")
+	log.Printf("[VulnDB] Imported %d %s records from %s", n, source, hdr.Filename)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "source": source, "records": n})
+}
+
+// GET /api/cicd/vulndb
+func GetVulnDBStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetUserFromContext(r.Context()); !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ecosystems := map[string]int{}
+	rows, err := database.DB.Query(`SELECT ecosystem, COUNT(*) FROM vuln_advisories GROUP BY ecosystem`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var eco string
+		var n int
+		if rows.Scan(&eco, &n) == nil {
+			ecosystems[eco] = n
+		}
+	}
+	rows.Close()
+
+	var cves int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM vuln_cve_scores`).Scan(&cves)
+
+	imports := []VulnDBImport{}
+	rows, err = database.DB.Query(`SELECT id, source, filename, records, imported_by, imported_at
+		FROM vuln_db_imports ORDER BY id DESC LIMIT 20`)
+	if err == nil {
+		for rows.Next() {
+			var im VulnDBImport
+			if rows.Scan(&im.ID, &im.Source, &im.Filename, &im.Records, &im.ImportedBy, &im.ImportedAt) == nil {
+				imports = append(imports, im)
+			}
+		}
+		rows.Close()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ecosystems": ecosystems,
+		"cve_scores": cves,
+		"imports":    imports,
+	})
+}
@@ -0,0 +1,501 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version comparison for the package ecosystems the scanner understands.
+// Each compare function returns -1, 0 or 1.
+
+// compareVersions dispatches on the OSV ecosystem name (the part before
+// any ":release" suffix).
+func compareVersions(ecosystem, a, b string) int {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	switch base {
+	case "Debian", "Ubuntu":
+		return compareDpkgVersions(a, b)
+	case "Alpine":
+		return compareApkVersions(a, b)
+	case "Red Hat", "Rocky Linux", "AlmaLinux", "openSUSE", "SUSE", "Mageia":
+		return compareRpmVersions(a, b)
+	case "Go", "npm":
+		return compareSemver(a, b)
+	case "PyPI":
+		return comparePep440(a, b)
+	}
+	return compareDpkgVersions(a, b)
+}
+
+// ── dpkg ────────────────────────────────────────────────────────────────────
+
+func dpkgOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case c >= '0' && c <= '9':
+		return 0
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return int(c)
+	}
+	return int(c) + 256
+}
+
+// dpkgVerrevcmp is the upstream/revision comparison from dpkg's lib/dpkg/version.c.
+func dpkgVerrevcmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		firstDiff := 0
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := 0, 0
+			if i < len(a) {
+				ac = dpkgOrder(a[i])
+			}
+			if j < len(b) {
+				bc = dpkgOrder(b[j])
+			}
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+func splitEpoch(v string) (int, string) {
+	if i := strings.Index(v, ":"); i > 0 {
+		if e, err := strconv.Atoi(v[:i]); err == nil {
+			return e, v[i+1:]
+		}
+	}
+	return 0, v
+}
+
+func compareDpkgVersions(a, b string) int {
+	ea, ra := splitEpoch(a)
+	eb, rb := splitEpoch(b)
+	if ea != eb {
+		return sign(ea - eb)
+	}
+	ua, reva := ra, ""
+	if i := strings.LastIndex(ra, "-"); i >= 0 {
+		ua, reva = ra[:i], ra[i+1:]
+	}
+	ub, revb := rb, ""
+	if i := strings.LastIndex(rb, "-"); i >= 0 {
+		ub, revb = rb[:i], rb[i+1:]
+	}
+	if c := dpkgVerrevcmp(ua, ub); c != 0 {
+		return c
+	}
+	return dpkgVerrevcmp(reva, revb)
+}
+
+// ── apk ─────────────────────────────────────────────────────────────────────
+
+// compareApkVersions maps apk's pre-release suffixes onto dpkg's "~" so
+// 1.0_rc1 < 1.0 < 1.0_p1, then compares like dpkg with -rN as revision.
+func compareApkVersions(a, b string) int {
+	norm := func(v string) string {
+		for _, s := range []string{"_alpha", "_beta", "_pre", "_rc"} {
+			v = strings.ReplaceAll(v, s, "~"+s[1:])
+		}
+		return v
+	}
+	return compareDpkgVersions(norm(a), norm(b))
+}
+
+// ── rpm ─────────────────────────────────────────────────────────────────────
+
+// rpmvercmp follows rpm's rpmio/rpmvercmp.c including ~ and ^ handling.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isAlnum := func(c byte) bool { return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isAlnum(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isAlnum(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+		if (i < len(a) && a[i] == '~') || (j < len(b) && b[j] == '~') {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if (i < len(a) && a[i] == '^') || (j < len(b) && b[j] == '^') {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+		si, sj := i, j
+		numeric := isDigit(a[i])
+		if numeric {
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+		} else {
+			for i < len(a) && isAlnum(a[i]) && !isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isAlnum(b[j]) && !isDigit(b[j]) {
+				j++
+			}
+		}
+		sa, sb := a[si:i], b[sj:j]
+		if sb == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			sa = strings.TrimLeft(sa, "0")
+			sb = strings.TrimLeft(sb, "0")
+			if len(sa) != len(sb) {
+				return sign(len(sa) - len(sb))
+			}
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i >= len(a):
+		return -1
+	}
+	return 1
+}
+
+func compareRpmVersions(a, b string) int {
+	ea, ra := splitEpoch(a)
+	eb, rb := splitEpoch(b)
+	if ea != eb {
+		return sign(ea - eb)
+	}
+	va, rela, _ := strings.Cut(ra, "-")
+	vb, relb, _ := strings.Cut(rb, "-")
+	if c := rpmvercmp(va, vb); c != 0 {
+		return c
+	}
+	if rela == "" || relb == "" {
+		return 0
+	}
+	return rpmvercmp(rela, relb)
+}
+
+// ── semver / PEP 440 ────────────────────────────────────────────────────────
+
+// compareSemver compares MAJOR.MINOR.PATCH[-pre][+build]; a leading "v"
+// and Go's "+incompatible" suffix are ignored.
+func compareSemver(a, b string) int {
+	parse := func(v string) ([]int, string) {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+		v, _, _ = strings.Cut(v, "+")
+		core, pre, _ := strings.Cut(v, "-")
+		nums := make([]int, 3)
+		for k, p := range strings.SplitN(core, ".", 3) {
+			nums[k], _ = strconv.Atoi(p)
+		}
+		return nums, pre
+	}
+	na, pa := parse(a)
+	nb, pb := parse(b)
+	for k := 0; k < 3; k++ {
+		if na[k] != nb[k] {
+			return sign(na[k] - nb[k])
+		}
+	}
+	switch {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	}
+	ia, ib := strings.Split(pa, "."), strings.Split(pb, ".")
+	for k := 0; k < len(ia) && k < len(ib); k++ {
+		x, errX := strconv.Atoi(ia[k])
+		y, errY := strconv.Atoi(ib[k])
+		switch {
+		case errX == nil && errY == nil:
+			if x != y {
+				return sign(x - y)
+			}
+		case errX == nil:
+			return -1
+		case errY == nil:
+			return 1
+		default:
+			if c := strings.Compare(ia[k], ib[k]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(ia) - len(ib))
+}
+
+// comparePep440 is an approximation good enough for advisory ranges:
+// dev/alpha/beta/rc releases sort before the final release, post releases
+// after it.
+func comparePep440(a, b string) int {
+	norm := func(v string) string {
+		v = strings.ToLower(strings.TrimSpace(v))
+		v = strings.TrimPrefix(v, "v")
+		v = strings.NewReplacer(".dev", "~~dev", "alpha", "~a", "beta", "~b", "rc", "~rc").Replace(v)
+		// "a1"/"b1" directly after a digit
+		var sb strings.Builder
+		for k := 0; k < len(v); k++ {
+			if (v[k] == 'a' || v[k] == 'b') && k > 0 && isDigit(v[k-1]) {
+				sb.WriteByte('~')
+			}
+			sb.WriteByte(v[k])
+		}
+		return sb.String()
+	}
+	return dpkgVerrevcmp(norm(a), norm(b))
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// ── OSV ranges ──────────────────────────────────────────────────────────────
+
+type osvEvent struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+type osvRange struct {
+	Type   string     `json:"type"`
+	Events []osvEvent `json:"events"`
+}
+
+// osvAffected reports whether version falls in any of the ranges or the
+// explicit versions list, following the OSV evaluation rules.
+func osvAffected(ecosystem, version string, ranges []osvRange, versions []string) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	for _, r := range ranges {
+		if r.Type == "GIT" {
+			continue
+		}
+		events := append([]osvEvent(nil), r.Events...)
+		eventVersion := func(e osvEvent) string {
+			switch {
+			case e.Introduced != "":
+				return e.Introduced
+			case e.Fixed != "":
+				return e.Fixed
+			}
+			return e.LastAffected
+		}
+		sort.SliceStable(events, func(x, y int) bool {
+			vx, vy := eventVersion(events[x]), eventVersion(events[y])
+			if vx == "0" {
+				return vy != "0"
+			}
+			if vy == "0" {
+				return false
+			}
+			return compareVersions(ecosystem, vx, vy) < 0
+		})
+		affected := false
+		for _, e := range events {
+			switch {
+			case e.Introduced != "":
+				if e.Introduced == "0" || compareVersions(ecosystem, version, e.Introduced) >= 0 {
+					affected = true
+				}
+			case e.Fixed != "":
+				if compareVersions(ecosystem, version, e.Fixed) >= 0 {
+					affected = false
+				}
+			case e.LastAffected != "":
+				if compareVersions(ecosystem, version, e.LastAffected) > 0 {
+					affected = false
+				}
+			}
+		}
+		if affected {
+			return true
+		}
+	}
+	return false
+}
+
+// ── Severity ────────────────────────────────────────────────────────────────
+
+// cvss3BaseScore computes the base score from a CVSS v3.x vector string,
+// returning 0 if the vector can't be parsed.
+func cvss3BaseScore(vector string) float64 {
+	m := map[string]string{}
+	for _, part := range strings.Split(vector, "/") {
+		if k, v, ok := strings.Cut(part, ":"); ok {
+			m[k] = v
+		}
+	}
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"UI": {"N": 0.85, "R": 0.62},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	get := func(k string) (float64, bool) {
+		v, ok := weights[k][m[k]]
+		return v, ok
+	}
+	av, ok1 := get("AV")
+	ac, ok2 := get("AC")
+	ui, ok3 := get("UI")
+	c, ok4 := get("C")
+	i, ok5 := get("I")
+	a, ok6 := get("A")
+	scope := m["S"]
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6) || (scope != "U" && scope != "C") {
+		return 0
+	}
+	var pr float64
+	switch m["PR"] {
+	case "N":
+		pr = 0.85
+	case "L":
+		pr = 0.62
+		if scope == "C" {
+			pr = 0.68
+		}
+	case "H":
+		pr = 0.27
+		if scope == "C" {
+			pr = 0.5
+		}
+	default:
+		return 0
+	}
+	iss := 1 - (1-c)*(1-i)*(1-a)
+	var impact float64
+	if scope == "U" {
+		impact = 6.42 * iss
+	} else {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0
+	}
+	exploit := 8.22 * av * ac * pr * ui
+	if scope == "U" {
+		return roundUp1(math.Min(impact+exploit, 10))
+	}
+	return roundUp1(math.Min(1.08*(impact+exploit), 10))
+}
+
+// roundUp1 is the CVSS v3.1 "round up to one decimal" function.
+func roundUp1(x float64) float64 {
+	n := int64(math.Round(x * 100000))
+	if n%10000 == 0 {
+		return float64(n) / 100000
+	}
+	return (math.Floor(float64(n)/10000) + 1) / 10
+}
+
+// severityFromScore maps a CVSS score onto the report's severity buckets.
+func severityFromScore(score float64) string {
+	switch {
+	case score >= 9:
+		return "critical"
+	case score >= 7:
+		return "high"
+	case score >= 4:
+		return "medium"
+	case score > 0:
+		return "low"
+	}
+	return "info"
+}
+
+// normalizeSeverity folds the many spellings used by advisory sources and
+// scanners into critical/high/medium/low/info.
+func normalizeSeverity(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "critical":
+		return "critical"
+	case "high", "important", "error":
+		return "high"
+	case "medium", "moderate", "warning":
+		return "medium"
+	case "low", "negligible", "minor", "note":
+		return "low"
+	}
+	return "info"
+}
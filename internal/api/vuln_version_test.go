@@ -0,0 +1,73 @@
+package api
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		ecosystem, a, b string
+		want            int
+	}{
+		// dpkg: epochs, revisions and "~" sorting before everything
+		{"Debian:12", "1.2.3-1", "1.2.3-1", 0},
+		{"Debian:12", "1.2.3-1", "1.2.3-2", -1},
+		{"Debian:12", "1:1.0-1", "2.0-1", 1},
+		{"Ubuntu:22.04", "1.0~rc1-1", "1.0-1", -1},
+		{"Ubuntu:22.04", "1.10-1", "1.9-1", 1},
+		{"Debian", "2.36-9+deb12u4", "2.36-9+deb12u3", 1},
+		// apk: _rc before the release, _p after it, -rN as revision
+		{"Alpine:v3.19", "1.0_rc1", "1.0", -1},
+		{"Alpine:v3.19", "1.0_p1", "1.0", 1},
+		{"Alpine:v3.19", "3.1.4-r5", "3.1.4-r10", -1},
+		// rpm: ~ before the release, ^ after it
+		{"Red Hat", "1.0~beta", "1.0", -1},
+		{"Rocky Linux", "1.0^git1", "1.0", 1},
+		{"AlmaLinux", "2.17-326.el7", "2.17-325.el7", 1},
+		{"openSUSE", "1.2.a", "1.2.1", -1},
+		// semver: pre-releases before the release, build metadata ignored
+		{"Go", "v1.2.3", "1.2.3", 0},
+		{"Go", "v1.2.3+incompatible", "v1.2.3", 0},
+		{"npm", "1.0.0-alpha", "1.0.0", -1},
+		{"npm", "1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"npm", "1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"npm", "1.10.0", "1.9.9", 1},
+		// PEP 440: dev < alpha < beta < rc < final < post
+		{"PyPI", "1.0.dev1", "1.0a1", -1},
+		{"PyPI", "1.0a1", "1.0b1", -1},
+		{"PyPI", "1.0rc1", "1.0", -1},
+		{"PyPI", "1.0", "1.0.post1", -1},
+		{"PyPI", "2.31.0", "2.4.0", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.ecosystem, tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersions(tt.ecosystem, tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestOSVAffected(t *testing.T) {
+	ranges := []osvRange{{Type: "ECOSYSTEM", Events: []osvEvent{
+		{Introduced: "0"}, {Fixed: "1.2.0"}, {Introduced: "2.0.0"}, {LastAffected: "2.1.0"},
+	}}}
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"1.0.0", true},
+		{"1.2.0", false},
+		{"1.5.0", false},
+		{"2.0.0", true},
+		{"2.1.0", true},
+		{"2.1.1", false},
+	}
+	for _, tt := range tests {
+		if got := osvAffected("npm", tt.version, ranges, nil); got != tt.want {
+			t.Errorf("osvAffected(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+	if !osvAffected("npm", "3.0.0", nil, []string{"3.0.0"}) {
+		t.Error("explicit version list not honoured")
+	}
+}
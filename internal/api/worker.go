@@ -5,9 +5,11 @@ import (
 "fmt"
 "net"
 "net/http"
+"strconv"
 "time"
 
 "github.com/adisaputra10/docker-management/internal/database"
+"github.com/adisaputra10/docker-management/internal/vault"
 "github.com/gorilla/mux"
 )
 
@@ -25,6 +27,19 @@ Description string `json:"description"`
 WorkspaceID string `json:"workspace_id"`
 Status      string `json:"status"`
 CreatedAt   string `json:"created_at"`
+MaxConcurrentJobs  int     `json:"max_concurrent_jobs"`
+RunningJobs        int     `json:"running_jobs"`
+HostKeyFingerprint *string `json:"host_key_fingerprint"`
+LastHeartbeatAt    *string `json:"last_heartbeat_at"`
+LastError          *string `json:"last_error"`
+OS                 *string  `json:"os"`
+CPUCores           *int     `json:"cpu_cores"`
+LoadAvg            *float64 `json:"load_avg"`
+MemTotalMB         *int64   `json:"mem_total_mb"`
+MemAvailableMB     *int64   `json:"mem_available_mb"`
+DiskTotalMB        *int64   `json:"disk_total_mb"`
+DiskFreeMB         *int64   `json:"disk_free_mb"`
+DockerVersion      *string  `json:"docker_version"`
 }
 
 type WorkerRequest struct {
@@ -37,6 +52,7 @@ AgentType     string `json:"agent_type"`
 Labels        string `json:"labels"`
 Description   string `json:"description"`
 WorkspaceID   string `json:"workspace_id"`
+MaxConcurrentJobs int `json:"max_concurrent_jobs"`
 }
 
 //  Handlers 
@@ -49,7 +65,9 @@ http.Error(w, "Forbidden", http.StatusForbidden)
 return
 }
 wsID := r.URL.Query().Get("workspace_id")
-query := "SELECT id, name, host, ssh_port, ssh_user, agent_type, labels, description, workspace_id, status, created_at FROM cicd_workers"
+query := `SELECT id, name, host, ssh_port, ssh_user, agent_type, labels, description, workspace_id, status, created_at,
+ max_concurrent_jobs, host_key_fingerprint, last_heartbeat_at, last_error, os, cpu_cores, load_avg,
+ mem_total_mb, mem_available_mb, disk_total_mb, disk_free_mb, docker_version FROM cicd_workers`
 args := []interface{}{}
 if wsID != "" {
 query += " WHERE workspace_id = ?"
@@ -68,9 +86,12 @@ var list []CicdWorker
 for rows.Next() {
 var wk CicdWorker
 if err := rows.Scan(&wk.ID, &wk.Name, &wk.Host, &wk.SSHPort, &wk.SSHUser,
-&wk.AgentType, &wk.Labels, &wk.Description, &wk.WorkspaceID, &wk.Status, &wk.CreatedAt); err != nil {
+&wk.AgentType, &wk.Labels, &wk.Description, &wk.WorkspaceID, &wk.Status, &wk.CreatedAt,
+&wk.MaxConcurrentJobs, &wk.HostKeyFingerprint, &wk.LastHeartbeatAt, &wk.LastError, &wk.OS, &wk.CPUCores, &wk.LoadAvg,
+&wk.MemTotalMB, &wk.MemAvailableMB, &wk.DiskTotalMB, &wk.DiskFreeMB, &wk.DockerVersion); err != nil {
 continue
 }
+wk.RunningJobs = runningJobs(wk.ID)
 list = append(list, wk)
 }
 if list == nil {
@@ -109,23 +130,39 @@ req.SSHUser = "root"
 if req.AgentType == "" {
 req.AgentType = "shell"
 }
+if req.MaxConcurrentJobs <= 0 {
+req.MaxConcurrentJobs = 2
+}
+if req.MaxConcurrentJobs > maxWorkerJobs {
+http.Error(w, fmt.Sprintf("max_concurrent_jobs must be at most %d", maxWorkerJobs), http.StatusBadRequest)
+return
+}
 
+sshKey, err := vault.Seal(req.SSHPrivateKey)
+if err != nil {
+http.Error(w, err.Error(), http.StatusInternalServerError)
+return
+}
 result, err := database.DB.Exec(
-`INSERT INTO cicd_workers (name, host, ssh_port, ssh_user, ssh_private_key, agent_type, labels, description, workspace_id, status)
- VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'offline')`,
-req.Name, req.Host, req.SSHPort, req.SSHUser, req.SSHPrivateKey,
-req.AgentType, req.Labels, req.Description, req.WorkspaceID,
+`INSERT INTO cicd_workers (name, host, ssh_port, ssh_user, ssh_private_key, agent_type, labels, description, workspace_id, status, max_concurrent_jobs)
+ VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'offline', ?)`,
+req.Name, req.Host, req.SSHPort, req.SSHUser, sshKey,
+req.AgentType, req.Labels, req.Description, req.WorkspaceID, req.MaxConcurrentJobs,
 )
 if err != nil {
 http.Error(w, "Error creating worker: "+err.Error(), http.StatusInternalServerError)
 return
 }
 id, _ := result.LastInsertId()
+// First check pins the host key and brings the worker online.
+if wk, err := loadPipelineWorker(id); err == nil {
+go checkWorker(wk)
+}
 w.Header().Set("Content-Type", "application/json")
 json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id})
 }
 
-// GET /api/cicd/workers/{id}  (admin only)  includes SSH key
+// GET /api/cicd/workers/{id}  (admin only)  SSH key masked
 func GetWorker(w http.ResponseWriter, r *http.Request) {
 user, ok := GetUserFromContext(r.Context())
 if !ok || !HasRole(user.Role, "admin") {
@@ -136,10 +173,12 @@ id := mux.Vars(r)["id"]
 var wk CicdWorker
 var sshKey string
 err := database.DB.QueryRow(
-`SELECT id, name, host, ssh_port, ssh_user, ssh_private_key, agent_type, labels, description, workspace_id, status, created_at
+`SELECT id, name, host, ssh_port, ssh_user, ssh_private_key, agent_type, labels, description, workspace_id, status, created_at,
+ max_concurrent_jobs, host_key_fingerprint, last_heartbeat_at, last_error
  FROM cicd_workers WHERE id = ?`, id,
 ).Scan(&wk.ID, &wk.Name, &wk.Host, &wk.SSHPort, &wk.SSHUser, &sshKey,
-&wk.AgentType, &wk.Labels, &wk.Description, &wk.WorkspaceID, &wk.Status, &wk.CreatedAt)
+&wk.AgentType, &wk.Labels, &wk.Description, &wk.WorkspaceID, &wk.Status, &wk.CreatedAt,
+&wk.MaxConcurrentJobs, &wk.HostKeyFingerprint, &wk.LastHeartbeatAt, &wk.LastError)
 if err != nil {
 http.Error(w, "Not found", http.StatusNotFound)
 return
@@ -150,13 +189,18 @@ out := map[string]interface{}{
 "host":            wk.Host,
 "ssh_port":        wk.SSHPort,
 "ssh_user":        wk.SSHUser,
-"ssh_private_key": sshKey,
+"ssh_private_key": maskSecret(sshKey),
 "agent_type":      wk.AgentType,
 "labels":          wk.Labels,
 "description":     wk.Description,
 "workspace_id":    wk.WorkspaceID,
 "status":          wk.Status,
 "created_at":      wk.CreatedAt,
+"max_concurrent_jobs":  wk.MaxConcurrentJobs,
+"running_jobs":         runningJobs(wk.ID),
+"host_key_fingerprint": wk.HostKeyFingerprint,
+"last_heartbeat_at":    wk.LastHeartbeatAt,
+"last_error":           wk.LastError,
 }
 w.Header().Set("Content-Type", "application/json")
 json.NewEncoder(w).Encode(out)
@@ -178,38 +222,39 @@ w.Header().Set("Content-Type", "application/json")
 json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
 }
 
-// POST /api/cicd/workers/{id}/test  (admin only)  test SSH port of saved worker
+// POST /api/cicd/workers/{id}/test  (admin only)  SSH handshake with the stored key
 func TestWorkerSSH(w http.ResponseWriter, r *http.Request) {
 user, ok := GetUserFromContext(r.Context())
 if !ok || !HasRole(user.Role, "admin") {
 http.Error(w, "Forbidden", http.StatusForbidden)
 return
 }
-id := mux.Vars(r)["id"]
-
-var host string
-var port int
-err := database.DB.QueryRow(
-`SELECT host, ssh_port FROM cicd_workers WHERE id = ?`, id,
-).Scan(&host, &port)
+wk, err := loadPipelineWorker(mux.Vars(r)["id"])
 if err != nil {
 http.Error(w, "Worker not found", http.StatusNotFound)
 return
 }
 
-result := probeSSHPort(host, port)
-
-newStatus := "offline"
-if result["success"].(bool) {
-newStatus = "online"
+metrics, fingerprint, err := checkWorker(wk)
+result := map[string]interface{}{
+"success":              err == nil,
+"host_key_fingerprint": fingerprint,
+"host_key_pinned":      wk.HostKey != "" || (err == nil && fingerprint != ""),
+}
+if err != nil {
+result["message"] = err.Error()
+} else {
+result["message"] = fmt.Sprintf("Authenticated as %s on %s", wk.User, wk.Host)
+result["metrics"] = metrics
 }
-database.DB.Exec("UPDATE cicd_workers SET status = ? WHERE id = ?", newStatus, id) //nolint:errcheck
 
 w.Header().Set("Content-Type", "application/json")
 json.NewEncoder(w).Encode(result)
 }
 
 // POST /api/cicd/workers/test-ssh  (admin only)  test before saving
+// With ssh_private_key set this is a full handshake that reports the host
+// key fingerprint (nothing is pinned); otherwise only the port is probed.
 func TestWorkerSSHDirect(w http.ResponseWriter, r *http.Request) {
 user, ok := GetUserFromContext(r.Context())
 if !ok || !HasRole(user.Role, "admin") {
@@ -217,8 +262,10 @@ http.Error(w, "Forbidden", http.StatusForbidden)
 return
 }
 var req struct {
-Host    string `json:"host"`
-SSHPort int    `json:"ssh_port"`
+Host          string `json:"host"`
+SSHPort       int    `json:"ssh_port"`
+SSHUser       string `json:"ssh_user"`
+SSHPrivateKey string `json:"ssh_private_key"`
 }
 if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 http.Error(w, "Invalid request", http.StatusBadRequest)
@@ -227,8 +274,27 @@ return
 if req.SSHPort <= 0 {
 req.SSHPort = 22
 }
+if req.SSHUser == "" {
+req.SSHUser = "root"
+}
 w.Header().Set("Content-Type", "application/json")
+if req.SSHPrivateKey == "" || req.Host == "" {
 json.NewEncoder(w).Encode(probeSSHPort(req.Host, req.SSHPort))
+return
+}
+metrics, fingerprint, err := probeWorker(pipelineWorker{
+Name: req.Host, Host: req.Host, Port: req.SSHPort, User: req.SSHUser, Key: req.SSHPrivateKey,
+})
+if err != nil {
+json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": err.Error(), "host_key_fingerprint": fingerprint})
+return
+}
+json.NewEncoder(w).Encode(map[string]interface{}{
+"success":              true,
+"message":              fmt.Sprintf("Authenticated as %s on %s", req.SSHUser, req.Host),
+"host_key_fingerprint": fingerprint,
+"metrics":              metrics,
+})
 }
 
 // probeSSHPort does a TCP dial to check if the SSH port is reachable.
@@ -236,7 +302,7 @@ func probeSSHPort(host string, port int) map[string]interface{} {
 if host == "" {
 return map[string]interface{}{"success": false, "message": "Host is required"}
 }
-addr := fmt.Sprintf("%s:%d", host, port)
+addr := net.JoinHostPort(host, strconv.Itoa(port))
 conn, err := net.DialTimeout("tcp", addr, 8*time.Second)
 if err != nil {
 return map[string]interface{}{
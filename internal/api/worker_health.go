@@ -0,0 +1,294 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adisaputra10/docker-management/internal/database"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/ssh"
+)
+
+// Workers are checked with a real SSH handshake using their stored key.
+// The host key seen on the first successful connection is pinned (trust on
+// first use); later connections presenting a different key are refused
+// until an admin clears the pin. Each check also collects basic facts
+// about the machine, and a heartbeat repeats it for every worker so the
+// status the scheduler relies on stays current.
+
+const (
+	defaultHeartbeatInterval = 60 * time.Second
+	maxWorkerJobs            = 64
+)
+
+var errWorkersBusy = errors.New("all matching workers are at capacity")
+
+// WorkerMetrics are the facts collected from a worker on each check.
+type WorkerMetrics struct {
+	OS             string  `json:"os"`
+	CPUCores       int     `json:"cpu_cores"`
+	LoadAvg        float64 `json:"load_avg"`
+	MemTotalMB     int64   `json:"mem_total_mb"`
+	MemAvailableMB int64   `json:"mem_available_mb"`
+	DiskTotalMB    int64   `json:"disk_total_mb"` // filesystem holding /tmp, where jobs run
+	DiskFreeMB     int64   `json:"disk_free_mb"`
+	DockerVersion  string  `json:"docker_version"` // empty when Docker is not usable
+}
+
+// workerFactsScript prints key=value lines parsed by parseWorkerMetrics.
+const workerFactsScript = `echo "os=$( (. /etc/os-release 2>/dev/null && echo "$PRETTY_NAME") || uname -sr)"
+echo "cpus=$(nproc 2>/dev/null || getconf _NPROCESSORS_ONLN 2>/dev/null)"
+echo "load=$(cut -d' ' -f1 /proc/loadavg 2>/dev/null)"
+echo "mem=$(awk '/^MemTotal:/ {t=$2} /^MemAvailable:/ {a=$2} END {print t" "a}' /proc/meminfo 2>/dev/null)"
+echo "disk=$(df -Pk /tmp 2>/dev/null | awk 'NR==2 {print $2" "$4}')"
+echo "docker=$(docker version --format '{{.Server.Version}}' 2>/dev/null)"`
+
+func parseWorkerMetrics(out string) WorkerMetrics {
+	var m WorkerMetrics
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		kb := func(i int) int64 {
+			if i >= len(fields) {
+				return 0
+			}
+			n, _ := strconv.ParseInt(fields[i], 10, 64)
+			return n / 1024
+		}
+		switch key {
+		case "os":
+			m.OS = value
+		case "cpus":
+			m.CPUCores, _ = strconv.Atoi(value)
+		case "load":
+			m.LoadAvg, _ = strconv.ParseFloat(value, 64)
+		case "mem":
+			m.MemTotalMB, m.MemAvailableMB = kb(0), kb(1)
+		case "disk":
+			m.DiskTotalMB, m.DiskFreeMB = kb(0), kb(1)
+		case "docker":
+			m.DockerVersion = value
+		}
+	}
+	return m
+}
+
+// ── SSH ─────────────────────────────────────────────────────────────────────
+
+// dialWorker opens an SSH connection to wk with its stored key. Saved
+// workers (ID != 0) have their host key checked against the pinned one,
+// or pinned if none is stored yet.
+func dialWorker(wk pipelineWorker) (*ssh.Client, error) {
+	client, _, err := dialWorkerHostKey(wk)
+	return client, err
+}
+
+func dialWorkerHostKey(wk pipelineWorker) (client *ssh.Client, fingerprint string, err error) {
+	if wk.Key == "" {
+		return nil, "", fmt.Errorf("worker %s has no SSH private key", wk.Name)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(wk.Key))
+	if err != nil {
+		return nil, "", fmt.Errorf("worker %s: invalid SSH private key: %v", wk.Name, err)
+	}
+	config := &ssh.ClientConfig{
+		User: wk.User,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			fingerprint = ssh.FingerprintSHA256(key)
+			presented := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+			if wk.HostKey != "" {
+				if presented != wk.HostKey {
+					return fmt.Errorf("host key mismatch: pinned %s, worker presented %s", wk.HostKeyFingerprint, fingerprint)
+				}
+				return nil
+			}
+			if wk.ID == 0 {
+				return nil
+			}
+			// Only pin if nobody else has since: a concurrent dial may have
+			// pinned a different key, and that one wins.
+			res, err := database.DB.Exec(
+				`UPDATE cicd_workers SET host_key = ?, host_key_fingerprint = ?
+				 WHERE id = ? AND (host_key IS NULL OR host_key = '')`,
+				presented, fingerprint, wk.ID)
+			if err != nil {
+				return fmt.Errorf("pinning host key: %v", err)
+			}
+			if n, _ := res.RowsAffected(); n == 1 {
+				log.Printf("[Worker] %s: pinned host key %s", wk.Name, fingerprint)
+				return nil
+			}
+			var pinned, pinnedFP sql.NullString
+			if err := database.DB.QueryRow(`SELECT host_key, host_key_fingerprint FROM cicd_workers WHERE id = ?`, wk.ID).
+				Scan(&pinned, &pinnedFP); err != nil {
+				return fmt.Errorf("reading pinned host key: %v", err)
+			}
+			if pinned.String != presented {
+				return fmt.Errorf("host key mismatch: pinned %s, worker presented %s", pinnedFP.String, fingerprint)
+			}
+			return nil
+		},
+		Timeout: 20 * time.Second,
+	}
+	addr := net.JoinHostPort(wk.Host, strconv.Itoa(wk.Port))
+	client, err = ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, fingerprint, fmt.Errorf("connecting to worker %s (%s): %v", wk.Name, addr, err)
+	}
+	return client, fingerprint, nil
+}
+
+// probeWorker connects to wk and collects its metrics.
+func probeWorker(wk pipelineWorker) (WorkerMetrics, string, error) {
+	client, fingerprint, err := dialWorkerHostKey(wk)
+	if err != nil {
+		return WorkerMetrics{}, fingerprint, err
+	}
+	defer client.Close()
+	var out strings.Builder
+	if err := runRemote(client, workerFactsScript, nil, &out); err != nil {
+		return WorkerMetrics{}, fingerprint, fmt.Errorf("collecting facts: %v", err)
+	}
+	return parseWorkerMetrics(out.String()), fingerprint, nil
+}
+
+// recordWorkerHealth stores the outcome of a probe.
+func recordWorkerHealth(id int, m WorkerMetrics, probeErr error) {
+	now := time.Now().Format(time.RFC3339)
+	if probeErr != nil {
+		database.DB.Exec(`UPDATE cicd_workers SET status = 'offline', last_heartbeat_at = ?, last_error = ? WHERE id = ?`,
+			now, probeErr.Error(), id)
+		return
+	}
+	database.DB.Exec(
+		`UPDATE cicd_workers SET status = 'online', last_heartbeat_at = ?, last_error = NULL, os = ?, cpu_cores = ?,
+		        load_avg = ?, mem_total_mb = ?, mem_available_mb = ?, disk_total_mb = ?, disk_free_mb = ?,
+		        docker_version = ? WHERE id = ?`,
+		now, m.OS, m.CPUCores, m.LoadAvg, m.MemTotalMB, m.MemAvailableMB, m.DiskTotalMB, m.DiskFreeMB,
+		m.DockerVersion, id)
+}
+
+func checkWorker(wk pipelineWorker) (WorkerMetrics, string, error) {
+	m, fingerprint, err := probeWorker(wk)
+	recordWorkerHealth(wk.ID, m, err)
+	return m, fingerprint, err
+}
+
+// ── Heartbeats ──────────────────────────────────────────────────────────────
+
+func heartbeatInterval() time.Duration {
+	v, _ := database.GetSetting("worker_heartbeat_interval_seconds")
+	if n, err := strconv.Atoi(v); err == nil && n >= 10 {
+		return time.Duration(n) * time.Second
+	}
+	return defaultHeartbeatInterval
+}
+
+// StartWorkerHeartbeats checks every worker now and then periodically
+// (setting worker_heartbeat_interval_seconds, default 60).
+func StartWorkerHeartbeats() {
+	go func() {
+		for {
+			heartbeatWorkers()
+			time.Sleep(heartbeatInterval())
+		}
+	}()
+}
+
+func heartbeatWorkers() {
+	workers, err := loadPipelineWorkers()
+	if err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for _, wk := range workers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(wk pipelineWorker) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, _, err := checkWorker(wk); err != nil && wk.Status == "online" {
+				log.Printf("[Worker] %s went offline: %v", wk.Name, err)
+			}
+		}(wk)
+	}
+	wg.Wait()
+}
+
+func runningJobs(workerID int) int {
+	workerLoadMu.Lock()
+	defer workerLoadMu.Unlock()
+	return workerLoad[workerID]
+}
+
+// ── Handlers ────────────────────────────────────────────────────────────────
+
+// DELETE /api/cicd/workers/{id}/host-key  (admin only)
+// Forgets the pinned host key; the next connection pins the new one.
+func ResetWorkerHostKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	res, err := database.DB.Exec(`UPDATE cicd_workers SET host_key = NULL, host_key_fingerprint = NULL WHERE id = ?`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	recordActivityLog("worker_host_key_reset", id, "pinned host key cleared by "+user.Username, "success")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// PUT /api/cicd/workers/{id}/capacity  (admin only)
+// Body: {"max_concurrent_jobs": 4}
+func UpdateWorkerCapacity(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok || !HasRole(user.Role, "admin") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		MaxConcurrentJobs int `json:"max_concurrent_jobs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.MaxConcurrentJobs < 1 || req.MaxConcurrentJobs > maxWorkerJobs {
+		http.Error(w, fmt.Sprintf("max_concurrent_jobs must be between 1 and %d", maxWorkerJobs), http.StatusBadRequest)
+		return
+	}
+	res, err := database.DB.Exec(`UPDATE cicd_workers SET max_concurrent_jobs = ? WHERE id = ?`,
+		req.MaxConcurrentJobs, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "max_concurrent_jobs": req.MaxConcurrentJobs})
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/adisaputra10/docker-management/internal/models"
+	"github.com/adisaputra10/docker-management/internal/vault"
 	_ "modernc.org/sqlite"
 )
 
@@ -232,6 +233,42 @@ func InitDB() error {
 	if _, err = DB.Exec(queryK0sNodes); err != nil {
 		return err
 	}
+	// Migrate: per-node SSH access, k0s version and lifecycle progress
+	for _, col := range []string{
+		"ALTER TABLE k0s_nodes ADD COLUMN username TEXT",
+		"ALTER TABLE k0s_nodes ADD COLUMN password TEXT",
+		"ALTER TABLE k0s_nodes ADD COLUMN auth_method TEXT",
+		"ALTER TABLE k0s_nodes ADD COLUMN ssh_key TEXT",
+		"ALTER TABLE k0s_nodes ADD COLUMN version TEXT",
+		"ALTER TABLE k0s_nodes ADD COLUMN operation_id INTEGER",
+		"ALTER TABLE k0s_nodes ADD COLUMN progress TEXT",
+		"ALTER TABLE k0s_nodes ADD COLUMN progress_message TEXT",
+		"ALTER TABLE k0s_nodes ADD COLUMN progress_at DATETIME",
+		"ALTER TABLE k0s_nodes ADD COLUMN cordoned INTEGER NOT NULL DEFAULT 0",
+	} {
+		DB.Exec(col) // ignore error if column already exists
+	}
+
+	// Create k0s_operations table (upgrades, controller joins, node replacements)
+	queryK0sOperations := `
+	CREATE TABLE IF NOT EXISTS k0s_operations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cluster_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		target_version TEXT,
+		plan TEXT,
+		username TEXT,
+		status TEXT NOT NULL DEFAULT 'running',
+		error TEXT,
+		log TEXT,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME,
+		FOREIGN KEY(cluster_id) REFERENCES k0s_clusters(id) ON DELETE CASCADE
+	);
+	`
+	if _, err = DB.Exec(queryK0sOperations); err != nil {
+		return err
+	}
 
 	// Create user_namespaces table (map users to k8s namespaces per cluster)
 	queryUserNamespaces := `
@@ -292,6 +329,90 @@ func InitDB() error {
 		return err
 	}
 
+	workerCols := []string{
+		"ALTER TABLE cicd_workers ADD COLUMN max_concurrent_jobs INTEGER NOT NULL DEFAULT 2",
+		"ALTER TABLE cicd_workers ADD COLUMN host_key TEXT",
+		"ALTER TABLE cicd_workers ADD COLUMN host_key_fingerprint TEXT",
+		"ALTER TABLE cicd_workers ADD COLUMN last_heartbeat_at DATETIME",
+		"ALTER TABLE cicd_workers ADD COLUMN last_error TEXT",
+		"ALTER TABLE cicd_workers ADD COLUMN os TEXT",
+		"ALTER TABLE cicd_workers ADD COLUMN cpu_cores INTEGER",
+		"ALTER TABLE cicd_workers ADD COLUMN load_avg REAL",
+		"ALTER TABLE cicd_workers ADD COLUMN mem_total_mb INTEGER",
+		"ALTER TABLE cicd_workers ADD COLUMN mem_available_mb INTEGER",
+		"ALTER TABLE cicd_workers ADD COLUMN disk_total_mb INTEGER",
+		"ALTER TABLE cicd_workers ADD COLUMN disk_free_mb INTEGER",
+		"ALTER TABLE cicd_workers ADD COLUMN docker_version TEXT",
+	}
+	for _, col := range workerCols {
+		DB.Exec(col) // ignore error if column already exists
+	}
+
+	// Create cicd_secrets table (values exposed to pipeline jobs as env)
+	queryCicdSecrets := `
+	CREATE TABLE IF NOT EXISTS cicd_secrets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		value TEXT NOT NULL DEFAULT '',
+		description TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err = DB.Exec(queryCicdSecrets); err != nil {
+		return err
+	}
+
+	// Create pipelines, pipeline_runs and pipeline_jobs tables
+	queryPipelines := `
+	CREATE TABLE IF NOT EXISTS pipelines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		repo_id INTEGER,
+		definition TEXT,
+		definition_path TEXT,
+		workspace_id TEXT,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS pipeline_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		pipeline_id INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'queued',
+		commit_sha TEXT NOT NULL DEFAULT '',
+		trigger TEXT NOT NULL DEFAULT 'manual',
+		actor TEXT NOT NULL DEFAULT '',
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		started_at DATETIME,
+		finished_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_pipeline_runs_pipeline ON pipeline_runs(pipeline_id);
+	CREATE TABLE IF NOT EXISTS pipeline_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		stage TEXT NOT NULL DEFAULT '',
+		stage_index INTEGER NOT NULL DEFAULT 0,
+		worker_id INTEGER,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempt INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL DEFAULT 1,
+		exit_code INTEGER,
+		error TEXT,
+		log TEXT,
+		artifact_path TEXT,
+		scan_report_id INTEGER,
+		started_at DATETIME,
+		finished_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_pipeline_jobs_run ON pipeline_jobs(run_id);
+	`
+	if _, err = DB.Exec(queryPipelines); err != nil {
+		return err
+	}
+
 	// Create cicd_scan_reports table
 	queryCicdScans := `
 	CREATE TABLE IF NOT EXISTS cicd_scan_reports (
@@ -315,6 +436,14 @@ func InitDB() error {
 	if _, err = DB.Exec(queryCicdScans); err != nil {
 		return err
 	}
+	// Migrate: who produced a report. Only the built-in scanner and
+	// pipeline scan steps count towards admission.
+	for _, col := range []string{
+		"ALTER TABLE cicd_scan_reports ADD COLUMN source TEXT NOT NULL DEFAULT 'api'",
+		"ALTER TABLE cicd_scan_reports ADD COLUMN submitted_by TEXT",
+	} {
+		DB.Exec(col) // ignore error if column already exists
+	}
 
 	// Seed dummy scan reports if table is empty
 	if err := seedScanReports(); err != nil {
@@ -363,6 +492,418 @@ func InitDB() error {
 		return err
 	}
 
+	// Migrate: SSH deploy keys, continuous sync, cluster targets and drift for GitOps
+	gitopsCols := []string{
+		"ALTER TABLE gitops_repos ADD COLUMN ssh_key TEXT",
+		"ALTER TABLE gitops_deployments ADD COLUMN deployed_sha TEXT",
+		"ALTER TABLE gitops_deployments ADD COLUMN sync_interval INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE gitops_deployments ADD COLUMN paused INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE gitops_deployments ADD COLUMN last_sync_at DATETIME",
+		"ALTER TABLE gitops_deployments ADD COLUMN last_sync_error TEXT",
+		"ALTER TABLE gitops_deployments ADD COLUMN cluster_id INTEGER",
+		"ALTER TABLE gitops_deployments ADD COLUMN created_by INTEGER",
+		"ALTER TABLE gitops_deployments ADD COLUMN sync_status TEXT NOT NULL DEFAULT 'Unknown'",
+		"ALTER TABLE gitops_deployments ADD COLUMN drift_checked_at DATETIME",
+		"ALTER TABLE gitops_deployments ADD COLUMN drift_diff TEXT",
+		"ALTER TABLE gitops_repos ADD COLUMN webhook_secret TEXT",
+		"ALTER TABLE gitops_repos ADD COLUMN build_on_push INTEGER NOT NULL DEFAULT 0",
+	}
+	for _, col := range gitopsCols {
+		DB.Exec(col) // ignore error if column already exists
+	}
+
+	// Create deployment_runs table (history of GitOps deploys)
+	queryDeploymentRuns := `
+	CREATE TABLE IF NOT EXISTS deployment_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		deployment_id INTEGER NOT NULL,
+		commit_sha TEXT,
+		manifest_hash TEXT,
+		trigger TEXT NOT NULL DEFAULT 'manual',
+		actor TEXT NOT NULL DEFAULT '',
+		values_override TEXT,
+		status TEXT NOT NULL DEFAULT 'running',
+		log TEXT,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_deployment_runs_deployment ON deployment_runs(deployment_id);
+	`
+	if _, err = DB.Exec(queryDeploymentRuns); err != nil {
+		return err
+	}
+
+	// Create webhook_deliveries table (raw git push webhooks, kept for replay)
+	queryWebhookDeliveries := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		repo_id INTEGER NOT NULL,
+		provider TEXT NOT NULL DEFAULT '',
+		event TEXT NOT NULL DEFAULT '',
+		delivery_id TEXT NOT NULL DEFAULT '',
+		ref TEXT NOT NULL DEFAULT '',
+		commit_sha TEXT NOT NULL DEFAULT '',
+		signature_valid INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'received',
+		result TEXT NOT NULL DEFAULT '',
+		headers TEXT NOT NULL DEFAULT '{}',
+		payload TEXT NOT NULL DEFAULT '',
+		replay_of INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_repo ON webhook_deliveries(repo_id);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_delivery ON webhook_deliveries(repo_id, delivery_id);
+	`
+	if _, err = DB.Exec(queryWebhookDeliveries); err != nil {
+		return err
+	}
+
+	// Create volume_backups table (backup catalog)
+	queryVolumeBackups := `
+	CREATE TABLE IF NOT EXISTS volume_backups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		host_id INTEGER NOT NULL,
+		volume_name TEXT NOT NULL,
+		storage TEXT NOT NULL DEFAULT 'local',
+		location TEXT NOT NULL DEFAULT '',
+		size_bytes INTEGER NOT NULL DEFAULT 0,
+		checksum TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'running',
+		error TEXT,
+		trigger TEXT NOT NULL DEFAULT 'manual',
+		schedule_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);
+	`
+	if _, err = DB.Exec(queryVolumeBackups); err != nil {
+		return err
+	}
+
+	// Create volume_backup_schedules table (one schedule per host/volume)
+	queryVolumeBackupSchedules := `
+	CREATE TABLE IF NOT EXISTS volume_backup_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		host_id INTEGER NOT NULL,
+		volume_name TEXT NOT NULL,
+		interval_minutes INTEGER NOT NULL DEFAULT 1440,
+		retention INTEGER NOT NULL DEFAULT 7,
+		storage TEXT NOT NULL DEFAULT 'local',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		last_run_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(host_id, volume_name)
+	);
+	`
+	if _, err = DB.Exec(queryVolumeBackupSchedules); err != nil {
+		return err
+	}
+
+	// Create image_builds table (build history)
+	queryImageBuilds := `
+	CREATE TABLE IF NOT EXISTS image_builds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		host_id INTEGER NOT NULL,
+		source_type TEXT NOT NULL DEFAULT 'upload',
+		repo_id INTEGER,
+		context_path TEXT NOT NULL DEFAULT '',
+		commit_sha TEXT NOT NULL DEFAULT '',
+		dockerfile TEXT NOT NULL DEFAULT 'Dockerfile',
+		tags TEXT NOT NULL DEFAULT '[]',
+		build_args TEXT NOT NULL DEFAULT '{}',
+		target TEXT NOT NULL DEFAULT '',
+		labels TEXT NOT NULL DEFAULT '{}',
+		no_cache INTEGER NOT NULL DEFAULT 0,
+		registry_id INTEGER,
+		push_ref TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'queued',
+		image_id TEXT NOT NULL DEFAULT '',
+		digest TEXT NOT NULL DEFAULT '',
+		error TEXT,
+		log TEXT,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		started_at DATETIME,
+		finished_at DATETIME
+	);
+	`
+	if _, err = DB.Exec(queryImageBuilds); err != nil {
+		return err
+	}
+
+	// Create image_pushes table (push history)
+	queryImagePushes := `
+	CREATE TABLE IF NOT EXISTS image_pushes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		host_id INTEGER NOT NULL,
+		image TEXT NOT NULL,
+		registry_id INTEGER NOT NULL,
+		target_ref TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'running',
+		digest TEXT NOT NULL DEFAULT '',
+		size_bytes INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		log TEXT,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);
+	`
+	if _, err = DB.Exec(queryImagePushes); err != nil {
+		return err
+	}
+
+	// Create vulnerability database tables (offline OSV / NVD snapshots)
+	queryVulnAdvisories := `
+	CREATE TABLE IF NOT EXISTS vuln_advisories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		vuln_id TEXT NOT NULL,
+		aliases TEXT NOT NULL DEFAULT '[]',
+		ecosystem TEXT NOT NULL,
+		package TEXT NOT NULL,
+		ranges TEXT NOT NULL DEFAULT '[]',
+		versions TEXT NOT NULL DEFAULT '[]',
+		severity TEXT NOT NULL DEFAULT '',
+		cvss_score REAL NOT NULL DEFAULT 0,
+		summary TEXT NOT NULL DEFAULT '',
+		modified TEXT NOT NULL DEFAULT '',
+		UNIQUE(vuln_id, ecosystem, package)
+	);
+	CREATE INDEX IF NOT EXISTS idx_vuln_advisories_package ON vuln_advisories(package);
+	CREATE TABLE IF NOT EXISTS vuln_cve_scores (
+		cve_id TEXT PRIMARY KEY,
+		severity TEXT NOT NULL,
+		cvss_score REAL NOT NULL DEFAULT 0,
+		summary TEXT NOT NULL DEFAULT '',
+		modified TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE IF NOT EXISTS vuln_db_imports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		source TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		records INTEGER NOT NULL DEFAULT 0,
+		imported_by TEXT NOT NULL DEFAULT '',
+		imported_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err = DB.Exec(queryVulnAdvisories); err != nil {
+		return err
+	}
+
+	// Create scan_findings table (normalized findings per scan report)
+	queryScanFindings := `
+	CREATE TABLE IF NOT EXISTS scan_findings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		report_id INTEGER NOT NULL,
+		fingerprint TEXT NOT NULL,
+		tool TEXT NOT NULL DEFAULT '',
+		rule_id TEXT NOT NULL DEFAULT '',
+		title TEXT NOT NULL DEFAULT '',
+		severity TEXT NOT NULL DEFAULT 'info',
+		package TEXT NOT NULL DEFAULT '',
+		installed_version TEXT NOT NULL DEFAULT '',
+		fixed_version TEXT NOT NULL DEFAULT '',
+		location TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_scan_findings_report ON scan_findings(report_id);
+	CREATE INDEX IF NOT EXISTS idx_scan_findings_fingerprint ON scan_findings(fingerprint);
+	`
+	if _, err = DB.Exec(queryScanFindings); err != nil {
+		return err
+	}
+
+	// Migrate: finding lifecycle columns
+	scanFindingCols := []string{
+		"ALTER TABLE scan_findings ADD COLUMN lifecycle TEXT NOT NULL DEFAULT 'new'",
+		"ALTER TABLE scan_findings ADD COLUMN first_seen_at DATETIME",
+	}
+	for _, col := range scanFindingCols {
+		DB.Exec(col) // ignore error if column already exists
+	}
+
+	// Create finding_triage table (accepted risk / false positive decisions per target)
+	queryFindingTriage := `
+	CREATE TABLE IF NOT EXISTS finding_triage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status TEXT NOT NULL CHECK(status IN ('accepted_risk', 'false_positive')),
+		reason TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(target, fingerprint)
+	);`
+	if _, err = DB.Exec(queryFindingTriage); err != nil {
+		return err
+	}
+
+	// Create admission_policies table (image scan gate per project / namespace)
+	queryAdmissionPolicies := `
+	CREATE TABLE IF NOT EXISTS admission_policies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		scope_type TEXT NOT NULL CHECK(scope_type IN ('global', 'project', 'namespace')),
+		project_id INTEGER,
+		cluster_id INTEGER,
+		namespace TEXT,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		max_critical INTEGER NOT NULL DEFAULT 0,
+		max_scan_age_days INTEGER NOT NULL DEFAULT 0,
+		require_scan INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err = DB.Exec(queryAdmissionPolicies); err != nil {
+		return err
+	}
+
+	// Create admission_events table (gate decisions and break-glass overrides)
+	queryAdmissionEvents := `
+	CREATE TABLE IF NOT EXISTS admission_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		policy_id INTEGER,
+		kind TEXT NOT NULL,
+		scope TEXT NOT NULL DEFAULT '',
+		images TEXT NOT NULL DEFAULT '',
+		decision TEXT NOT NULL,
+		reasons TEXT NOT NULL DEFAULT '',
+		username TEXT NOT NULL DEFAULT '',
+		override_reason TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err = DB.Exec(queryAdmissionEvents); err != nil {
+		return err
+	}
+
+	// Create k8s_apply_history table (manifests applied from the cluster admin, versioned per cluster)
+	queryApplyHistory := `
+	CREATE TABLE IF NOT EXISTS k8s_apply_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cluster_id INTEGER NOT NULL,
+		version INTEGER NOT NULL,
+		username TEXT NOT NULL DEFAULT '',
+		default_namespace TEXT NOT NULL DEFAULT 'default',
+		manifest TEXT NOT NULL,
+		manifest_hash TEXT NOT NULL DEFAULT '',
+		objects TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'success',
+		output TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(cluster_id, version)
+	);`
+	if _, err = DB.Exec(queryApplyHistory); err != nil {
+		return err
+	}
+
+	// Create node_drains table (node drains started from the cluster admin, with their logs)
+	queryNodeDrains := `
+	CREATE TABLE IF NOT EXISTS node_drains (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cluster_id INTEGER NOT NULL,
+		node TEXT NOT NULL,
+		username TEXT NOT NULL DEFAULT '',
+		options TEXT NOT NULL DEFAULT '{}',
+		status TEXT NOT NULL DEFAULT 'running',
+		error TEXT,
+		log TEXT,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);`
+	if _, err = DB.Exec(queryNodeDrains); err != nil {
+		return err
+	}
+
+	// Create helm_repositories table (chart repositories serving an index.yaml)
+	queryHelmRepositories := `
+	CREATE TABLE IF NOT EXISTS helm_repositories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		url TEXT NOT NULL,
+		username TEXT NOT NULL DEFAULT '',
+		password TEXT,
+		insecure_skip_verify INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err = DB.Exec(queryHelmRepositories); err != nil {
+		return err
+	}
+
+	// Create helm_operations table (helm install/upgrade/rollback/uninstall runs, with their logs)
+	queryHelmOperations := `
+	CREATE TABLE IF NOT EXISTS helm_operations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cluster_id INTEGER NOT NULL,
+		namespace TEXT NOT NULL,
+		release TEXT NOT NULL,
+		action TEXT NOT NULL,
+		chart TEXT NOT NULL DEFAULT '',
+		version TEXT NOT NULL DEFAULT '',
+		username TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'running',
+		error TEXT,
+		log TEXT,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);`
+	if _, err = DB.Exec(queryHelmOperations); err != nil {
+		return err
+	}
+
+	// Create cluster_backups table (backup catalog of k0s clusters: k0s backups and namespace exports)
+	queryClusterBackups := `
+	CREATE TABLE IF NOT EXISTS cluster_backups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cluster_id INTEGER NOT NULL,
+		cluster_name TEXT NOT NULL DEFAULT '',
+		kind TEXT NOT NULL CHECK(kind IN ('k0s', 'namespaces')),
+		namespaces TEXT NOT NULL DEFAULT '',
+		storage TEXT NOT NULL DEFAULT 'local',
+		location TEXT NOT NULL DEFAULT '',
+		size_bytes INTEGER NOT NULL DEFAULT 0,
+		checksum TEXT NOT NULL DEFAULT '',
+		object_count INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'running',
+		error TEXT,
+		trigger TEXT NOT NULL DEFAULT 'manual',
+		schedule_id INTEGER,
+		include_secrets INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);`
+	if _, err = DB.Exec(queryClusterBackups); err != nil {
+		return err
+	}
+
+	// Create cluster_backup_schedules table (recurring cluster backups with their retention)
+	queryClusterBackupSchedules := `
+	CREATE TABLE IF NOT EXISTS cluster_backup_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cluster_id INTEGER NOT NULL,
+		kind TEXT NOT NULL CHECK(kind IN ('k0s', 'namespaces')),
+		namespaces TEXT NOT NULL DEFAULT '',
+		interval_minutes INTEGER NOT NULL DEFAULT 1440,
+		retention INTEGER NOT NULL DEFAULT 7,
+		max_age_days INTEGER NOT NULL DEFAULT 0,
+		storage TEXT NOT NULL DEFAULT 'local',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		include_secrets INTEGER NOT NULL DEFAULT 0,
+		last_run_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err = DB.Exec(queryClusterBackupSchedules); err != nil {
+		return err
+	}
+	// Migrate: Secrets are only exported on request
+	for _, col := range []string{
+		"ALTER TABLE cluster_backups ADD COLUMN include_secrets INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE cluster_backup_schedules ADD COLUMN include_secrets INTEGER NOT NULL DEFAULT 0",
+	} {
+		DB.Exec(col) // ignore error if column already exists
+	}
+
 	// Migrate: add 'view' role to users table CHECK constraint
 	// SQLite doesn't support modifying CHECK constraints, so we recreate the table
 	err = migrateUsersRoleConstraint()
@@ -371,6 +912,12 @@ func InitDB() error {
 		// Continue anyway - table might already be migrated
 	}
 
+	// Encrypt stored credentials (plaintext from before the vault, or
+	// sealed under a master key that has since been replaced)
+	if err := initVault(); err != nil {
+		return fmt.Errorf("failed to initialize vault: %v", err)
+	}
+
 	// Insert default Local host if not exists
 	var count int
 	if err := DB.QueryRow("SELECT COUNT(*) FROM docker_hosts").Scan(&count); err == nil && count == 0 {
@@ -437,10 +984,20 @@ func GetSetting(key string) (string, error) {
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
+	if err == nil && sensitiveSettings[key] {
+		return vault.Open(value)
+	}
 	return value, err
 }
 
 func SetSetting(key, value string) error {
+	if sensitiveSettings[key] {
+		sealed, err := vault.Seal(value)
+		if err != nil {
+			return err
+		}
+		value = sealed
+	}
 	_, err := DB.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
 	return err
 }
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/adisaputra10/docker-management/internal/vault"
+)
+
+// SealedColumn is a table column whose values are stored sealed by the
+// vault.
+type SealedColumn struct {
+	Table  string
+	Column string
+	// Fields, when set, means the column holds a JSON object and only
+	// these of its fields are sealed.
+	Fields []string
+}
+
+// SealedColumns lists every column holding credentials.
+var SealedColumns = []SealedColumn{
+	{Table: "cicd_registries", Column: "password"},
+	{Table: "cicd_registries", Column: "extra_config", Fields: RegistryExtraSecretFields},
+	{Table: "cicd_workers", Column: "ssh_private_key"},
+	{Table: "gitops_repos", Column: "auth_token"},
+	{Table: "gitops_repos", Column: "ssh_key"},
+	{Table: "gitops_repos", Column: "webhook_secret"},
+	{Table: "k0s_clusters", Column: "password"},
+	{Table: "k0s_clusters", Column: "ssh_key"},
+	{Table: "k0s_clusters", Column: "kubeconfig"},
+	{Table: "k0s_clusters", Column: "sa_token"},
+	{Table: "k0s_nodes", Column: "password"},
+	{Table: "k0s_nodes", Column: "ssh_key"},
+	{Table: "cicd_secrets", Column: "value"},
+	{Table: "k8s_apply_history", Column: "manifest"},
+	{Table: "helm_repositories", Column: "password"},
+}
+
+// RegistryExtraSecretFields are the secret fields of a registry's
+// extra_config.
+var RegistryExtraSecretFields = []string{"aws_secret_access_key", "aws_session_token"}
+
+// sensitiveSettings are settings sealed by SetSetting and opened by
+// GetSetting.
+var sensitiveSettings = map[string]bool{
+	"openai_api_key":           true,
+	"sso_gitlab_client_secret": true,
+	"sso_entra_client_secret":  true,
+	"sso_oidc_client_secret":   true,
+}
+
+// IsSensitiveSetting reports whether the setting key holds a secret.
+func IsSensitiveSetting(key string) bool { return sensitiveSettings[key] }
+
+// VaultMigration counts the values touched by SealStoredSecrets.
+type VaultMigration struct {
+	Sealed    int `json:"sealed"`    // plaintext values that were encrypted
+	Rewrapped int `json:"rewrapped"` // values moved to the current master key
+	Failed    int `json:"failed"`    // values that could not be opened
+}
+
+// initVault loads the master key and seals whatever is still stored in
+// plaintext or under an old master key.
+func initVault() error {
+	if err := vault.Init(); err != nil {
+		return err
+	}
+	m, err := SealStoredSecrets(false)
+	if err != nil {
+		return err
+	}
+	if m.Sealed > 0 || m.Rewrapped > 0 {
+		log.Printf("Vault: sealed %d plaintext secrets, re-wrapped %d", m.Sealed, m.Rewrapped)
+	}
+	if m.Failed > 0 {
+		log.Printf("WARNING: vault could not open %d stored secrets; is a previous master key missing?", m.Failed)
+	}
+	return nil
+}
+
+// SealStoredSecrets seals plaintext credentials and re-wraps sealed ones
+// under the current master key. With reencrypt every value also gets a
+// new data key.
+func SealStoredSecrets(reencrypt bool) (VaultMigration, error) {
+	var m VaultMigration
+	for _, c := range SealedColumns {
+		if err := sealColumn(c, reencrypt, &m); err != nil {
+			return m, fmt.Errorf("sealing %s.%s: %v", c.Table, c.Column, err)
+		}
+	}
+
+	type setting struct{ key, value string }
+	rows, err := DB.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return m, err
+	}
+	var settings []setting
+	for rows.Next() {
+		var s setting
+		if rows.Scan(&s.key, &s.value) == nil && sensitiveSettings[s.key] {
+			settings = append(settings, s)
+		}
+	}
+	rows.Close()
+	for _, s := range settings {
+		out, changed, err := rewrapValue(s.value, nil, reencrypt, &m)
+		if err != nil {
+			log.Printf("Vault: setting %s: %v", s.key, err)
+			continue
+		}
+		if changed {
+			if _, err := DB.Exec("UPDATE settings SET value = ? WHERE key = ?", out, s.key); err != nil {
+				return m, err
+			}
+		}
+	}
+	return m, nil
+}
+
+func sealColumn(c SealedColumn, reencrypt bool, m *VaultMigration) error {
+	type row struct {
+		id    int64
+		value string
+	}
+	rows, err := DB.Query(fmt.Sprintf("SELECT id, %s FROM %s WHERE %s IS NOT NULL AND %s != ''",
+		c.Column, c.Table, c.Column, c.Column))
+	if err != nil {
+		return err
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if rows.Scan(&r.id, &r.value) == nil {
+			pending = append(pending, r)
+		}
+	}
+	rows.Close()
+
+	for _, r := range pending {
+		out, changed, err := rewrapValue(r.value, c.Fields, reencrypt, m)
+		if err != nil {
+			log.Printf("Vault: %s.%s id=%d: %v", c.Table, c.Column, r.id, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if _, err := DB.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", c.Table, c.Column), out, r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrapValue brings one stored value under the current master key.
+func rewrapValue(v string, fields []string, reencrypt bool, m *VaultMigration) (string, bool, error) {
+	var out string
+	var err error
+	if fields != nil {
+		out, err = vault.RewrapFields(v, reencrypt, fields...)
+	} else {
+		out, err = vault.Rewrap(v, reencrypt)
+	}
+	if err != nil {
+		m.Failed++
+		return "", false, err
+	}
+	if out == v {
+		return v, false, nil
+	}
+	if fields == nil && !vault.IsSealed(v) {
+		m.Sealed++
+	} else {
+		m.Rewrapped++
+	}
+	return out, true, nil
+}
+
+// OpenSecret opens a stored credential. Failures are logged and yield ""
+// so callers behave as if the credential were missing.
+func OpenSecret(v string) string {
+	out, err := vault.Open(v)
+	if err != nil {
+		log.Printf("Vault: %v", err)
+		return ""
+	}
+	return out
+}
+
+// OpenNullSecret is OpenSecret for nullable columns.
+func OpenNullSecret(v sql.NullString) string {
+	if !v.Valid {
+		return ""
+	}
+	return OpenSecret(v.String)
+}
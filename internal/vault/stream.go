@@ -0,0 +1,205 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Streams seal data too large to hold in memory, such as backup archives.
+// Like a sealed value, a stream is encrypted under its own data key that
+// is wrapped with the master key in a header line:
+//
+//	vault:stream:v1:<key id>:<wrapped data key>\n
+//
+// The data follows in chunks, each a 4-byte big-endian length and the
+// AES-GCM ciphertext of up to streamChunkSize bytes. A chunk's nonce is its
+// sequence number with a final flag in the last byte, so chunks can't be
+// reordered, dropped or cut off at the end without OpenStream noticing.
+// Streams are decrypted with the master key that sealed them, so a retired
+// key stays in VAULT_PREVIOUS_MASTER_KEYS while streams sealed under it
+// are kept.
+
+const (
+	streamPrefix    = "vault:stream:v1:"
+	streamChunkSize = 64 * 1024
+)
+
+// SealStream returns a writer that seals what is written to it onto w.
+// Close writes the final chunk; it does not close w.
+func SealStream(w io.Writer) (io.WriteCloser, error) {
+	mu.RLock()
+	kek := current
+	mu.RUnlock()
+	if kek == nil {
+		return nil, ErrNotInitialized
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	wrapped, err := encrypt(kek.key, dek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	header := streamPrefix + kek.id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + "\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return nil, err
+	}
+	return &streamWriter{w: w, gcm: gcm, buf: make([]byte, 0, streamChunkSize)}, nil
+}
+
+// OpenStream returns a reader of the plaintext of a stream sealed by
+// SealStream. Data that isn't a sealed stream (written before streams were
+// sealed) is returned as it is.
+func OpenStream(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(len(streamPrefix)); string(head) != streamPrefix {
+		return br, nil
+	}
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	kid, encoded, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(line, streamPrefix), "\n"), ":")
+	if !ok {
+		return nil, ErrCorrupt
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	dek, err := unwrap(kid, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{r: br, gcm: gcm}, nil
+}
+
+// streamNonce is the nonce of chunk seq: the sequence number, then a byte
+// that is 1 on the final chunk.
+func streamNonce(gcm cipher.AEAD, seq uint64, final bool) []byte {
+	nonce := make([]byte, gcm.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], seq)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type streamWriter struct {
+	w   io.Writer
+	gcm cipher.AEAD
+	buf []byte
+	seq uint64
+	err error
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, so the
+		// last chunk is always the one Close seals as final.
+		if len(s.buf) == streamChunkSize {
+			if s.err = s.flush(false); s.err != nil {
+				return n, s.err
+			}
+		}
+		c := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (s *streamWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.err = s.flush(true)
+	if s.err == nil {
+		s.err = io.ErrClosedPipe
+		return nil
+	}
+	return s.err
+}
+
+func (s *streamWriter) flush(final bool) error {
+	ct := s.gcm.Seal(nil, streamNonce(s.gcm, s.seq, final), s.buf, nil)
+	s.seq++
+	s.buf = s.buf[:0]
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(ct)))
+	if _, err := s.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := s.w.Write(ct)
+	return err
+}
+
+type streamReader struct {
+	r    *bufio.Reader
+	gcm  cipher.AEAD
+	buf  bytes.Reader
+	seq  uint64
+	done bool
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for s.buf.Len() == 0 {
+		if s.done {
+			if _, err := s.r.ReadByte(); err != io.EOF {
+				return 0, ErrCorrupt
+			}
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	return s.buf.Read(p)
+}
+
+// next reads and opens the following chunk.
+func (s *streamReader) next() error {
+	var length [4]byte
+	if _, err := io.ReadFull(s.r, length[:]); err != nil {
+		// The stream ended before its final chunk.
+		return ErrCorrupt
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > streamChunkSize+uint32(s.gcm.Overhead()) {
+		return ErrCorrupt
+	}
+	ct := make([]byte, n)
+	if _, err := io.ReadFull(s.r, ct); err != nil {
+		return ErrCorrupt
+	}
+	pt, err := s.gcm.Open(nil, streamNonce(s.gcm, s.seq, false), ct, nil)
+	if err != nil {
+		if pt, err = s.gcm.Open(nil, streamNonce(s.gcm, s.seq, true), ct, nil); err != nil {
+			return ErrCorrupt
+		}
+		s.done = true
+	}
+	s.seq++
+	s.buf.Reset(pt)
+	return nil
+}
@@ -0,0 +1,100 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func sealStream(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := SealStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Odd-sized writes so chunks don't line up with them.
+	for len(data) > 0 {
+		n := min(len(data), 10007)
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openStream(sealed []byte) ([]byte, error) {
+	r, err := OpenStream(bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestSealStream(t *testing.T) {
+	useKeys(t, testKeyA)
+	big := make([]byte, 3*streamChunkSize+123)
+	rand.Read(big)
+	for name, data := range map[string][]byte{
+		"empty":       {},
+		"small":       []byte("etcd snapshot"),
+		"exact chunk": big[:streamChunkSize],
+		"many chunks": big,
+	} {
+		sealed := sealStream(t, data)
+		if len(data) > 0 && bytes.Contains(sealed, data) {
+			t.Errorf("%s: sealed stream contains the plaintext", name)
+		}
+		got, err := openStream(sealed)
+		if err != nil {
+			t.Fatalf("%s: OpenStream: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: opened %d bytes, want %d", name, len(got), len(data))
+		}
+	}
+
+	// Data that was never sealed passes through.
+	if got, err := openStream([]byte("plain archive")); err != nil || string(got) != "plain archive" {
+		t.Errorf("OpenStream(plaintext) = %q, %v", got, err)
+	}
+}
+
+func TestOpenStreamErrors(t *testing.T) {
+	useKeys(t, testKeyA)
+	data := make([]byte, 2*streamChunkSize+50)
+	rand.Read(data)
+	sealed := sealStream(t, data)
+	header := bytes.IndexByte(sealed, '\n') + 1
+	chunk := 4 + streamChunkSize + 16
+
+	tampered := bytes.Clone(sealed)
+	tampered[header+100] ^= 1
+	tests := []struct {
+		name   string
+		sealed []byte
+		want   error
+	}{
+		{"tampered chunk", tampered, ErrCorrupt},
+		{"truncated at a chunk boundary", sealed[:header+chunk], ErrCorrupt},
+		{"truncated mid-chunk", sealed[:len(sealed)-10], ErrCorrupt},
+		{"trailing data", append(bytes.Clone(sealed), 0), ErrCorrupt},
+		{"chunks swapped", append(append(bytes.Clone(sealed[:header]), sealed[header+chunk:header+2*chunk]...), sealed[header+chunk:]...), ErrCorrupt},
+	}
+	for _, tt := range tests {
+		if _, err := openStream(tt.sealed); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	useKeys(t, testKeyB)
+	if _, err := openStream(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("OpenStream under another key: error = %v, want %v", err, ErrUnknownKey)
+	}
+}
@@ -0,0 +1,455 @@
+// Package vault encrypts credentials before they are written to the
+// database.
+//
+// It uses envelope encryption. Every secret is encrypted with AES-256-GCM
+// under its own random data key. That data key is in turn encrypted
+// ("wrapped") with the master key and stored next to the ciphertext, so
+// rotating the master key only re-wraps data keys and never touches the
+// secrets themselves.
+//
+// The master key comes from VAULT_MASTER_KEY (base64 or hex, 32 bytes) or
+// from the file named by VAULT_MASTER_KEY_FILE. Without either, a key is
+// generated into database/vault.key on first start. Keys that were
+// replaced but may still wrap stored data keys are listed in
+// VAULT_PREVIOUS_MASTER_KEYS (comma separated), or on the lines after the
+// first in the key file.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// prefix marks a sealed value:
+// vault:v1:<key id>:<wrapped data key>:<nonce+ciphertext>
+const prefix = "vault:v1:"
+
+// DefaultKeyFile is where a generated master key is kept.
+const DefaultKeyFile = "./database/vault.key"
+
+var (
+	ErrNotInitialized = errors.New("vault: master key not loaded")
+	ErrUnknownKey     = errors.New("vault: value was sealed with a master key that is not configured")
+	ErrCorrupt        = errors.New("vault: sealed value is corrupt")
+)
+
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	mu        sync.RWMutex
+	current   *masterKey
+	keys      = map[string]*masterKey{}
+	keyFile   string // set when the keys came from a file the vault may rewrite
+	keySource string
+)
+
+// Status describes the loaded master keys.
+type Status struct {
+	KeyID        string   `json:"key_id"`
+	Source       string   `json:"source"`
+	PreviousKeys []string `json:"previous_keys"`
+	Rotatable    bool     `json:"rotatable"` // a new key can be generated in place
+}
+
+// Init loads the master key and any previous keys.
+func Init() error {
+	var primary string
+	var previous []string
+	source := ""
+	file := ""
+
+	switch {
+	case os.Getenv("VAULT_MASTER_KEY") != "":
+		primary = os.Getenv("VAULT_MASTER_KEY")
+		source = "env"
+	case os.Getenv("VAULT_MASTER_KEY_FILE") != "":
+		path := os.Getenv("VAULT_MASTER_KEY_FILE")
+		lines, err := readKeyFile(path)
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return fmt.Errorf("vault: %s holds no key", path)
+		}
+		primary, previous = lines[0], lines[1:]
+		source = "file " + path
+	default:
+		lines, err := readKeyFile(DefaultKeyFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(lines) == 0 {
+			k, err := generateKey()
+			if err != nil {
+				return err
+			}
+			if err := writeKeyFile(DefaultKeyFile, []string{k}); err != nil {
+				return err
+			}
+			log.Printf("WARNING: generated a vault master key in %s; back it up, or set VAULT_MASTER_KEY, or stored credentials cannot be decrypted", DefaultKeyFile)
+			lines = []string{k}
+		}
+		primary, previous = lines[0], lines[1:]
+		source = "file " + DefaultKeyFile
+		file = DefaultKeyFile
+	}
+	for _, k := range strings.Split(os.Getenv("VAULT_PREVIOUS_MASTER_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			previous = append(previous, k)
+		}
+	}
+
+	cur, err := parseKey(primary)
+	if err != nil {
+		return err
+	}
+	loaded := map[string]*masterKey{cur.id: cur}
+	for _, p := range previous {
+		k, err := parseKey(p)
+		if err != nil {
+			return fmt.Errorf("previous key: %v", err)
+		}
+		loaded[k.id] = k
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	current, keys, keyFile, keySource = cur, loaded, file, source
+	return nil
+}
+
+// CurrentStatus reports which keys are loaded.
+func CurrentStatus() Status {
+	mu.RLock()
+	defer mu.RUnlock()
+	s := Status{Source: keySource, Rotatable: keyFile != "", PreviousKeys: []string{}}
+	if current != nil {
+		s.KeyID = current.id
+	}
+	for id := range keys {
+		if current == nil || id != current.id {
+			s.PreviousKeys = append(s.PreviousKeys, id)
+		}
+	}
+	return s
+}
+
+// GenerateMasterKey replaces the master key in a generated key file with a
+// new one, keeping the old keys as previous keys. Stored values must be
+// re-wrapped afterwards (see Rewrap).
+func GenerateMasterKey() (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if keyFile == "" {
+		return "", errors.New("vault: the master key is configured externally; set a new VAULT_MASTER_KEY and list the old one in VAULT_PREVIOUS_MASTER_KEYS")
+	}
+	lines, err := readKeyFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	k, err := generateKey()
+	if err != nil {
+		return "", err
+	}
+	cur, err := parseKey(k)
+	if err != nil {
+		return "", err
+	}
+	if err := writeKeyFile(keyFile, append([]string{k}, lines...)); err != nil {
+		return "", err
+	}
+	keys[cur.id] = cur
+	current = cur
+	return cur.id, nil
+}
+
+// IsSealed reports whether v was produced by Seal.
+func IsSealed(v string) bool { return strings.HasPrefix(v, prefix) }
+
+// KeyID returns the id of the master key that wraps v, or "" if v is not
+// sealed.
+func KeyID(v string) string {
+	if !IsSealed(v) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(v, prefix), ":")
+	return id
+}
+
+// NeedsRewrap reports whether v is sealed under a key other than the
+// current master key.
+func NeedsRewrap(v string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return IsSealed(v) && current != nil && KeyID(v) != current.id
+}
+
+// Seal encrypts plaintext under a fresh data key. Empty strings and values
+// that are already sealed are returned unchanged.
+func Seal(plaintext string) (string, error) {
+	if plaintext == "" || IsSealed(plaintext) {
+		return plaintext, nil
+	}
+	mu.RLock()
+	kek := current
+	mu.RUnlock()
+	if kek == nil {
+		return "", ErrNotInitialized
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := encrypt(kek.key, dek)
+	if err != nil {
+		return "", err
+	}
+	ct, err := encrypt(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return prefix + kek.id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ct), nil
+}
+
+// Open decrypts a sealed value. Values that are not sealed (stored before
+// the vault existed) are returned as they are.
+func Open(v string) (string, error) {
+	if !IsSealed(v) {
+		return v, nil
+	}
+	kid, wrapped, ct, err := split(v)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrap(kid, wrapped)
+	if err != nil {
+		return "", err
+	}
+	pt, err := decrypt(dek, ct)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(pt), nil
+}
+
+// Rewrap re-wraps the data key of a value sealed under a previous master
+// key with the current one, leaving the ciphertext alone. With reencrypt
+// the value is instead decrypted and sealed again under a new data key.
+// Plaintext values are sealed; values already under the current key are
+// returned unchanged.
+func Rewrap(v string, reencrypt bool) (string, error) {
+	if v == "" || (IsSealed(v) && !reencrypt && !NeedsRewrap(v)) {
+		return v, nil
+	}
+	if !IsSealed(v) || reencrypt {
+		pt, err := Open(v)
+		if err != nil {
+			return "", err
+		}
+		return Seal(pt)
+	}
+	kid, wrapped, ct, err := split(v)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrap(kid, wrapped)
+	if err != nil {
+		return "", err
+	}
+	mu.RLock()
+	kek := current
+	mu.RUnlock()
+	rewrapped, err := encrypt(kek.key, dek)
+	if err != nil {
+		return "", err
+	}
+	return prefix + kek.id + ":" + base64.RawStdEncoding.EncodeToString(rewrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ct), nil
+}
+
+// SealFields seals the named string fields of a JSON object, leaving the
+// rest of it readable. Invalid JSON is returned unchanged.
+func SealFields(raw string, fields ...string) (string, error) {
+	return mapFields(raw, fields, Seal)
+}
+
+// OpenFields reverses SealFields.
+func OpenFields(raw string, fields ...string) (string, error) {
+	return mapFields(raw, fields, Open)
+}
+
+// RewrapFields applies Rewrap to the named fields of a JSON object.
+func RewrapFields(raw string, reencrypt bool, fields ...string) (string, error) {
+	return mapFields(raw, fields, func(v string) (string, error) { return Rewrap(v, reencrypt) })
+}
+
+func mapFields(raw string, fields []string, fn func(string) (string, error)) (string, error) {
+	if raw == "" {
+		return raw, nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+		return raw, nil
+	}
+	changed := false
+	for _, f := range fields {
+		s, ok := obj[f].(string)
+		if !ok || s == "" {
+			continue
+		}
+		out, err := fn(s)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", f, err)
+		}
+		if out != s {
+			obj[f] = out
+			changed = true
+		}
+	}
+	if !changed {
+		return raw, nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ── Internals ───────────────────────────────────────────────────────────────
+
+func split(v string) (kid string, wrapped, ct []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(v, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrCorrupt
+	}
+	if wrapped, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, ErrCorrupt
+	}
+	if ct, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrCorrupt
+	}
+	return parts[0], wrapped, ct, nil
+}
+
+func unwrap(kid string, wrapped []byte) ([]byte, error) {
+	mu.RLock()
+	kek, ok := keys[kid]
+	loaded := current != nil
+	mu.RUnlock()
+	if !ok {
+		if !loaded {
+			return nil, ErrNotInitialized
+		}
+		return nil, fmt.Errorf("%w (key id %s)", ErrUnknownKey, kid)
+	}
+	dek, err := decrypt(kek.key, wrapped)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return dek, nil
+}
+
+// encrypt returns nonce || AES-GCM ciphertext.
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// parseKey accepts a 32-byte key as base64 (standard or URL, padded or
+// not) or hex.
+func parseKey(s string) (*masterKey, error) {
+	s = strings.TrimSpace(s)
+	var key []byte
+	if b, err := hex.DecodeString(s); err == nil && len(b) == 32 {
+		key = b
+	} else {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(s); err == nil && len(b) == 32 {
+				key = b
+				break
+			}
+		}
+	}
+	if key == nil {
+		return nil, errors.New("vault: master key must be 32 bytes, base64 or hex encoded")
+	}
+	sum := sha256.Sum256(key)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), key: key}, nil
+}
+
+func generateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func readKeyFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("vault: reading key file: %w", err)
+	}
+	var lines []string
+	for _, l := range strings.Split(string(data), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+func writeKeyFile(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
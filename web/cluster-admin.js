@@ -558,6 +558,7 @@ function renderPods(items) {
                 <button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem" onclick="showPodDetails('${name}','${ns}')">ℹ️ Details</button>
                 <button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-left:0.25rem" onclick="showLogs('${ns}','${name}')">📋 Logs</button>
                 <button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-left:0.25rem;background:#0f4c75;color:#e2f0ff" onclick="execPod('${ns}','${name}')">💻 Exec</button>
+                ${canDelete && phase === 'Running' ? `<button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-left:0.25rem" onclick="startPortForward('${ns}','pods','${name}')">🔌 Forward</button>` : ''}
                 ${hasDel ? `<button class="btn btn-danger" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-left:0.25rem" onclick="deleteResource('pods','${name}','${ns}')">🗑️</button>` : ''}
             </td>
         </tr>`;
@@ -653,6 +654,7 @@ function renderDeployments(items) {
             <td>${cpuMemDisplay}</td>
             <td style="color:#64748b">${age(d.metadata.creationTimestamp)}</td>
             <td onclick="event.stopPropagation()">
+                <button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-right:0.2rem" onclick="showWorkloadLogs('${ns}','deployments','${name}')">📋 Logs</button>
                 ${canEdit ? `<button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-right:0.2rem" onclick="editResource('deployments','${name}','${ns}')">✏️ Edit</button>` : ''}
                 ${canEdit ? `<button class="btn btn-danger" style="padding:0.2rem 0.6rem;font-size:0.75rem" onclick="deleteResource('deployments','${name}','${ns}')">🗑️ Delete</button>` : ''}
             </td>
@@ -763,6 +765,7 @@ function renderWorkloadGeneric(items, resource) {
             <td style="color:#94a3b8;max-width:200px;overflow:hidden;text-overflow:ellipsis">${images}</td>
             <td style="color:#64748b">${age(d.metadata.creationTimestamp)}</td>
             <td>
+                <button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-right:0.2rem" onclick="showWorkloadLogs('${ns}','${resource}','${name}')">📋 Logs</button>
                 ${canDelete ? `<button class="btn btn-ghost" style="padding:0.2rem 0.6rem;font-size:0.75rem;margin-right:0.2rem" onclick="editResource('${resource}','${name}','${ns}')">✏️ Edit</button>` : ''}
                 ${canDelete ? `<button class="btn btn-danger" style="padding:0.2rem 0.6rem;font-size:0.75rem" onclick="deleteResource('${resource}','${name}','${ns}')">🗑️</button>` : ''}
             </td>
@@ -2088,7 +2091,12 @@ async function submitNodeLabels() {
 }
 
 // ── Pod Logs ──────────────────────────────────────────
-let _logCtx = { ns: '', pod: '' };
+// owner ("deployments/web") switches to the aggregated stream of every pod
+// the workload selects; follow streams new lines over a WebSocket.
+let _logCtx = { ns: '', pod: '', owner: '', follow: false, previous: false };
+let _logWs = null;
+let _logLines = 0;
+const LOG_MAX_LINES = 5000;
 
 function colorizeLog(text) {
     return text.split('\n').map(line => {
@@ -2112,30 +2120,92 @@ function colorizeLog(text) {
     }).join('\n');
 }
 
+// Stable color per pod/container, so interleaved lines are easy to tell apart.
+function logSourceColor(src) {
+    let h = 0;
+    for (let i = 0; i < src.length; i++) h = (h * 31 + src.charCodeAt(i)) >>> 0;
+    return `hsl(${h % 360}, 70%, 68%)`;
+}
+
 async function showLogs(namespace, podName) {
-    _logCtx = { ns: namespace, pod: podName };
+    _logCtx = { ns: namespace, pod: podName, owner: '', follow: false, previous: false };
     document.getElementById('log-modal-title').textContent = `📋 Logs — ${podName}`;
     document.getElementById('log-modal').classList.add('open');
+    _syncLogButtons();
+    await _fetchLogs();
+}
+
+// Aggregated, followed logs of every pod of a deployment/statefulset/daemonset.
+async function showWorkloadLogs(namespace, resource, name) {
+    _logCtx = { ns: namespace, pod: '', owner: `${resource}/${name}`, follow: true, previous: false };
+    document.getElementById('log-modal-title').textContent = `📋 Logs — ${resource}/${name} (all pods)`;
+    document.getElementById('log-modal').classList.add('open');
+    _syncLogButtons();
     await _fetchLogs();
 }
 
 async function reloadCurrentLog() {
-    if (_logCtx.pod) await _fetchLogs();
+    if (_logCtx.pod || _logCtx.owner) await _fetchLogs();
+}
+
+function toggleLogFollow() {
+    _logCtx.follow = !_logCtx.follow;
+    if (_logCtx.follow) _logCtx.previous = false;
+    _syncLogButtons();
+    reloadCurrentLog();
+}
+
+function toggleLogPrevious() {
+    _logCtx.previous = !_logCtx.previous;
+    if (_logCtx.previous) _logCtx.follow = false;
+    _syncLogButtons();
+    reloadCurrentLog();
+}
+
+function _syncLogButtons() {
+    const on = 'rgba(99,102,241,0.3)';
+    const follow = document.getElementById('log-follow-btn');
+    follow.style.background = _logCtx.follow ? on : '';
+    follow.textContent = _logCtx.follow ? '⏸ Following' : '▶ Follow';
+    // The aggregated view is always streamed.
+    follow.disabled = !!_logCtx.owner;
+    document.getElementById('log-previous-btn').style.background = _logCtx.previous ? on : '';
+}
+
+function _logQuery() {
+    const tail = document.getElementById('log-tail')?.value || '500';
+    const since = document.getElementById('log-since')?.value || '';
+    const params = new URLSearchParams({ namespace: _logCtx.ns, tailLines: tail });
+    if (since) params.set('since', since);
+    if (_logCtx.previous) params.set('previous', 'true');
+    return params;
+}
+
+function _stopLogStream() {
+    if (_logWs) {
+        _logWs.onclose = null;
+        _logWs.close();
+        _logWs = null;
+    }
 }
 
 async function _fetchLogs() {
+    _stopLogStream();
+    if (_logCtx.owner || _logCtx.follow) return _streamLogs();
+
     const el = document.getElementById('log-output');
     el.innerHTML = '<span style="color:#475569">Loading logs…</span>';
     document.getElementById('log-line-count').textContent = '';
 
-    const tail = document.getElementById('log-tail')?.value || '500';
-    const tailParam = tail === '0' ? '' : `&tailLines=${tail}`;
-
     try {
         const res = await fetch(
-            `${API_BASE}/k0s/clusters/${state.clusterId}/k8s/pods/${_logCtx.pod}/logs?namespace=${_logCtx.ns}${tailParam}`
+            `${API_BASE}/k0s/clusters/${state.clusterId}/k8s/pods/${_logCtx.pod}/logs?${_logQuery()}`
         );
         const text = await res.text();
+        if (!res.ok) {
+            el.innerHTML = `<span class="log-err">Error: ${text.replace(/</g,'&lt;')}</span>`;
+            return;
+        }
         if (!text.trim()) {
             el.innerHTML = '<span style="color:#475569">(no log output)</span>';
             return;
@@ -2149,6 +2219,72 @@ async function _fetchLogs() {
     }
 }
 
+function _streamLogs() {
+    const el = document.getElementById('log-output');
+    el.innerHTML = '';
+    _logLines = 0;
+    document.getElementById('log-line-count').textContent = 'connecting…';
+
+    const params = _logQuery();
+    if (!_logCtx.follow) params.set('follow', 'false');
+    params.set('token', localStorage.getItem('authToken') || '');
+    let path = `k8s/pods/${_logCtx.pod}/logs/stream`;
+    if (_logCtx.owner) {
+        path = 'k8s/logs/stream';
+        params.set('owner', _logCtx.owner);
+    }
+    const wsProto = location.protocol === 'https:' ? 'wss' : 'ws';
+    const ws = new WebSocket(`${wsProto}://${location.host}/api/k0s/clusters/${state.clusterId}/${path}?${params}`);
+    _logWs = ws;
+
+    const append = html => {
+        const atBottom = el.scrollHeight - el.scrollTop - el.clientHeight < 40;
+        const div = document.createElement('div');
+        div.innerHTML = html;
+        el.appendChild(div);
+        while (el.childElementCount > LOG_MAX_LINES) el.removeChild(el.firstChild);
+        if (atBottom) el.scrollTop = el.scrollHeight;
+    };
+
+    ws.onopen = () => {
+        document.getElementById('log-line-count').textContent = _logCtx.follow ? '● live' : '';
+    };
+    ws.onmessage = ev => {
+        const m = JSON.parse(ev.data);
+        const src = m.pod ? (_logCtx.owner ? `${m.pod}/${m.container}` : m.container) : '';
+        const prefix = src
+            ? `<span class="log-src" style="color:${logSourceColor(src)}">[${escapeHtml(src)}]</span> `
+            : '';
+        switch (m.type) {
+            case 'line':
+                _logLines++;
+                append(prefix + colorizeLog(m.line));
+                if (!_logCtx.follow) document.getElementById('log-line-count').textContent = `${_logLines} lines`;
+                break;
+            case 'error':
+                append(`${prefix}<span class="log-err">${escapeHtml(m.message)}</span>`);
+                break;
+            case 'info':
+                append(`${prefix}<span class="log-note">${escapeHtml(m.message)}</span>`);
+                break;
+            case 'end':
+                if (!_logLines) append('<span class="log-note">(no log output)</span>');
+                break;
+        }
+    };
+    ws.onerror = () => {
+        if (!_logLines) append('<span class="log-err">Could not open the log stream (no access, or the pod is gone)</span>');
+    };
+    ws.onclose = () => {
+        if (_logWs !== ws) return;
+        _logWs = null;
+        if (_logCtx.follow) {
+            append('<span class="log-note">— stream closed —</span>');
+            document.getElementById('log-line-count').textContent = `${_logLines} lines`;
+        }
+    };
+}
+
 function toggleLogWrap() {
     const el = document.getElementById('log-output');
     const btn = document.getElementById('log-wrap-btn');
@@ -2166,9 +2302,37 @@ function copyLogs() {
 }
 
 function closeLogModal() {
+    _stopLogStream();
     document.getElementById('log-modal').classList.remove('open');
 }
 
+// ── Port-forward ──────────────────────────────────────
+// Opens a temporary listener on the management server that forwards to a
+// pod or service port, so it can be reached without a kubeconfig.
+async function startPortForward(namespace, resource, name) {
+    const port = prompt(`Port of ${resource.slice(0, -1)} ${name} to forward (number or name):`);
+    if (!port) return;
+    const minutes = prompt('Close the forward after how many minutes? (max 480)', '60');
+    if (minutes === null) return;
+    try {
+        const res = await fetch(`${API_BASE}/k0s/clusters/${state.clusterId}/port-forwards`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ namespace, resource, name, port: port.trim(), ttl_minutes: parseInt(minutes) || 60 })
+        });
+        if (!res.ok) {
+            alert('Port-forward failed: ' + (await res.text()));
+            return;
+        }
+        const fwd = await res.json();
+        alert(`Forwarding ${fwd.address} → ${resource}/${name}:${fwd.port}\n` +
+              `Open until ${new Date(fwd.expires_at).toLocaleString()}.` +
+              (fwd.allowed_from ? `\nOnly connections from ${fwd.allowed_from} are accepted.` : ''));
+    } catch (e) {
+        alert('Failed: ' + e.message);
+    }
+}
+
 // ── Pod Exec Terminal ─────────────────────────────────
 let execTerm  = null;
 let execWs    = null;